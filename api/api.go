@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"strings"
 
 	"snack.com/xiyanxiyan10/stocktrader/config"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
@@ -15,10 +16,10 @@ type ExchangeBroker interface {
 	getAccount() (*constant.Account, error)
 	getOrders(symbol string) ([]constant.Order, error)
 	getTicker(symbol string) (*constant.Ticker, error)
+	getRecords(symbol string) ([]constant.Record, error)
 	getPosition(stockType string) ([]constant.Position, error)
-	buy(price, amount, msg string) (string, error)
-	sell(price, amount, msg string) (string, error)
-	cancelOrder(orderID string) (bool, error)
+	placeOrder(req constant.OrderRequest) (string, error)
+	cancelOrder(symbol, orderID string) (bool, error)
 	start() error
 	stop() error
 }
@@ -33,19 +34,36 @@ type Exchange interface {
 	AutoSleep()
 	Buy(price, amount, msg string) (string, error)
 	Sell(price, amount, msg string) (string, error)
+	PlaceOrder(req constant.OrderRequest) (string, error)
 	GetOrder(id string) (*constant.Order, error)
+	GetOrderByClientID(clientID string) (*constant.Order, error)
+	NewClientOrderID() string
 	GetOrders() ([]constant.Order, error)
 	CancelOrder(orderID string) (bool, error)
 	GetTicker() (*constant.Ticker, error)
 	GetPosition() ([]constant.Position, error)
 	GetAccount() (*constant.Account, error)
 	GetDepth() (*constant.Depth, error)
+	GetRecords() ([]constant.Record, error)
+	// 指定品种的调用, 不依赖 SetStockType 设置的当前品种, 空品种为当前品种
+	GetTickerOf(symbol string) (*constant.Ticker, error)
+	GetDepthOf(symbol string) (*constant.Depth, error)
+	GetRecordsOf(symbol string) ([]constant.Record, error)
+	GetOrderOf(symbol, id string) (*constant.Order, error)
+	GetOrdersOf(symbol string) ([]constant.Order, error)
+	CancelOrderOf(symbol, orderID string) (bool, error)
+	GetPositionOf(symbol string) ([]constant.Position, error)
+	GetInstrument(symbol string) constant.Instrument
 	SetDirection(direction string)
 	GetDirection() string
 	SetMarginLevel(lever float64)
 	GetMarginLevel() float64
 	SetStockType(stockType string)
 	GetStockType() string
+	SetPeriod(period string)
+	GetPeriod() string
+	SetPeriodSize(size int)
+	GetPeriodSize() int
 	GetBackAccount() map[string]float64
 	SetBackAccount(string, float64)
 	SetBackCommission(float64, float64, float64, float64)
@@ -63,9 +81,23 @@ var (
 		constant.FutureBack: NewFutureBackExchange,
 		constant.SpotBack:   NewSpotBackExchange,
 		constant.SZ:         NewSZExchange,
+		constant.CTP:        NewCtpExchange,
+		constant.IB:         NewIBExchange,
+		constant.Binance:    NewBinanceExchange,
+		constant.OKEx:       NewOKExExchange,
+		constant.OKExFuture: NewOKExFutureExchange,
+		constant.OKExSwap:   NewOKExSwapExchange,
+		constant.Bitmex:     NewBitmexExchange,
 	}
 )
 
+// paperVenues the live exchanges can trade on paper, the paper account only simulates the spot
+var paperVenues = map[string]bool{
+	constant.HuoBi:   true,
+	constant.Binance: true,
+	constant.OKEx:    true,
+}
+
 // loadMaker ...
 func loadMaker(exchangeType string) (func(constant.Option) (Exchange, error), error) {
 	f, err := util.HotPlugin(config.String(fmt.Sprintf("/%s/%s.so",
@@ -91,6 +123,19 @@ func getExchangeMaker(opt constant.Option) (maker func(constant.Option) (Exchang
 
 // GetExchange ...
 func GetExchange(opt constant.Option) (Exchange, error) {
+	// 模拟盘使用实盘行情, 如 PaperBinance
+	if live := strings.TrimPrefix(opt.Type, constant.Paper); live != opt.Type {
+		if !paperVenues[live] {
+			return nil, fmt.Errorf("paper trading of %s is not supported, only the spot exchanges", live)
+		}
+		liveOpt := opt
+		liveOpt.Type = live
+		exchange, err := GetExchange(liveOpt)
+		if err != nil {
+			return nil, err
+		}
+		return NewPaperExchange(exchange, opt), nil
+	}
 	maker, ok := getExchangeMaker(opt)
 	if !ok {
 		return nil, fmt.Errorf("get exchange maker fail")
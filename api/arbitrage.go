@@ -0,0 +1,487 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// arbDust the amount below which the legs are treated as balanced
+const arbDust = 1e-9
+
+// how long to wait for the canceled order to finish and how often to poll it
+var (
+	arbCancelTimeout = 5 * time.Second
+	arbPollInterval  = 200 * time.Millisecond
+)
+
+// arbContracts the contract exchanges, the legs only buy and sell spot without the open and close direction
+var arbContracts = map[string]bool{
+	constant.HuoBiDm:    true,
+	constant.OKExFuture: true,
+	constant.OKExSwap:   true,
+	constant.Bitmex:     true,
+	constant.FutureBack: true,
+	constant.CTP:        true,
+}
+
+// ArbQuote the best bid and ask of the instrument on an exchange
+type ArbQuote struct {
+	Index     int
+	Name      string
+	Symbol    string
+	Bid       float64
+	BidAmount float64
+	Ask       float64
+	AskAmount float64
+	Fee       float64 // taker 手续费率
+	Time      int64   // 更新时间, 毫秒
+	Error     string  // 最近一次更新失败的原因
+}
+
+// ArbBalance the available base and quote currencies of the instrument on an exchange
+type ArbBalance struct {
+	Index int
+	Name  string
+	Base  float64 // 基础货币, 如 BTC/USDT 的 BTC
+	Quote float64 // 计价货币, 如 BTC/USDT 的 USDT
+}
+
+// ArbSpread buy at the ask of an exchange and sell at the bid of another
+type ArbSpread struct {
+	Buy       int // 买入交易所的下标
+	Sell      int // 卖出交易所的下标
+	BuyPrice  float64
+	SellPrice float64
+	Amount    float64 // 两边盘口及余额允许的数量
+	Gross     float64 // 每单位价差
+	Net       float64 // 扣除双边手续费后每单位价差
+	Rate      float64 // Net / BuyPrice
+}
+
+// ArbResult the result of an arbitrage executed in legs
+type ArbResult struct {
+	Buy         int
+	Sell        int
+	BuyOrder    string
+	SellOrder   string
+	HedgeOrder  string  // 卖出交易所补单
+	Bought      float64 // 买入交易所成交数量
+	BuyPrice    float64
+	Sold        float64 // 卖出交易所成交数量, 包括补单
+	SellPrice   float64
+	Unwound     float64 // 补单失败后在买入交易所卖出平掉的数量
+	UnwindPrice float64
+	Residual    float64 // 对冲后仍未平衡的数量, 包括撤单后状态未知的数量
+	Profit      float64 // 扣除手续费后的盈亏, 计价货币
+	Error       string
+}
+
+// arbLeg the instrument on an exchange
+type arbLeg struct {
+	exchange Exchange
+	symbol   string
+	fee      float64
+	feeSet   bool
+	quote    ArbQuote
+	balance  ArbBalance
+}
+
+// Arbitrage watch the spreads of an instrument across exchanges and trade them in legs,
+// every exchange is called with its symbol of the instrument, leaving its stock type untouched
+type Arbitrage struct {
+	mu       sync.Mutex
+	legs     []*arbLeg
+	balanced bool // 余额是否已更新
+}
+
+// NewArbitrage watch the symbol on the exchanges
+func NewArbitrage(symbol string, exchanges ...Exchange) *Arbitrage {
+	a := &Arbitrage{}
+	for i, e := range exchanges {
+		a.legs = append(a.legs, &arbLeg{
+			exchange: e,
+			symbol:   symbol,
+			quote:    ArbQuote{Index: i, Name: e.GetName(), Symbol: symbol},
+			balance:  ArbBalance{Index: i, Name: e.GetName()},
+		})
+	}
+	return a
+}
+
+// leg ...
+func (a *Arbitrage) leg(index int) (*arbLeg, error) {
+	if index < 0 || index >= len(a.legs) {
+		return nil, fmt.Errorf("Arbitrage() error, the error number is invalid exchange index %d", index)
+	}
+	return a.legs[index], nil
+}
+
+// SetSymbol set the symbol of the instrument on an exchange named differently, e.g. XBT/USDT
+func (a *Arbitrage) SetSymbol(index int, symbol string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	leg, err := a.leg(index)
+	if err != nil {
+		return err
+	}
+	leg.symbol, leg.quote.Symbol = symbol, symbol
+	return nil
+}
+
+// SetFee set the taker fee rate of an exchange, the taker of GetBackCommission used by default
+func (a *Arbitrage) SetFee(index int, taker float64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	leg, err := a.leg(index)
+	if err != nil {
+		return err
+	}
+	leg.fee, leg.feeSet = taker, true
+	return nil
+}
+
+// takerFee ...
+func (leg *arbLeg) takerFee() float64 {
+	if leg.feeSet {
+		return leg.fee
+	}
+	if fees := leg.exchange.GetBackCommission(); len(fees) > 0 {
+		return fees[0]
+	}
+	return 0
+}
+
+// Update get the depth of all the exchanges at the same time
+func (a *Arbitrage) Update() []ArbQuote {
+	a.mu.Lock()
+	legs := append([]*arbLeg{}, a.legs...)
+	a.mu.Unlock()
+	quotes := make([]ArbQuote, len(legs))
+	var wg sync.WaitGroup
+	for i, leg := range legs {
+		wg.Add(1)
+		go func(i int, leg *arbLeg) {
+			defer wg.Done()
+			a.mu.Lock()
+			quote := leg.quote
+			quote.Fee = leg.takerFee()
+			a.mu.Unlock()
+			depth, err := leg.exchange.GetDepthOf(quote.Symbol)
+			switch {
+			case err != nil:
+				quote.Error = err.Error()
+			case len(depth.Bids) == 0 || len(depth.Asks) == 0:
+				quote.Error = "empty depth"
+			default:
+				quote.Bid, quote.BidAmount = depth.Bids[0].Price, depth.Bids[0].Amount
+				quote.Ask, quote.AskAmount = depth.Asks[0].Price, depth.Asks[0].Amount
+				quote.Time, quote.Error = time.Now().UnixNano()/int64(time.Millisecond), ""
+			}
+			quotes[i] = quote
+		}(i, leg)
+	}
+	wg.Wait()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, leg := range legs {
+		leg.quote = quotes[i]
+	}
+	return quotes
+}
+
+// Quotes get the quotes of the last update
+func (a *Arbitrage) Quotes() []ArbQuote {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	quotes := []ArbQuote{}
+	for _, leg := range a.legs {
+		quotes = append(quotes, leg.quote)
+	}
+	return quotes
+}
+
+// currencies the base and quote currencies of the symbol, e.g. BTC and USD of BTC/USD.swap
+func currencies(symbol string) (string, string) {
+	vec := stockPair2Vec(strings.Split(symbol, ".")[0])
+	return vec[0], vec[1]
+}
+
+// UpdateBalances get the accounts of all the exchanges
+func (a *Arbitrage) UpdateBalances() ([]ArbBalance, error) {
+	a.mu.Lock()
+	legs := append([]*arbLeg{}, a.legs...)
+	a.mu.Unlock()
+	balances := make([]ArbBalance, len(legs))
+	errs := make([]error, len(legs))
+	var wg sync.WaitGroup
+	for i, leg := range legs {
+		wg.Add(1)
+		go func(i int, leg *arbLeg) {
+			defer wg.Done()
+			account, err := leg.exchange.GetAccount()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			base, quote := currencies(leg.symbol)
+			balances[i] = ArbBalance{
+				Index: i,
+				Name:  leg.exchange.GetName(),
+				Base:  account.SubAccounts[base].Amount,
+				Quote: account.SubAccounts[quote].Amount,
+			}
+		}(i, leg)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("UpdateBalances() error, the error number is %s: %s", legs[i].exchange.GetName(), err.Error())
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, leg := range legs {
+		leg.balance = balances[i]
+	}
+	a.balanced = true
+	return balances, nil
+}
+
+// Balances get the balances of the last update
+func (a *Arbitrage) Balances() []ArbBalance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	balances := []ArbBalance{}
+	for _, leg := range a.legs {
+		balances = append(balances, leg.balance)
+	}
+	return balances
+}
+
+// spread ...
+func (a *Arbitrage) spread(buy, sell *arbLeg) ArbSpread {
+	bq, sq := buy.quote, sell.quote
+	s := ArbSpread{Buy: bq.Index, Sell: sq.Index, BuyPrice: bq.Ask, SellPrice: sq.Bid}
+	s.Gross = sq.Bid - bq.Ask
+	s.Net = sq.Bid*(1-sq.Fee) - bq.Ask*(1+bq.Fee)
+	s.Rate = s.Net / bq.Ask
+	s.Amount = math.Min(bq.AskAmount, sq.BidAmount)
+	if a.balanced {
+		s.Amount = math.Min(s.Amount, math.Min(buy.balance.Quote/(bq.Ask*(1+bq.Fee)), sell.balance.Base))
+	}
+	return s
+}
+
+// Spreads get the spreads of all the pairs of the exchanges quoted, the most profitable first
+func (a *Arbitrage) Spreads() []ArbSpread {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	spreads := []ArbSpread{}
+	for _, buy := range a.legs {
+		for _, sell := range a.legs {
+			// 更新失败的报价已过期, 不参与计算
+			if buy == sell || buy.quote.Error != "" || sell.quote.Error != "" ||
+				buy.quote.Ask <= 0 || sell.quote.Bid <= 0 {
+				continue
+			}
+			spreads = append(spreads, a.spread(buy, sell))
+		}
+	}
+	sort.SliceStable(spreads, func(i, j int) bool { return spreads[i].Rate > spreads[j].Rate })
+	return spreads
+}
+
+// Best get the most profitable spread with a positive net rate above the threshold and an amount, or nil
+func (a *Arbitrage) Best(threshold float64) *ArbSpread {
+	for _, s := range a.Spreads() {
+		if s.Net > 0 && s.Rate >= threshold && s.Amount > arbDust {
+			return &s
+		}
+	}
+	return nil
+}
+
+// spot check the leg trades spot, the contracts need the open and close direction per leg
+func (leg *arbLeg) spot() error {
+	if arbContracts[leg.exchange.GetType()] || strings.Contains(leg.symbol, ".") {
+		return fmt.Errorf("Arbitrage() error, the error number is %s of %s is not spot",
+			leg.symbol, leg.exchange.GetName())
+	}
+	return nil
+}
+
+// take place an immediate or cancel order, the rest canceled if the exchange keeps it open,
+// the amount which may still be filled when the order does not finish in time is returned as unknown
+func (a *Arbitrage) take(leg *arbLeg, req constant.OrderRequest) (*constant.Order, float64, error) {
+	e := leg.exchange
+	a.mu.Lock()
+	req.Symbol = leg.symbol
+	a.mu.Unlock()
+	req.Msg = "arbitrage"
+	if req.OrderType == "" {
+		req.OrderType = constant.OrderTypeLimit
+	}
+	if req.OrderType == constant.OrderTypeLimit {
+		req.TimeInForce = constant.TimeInForceIOC
+	}
+	id, err := e.PlaceOrder(req)
+	if err != nil {
+		// 下单结果未知时可能已经成交
+		if uncertain(err) {
+			return nil, req.Amount, err
+		}
+		return nil, 0, err
+	}
+	order, err := e.GetOrderOf(req.Symbol, id)
+	if err != nil {
+		return &constant.Order{Id: id}, req.Amount, err
+	}
+	if finished(order.Status) {
+		return order, 0, nil
+	}
+	e.CancelOrderOf(req.Symbol, id)
+	// 撤单是异步的, 等待订单结束后才能确定成交数量
+	deadline := time.Now().Add(arbCancelTimeout)
+	for {
+		if latest, err := e.GetOrderOf(req.Symbol, id); err == nil {
+			order = latest
+			if finished(order.Status) {
+				return order, 0, nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(arbPollInterval)
+	}
+	unknown := math.Max(req.Amount-order.DealAmount, 0)
+	return order, unknown, fmt.Errorf("order %s not finished after the cancel, %v unknown", id, unknown)
+}
+
+// Execute buy the amount on an exchange, then sell what is bought on another at the quotes of the last update,
+// the part not sold is sold at market on the selling exchange, and unwound on the buying exchange if it fails
+func (a *Arbitrage) Execute(buy, sell int, amount float64) (*ArbResult, error) {
+	a.mu.Lock()
+	buyLeg, errB := a.leg(buy)
+	sellLeg, errS := a.leg(sell)
+	a.mu.Unlock()
+	switch {
+	case errB != nil:
+		return nil, errB
+	case errS != nil:
+		return nil, errS
+	case buy == sell:
+		return nil, fmt.Errorf("Arbitrage() error, the error number is the same exchange %d", buy)
+	}
+	a.mu.Lock()
+	errB, errS = buyLeg.spot(), sellLeg.spot()
+	a.mu.Unlock()
+	switch {
+	case errB != nil:
+		return nil, errB
+	case errS != nil:
+		return nil, errS
+	}
+	return a.execute(buyLeg, sellLeg, amount)
+}
+
+// execute ...
+func (a *Arbitrage) execute(buyLeg, sellLeg *arbLeg, amount float64) (*ArbResult, error) {
+	a.mu.Lock()
+	bq, sq := buyLeg.quote, sellLeg.quote
+	a.mu.Unlock()
+	res := &ArbResult{Buy: bq.Index, Sell: sq.Index}
+	if bq.Ask <= 0 || sq.Bid <= 0 {
+		return nil, fmt.Errorf("Arbitrage() error, the error number is no quote, call Update() first")
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("Arbitrage() error, the error number is invalid amount %v", amount)
+	}
+	// 第一腿: 以卖一价买入, 未成交部分撤销
+	order, unknown, err := a.take(buyLeg, constant.OrderRequest{Side: constant.TradeTypeBuy, Price: bq.Ask, Amount: amount})
+	if order != nil {
+		res.BuyOrder, res.Bought, res.BuyPrice = order.Id, order.DealAmount, order.AvgPrice
+	}
+	if err != nil && res.Bought <= arbDust {
+		res.Error, res.Residual = err.Error(), unknown
+		return res, fmt.Errorf("Arbitrage() error, the error number is buy leg %s", err.Error())
+	}
+	if err != nil {
+		// 已成交的部分仍然对冲, 状态未知的部分计入 Residual
+		res.Error = err.Error()
+	}
+	if res.Bought <= arbDust {
+		return res, nil
+	}
+	// 第二腿: 按第一腿的成交数量以买一价卖出
+	soldValue := 0.0
+	pending := unknown
+	order, unknown, err = a.take(sellLeg, constant.OrderRequest{Side: constant.TradeTypeSell, Price: sq.Bid, Amount: res.Bought})
+	if order != nil {
+		res.SellOrder, res.Sold, soldValue = order.Id, order.DealAmount, order.DealAmount*order.AvgPrice
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if unknown > arbDust {
+		// 卖出状态未知时不补单, 以免重复卖出
+		res.Residual = pending + unknown
+		return a.finish(res, buyLeg, soldValue, 0, bq.Fee, sq.Fee)
+	}
+	// 对冲: 剩余部分在卖出交易所市价补单, 仍有剩余时在买入交易所市价卖出平掉
+	residual := res.Bought - res.Sold
+	if residual > arbDust {
+		order, unknown, err = a.take(sellLeg, constant.OrderRequest{Side: constant.TradeTypeSell,
+			OrderType: constant.OrderTypeMarket, Amount: residual})
+		if order != nil {
+			res.HedgeOrder = order.Id
+			res.Sold += order.DealAmount
+			soldValue += order.DealAmount * order.AvgPrice
+			residual -= order.DealAmount
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		if unknown > arbDust {
+			res.Residual = pending + residual
+			return a.finish(res, buyLeg, soldValue, 0, bq.Fee, sq.Fee)
+		}
+	}
+	unwoundValue := 0.0
+	if residual > arbDust {
+		order, unknown, err = a.take(buyLeg, constant.OrderRequest{Side: constant.TradeTypeSell,
+			OrderType: constant.OrderTypeMarket, Amount: residual})
+		if order != nil {
+			res.Unwound, res.UnwindPrice = order.DealAmount, order.AvgPrice
+			unwoundValue = order.DealAmount * order.AvgPrice
+			residual -= order.DealAmount
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}
+	if residual+pending > arbDust {
+		res.Residual = residual + pending
+	}
+	return a.finish(res, buyLeg, soldValue, unwoundValue, bq.Fee, sq.Fee)
+}
+
+// finish the sell price and the profit of the result, an error if it is not balanced
+func (a *Arbitrage) finish(res *ArbResult, buyLeg *arbLeg, soldValue, unwoundValue, buyFee, sellFee float64) (*ArbResult, error) {
+	if res.Sold > 0 {
+		res.SellPrice = soldValue / res.Sold
+	}
+	res.Profit = soldValue*(1-sellFee) + unwoundValue*(1-buyFee) - res.Bought*res.BuyPrice*(1+buyFee)
+	if res.Residual > 0 {
+		buyLeg.exchange.Log(constant.ERROR, buyLeg.symbol, res.BuyPrice, res.Residual,
+			fmt.Sprintf("Arbitrage() error, the error number is %v unhedged, %s", res.Residual, res.Error))
+		return res, fmt.Errorf("Arbitrage() error, the error number is %v unhedged: %s", res.Residual, res.Error)
+	}
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestArbitrage(t *testing.T) {
+	cheap := NewMockExchange(constant.Option{BackLog: true})
+	rich := NewMockExchange(constant.Option{Index: 1, BackLog: true})
+	rich.SetTicker(constant.Ticker{Last: 102, Buy: 101.9, Sell: 102.1})
+	rich.SetDepth(constant.Depth{
+		Asks: constant.DepthRecords{{Price: 102.1, Amount: 3}},
+		Bids: constant.DepthRecords{{Price: 101.9, Amount: 3}},
+	})
+	cheap.SetBackCommission(0.001, 0.001, 0, 0)
+	a := NewArbitrage("BTC/USDT", cheap, rich)
+	a.SetFee(1, 0.001)
+
+	a.Update()
+	spreads := a.Spreads()
+	if len(spreads) != 2 || spreads[0].Buy != 0 || spreads[0].Sell != 1 || spreads[0].Amount != 3 ||
+		math.Abs(spreads[0].Net-(101.9*0.999-100.1*1.001)) > 1e-9 || spreads[1].Net >= 0 {
+		t.Fatalf("unexpected spreads %+v", spreads)
+	}
+	cheap.SetAccount(constant.Account{SubAccounts: map[string]constant.SubAccount{"USDT": {Amount: 200.4002}}})
+	if balances, err := a.UpdateBalances(); err != nil || balances[0].Quote != 200.4002 || balances[1].Base != 10 {
+		t.Fatalf("unexpected balances %+v %v", balances, err)
+	}
+	// 余额只够买 2 个
+	if best := a.Best(0.01); best == nil || math.Abs(best.Amount-2) > 1e-9 {
+		t.Fatalf("unexpected best spread %+v", best)
+	}
+	if best := a.Best(0.02); best != nil {
+		t.Fatalf("the spread below the threshold should be ignored, got %+v", best)
+	}
+
+	res, err := a.Execute(0, 1, 2)
+	if err != nil || res.Bought != 2 || res.BuyPrice != 100 || res.Sold != 2 || res.SellPrice != 102 ||
+		res.HedgeOrder != "" || math.Abs(res.Profit-(204*0.999-200*1.001)) > 1e-9 {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+
+	// 第二腿只成交一半, 补单再成交一半, 剩余在买入交易所平掉
+	rich.SetFillRatio(0.5)
+	res, err = a.Execute(0, 1, 2)
+	if err != nil || res.Bought != 2 || res.Sold != 1.5 || res.HedgeOrder == "" || res.Unwound != 0.5 ||
+		res.UnwindPrice != 100 || res.Residual != 0 {
+		t.Fatalf("unexpected hedged result %+v %v", res, err)
+	}
+	orders := cheap.Orders()
+	if last := orders[len(orders)-1]; last.TradeType != constant.TradeTypeSell || last.Price != -1 || last.DealAmount != 0.5 {
+		t.Fatalf("unexpected unwind order %+v", last)
+	}
+
+	// 第一腿未成交时不下第二腿
+	cheap.SetFillRatio(0)
+	count := len(rich.Orders())
+	if res, err := a.Execute(0, 1, 1); err != nil || res.Bought != 0 || len(rich.Orders()) != count {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+	if _, err := a.Execute(0, 0, 1); err == nil {
+		t.Fatalf("the same exchange should fail")
+	}
+	if _, err := a.Execute(0, 2, 1); err == nil {
+		t.Fatalf("invalid index should fail")
+	}
+}
+
+// stuckExchange an exchange whose orders stay open after the cancel
+type stuckExchange struct {
+	*MockExchange
+}
+
+func (e *stuckExchange) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	order, err := e.MockExchange.GetOrderOf(symbol, id)
+	if err != nil {
+		return nil, err
+	}
+	res := *order
+	res.Status = constant.ORDER_UNFINISH
+	return &res, nil
+}
+
+func TestArbitrageUnknown(t *testing.T) {
+	arbCancelTimeout, arbPollInterval = 10*time.Millisecond, time.Millisecond
+	defer func() { arbCancelTimeout, arbPollInterval = 5*time.Second, 200*time.Millisecond }()
+	cheap := NewMockExchange(constant.Option{BackLog: true})
+	rich := NewMockExchange(constant.Option{Index: 1, BackLog: true})
+	rich.SetDepth(constant.Depth{
+		Asks: constant.DepthRecords{{Price: 102.1, Amount: 3}},
+		Bids: constant.DepthRecords{{Price: 101.9, Amount: 3}},
+	})
+	cheap.SetFillRatio(0.5)
+	a := NewArbitrage("BTC/USDT", &stuckExchange{cheap}, rich)
+	a.Update()
+
+	// 撤单后仍未结束, 已成交部分对冲, 状态未知的部分计入 Residual
+	res, err := a.Execute(0, 1, 2)
+	if err == nil || res.Bought != 1 || res.Sold != 1 || res.Residual != 1 {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+
+	// 只支持现货
+	a.SetSymbol(1, "BTC/USDT.swap")
+	if _, err := a.Execute(0, 1, 1); err == nil {
+		t.Fatalf("the contract leg should fail")
+	}
+	swap := NewMockExchange(constant.Option{Type: constant.OKExSwap, BackLog: true})
+	if _, err := NewArbitrage("BTC/USDT", cheap, swap).Execute(0, 1, 1); err == nil {
+		t.Fatalf("the contract exchange should fail")
+	}
+}
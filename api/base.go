@@ -2,7 +2,10 @@ package api
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"snack.com/xiyanxiyan10/stocktrader/constant"
@@ -59,6 +62,19 @@ func (l *DataLoader) Dump() []constant.OHLC {
 	return l.datas
 }
 
+// Records the last size records fed by Next, all of them when size <= 0
+func (l *DataLoader) Records(size int) []constant.Record {
+	fed := l.datas[:l.curr]
+	if size > 0 && len(fed) > size {
+		fed = fed[len(fed)-size:]
+	}
+	records := make([]constant.Record, 0, len(fed))
+	for _, ohlc := range fed {
+		records = append(records, constant.Record(ohlc))
+	}
+	return records
+}
+
 // Load ...
 func (l *DataLoader) Load(ohlcs []constant.OHLC) {
 	l.datas = append(l.datas, ohlcs...)
@@ -71,18 +87,19 @@ func (l *DataLoader) Load(ohlcs []constant.OHLC) {
 type BaseExchange struct {
 	period             string
 	size               int
-	id                 int     // id of the exchange
-	ioMode             string  // io mode for exchange
-	direction          string  // trade type
-	stockType          string  // stockType
-	lever              float64 // lever
+	id                 int          // id of the exchange
+	ioMode             string       // io mode for exchange
+	settingsMu         sync.RWMutex // ExecTasks 的协程并发读写下面的设置
+	direction          string       // trade type
+	stockType          string       // stockType
+	lever              float64      // lever
 	recordsPeriodMap   map[string]int64
 	recordsPeriodDbMap map[string]int64 // coin watched
 	// recordsPeriod support
 	minAmountMap map[string]float64 // minAmount of trade
-	limit        int64
-	lastSleep    int64
-	lastTimes    int64
+	tickSizeMap  map[string]float64 // 最小价格变动
+	limiter      *rateLimiter       // 交易所的请求限流, 同一交易所共享
+	ownLimiter   *rateLimiter       // 本实例的请求限流, 不超过交易所的限流
 	currencyMap  map[string]float64
 
 	coverRate    float64
@@ -92,8 +109,9 @@ type BaseExchange struct {
 
 	host string
 
-	logger model.Logger
-	option constant.Option
+	logger  model.Logger
+	option  constant.Option
+	clients *clientOrders // 客户端订单号
 
 	father ExchangeBroker
 }
@@ -106,24 +124,38 @@ func stockPair2Vec(pair string) []string {
 	return res
 }
 
+// Buy ...
 func (e *BaseExchange) Buy(price, amount, msg string) (string, error) {
-	orderID, err := e.father.buy(price, amount, msg)
-	if err != nil {
-		return "", err
-	}
-	return orderID, nil
+	return placeString(e, constant.TradeTypeBuy, price, amount, msg)
 }
 
+// Sell ...
 func (e *BaseExchange) Sell(price, amount, msg string) (string, error) {
-	orderID, err := e.father.sell(price, amount, msg)
-	if err != nil {
+	return placeString(e, constant.TradeTypeSell, price, amount, msg)
+}
+
+// PlaceOrder place the order of req.Symbol, the current stock type without it
+func (e *BaseExchange) PlaceOrder(req constant.OrderRequest) (string, error) {
+	if err := e.prepareOrder(&req); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
 		return "", err
 	}
-	return orderID, nil
+	return e.submitOrder(e.clientLookup(), req, e.father.placeOrder)
 }
 
+// GetOrderByClientID get the order placed with the client order id
+func (e *BaseExchange) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	return e.orderByClientID(e.GetOrderOf, clientID)
+}
+
+// CancelOrder ...
 func (e *BaseExchange) CancelOrder(orderID string) (bool, error) {
-	status, err := e.father.cancelOrder(orderID)
+	return e.CancelOrderOf(e.GetStockType(), orderID)
+}
+
+// CancelOrderOf cancel an order of the symbol
+func (e *BaseExchange) CancelOrderOf(symbol, orderID string) (bool, error) {
+	status, err := e.father.cancelOrder(e.symbolOf(symbol), orderID)
 	if err != nil {
 		return false, err
 	}
@@ -164,10 +196,20 @@ func (e *BaseExchange) SetBackAccount(key string, val float64) {
 	e.currencyMap[key] = val
 }
 
-// SetLimit set the limit calls amount per second of this exchange
+// SetLimit set the limit calls amount per second of this exchange below the limit of the venue,
+// 0 to use the limit of the venue only
 func (e *BaseExchange) SetLimit(times int64) int64 {
-	e.limit = times
-	return e.limit
+	if e.limiter == nil {
+		e.limiter = limiterOf(e.option.Type)
+	}
+	rate := e.limiter.getRate()
+	if times <= 0 {
+		e.ownLimiter = nil
+		return int64(rate)
+	}
+	rate = math.Min(rate, float64(times))
+	e.ownLimiter = newRateLimiter(e.option.Type, rate, rate)
+	return int64(rate)
 }
 
 // AutoSleep auto sleep to achieve the limit calls amount per second of this exchange
@@ -175,12 +217,7 @@ func (e *BaseExchange) AutoSleep() {
 	if e.option.BackTest {
 		return
 	}
-	if e.limit == 0 {
-		e.limit = 1000
-	}
-	time.Sleep(time.Duration(e.limit) * time.Millisecond)
-	e.lastTimes = 0
-	e.lastSleep = time.Now().UnixNano()
+	e.throttle("AutoSleep")
 }
 
 // Sleep ...
@@ -213,8 +250,9 @@ func (e *BaseExchange) Stop() error {
 func (e *BaseExchange) Init(opt constant.Option) error {
 	e.logger = model.Logger{TraderID: opt.TraderID, ExchangeType: opt.Type, Back: opt.BackLog}
 	e.option = opt
-	e.limit = opt.Limit
-	e.lastSleep = time.Now().UnixNano()
+	e.limiter = limiterOf(opt.Type)
+	e.SetLimit(opt.Limit)
+	e.clients = newClientOrders(fmt.Sprintf("%d.%d.%d", opt.TraderID, opt.Index, time.Now().Unix()))
 	e.recordsPeriodDbMap = map[string]int64{
 		"M1":  constant.Minute,
 		"M5":  5 * constant.Minute,
@@ -246,34 +284,62 @@ func (e *BaseExchange) getSymbol(symbol string) (string, string) {
 
 // SetDirection set the limit calls amount per second of this exchange
 func (e *BaseExchange) SetDirection(direction string) {
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
 	e.direction = direction
 }
 
 // GetDirection set the limit calls amount per second of this exchange
 func (e *BaseExchange) GetDirection() string {
+	e.settingsMu.RLock()
+	defer e.settingsMu.RUnlock()
 	return e.direction
 }
 
 // SetMarginLevel set the limit calls amount per second of this exchange
 func (e *BaseExchange) SetMarginLevel(lever float64) {
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
 	e.lever = lever
 }
 
 // GetMarginLevel set the limit calls amount per second of this exchange
 func (e *BaseExchange) GetMarginLevel() float64 {
+	e.settingsMu.RLock()
+	defer e.settingsMu.RUnlock()
 	return e.lever
 }
 
 // GetStockType set the limit calls amount per second of this exchange
 func (e *BaseExchange) GetStockType() string {
+	e.settingsMu.RLock()
+	defer e.settingsMu.RUnlock()
 	return e.stockType
 }
 
 // SetStockType set the limit calls amount per second of this exchange
 func (e *BaseExchange) SetStockType(stockType string) {
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
 	e.stockType = stockType
 }
 
+// settings the stock type, direction and margin level read at once,
+// ExecTasks may change them from other goroutines
+func (e *BaseExchange) settings() (stockType, direction string, lever float64) {
+	e.settingsMu.RLock()
+	defer e.settingsMu.RUnlock()
+	return e.stockType, e.direction, e.lever
+}
+
+// symbolOf the symbol of the call, the current stock type when it is empty
+func (e *BaseExchange) symbolOf(symbol string) string {
+	if symbol == "" {
+		return e.GetStockType()
+	}
+	return symbol
+}
+
 // SetMinAmountMap ...
 func (e *BaseExchange) SetMinAmountMap(m map[string]float64) {
 	e.minAmountMap = m
@@ -284,6 +350,16 @@ func (e *BaseExchange) GetMinAmountMap() map[string]float64 {
 	return e.minAmountMap
 }
 
+// SetTickSizeMap ...
+func (e *BaseExchange) SetTickSizeMap(m map[string]float64) {
+	e.tickSizeMap = m
+}
+
+// GetTickSizeMap ...
+func (e *BaseExchange) GetTickSizeMap() map[string]float64 {
+	return e.tickSizeMap
+}
+
 // SetRecordsPeriodMap ...
 func (e *BaseExchange) SetRecordsPeriodMap(m map[string]int64) {
 	e.recordsPeriodMap = m
@@ -299,21 +375,51 @@ func (e *BaseExchange) GetTicker() (*constant.Ticker, error) {
 	return e.father.getTicker(e.GetStockType())
 }
 
+// GetTickerOf get the market ticker of the symbol
+func (e *BaseExchange) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	return e.father.getTicker(e.symbolOf(symbol))
+}
+
 // GetDepth.father.get depth from exchange
 func (e *BaseExchange) GetDepth() (*constant.Depth, error) {
 	return e.father.getDepth(e.GetStockType())
 }
 
+// GetDepthOf get the depth of the symbol
+func (e *BaseExchange) GetDepthOf(symbol string) (*constant.Depth, error) {
+	return e.father.getDepth(e.symbolOf(symbol))
+}
+
+// GetRecords get the klines of the stock type by the period and the size set
+func (e *BaseExchange) GetRecords() ([]constant.Record, error) {
+	return e.father.getRecords(e.GetStockType())
+}
+
+// GetRecordsOf get the klines of the symbol by the period and the size set
+func (e *BaseExchange) GetRecordsOf(symbol string) ([]constant.Record, error) {
+	return e.father.getRecords(e.symbolOf(symbol))
+}
+
 // GetOrder ...
 func (e *BaseExchange) GetOrder(id string) (*constant.Order, error) {
 	return e.father.getOrder(e.GetStockType(), id)
 }
 
+// GetOrderOf get an order of the symbol
+func (e *BaseExchange) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	return e.father.getOrder(e.symbolOf(symbol), id)
+}
+
 // GetOrders.father.get all unfilled orders
 func (e *BaseExchange) GetOrders() ([]constant.Order, error) {
 	return e.father.getOrders(e.GetStockType())
 }
 
+// GetOrdersOf get all unfilled orders of the symbol
+func (e *BaseExchange) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	return e.father.getOrders(e.symbolOf(symbol))
+}
+
 // GetAccount ...
 func (e *BaseExchange) GetAccount() (*constant.Account, error) {
 	return e.father.getAccount()
@@ -324,28 +430,49 @@ func (e *BaseExchange) GetPosition() ([]constant.Position, error) {
 	return e.father.getPosition(e.GetStockType())
 }
 
+// GetPositionOf get the positions of the symbol
+func (e *BaseExchange) GetPositionOf(symbol string) ([]constant.Position, error) {
+	return e.father.getPosition(e.symbolOf(symbol))
+}
+
 // ValidBuy ...
 func (e *BaseExchange) ValidBuy() error {
-	dir := e.GetDirection()
-	if dir == constant.TradeTypeBuy {
-		return nil
-	}
-	if dir == constant.TradeTypeShortClose {
-		return nil
-	}
-	return errors.New("buy direction error:" + e.GetDirection())
+	return validDirection(constant.TradeTypeBuy, e.GetDirection())
 }
 
 // ValidSell ...
 func (e *BaseExchange) ValidSell() error {
-	dir := e.GetDirection()
-	if dir == constant.TradeTypeSell {
-		return nil
+	return validDirection(constant.TradeTypeSell, e.GetDirection())
+}
+
+// validDirection check the direction opens or closes the position by the side
+func validDirection(side, dir string) error {
+	if side == constant.TradeTypeBuy {
+		if dir == constant.TradeTypeBuy || dir == constant.TradeTypeShortClose {
+			return nil
+		}
+		return errors.New("buy direction error:" + dir)
 	}
-	if dir == constant.TradeTypeLongClose {
+	if dir == constant.TradeTypeSell || dir == constant.TradeTypeLongClose {
 		return nil
 	}
-	return errors.New("sell direction error:" + e.GetDirection())
+	return errors.New("sell direction error:" + dir)
+}
+
+// directionOf the direction of the request, the one set by SetDirection without it
+func (e *BaseExchange) directionOf(req constant.OrderRequest) string {
+	if req.Direction != "" {
+		return req.Direction
+	}
+	return e.GetDirection()
+}
+
+// marginLevelOf the margin level of the request, the one set by SetMarginLevel without it
+func (e *BaseExchange) marginLevelOf(req constant.OrderRequest) float64 {
+	if req.MarginLevel > 0 {
+		return req.MarginLevel
+	}
+	return e.GetMarginLevel()
 }
 
 // Log print something to console
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"sync"
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestSymbolCalls(t *testing.T) {
+	e := NewMockExchange(constant.Option{BackLog: true})
+	e.SetTickerOf("ETH/USDT", constant.Ticker{Last: 10, Buy: 9.9, Sell: 10.1})
+	e.SetRecords("ETH/USDT", []constant.Record{{Close: 10}, {Close: 11}})
+
+	if ticker, err := e.GetTickerOf("ETH/USDT"); err != nil || ticker.Last != 10 {
+		t.Fatalf("unexpected ticker %+v %v", ticker, err)
+	}
+	if ticker, _ := e.GetTicker(); ticker.Last != 100 {
+		t.Fatalf("the ticker of the stock type should not change, got %+v", ticker)
+	}
+	if depth, _ := e.GetDepthOf("ETH/USDT"); depth.StockType != "ETH/USDT" {
+		t.Fatalf("unexpected depth %+v", depth)
+	}
+	if records, _ := e.GetRecordsOf("ETH/USDT"); len(records) != 2 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if records, _ := e.GetRecords(); len(records) != 0 {
+		t.Fatalf("unexpected records of the stock type %+v", records)
+	}
+
+	// 指定品种下单不修改当前品种
+	req := constant.OrderRequest{Symbol: "ETH/USDT", Side: constant.TradeTypeBuy, Price: 9, Amount: 1, ClientOrderID: "eth-1"}
+	id, err := e.PlaceOrder(req)
+	if err != nil || e.GetStockType() != "BTC/USDT" {
+		t.Fatalf("place order: %v, stock type %s", err, e.GetStockType())
+	}
+	if orders, _ := e.GetOrdersOf("ETH/USDT"); len(orders) != 1 || orders[0].StockType != "ETH/USDT" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+	if orders, _ := e.GetOrders(); len(orders) != 0 {
+		t.Fatalf("unexpected orders of the stock type %+v", orders)
+	}
+	if order, err := e.GetOrderByClientID("eth-1"); err != nil || order.Id != id {
+		t.Fatalf("get by client id: %+v %v", order, err)
+	}
+	e.SetTickerOf("ETH/USDT", constant.Ticker{Last: 8.5})
+	if order, _ := e.GetOrderOf("ETH/USDT", id); order.Status != constant.ORDER_FINISH || order.AvgPrice != 8.5 {
+		t.Fatalf("the order should be filled by the ticker of its symbol, got %+v", order)
+	}
+	id, _ = e.PlaceOrder(constant.OrderRequest{Symbol: "ETH/USDT", Side: constant.TradeTypeSell, Price: 12, Amount: 1})
+	if _, err := e.CancelOrderOf("BTC/USDT", id); err != ErrNotFoundOrder {
+		t.Fatalf("cancel on another symbol: %v", err)
+	}
+	if ok, err := e.CancelOrderOf("ETH/USDT", id); !ok || err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+}
+
+func TestPaperSymbols(t *testing.T) {
+	live := NewMockExchange(constant.Option{BackLog: true})
+	live.SetTickerOf("ETH/USDT", constant.Ticker{Last: 10, Buy: 9.9, Sell: 10.1})
+	e := newPaperExchange(live, constant.Option{Type: constant.Paper + "Mock", BackLog: true}, &memoryStore{})
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	e.SetStockType("BTC/USDT")
+	e.SetBackAccount("USDT", 10000)
+
+	if _, err := e.GetTicker(); err != nil {
+		t.Fatalf("ticker: %v", err)
+	}
+	id, err := e.PlaceOrder(constant.OrderRequest{Symbol: "ETH/USDT", Side: constant.TradeTypeBuy,
+		OrderType: constant.OrderTypeMarket, Amount: 2})
+	if order, _ := e.GetOrderOf("ETH/USDT", id); err != nil || order.AvgPrice != 10 {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	// 各品种的最新行情分别保存, 不受其他品种的行情影响
+	ord, err := e.engine.MarketBuy("1", "-1", "BTC/USDT")
+	if err != nil || ord.Price != 100 {
+		t.Fatalf("the market order should be filled at the last price of its symbol, got %+v %v", ord, err)
+	}
+	if orders, _ := e.GetOrdersOf("ETH/USDT"); len(orders) != 0 {
+		t.Fatalf("unexpected open orders %+v", orders)
+	}
+}
+
+func TestConcurrentSettings(t *testing.T) {
+	e := NewMockExchange(constant.Option{BackLog: true})
+	var wg sync.WaitGroup
+	for i, symbol := range []string{"BTC/USDT", "ETH/USDT", "LTC/USDT", "EOS/USDT"} {
+		wg.Add(1)
+		go func(i int, symbol string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.SetStockType(symbol)
+				e.SetDirection(constant.TradeTypeBuy)
+				e.SetMarginLevel(float64(i + 1))
+				e.GetStockType()
+				e.GetDirection()
+				e.GetMarginLevel()
+				if _, err := e.Buy("100", "1", ""); err != nil {
+					t.Errorf("buy: %v", err)
+					return
+				}
+				// 请求中指定的品种及方向不受其他协程的设置影响
+				id, err := e.PlaceOrder(constant.OrderRequest{Symbol: symbol, Side: constant.TradeTypeBuy, Price: 100,
+					Amount: 1, Direction: constant.TradeTypeBuy})
+				if err != nil {
+					t.Errorf("place order: %v", err)
+					return
+				}
+				if order, err := e.GetOrderOf(symbol, id); err != nil || order.StockType != symbol {
+					t.Errorf("unexpected order %+v %v", order, err)
+					return
+				}
+			}
+		}(i, symbol)
+	}
+	wg.Wait()
+}
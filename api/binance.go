@@ -0,0 +1,50 @@
+package api
+
+import (
+	goex "github.com/nntaoli-project/goex"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// NewBinanceExchange create an exchange struct of the spot of binance.com
+func NewBinanceExchange(opt constant.Option) (Exchange, error) {
+	exchange := NewSpotExchange(opt)
+	exchange.SetStockTypeMap(map[string]goex.CurrencyPair{
+		"BTC/USDT": goex.BTC_USDT,
+		"ETH/USDT": goex.ETH_USDT,
+		"EOS/USDT": goex.EOS_USDT,
+		"LTC/USDT": goex.LTC_USDT,
+		"BNB/USDT": goex.BNB_USDT,
+		"ETH/BTC":  goex.ETH_BTC,
+	})
+	exchange.SetMinAmountMap(map[string]float64{
+		"BTC/USDT": 0.00001,
+		"ETH/USDT": 0.0001,
+		"EOS/USDT": 0.01,
+		"LTC/USDT": 0.001,
+		"BNB/USDT": 0.001,
+		"ETH/BTC":  0.001,
+	})
+	exchange.SetTickSizeMap(map[string]float64{
+		"BTC/USDT": 0.01,
+		"ETH/USDT": 0.01,
+		"EOS/USDT": 0.0001,
+		"LTC/USDT": 0.01,
+		"BNB/USDT": 0.01,
+		"ETH/BTC":  0.000001,
+	})
+	exchange.SetRecordsPeriodMap(map[string]int64{
+		"M1":  goex.KLINE_PERIOD_1MIN,
+		"M5":  goex.KLINE_PERIOD_5MIN,
+		"M15": goex.KLINE_PERIOD_15MIN,
+		"M30": goex.KLINE_PERIOD_30MIN,
+		"H1":  goex.KLINE_PERIOD_1H,
+		"H2":  goex.KLINE_PERIOD_2H,
+		"H4":  goex.KLINE_PERIOD_4H,
+		"D1":  goex.KLINE_PERIOD_1DAY,
+		"W1":  goex.KLINE_PERIOD_1WEEK,
+	})
+	if err := exchange.Init(opt); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
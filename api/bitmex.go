@@ -0,0 +1,39 @@
+package api
+
+import (
+	goex "github.com/nntaoli-project/goex"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// NewBitmexExchange create an exchange struct of the perpetual swaps of bitmex.com, e.g. BTC/USD.swap
+func NewBitmexExchange(opt constant.Option) (Exchange, error) {
+	exchange := NewFutureExchange(opt)
+	// goex 将 BTC 转换为 XBT
+	exchange.SetStockTypeMap(map[string]goex.CurrencyPair{
+		"BTC/USD": goex.BTC_USD,
+		"ETH/USD": goex.ETH_USD,
+	})
+	exchange.SetContractTypeMap(map[string]string{
+		"":     goex.SWAP_CONTRACT,
+		"swap": goex.SWAP_CONTRACT,
+	})
+	// 数量为合约张数, 每张 1 美元
+	exchange.SetMinAmountMap(map[string]float64{
+		"BTC/USD": 1,
+		"ETH/USD": 1,
+	})
+	exchange.SetTickSizeMap(map[string]float64{
+		"BTC/USD": 0.5,
+		"ETH/USD": 0.05,
+	})
+	exchange.SetRecordsPeriodMap(map[string]int64{
+		"M1": goex.KLINE_PERIOD_1MIN,
+		"M5": goex.KLINE_PERIOD_5MIN,
+		"H1": goex.KLINE_PERIOD_1H,
+		"D1": goex.KLINE_PERIOD_1DAY,
+	})
+	if err := exchange.Init(opt); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
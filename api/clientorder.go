@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/util"
+)
+
+// submitRetries times to resubmit an order whose result is unknown
+const submitRetries = 2
+
+// clientOrderBroker a broker which sends the client order id to the venue,
+// so the order can be queried by it when the result of placing is unknown
+type clientOrderBroker interface {
+	getOrderByClientID(symbol, clientID string) (*constant.Order, error)
+}
+
+// clientOrders map the client order id to the order id returned by the exchange
+type clientOrders struct {
+	mu      sync.Mutex
+	gen     *util.IDGen
+	ids     map[string]string // client id -> order id
+	symbols map[string]string // client id -> symbol
+}
+
+// newClientOrders ...
+func newClientOrders(prefix string) *clientOrders {
+	if prefix == "" {
+		prefix = "order"
+	}
+	return &clientOrders{
+		gen:     util.NewIDGen(prefix),
+		ids:     make(map[string]string),
+		symbols: make(map[string]string),
+	}
+}
+
+// next generate a new client order id
+func (c *clientOrders) next() string {
+	return c.gen.Get()
+}
+
+// get the order id and the symbol of the client id
+func (c *clientOrders) get(clientID string) (string, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.ids[clientID]
+	return id, c.symbols[clientID], ok
+}
+
+// bind ...
+func (c *clientOrders) bind(clientID, id, symbol string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[clientID] = id
+	c.symbols[clientID] = symbol
+}
+
+// uncertain whether the error leaves the order state unknown, e.g. the request timeout
+// after it has been sent to the exchange, or the gateway of the exchange returns 502/504
+func uncertain(err error) bool {
+	err = classify("PlaceOrder", err)
+	return errors.Is(err, ErrNetwork) || errors.Is(err, ErrUnavailable)
+}
+
+// NewClientOrderID generate a client order id of this exchange
+func (e *BaseExchange) NewClientOrderID() string {
+	if e.clients == nil {
+		e.clients = newClientOrders(e.option.Type)
+	}
+	return e.clients.next()
+}
+
+// clientLookup query the order by the client id from the venue, nil if the venue does not keep it
+func (e *BaseExchange) clientLookup() func(string, string) (*constant.Order, error) {
+	if broker, ok := e.father.(clientOrderBroker); ok {
+		return broker.getOrderByClientID
+	}
+	return nil
+}
+
+// submitOrder place the order with a client order id, when the result is unknown, query the venue
+// by the client id and resubmit only when the venue reports it is not found; without a lookup
+// the order state is unknown and never resubmitted
+func (e *BaseExchange) submitOrder(lookup func(string, string) (*constant.Order, error),
+	req constant.OrderRequest, place func(constant.OrderRequest) (string, error)) (string, error) {
+	if e.clients == nil {
+		e.clients = newClientOrders(e.option.Type)
+	}
+	req.Symbol = e.symbolOf(req.Symbol)
+	if req.ClientOrderID == "" {
+		req.ClientOrderID = e.clients.next()
+	} else if id, _, ok := e.clients.get(req.ClientOrderID); ok {
+		// 同一客户端订单号只提交一次
+		return id, nil
+	}
+	var err error
+	for i := 0; i <= submitRetries; i++ {
+		if i > 0 && !e.option.BackTest {
+			time.Sleep(time.Duration(i) * 500 * time.Millisecond)
+		}
+		var id string
+		if id, err = place(req); err == nil {
+			e.clients.bind(req.ClientOrderID, id, req.Symbol)
+			return id, nil
+		}
+		if !uncertain(err) {
+			return "", err
+		}
+		if lookup == nil {
+			// 交易所不支持按客户端订单号查询, 无法确认是否已提交, 不能重复提交
+			break
+		}
+		order, lookupErr := lookup(req.Symbol, req.ClientOrderID)
+		if lookupErr == nil && order != nil {
+			e.logger.Log(constant.INFO, req.Symbol, req.Price, req.Amount,
+				"PlaceOrder() found the submitted order ", order.Id, " of client id ", req.ClientOrderID)
+			e.clients.bind(req.ClientOrderID, order.Id, req.Symbol)
+			return order.Id, nil
+		}
+		if !errors.Is(lookupErr, ErrNotFoundOrder) {
+			// 查询同样失败时结果仍然未知
+			break
+		}
+	}
+	e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+		"PlaceOrder() error, the error number is order state unknown, client id ", req.ClientOrderID)
+	return "", fmt.Errorf("PlaceOrder() error, the error number is order state unknown, client id %s: %s",
+		req.ClientOrderID, err.Error())
+}
+
+// orderByClientID get the order placed with the client id from the symbol it is placed on
+func (e *BaseExchange) orderByClientID(get func(string, string) (*constant.Order, error), clientID string) (*constant.Order, error) {
+	id, symbol, ok := "", "", false
+	if e.clients != nil {
+		id, symbol, ok = e.clients.get(clientID)
+	}
+	if !ok {
+		// 本地没有记录时, 向支持客户端订单号的交易所查询, 如重启前提交的订单
+		if lookup := e.clientLookup(); lookup != nil {
+			order, err := lookup(e.GetStockType(), clientID)
+			if err == nil && order != nil {
+				order.ClientID = clientID
+			}
+			return order, err
+		}
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0, 0,
+			"GetOrderByClientID() error, the error number is client id not found ", clientID)
+		return nil, fmt.Errorf("GetOrderByClientID() error, the error number is client id %s not found", clientID)
+	}
+	order, err := get(symbol, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("GetOrderByClientID() error, the error number is order %s not found", id)
+	}
+	order.ClientID = clientID
+	return order, nil
+}
@@ -0,0 +1,597 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// ctp 买卖方向及开平标志
+const (
+	ctpBuy  byte = '0'
+	ctpSell byte = '1'
+
+	ctpOpen           byte = '0'
+	ctpClose          byte = '1'
+	ctpForceClose     byte = '2'
+	ctpCloseToday     byte = '3'
+	ctpCloseYesterday byte = '4'
+
+	// 报单状态
+	ctpStatusAllTraded byte = '0'
+	ctpStatusPartQueue byte = '1'
+	ctpStatusPartNoQue byte = '2'
+	ctpStatusNoTrade   byte = '3'
+	ctpStatusNoTradeNQ byte = '4'
+	ctpStatusCanceled  byte = '5'
+)
+
+// ctpQueryWait how long to wait for the response of a position or account query
+var ctpQueryWait = time.Second
+
+// ctpOffset the buy/sell direction and the offset flag of a trade type
+type ctpOffset struct {
+	direction byte
+	offset    byte
+}
+
+// ctpOffsets the ctp direction and offset of every trade type set by SetDirection
+var ctpOffsets = map[string]ctpOffset{
+	constant.TradeTypeLong:            {ctpBuy, ctpOpen},
+	constant.TradeTypeShort:           {ctpSell, ctpOpen},
+	constant.TradeTypeLongClose:       {ctpSell, ctpClose},
+	constant.TradeTypeShortClose:      {ctpBuy, ctpClose},
+	constant.TradeTypeLongCloseToday:  {ctpSell, ctpCloseToday},
+	constant.TradeTypeShortCloseToday: {ctpBuy, ctpCloseToday},
+}
+
+// ctpTick the depth market data of an instrument
+type ctpTick struct {
+	Last       float64
+	Open       float64
+	High       float64
+	Low        float64
+	Close      float64
+	Volume     float64
+	Bid        float64
+	BidVolume  float64
+	Ask        float64
+	AskVolume  float64
+	UpperLimit float64 // 涨停板价
+	LowerLimit float64 // 跌停板价
+}
+
+// ctpInput an order inserted to the ctp front
+type ctpInput struct {
+	Instrument string
+	Direction  byte
+	Offset     byte
+	Price      float64
+	Volume     int
+}
+
+// ctpOrder an order reported by the ctp front
+type ctpOrder struct {
+	FrontID    int    // 前置编号, 被综合交易平台拒绝的报单为 0
+	SessionID  int    // 会话编号
+	Ref        string // 报单引用
+	ExchangeID string
+	SysID      string // 报单编号, 被拒绝的报单为空
+	Instrument string
+	Direction  byte
+	Offset     byte
+	Price      float64
+	Volume     int
+	Traded     int
+	Status     byte
+	Message    string
+}
+
+// ctpTrade a trade reported by the ctp front
+type ctpTrade struct {
+	ExchangeID string
+	SysID      string // 报单编号
+	Price      float64
+	Volume     int
+}
+
+// ctpPosition a position reported by the ctp front, one row per direction and position date
+type ctpPosition struct {
+	Instrument string
+	Long       bool
+	Position   int
+	Today      int // 今仓
+	Frozen     int // 平仓冻结
+	OpenCost   float64
+	Profit     float64
+}
+
+// ctpAccount the trading account reported by the ctp front
+type ctpAccount struct {
+	Balance     float64
+	Available   float64
+	Margin      float64
+	Frozen      float64
+	CloseProfit float64
+	Profit      float64
+}
+
+// ctpFront the ctp trading and market data front, implemented by apisdk/ctp with the ctp build tag
+type ctpFront interface {
+	Start() error
+	SubscribeMarketData(instruments []string) int
+	GetMarketData(instrument string) *ctpTick
+	ReqQryInvestorPosition() int
+	ReqQryTradingAccount() int
+	GetOrderList() []ctpOrder
+	GetTradeList() []ctpTrade
+	Session() (frontID, sessionID int)
+	GetInvestorPositions() []ctpPosition
+	GetAccountInfo() (ctpAccount, bool)
+	OrderOpen(input ctpInput) int
+	OrderClose(input ctpInput) int
+	OrderCancel(instrument, orderSysID string) int
+}
+
+// newCtpFront create the ctp front of the option, set by the ctp build
+var newCtpFront = func(opt constant.Option) (ctpFront, error) {
+	return nil, fmt.Errorf("ctp is not supported by this build, please build with the ctp tag")
+}
+
+// CtpExchange the exchange struct of the chinese futures through ctp
+type CtpExchange struct {
+	BaseExchange
+
+	front   ctpFront
+	mu      sync.Mutex
+	started bool
+	pending map[string]constant.Order // 已报入但前置尚未回报的报单
+}
+
+// NewCtpExchange create an exchange struct of ctp
+func NewCtpExchange(opt constant.Option) (Exchange, error) {
+	front, err := newCtpFront(opt)
+	if err != nil {
+		return nil, err
+	}
+	return newCtpExchange(opt, front), nil
+}
+
+// newCtpExchange ...
+func newCtpExchange(opt constant.Option, front ctpFront) *CtpExchange {
+	e := &CtpExchange{
+		front:   front,
+		pending: make(map[string]constant.Order),
+	}
+	e.BaseExchange.Init(opt)
+	e.SetID(opt.Index)
+	e.SetMinAmountMap(map[string]float64{})
+	e.BaseExchange.father = ExchangeBroker(e)
+	return e
+}
+
+// ready whether the front is started
+func (e *CtpExchange) ready() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.started
+}
+
+// SetStockType set the instrument and subscribe its market data
+func (e *CtpExchange) SetStockType(stockType string) {
+	e.BaseExchange.SetStockType(stockType)
+	if e.ready() && stockType != "" {
+		e.front.SubscribeMarketData([]string{stockType})
+	}
+}
+
+// start ...
+func (e *CtpExchange) start() error {
+	if err := e.front.Start(); err != nil {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+			"Start() error, the error number is "+err.Error())
+		return fmt.Errorf("Start() error, the error number is %s", err.Error())
+	}
+	e.mu.Lock()
+	e.started = true
+	e.mu.Unlock()
+	instruments := append([]string{}, e.option.WatchList...)
+	if stockType := e.GetStockType(); stockType != "" {
+		instruments = append(instruments, stockType)
+	}
+	if len(instruments) > 0 {
+		e.front.SubscribeMarketData(instruments)
+	}
+	return nil
+}
+
+// stop ...
+func (e *CtpExchange) stop() error {
+	return nil
+}
+
+// tick the market data of the instrument
+func (e *CtpExchange) tick(method, symbol string) (*ctpTick, error) {
+	if !e.ready() {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is ctp not started")
+		return nil, fmt.Errorf("%s() error, the error number is ctp not started", method)
+	}
+	tick := e.front.GetMarketData(symbol)
+	if tick == nil {
+		e.front.SubscribeMarketData([]string{symbol})
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is no market data")
+		return nil, fmt.Errorf("%s() error, the error number is no market data", method)
+	}
+	return tick, nil
+}
+
+// getTicker get market ticker
+func (e *CtpExchange) getTicker(symbol string) (*constant.Ticker, error) {
+	tick, err := e.tick("GetTicker", symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &constant.Ticker{
+		Last:  tick.Last,
+		Buy:   tick.Bid,
+		Sell:  tick.Ask,
+		Open:  tick.Open,
+		High:  tick.High,
+		Low:   tick.Low,
+		Close: tick.Close,
+		Vol:   tick.Volume,
+		Time:  time.Now().Unix(),
+	}, nil
+}
+
+// getRecords ctp pushes no kline, the records are built by the strategy from the ticks
+func (e *CtpExchange) getRecords(symbol string) ([]constant.Record, error) {
+	e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetRecords() error, the error number is not support")
+	return nil, fmt.Errorf("GetRecords() error, the error number is not support")
+}
+
+// getDepth get the first level of the depth, ctp only pushes one level
+func (e *CtpExchange) getDepth(symbol string) (*constant.Depth, error) {
+	tick, err := e.tick("GetDepth", symbol)
+	if err != nil {
+		return nil, err
+	}
+	depth := constant.Depth{StockType: symbol, Time: time.Now().Unix()}
+	if tick.Ask > 0 {
+		depth.Asks = append(depth.Asks, constant.DepthRecord{Price: tick.Ask, Amount: tick.AskVolume})
+	}
+	if tick.Bid > 0 {
+		depth.Bids = append(depth.Bids, constant.DepthRecord{Price: tick.Bid, Amount: tick.BidVolume})
+	}
+	return &depth, nil
+}
+
+// ctpTradeType the trade type of the ctp direction and offset
+func ctpTradeType(direction, offset byte) string {
+	closing := offset == ctpClose || offset == ctpForceClose || offset == ctpCloseYesterday
+	switch {
+	case direction == ctpBuy && offset == ctpOpen:
+		return constant.TradeTypeLong
+	case direction == ctpSell && offset == ctpOpen:
+		return constant.TradeTypeShort
+	case direction == ctpSell && offset == ctpCloseToday:
+		return constant.TradeTypeLongCloseToday
+	case direction == ctpBuy && offset == ctpCloseToday:
+		return constant.TradeTypeShortCloseToday
+	case direction == ctpSell && closing:
+		return constant.TradeTypeLongClose
+	case direction == ctpBuy && closing:
+		return constant.TradeTypeShortClose
+	}
+	return ""
+}
+
+// ctpStatus the trade status of the ctp order status
+func ctpStatus(order ctpOrder) constant.TradeStatus {
+	switch order.Status {
+	case ctpStatusAllTraded:
+		return constant.ORDER_FINISH
+	case ctpStatusPartQueue:
+		return constant.ORDER_PART_FINISH
+	case ctpStatusPartNoQue, ctpStatusNoTradeNQ, ctpStatusCanceled:
+		if order.SysID == "" && order.Traded == 0 {
+			return constant.ORDER_REJECT
+		}
+		return constant.ORDER_CANCEL
+	}
+	return constant.ORDER_UNFINISH
+}
+
+// ctpOrderID the id of the order, unique across the sessions by the front id, session id and order ref
+func ctpOrderID(frontID, sessionID int, ref string) string {
+	return fmt.Sprintf("%d:%d:%s", frontID, sessionID, strings.TrimSpace(ref))
+}
+
+// orderID the id of the ctp order, the orders rejected by the front are of this session
+func (e *CtpExchange) orderID(order ctpOrder) string {
+	if order.FrontID == 0 && order.SessionID == 0 {
+		frontID, sessionID := e.front.Session()
+		return ctpOrderID(frontID, sessionID, order.Ref)
+	}
+	return ctpOrderID(order.FrontID, order.SessionID, order.Ref)
+}
+
+// avgPrice the volume weighted price of the trades of the order
+func (e *CtpExchange) avgPrice(order ctpOrder) float64 {
+	volume, turnover := 0, 0.0
+	if order.SysID != "" {
+		for _, trade := range e.front.GetTradeList() {
+			if trade.ExchangeID == order.ExchangeID && trade.SysID == order.SysID {
+				volume += trade.Volume
+				turnover += trade.Price * float64(trade.Volume)
+			}
+		}
+	}
+	if volume > 0 {
+		return turnover / float64(volume)
+	}
+	// 成交回报未到时以报单价格估算
+	return order.Price
+}
+
+// orderC2U convert the ctp order to the usr order
+func (e *CtpExchange) orderC2U(order ctpOrder) constant.Order {
+	res := constant.Order{
+		Id:         e.orderID(order),
+		Price:      order.Price,
+		Amount:     float64(order.Volume),
+		DealAmount: float64(order.Traded),
+		TradeType:  ctpTradeType(order.Direction, order.Offset),
+		StockType:  order.Instrument,
+		Status:     ctpStatus(order),
+	}
+	if order.Traded > 0 {
+		res.AvgPrice = e.avgPrice(order)
+	}
+	return res
+}
+
+// findOrder the latest report of the order
+func (e *CtpExchange) findOrder(id string) (ctpOrder, bool) {
+	var found ctpOrder
+	ok := false
+	for _, order := range e.front.GetOrderList() {
+		if e.orderID(order) != id {
+			continue
+		}
+		// 同一报单引用可能有拒单及报单编号两条记录, 以有报单编号的为准
+		if !ok || found.SysID == "" {
+			found, ok = order, true
+		}
+	}
+	return found, ok
+}
+
+// placeOrder insert an order, the open or close offset decided by the direction
+func (e *CtpExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
+	}
+	stockType := req.Symbol
+	fail := func(reason string) (string, error) {
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount,
+			method+"() error, the error number is "+reason)
+		return "", fmt.Errorf("%s() error, the error number is %s", method, reason)
+	}
+	if !e.ready() {
+		return fail("ctp not started")
+	}
+	direction := e.directionOf(req)
+	offset, ok := ctpOffsets[direction]
+	if !ok {
+		return fail("invalid direction " + direction)
+	}
+	if (offset.direction == ctpBuy) != (req.Side == constant.TradeTypeBuy) {
+		return fail(strings.ToLower(method) + " direction error:" + direction)
+	}
+	if req.ReduceOnly && offset.offset == ctpOpen {
+		return fail("reduce only order must close position")
+	}
+	if req.PostOnly || req.TimeInForce != constant.TimeInForceGTC {
+		return fail("ctp only supports GTC orders")
+	}
+	if req.Amount != math.Trunc(req.Amount) {
+		return fail(fmt.Sprintf("amount %v is not an integer of lots", req.Amount))
+	}
+	price := req.Price
+	if req.OrderType == constant.OrderTypeMarket {
+		// ctp 不支持市价单, 以涨跌停价报单
+		tick := e.front.GetMarketData(stockType)
+		if tick != nil && offset.direction == ctpBuy {
+			price = tick.UpperLimit
+		} else if tick != nil {
+			price = tick.LowerLimit
+		}
+		if price <= 0 {
+			return fail("no limit price for market order")
+		}
+	}
+	input := ctpInput{
+		Instrument: stockType,
+		Direction:  offset.direction,
+		Offset:     offset.offset,
+		Price:      price,
+		Volume:     int(req.Amount),
+	}
+	var ref int
+	if offset.offset == ctpOpen {
+		ref = e.front.OrderOpen(input)
+	} else {
+		ref = e.front.OrderClose(input)
+	}
+	if ref <= 0 {
+		return fail("insert order fail")
+	}
+	frontID, sessionID := e.front.Session()
+	id := ctpOrderID(frontID, sessionID, fmt.Sprint(ref))
+	e.mu.Lock()
+	e.pending[id] = constant.Order{
+		Id:        id,
+		Price:     price,
+		Amount:    req.Amount,
+		TradeType: direction,
+		StockType: stockType,
+		Time:      time.Now().Unix(),
+	}
+	e.mu.Unlock()
+	e.logger.Log(direction, stockType, price, req.Amount, req.Msg)
+	return id, nil
+}
+
+// getOrder get details of an order
+func (e *CtpExchange) getOrder(symbol, id string) (*constant.Order, error) {
+	if order, ok := e.findOrder(id); ok {
+		e.mu.Lock()
+		delete(e.pending, id)
+		e.mu.Unlock()
+		res := e.orderC2U(order)
+		return &res, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if order, ok := e.pending[id]; ok {
+		return &order, nil
+	}
+	return nil, ErrNotFoundOrder
+}
+
+// getOrders get all unfilled orders of the instrument
+func (e *CtpExchange) getOrders(symbol string) ([]constant.Order, error) {
+	resOrders := make([]constant.Order, 0)
+	reported := make(map[string]bool)
+	for _, order := range e.front.GetOrderList() {
+		reported[e.orderID(order)] = true
+		if order.Instrument != symbol {
+			continue
+		}
+		res := e.orderC2U(order)
+		if res.Status == constant.ORDER_UNFINISH || res.Status == constant.ORDER_PART_FINISH {
+			resOrders = append(resOrders, res)
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, order := range e.pending {
+		if reported[id] {
+			delete(e.pending, id)
+		} else if order.StockType == symbol {
+			resOrders = append(resOrders, order)
+		}
+	}
+	return resOrders, nil
+}
+
+// cancelOrder cancel an order
+func (e *CtpExchange) cancelOrder(symbol, orderID string) (bool, error) {
+	order, ok := e.findOrder(orderID)
+	if !ok || order.SysID == "" {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
+			"CancelOrder() error, the error number is not found order "+orderID)
+		return false, ErrNotFoundOrder
+	}
+	if status := ctpStatus(order); status != constant.ORDER_UNFINISH && status != constant.ORDER_PART_FINISH {
+		return false, ErrCancelOrderFinished
+	}
+	if e.front.OrderCancel(order.Instrument, strings.TrimSpace(order.SysID)) <= 0 {
+		e.logger.Log(constant.ERROR, order.Instrument, order.Price, float64(order.Volume),
+			"CancelOrder() error, the error number is cancel order fail")
+		return false, fmt.Errorf("CancelOrder() error, the error number is cancel order fail")
+	}
+	e.logger.Log(constant.TradeTypeCancel, order.Instrument, order.Price, float64(order.Volume),
+		"CancelOrder() success "+orderID)
+	return true, nil
+}
+
+// query send a query to the front and wait for the response
+func (e *CtpExchange) query(method string, req func() int) error {
+	if !e.ready() {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, method+"() error, the error number is ctp not started")
+		return fmt.Errorf("%s() error, the error number is ctp not started", method)
+	}
+	// 查询受流控限制, 失败时返回错误, 不使用上次查询的过期结果
+	err := e.call(method, func() error {
+		if ret := req(); ret != 0 {
+			return fmt.Errorf("request limit, the return code is %d", ret)
+		}
+		return nil
+	})
+	if err != nil {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, method+"() error, the error number is "+err.Error())
+		return fmt.Errorf("%s() error, the error number is :%w", method, err)
+	}
+	if ctpQueryWait > 0 {
+		time.Sleep(ctpQueryWait)
+	}
+	return nil
+}
+
+// getPosition get the long and short positions of the instrument, the today and history rows merged
+func (e *CtpExchange) getPosition(symbol string) ([]constant.Position, error) {
+	if err := e.query("GetPosition", e.front.ReqQryInvestorPosition); err != nil {
+		return nil, err
+	}
+	merged := make(map[bool]*constant.Position)
+	var cost = make(map[bool]float64)
+	for _, p := range e.front.GetInvestorPositions() {
+		if p.Instrument != symbol || p.Position == 0 {
+			continue
+		}
+		position := merged[p.Long]
+		if position == nil {
+			position = &constant.Position{StockType: symbol, TradeType: constant.TradeTypeShort}
+			if p.Long {
+				position.TradeType = constant.TradeTypeLong
+			}
+			merged[p.Long] = position
+		}
+		position.Amount += float64(p.Position)
+		position.FrozenAmount += float64(p.Frozen)
+		position.Available += float64(p.Position - p.Frozen)
+		position.Profit += p.Profit
+		cost[p.Long] += p.OpenCost * float64(p.Position)
+	}
+	positions := []constant.Position{}
+	for _, long := range []bool{true, false} {
+		if position := merged[long]; position != nil {
+			position.Price = cost[long] / position.Amount
+			positions = append(positions, *position)
+		}
+	}
+	return positions, nil
+}
+
+// getAccount get the account detail of this exchange
+func (e *CtpExchange) getAccount() (*constant.Account, error) {
+	if err := e.query("GetAccount", e.front.ReqQryTradingAccount); err != nil {
+		return nil, err
+	}
+	info, ok := e.front.GetAccountInfo()
+	if !ok {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+			"GetAccount() error, the error number is no account info")
+		return nil, fmt.Errorf("GetAccount() error, the error number is no account info")
+	}
+	sub := constant.SubAccount{
+		StockType:     "CNY",
+		AccountRights: info.Balance,
+		KeepDeposit:   info.Margin,
+		ProfitReal:    info.CloseProfit,
+		ProfitUnreal:  info.Profit,
+		Amount:        info.Available,
+		FrozenAmount:  info.Frozen,
+	}
+	if info.Balance > 0 {
+		sub.RiskRate = info.Margin / info.Balance
+	}
+	return &constant.Account{SubAccounts: map[string]constant.SubAccount{"CNY": sub}}, nil
+}
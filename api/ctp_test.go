@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// fakeCtpFront an in-memory ctp front, orders crossing the market are filled at once,
+// closing orders are checked against the today and history positions like SHFE
+type fakeCtpFront struct {
+	ticks      map[string]*ctpTick
+	orders     []ctpOrder
+	trades     []ctpTrade
+	positions  map[string]*ctpPosition // instrument_long_today
+	ref        int
+	sys        int
+	session    int
+	accountRet int // the return code of ReqQryTradingAccount
+}
+
+func newFakeCtpFront() *fakeCtpFront {
+	return &fakeCtpFront{
+		ticks:     map[string]*ctpTick{},
+		positions: map[string]*ctpPosition{},
+		session:   7,
+	}
+}
+
+func (f *fakeCtpFront) Start() error                                 { return nil }
+func (f *fakeCtpFront) SubscribeMarketData(instruments []string) int { return 0 }
+func (f *fakeCtpFront) ReqQryInvestorPosition() int                  { return 0 }
+func (f *fakeCtpFront) ReqQryTradingAccount() int                    { return f.accountRet }
+func (f *fakeCtpFront) GetMarketData(instrument string) *ctpTick     { return f.ticks[instrument] }
+func (f *fakeCtpFront) GetOrderList() []ctpOrder                     { return f.orders }
+func (f *fakeCtpFront) GetTradeList() []ctpTrade                     { return f.trades }
+func (f *fakeCtpFront) Session() (int, int)                          { return 1, f.session }
+
+func (f *fakeCtpFront) GetInvestorPositions() (positions []ctpPosition) {
+	for _, p := range f.positions {
+		positions = append(positions, *p)
+	}
+	return
+}
+
+func (f *fakeCtpFront) GetAccountInfo() (ctpAccount, bool) {
+	return ctpAccount{Balance: 100000, Available: 90000, Margin: 10000}, true
+}
+
+func (f *fakeCtpFront) position(instrument string, long, today bool) *ctpPosition {
+	key := fmt.Sprintf("%s_%v_%v", instrument, long, today)
+	if f.positions[key] == nil {
+		f.positions[key] = &ctpPosition{Instrument: instrument, Long: long}
+	}
+	return f.positions[key]
+}
+
+func (f *fakeCtpFront) insert(input ctpInput) int {
+	f.ref++
+	order := ctpOrder{FrontID: 1, SessionID: f.session, Ref: fmt.Sprint(f.ref), ExchangeID: "SHFE", Instrument: input.Instrument, Direction: input.Direction,
+		Offset: input.Offset, Price: input.Price, Volume: input.Volume, Status: ctpStatusNoTrade}
+	long := input.Direction == ctpBuy
+	if input.Offset != ctpOpen {
+		long = !long
+		held := f.position(input.Instrument, long, input.Offset == ctpCloseToday)
+		if held.Position < input.Volume {
+			// 被综合交易平台拒绝的报单只有报单引用
+			order.FrontID, order.SessionID = 0, 0
+			order.Status, order.Message = ctpStatusCanceled, "平仓量超过持仓量"
+			f.orders = append(f.orders, order)
+			return f.ref
+		}
+	}
+	f.sys++
+	order.SysID = fmt.Sprint(f.sys)
+	tick := f.ticks[input.Instrument]
+	if input.Direction == ctpBuy && input.Price >= tick.Ask || input.Direction == ctpSell && input.Price <= tick.Bid {
+		// 以对手价成交, 分两笔成交回报
+		price := tick.Ask
+		if input.Direction == ctpSell {
+			price = tick.Bid
+		}
+		order.Status, order.Traded = ctpStatusAllTraded, input.Volume
+		first := (input.Volume + 1) / 2
+		f.trades = append(f.trades, ctpTrade{ExchangeID: "SHFE", SysID: order.SysID, Price: price, Volume: first})
+		if input.Volume > first {
+			f.trades = append(f.trades, ctpTrade{ExchangeID: "SHFE", SysID: order.SysID, Price: price + 1, Volume: input.Volume - first})
+		}
+		if input.Offset == ctpOpen {
+			held := f.position(input.Instrument, long, true)
+			held.OpenCost = (held.OpenCost*float64(held.Position) + price*float64(input.Volume)) /
+				float64(held.Position+input.Volume)
+			held.Position += input.Volume
+			held.Today += input.Volume
+		} else {
+			held := f.position(input.Instrument, long, input.Offset == ctpCloseToday)
+			held.Position -= input.Volume
+		}
+	}
+	f.orders = append(f.orders, order)
+	return f.ref
+}
+
+func (f *fakeCtpFront) OrderOpen(input ctpInput) int  { return f.insert(input) }
+func (f *fakeCtpFront) OrderClose(input ctpInput) int { return f.insert(input) }
+
+func (f *fakeCtpFront) OrderCancel(instrument, orderSysID string) int {
+	for i := range f.orders {
+		if f.orders[i].SysID == orderSysID {
+			f.orders[i].Status = ctpStatusCanceled
+			return 1
+		}
+	}
+	return 0
+}
+
+func TestCtpExchange(t *testing.T) {
+	ctpQueryWait = 0
+	front := newFakeCtpFront()
+	front.ticks["rb2110"] = &ctpTick{Last: 5000, Bid: 4999, Ask: 5001, UpperLimit: 5400, LowerLimit: 4600}
+	e := newCtpExchange(constant.Option{BackLog: true}, front)
+	e.SetStockType("rb2110")
+	if _, err := e.Buy("5001", "1", ""); err == nil {
+		t.Fatalf("order before start should fail")
+	}
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	e.SetDirection(constant.TradeTypeLong)
+	if _, err := e.Sell("5001", "1", ""); err == nil {
+		t.Fatalf("sell with open long direction should fail")
+	}
+	if _, err := e.Buy("5001", "1.5", ""); err == nil {
+		t.Fatalf("fractional lots should fail")
+	}
+	id, err := e.Buy("-1", "2", "")
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if id != "1:7:1" {
+		t.Fatalf("unexpected order id %s", id)
+	}
+	// 均价按成交回报加权, 不是报单价格
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_FINISH || order.Price != 5400 ||
+		order.AvgPrice != 5001.5 || order.TradeType != constant.TradeTypeLong {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	// 今仓不能用平昨平掉
+	e.SetDirection(constant.TradeTypeLongClose)
+	id, _ = e.Sell("4999", "1", "")
+	if order, _ := e.GetOrder(id); id != "1:7:2" || order.Status != constant.ORDER_REJECT {
+		t.Fatalf("close yesterday of a today position should be rejected, got %s %+v", id, order)
+	}
+	// 请求中的方向优先于 SetDirection, 且不改变其设置
+	id, _ = e.PlaceOrder(constant.OrderRequest{Side: constant.TradeTypeSell, Price: 4999, Amount: 1,
+		Direction: constant.TradeTypeLongCloseToday})
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_FINISH || order.TradeType != constant.TradeTypeLongCloseToday {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if e.GetDirection() != constant.TradeTypeLongClose {
+		t.Fatalf("the direction of the request should not change the exchange, got %s", e.GetDirection())
+	}
+	positions, err := e.GetPosition()
+	if err != nil || len(positions) != 1 || positions[0].Amount != 1 || positions[0].TradeType != constant.TradeTypeLong {
+		t.Fatalf("unexpected positions %+v %v", positions, err)
+	}
+
+	e.SetDirection(constant.TradeTypeShort)
+	id, _ = e.Sell("5100", "3", "")
+	if orders, _ := e.GetOrders(); len(orders) != 1 || orders[0].Id != id || orders[0].TradeType != constant.TradeTypeShort {
+		t.Fatalf("unexpected open orders %+v", orders)
+	}
+	if ok, err := e.CancelOrder(id); !ok || err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_CANCEL {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if _, err := e.CancelOrder(id); err != ErrCancelOrderFinished {
+		t.Fatalf("cancel a canceled order: %v", err)
+	}
+
+	account, err := e.GetAccount()
+	if err != nil || account.SubAccounts["CNY"].AccountRights != 100000 {
+		t.Fatalf("unexpected account %+v %v", account, err)
+	}
+	// 查询失败时不使用上次的结果
+	front.accountRet = -2
+	if _, err := e.GetAccount(); err == nil {
+		t.Fatalf("failed query should return an error")
+	}
+}
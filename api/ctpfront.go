@@ -0,0 +1,204 @@
+//go:build ctp
+// +build ctp
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sdkctp "snack.com/xiyanxiyan10/stocktrader/apisdk/ctp"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func init() {
+	newCtpFront = newSdkCtpFront
+}
+
+// sdkCtpFront the ctp front of apisdk/ctp
+type sdkCtpFront struct {
+	handler sdkctp.CtpHandler
+}
+
+// fronts split the front addresses in config.ini
+func fronts(key string) []string {
+	var res []string
+	for _, front := range strings.Split(config.String(key), ",") {
+		if front = strings.TrimSpace(front); front != "" {
+			res = append(res, front)
+		}
+	}
+	return res
+}
+
+// newSdkCtpFront the investor id and password are the access key and secret key of the exchange
+func newSdkCtpFront(opt constant.Option) (ctpFront, error) {
+	mdFront, traderFront := fronts("ctpmdfront"), fronts("ctptraderfront")
+	if len(mdFront) == 0 || len(traderFront) == 0 {
+		return nil, fmt.Errorf("ctp front is not set in config.ini")
+	}
+	stream := config.String("ctpstream")
+	if stream == "" {
+		stream = "./data/ctp/"
+	}
+	// 每个投资者使用单独的流文件目录
+	stream = filepath.Join(stream, opt.AccessKey) + string(filepath.Separator)
+	if err := os.MkdirAll(stream, os.ModePerm); err != nil {
+		return nil, err
+	}
+	handler := sdkctp.NewCtp()
+	handler.SetTradeAccount(mdFront, traderFront, config.String("ctpbrokerid"), opt.AccessKey, opt.SecretKey,
+		config.String("ctpappid"), config.String("ctpauthcode"), stream)
+	return &sdkCtpFront{handler: handler}, nil
+}
+
+// Start ...
+func (f *sdkCtpFront) Start() error {
+	return f.handler.Start()
+}
+
+// SubscribeMarketData ...
+func (f *sdkCtpFront) SubscribeMarketData(instruments []string) int {
+	return f.handler.SubscribeMarketData(instruments)
+}
+
+// GetMarketData ...
+func (f *sdkCtpFront) GetMarketData(instrument string) *ctpTick {
+	data := f.handler.GetMarketData(instrument)
+	if data == nil {
+		return nil
+	}
+	return &ctpTick{
+		Last:       data.LastPrice,
+		Open:       data.OpenPrice,
+		High:       data.HighestPrice,
+		Low:        data.LowestPrice,
+		Close:      data.ClosePrice,
+		Volume:     float64(data.Volume),
+		Bid:        data.BidPrice1,
+		BidVolume:  float64(data.BidVolume1),
+		Ask:        data.AskPrice1,
+		AskVolume:  float64(data.AskVolume1),
+		UpperLimit: data.UpperLimitPrice,
+		LowerLimit: data.LowerLimitPrice,
+	}
+}
+
+// ReqQryInvestorPosition ...
+func (f *sdkCtpFront) ReqQryInvestorPosition() int {
+	return f.handler.ReqQryInvestorPosition()
+}
+
+// ReqQryTradingAccount ...
+func (f *sdkCtpFront) ReqQryTradingAccount() int {
+	return f.handler.ReqQryTradingAccount()
+}
+
+// firstByte ...
+func firstByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[0]
+}
+
+// GetOrderList ...
+func (f *sdkCtpFront) GetOrderList() []ctpOrder {
+	var orders []ctpOrder
+	for _, order := range f.handler.GetOrderList() {
+		orders = append(orders, ctpOrder{
+			FrontID:    order.FrontID,
+			SessionID:  order.SessionID,
+			Ref:        order.OrderRef,
+			ExchangeID: order.ExchangeID,
+			SysID:      strings.TrimSpace(order.OrderSysID),
+			Instrument: order.InstrumentID,
+			Direction:  firstByte(order.Direction),
+			Offset:     firstByte(order.CombOffsetFlag),
+			Price:      order.LimitPrice,
+			Volume:     order.Volume,
+			Traded:     order.VolumeTraded,
+			Status:     firstByte(order.OrderStatus),
+			Message:    order.StatusMsg,
+		})
+	}
+	return orders
+}
+
+// GetTradeList ...
+func (f *sdkCtpFront) GetTradeList() []ctpTrade {
+	var trades []ctpTrade
+	for _, trade := range f.handler.GetTradeList() {
+		trades = append(trades, ctpTrade{
+			ExchangeID: trade.ExchangeID,
+			SysID:      trade.OrderSysID,
+			Price:      trade.Price,
+			Volume:     trade.Volume,
+		})
+	}
+	return trades
+}
+
+// Session ...
+func (f *sdkCtpFront) Session() (int, int) {
+	return f.handler.GetSession()
+}
+
+// GetInvestorPositions ...
+func (f *sdkCtpFront) GetInvestorPositions() []ctpPosition {
+	var positions []ctpPosition
+	for _, p := range f.handler.GetInvestorPositions() {
+		positions = append(positions, ctpPosition{
+			Instrument: p.InstrumentID,
+			Long:       p.PosiDirection == "2",
+			Position:   p.Position,
+			Today:      p.TodayPosition,
+			Frozen:     p.ShortVolume,
+			OpenCost:   p.OpenCost,
+			Profit:     p.PositionProfit,
+		})
+	}
+	return positions
+}
+
+// GetAccountInfo ...
+func (f *sdkCtpFront) GetAccountInfo() (ctpAccount, bool) {
+	info, ok := f.handler.GetAccountInfo()
+	return ctpAccount{
+		Balance:     info.Balance,
+		Available:   info.Available,
+		Margin:      info.CurrMargin,
+		Frozen:      info.FrozenMargin + info.FrozenCash + info.FrozenCommission,
+		CloseProfit: info.CloseProfit,
+		Profit:      info.PositionProfit,
+	}, ok
+}
+
+// OrderOpen ...
+func (f *sdkCtpFront) OrderOpen(input ctpInput) int {
+	return f.handler.OrderOpen(sdkctp.InputOrderStruct{
+		InstrumentID: input.Instrument,
+		Direction:    input.Direction,
+		Price:        input.Price,
+		Volume:       input.Volume,
+	})
+}
+
+// OrderClose ...
+func (f *sdkCtpFront) OrderClose(input ctpInput) int {
+	return f.handler.OrderClose(sdkctp.InputOrderStruct{
+		InstrumentID:   input.Instrument,
+		Direction:      input.Direction,
+		Price:          input.Price,
+		Volume:         input.Volume,
+		CombOffsetFlag: input.Offset,
+	})
+}
+
+// OrderCancel ...
+func (f *sdkCtpFront) OrderCancel(instrument, orderSysID string) int {
+	return f.handler.OrderCancel(instrument, orderSysID)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// fillNotifier an exchange pushing its executions, e.g. the backtest exchanges
+type fillNotifier interface {
+	SetFillHandler(handler func(constant.Fill))
+}
+
+// emitFill call the handler with the execution of the order
+func emitFill(handler func(constant.Fill), ord constant.Order, price, amount, fee float64, at int64) {
+	if handler == nil || amount <= 0 {
+		return
+	}
+	handler(constant.Fill{
+		OrderID:   ord.Id,
+		ClientID:  ord.ClientID,
+		StockType: ord.StockType,
+		Side:      ord.TradeType,
+		Price:     price,
+		Amount:    amount,
+		Fee:       fee,
+		Time:      at,
+	})
+}
+
+// inferFill the execution between two queries of the order, for the exchanges not pushing fills
+func inferFill(last model.Order, ord constant.Order) (fill constant.Fill, ok bool) {
+	amount := ord.DealAmount - last.DealAmount
+	if amount <= 0 {
+		return
+	}
+	price := ord.Price
+	if ord.AvgPrice > 0 {
+		// 由前后两次的成交均价推算本次成交价
+		price = (ord.AvgPrice*ord.DealAmount - last.AvgPrice*last.DealAmount) / amount
+	}
+	fee := ord.Fee - last.Fee
+	if fee < 0 {
+		fee = 0
+	}
+	return constant.Fill{
+		OrderID:   ord.Id,
+		ClientID:  last.ClientID,
+		StockType: last.StockType,
+		Side:      last.Side,
+		Price:     price,
+		Amount:    amount,
+		Fee:       fee,
+		Time:      time.Now().UnixNano() / int64(time.Millisecond),
+	}, true
+}
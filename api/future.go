@@ -22,12 +22,13 @@ type FutureExchange struct {
 	tradeTypeMap        map[int]string
 	tradeTypeMapReverse map[string]int
 	exchangeTypeMap     map[string]string
+	contractTypeMap     map[string]string // 合约别名 -> goex 合约类型, 空键为默认合约
 
 	apiBuilder *builder.APIBuilder
 	api        goex.FutureRestAPI
 }
 
-func (e *FutureExchange) orderA2U(orders []goex.FutureOrder) []constant.Order {
+func (e *FutureExchange) orderA2U(symbol string, orders []goex.FutureOrder) []constant.Order {
 	resOrders := make([]constant.Order, 0)
 	for _, order := range orders {
 		resOrder := constant.Order{
@@ -36,7 +37,7 @@ func (e *FutureExchange) orderA2U(orders []goex.FutureOrder) []constant.Order {
 			Amount:     order.Amount,
 			DealAmount: order.DealAmount,
 			TradeType:  e.tradeTypeMap[order.OType],
-			StockType:  e.GetStockType(),
+			StockType:  symbol,
 		}
 		resOrders = append(resOrders, resOrder)
 	}
@@ -97,7 +98,7 @@ func (e *FutureExchange) positionA2U(positions []goex.FuturePosition) []constant
 }
 
 // depthA2U utilt api depth to usr depth
-func (e *FutureExchange) depthA2U(depth *goex.Depth) *constant.Depth {
+func (e *FutureExchange) depthA2U(symbol string, depth *goex.Depth) *constant.Depth {
 	var resDepth constant.Depth
 	resDepth.Time = depth.UTime.Unix()
 	for _, ask := range depth.AskList {
@@ -113,7 +114,7 @@ func (e *FutureExchange) depthA2U(depth *goex.Depth) *constant.Depth {
 		resDepth.Bids = append(resDepth.Bids, resBid)
 	}
 	resDepth.ContractType = depth.ContractType
-	resDepth.StockType = e.GetStockType()
+	resDepth.StockType = symbol
 	return &resDepth
 }
 
@@ -127,6 +128,25 @@ func (e *FutureExchange) GetStockTypeMap() map[string]goex.CurrencyPair {
 	return e.stockTypeMap
 }
 
+// SetContractTypeMap set the contract types supported, the contract of the empty key is the default
+func (e *FutureExchange) SetContractTypeMap(m map[string]string) {
+	e.contractTypeMap = m
+}
+
+// getSymbol split the symbol and the contract, the contract mapped by the contract type map
+func (e *FutureExchange) getSymbol(stockType string) (string, string) {
+	symbol, contract := e.BaseExchange.getSymbol(stockType)
+	if len(e.contractTypeMap) == 0 {
+		return symbol, contract
+	}
+	exchangeContract, ok := e.contractTypeMap[contract]
+	if !ok {
+		// 不支持的合约按不支持的品种处理
+		return "", contract
+	}
+	return symbol, exchangeContract
+}
+
 // SetTradeTypeMap ...
 func (e *FutureExchange) SetTradeTypeMap(key int, val string) {
 	e.tradeTypeMap[key] = val
@@ -152,8 +172,11 @@ func NewFutureExchange(opt constant.Option) *FutureExchange {
 			goex.CLOSE_SELL: constant.TradeTypeShortClose,
 		},
 		exchangeTypeMap: map[string]string{
-			constant.HuoBiDm: goex.HBDM,
-			constant.HuoBi:   goex.HUOBI_PRO,
+			constant.HuoBiDm:    goex.HBDM,
+			constant.HuoBi:      goex.HUOBI_PRO,
+			constant.OKExFuture: goex.OKEX_FUTURE,
+			constant.OKExSwap:   goex.OKEX_SWAP,
+			constant.Bitmex:     goex.BITMEX,
 		},
 		//apiBuilder: builder.NewAPIBuilder().HttpTimeout(5 * time.Second),
 	}
@@ -195,8 +218,9 @@ func (e *FutureExchange) start() error {
 		return fmt.Errorf("build api error")
 	}
 	exchangeName := e.exchangeTypeMap[e.option.Type]
+	secretKey, passphrase := apiSecret(e.option)
 	e.api = e.apiBuilder.APIKey(e.option.AccessKey).
-		APISecretkey(e.option.SecretKey).BuildFuture(exchangeName)
+		APISecretkey(secretKey).ApiPassphrase(passphrase).BuildFuture(exchangeName)
 	return nil
 }
 
@@ -217,17 +241,21 @@ func (e *FutureExchange) getDepth(stockType string) (*constant.Depth, error) {
 	symbol, contract := e.getSymbol(stockType)
 	exchangeStockType, ok := e.stockTypeMap[symbol]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0,
 			"GetDepth() error, the error number is stockType")
 		return nil, fmt.Errorf("GetDepth() error, the error number is stockType")
 	}
-	depth, err := e.api.GetFutureDepth(exchangeStockType, contract, constant.DepthSize)
+	var depth *goex.Depth
+	err := e.call("GetDepth", func() (err error) {
+		depth, err = e.api.GetFutureDepth(exchangeStockType, contract, constant.DepthSize)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0,
 			"GetDepth() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetDepth() error, the error number is %s", err.Error())
+		return nil, fmt.Errorf("GetDepth() error, the error number is %w", err)
 	}
-	resDepth := e.depthA2U(depth)
+	resDepth := e.depthA2U(stockType, depth)
 	return resDepth, nil
 }
 
@@ -240,11 +268,15 @@ func (e *FutureExchange) getPosition(stockType string) ([]constant.Position, err
 			"getPosition() error, the error number is stockType")
 		return nil, fmt.Errorf("GetPosition() error, the error number is stockType")
 	}
-	positions, err := e.api.GetFuturePosition(exchangeStockType, contract)
+	var positions []goex.FuturePosition
+	err := e.call("GetPosition", func() (err error) {
+		positions, err = e.api.GetFuturePosition(exchangeStockType, contract)
+		return
+	})
 	if err != nil {
 		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0,
 			"getPosition() error, the error number is "+err.Error())
-		return nil, fmt.Errorf("GetPosition() error, the error number is " + err.Error())
+		return nil, fmt.Errorf("GetPosition() error, the error number is %w", err)
 	}
 	resPosition := e.positionA2U(positions)
 	return resPosition, nil
@@ -252,11 +284,15 @@ func (e *FutureExchange) getPosition(stockType string) ([]constant.Position, err
 
 // GetAccount get the account detail of this exchange
 func (e *FutureExchange) getAccount() (*constant.Account, error) {
-	account, err := e.api.GetFutureUserinfo()
+	var account *goex.FutureAccount
+	err := e.call("GetAccount", func() (err error) {
+		account, err = e.api.GetFutureUserinfo()
+		return
+	})
 	if err != nil {
 		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
 			"GetAccount() error, the error number is "+err.Error())
-		return nil, fmt.Errorf("GetAccount() error, the error number is :" + err.Error())
+		return nil, fmt.Errorf("GetAccount() error, the error number is :%w", err)
 	}
 	var resAccount constant.Account
 	resAccount.SubAccounts = make(map[string]constant.SubAccount)
@@ -273,77 +309,57 @@ func (e *FutureExchange) getAccount() (*constant.Account, error) {
 	return &resAccount, nil
 }
 
-// Buy buy from exchange
-func (e *FutureExchange) buy(price, amount string, msg string) (string, error) {
-	var err error
-	var openType int
-	stockType := e.GetStockType()
-	stockType, contract := e.getSymbol(stockType)
-	exchangeStockType, ok := e.stockTypeMap[stockType]
-	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Buy() error, the error number is stockType")
-		return "", fmt.Errorf("Buy() error, the error number is stockType")
-	}
-	if err := e.ValidBuy(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Buy() error, the error number is %s", err.Error())
-		return "", fmt.Errorf("Buy() error, the error number is %s", err.Error())
-	}
-	level := e.GetMarginLevel()
-	var matchPrice = 0
-	if price == "-1" {
-		matchPrice = 1
-	}
-	openType = e.tradeTypeMapReverse[e.GetDirection()]
-	orderID, err := e.api.PlaceFutureOrder(exchangeStockType, contract,
-		price, amount, openType, matchPrice, level)
-
-	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Sell() error, the error number is %s", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
+// placeOrder place an order to the exchange
+func (e *FutureExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
 	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
-	return orderID, nil
-}
-
-// Sell sell from exchange
-func (e *FutureExchange) sell(price, amount string, msg string) (string, error) {
-	var err error
-	var openType int
-	stockType := e.GetStockType()
-	stockType, contract := e.getSymbol(stockType)
+	stockType, contract := e.getSymbol(req.Symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Sell() error, the error number is stockType")
-		return "", fmt.Errorf("Sell() error, the error number is stockType")
-	}
-	if err := e.ValidSell(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Sell() error, the error number is %s", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
-	}
-	level := e.GetMarginLevel()
-	var matchPrice = 0
-	if price == "-1" {
-		matchPrice = 1
-	}
-	openType = e.tradeTypeMapReverse[e.GetDirection()]
-	orderID, err := e.api.PlaceFutureOrder(exchangeStockType, contract,
-		price, amount, openType, matchPrice, level)
-
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is stockType")
+		return "", fmt.Errorf("%s() error, the error number is stockType", method)
+	}
+	direction := e.directionOf(req)
+	if err := validDirection(req.Side, direction); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %s", method, err.Error())
+	}
+	if req.ReduceOnly && direction != constant.TradeTypeLongClose && direction != constant.TradeTypeShortClose {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is reduce only order must close position")
+		return "", fmt.Errorf("%s() error, the error number is reduce only order must close position", method)
+	}
+	level := e.marginLevelOf(req)
+	openType := e.tradeTypeMapReverse[direction]
+	var orderID string
+	err := e.call("PlaceOrder", func() (err error) {
+		if opts := limitOptions(req); req.OrderType == constant.OrderTypeLimit && len(opts) > 0 {
+			var order *goex.FutureOrder
+			order, err = e.api.LimitFuturesOrder(exchangeStockType, contract,
+				orderPrice(req), orderAmount(req), openType, opts...)
+			if err == nil {
+				orderID = order.OrderID2
+			}
+			return
+		}
+		var matchPrice = 0
+		if req.OrderType == constant.OrderTypeMarket {
+			matchPrice = 1
+		}
+		orderID, err = e.api.PlaceFutureOrder(exchangeStockType, contract,
+			orderPrice(req), orderAmount(req), openType, matchPrice, level)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Sell() error, the error number is %s", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %w", method, err)
 	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
+	e.logger.Log(direction, req.Symbol, req.Price, req.Amount, req.Msg)
 	return orderID, nil
 }
 
@@ -352,15 +368,19 @@ func (e *FutureExchange) getOrder(symbol, id string) (*constant.Order, error) {
 	stockType, contract := e.getSymbol(symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0, util.Float64Must(id),
+		e.logger.Log(constant.ERROR, symbol, 0, util.Float64Must(id),
 			"GetOrder() error, the error number is stockType")
 		return nil, fmt.Errorf("GetOrder() error, the error number is stockType")
 	}
-	orders, err := e.api.GetUnfinishFutureOrders(exchangeStockType, contract)
+	var orders []goex.FutureOrder
+	err := e.call("GetOrder", func() (err error) {
+		orders, err = e.api.GetUnfinishFutureOrders(exchangeStockType, contract)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(id),
+		e.logger.Log(constant.ERROR, symbol, 0.0, util.Float64Must(id),
 			"GetOrder() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetOrder() error, the error number is %s", err.Error())
+		return nil, fmt.Errorf("GetOrder() error, the error number is %w", err)
 	}
 	for _, order := range orders {
 		if id != order.OrderID2 {
@@ -372,7 +392,7 @@ func (e *FutureExchange) getOrder(symbol, id string) (*constant.Order, error) {
 			Amount:     order.Amount,
 			DealAmount: order.DealAmount,
 			TradeType:  e.tradeTypeMap[order.OType],
-			StockType:  e.GetStockType(),
+			StockType:  symbol,
 		}, nil
 	}
 	return nil, fmt.Errorf("GetOrder() error, the error number is not found")
@@ -383,60 +403,103 @@ func (e *FutureExchange) getOrders(symbol string) ([]constant.Order, error) {
 	stockType, contract := e.getSymbol(symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, "", 0, 0, "GetOrders() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, symbol, 0, 0, "GetOrders() error, the error number is stockType")
 		return nil, fmt.Errorf("GetOrders() error, the error number is stockType")
 	}
-	orders, err := e.api.GetUnfinishFutureOrders(exchangeStockType, contract)
+	var orders []goex.FutureOrder
+	err := e.call("GetOrders", func() (err error) {
+		orders, err = e.api.GetUnfinishFutureOrders(exchangeStockType, contract)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
 			"GetOrders() error, the error number is "+err.Error())
-		return nil, fmt.Errorf("GetOrders() error, the error number is " + err.Error())
+		return nil, fmt.Errorf("GetOrders() error, the error number is %w", err)
 	}
-	resOrders := e.orderA2U(orders)
+	resOrders := e.orderA2U(symbol, orders)
 	return resOrders, nil
 }
 
 // CancelOrder cancel an order
-func (e *FutureExchange) cancelOrder(orderID string) (bool, error) {
-	stockType := e.GetStockType()
-	stockType, contract := e.getSymbol(stockType)
+func (e *FutureExchange) cancelOrder(symbol, orderID string) (bool, error) {
+	stockType, contract := e.getSymbol(symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0, util.Float64Must(orderID),
+		e.logger.Log(constant.ERROR, symbol, 0, util.Float64Must(orderID),
 			"CancelOrder() error, the error number is stockType")
 		return false, fmt.Errorf("CancelOrder() error, the error number is stockType")
 	}
-	result, err := e.api.FutureCancelOrder(exchangeStockType, contract, orderID)
+	var result bool
+	err := e.call("CancelOrder", func() (err error) {
+		result, err = e.api.FutureCancelOrder(exchangeStockType, contract, orderID)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(orderID),
+		e.logger.Log(constant.ERROR, symbol, 0.0, util.Float64Must(orderID),
 			"CancelOrder() error, the error number is ", err.Error())
-		return false, fmt.Errorf("CancelOrder() error, the error number is %s", err.Error())
+		return false, fmt.Errorf("CancelOrder() error, the error number is %w", err)
 	}
 	if !result {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(orderID),
+		e.logger.Log(constant.ERROR, symbol, 0.0, util.Float64Must(orderID),
 			"CancelOrder() error, the error number is false")
 		return result, fmt.Errorf("CancelOrder() error, the error number is false")
 	}
-	e.logger.Log(constant.TradeTypeCancel, e.GetStockType(), 0, util.Float64Must(orderID),
+	e.logger.Log(constant.TradeTypeCancel, symbol, 0, util.Float64Must(orderID),
 		"CancelOrder() success")
 	return result, nil
 }
 
 // getTicker get market ticker
 func (e *FutureExchange) getTicker(symbol string) (*constant.Ticker, error) {
-	stockType := e.GetStockType()
-	stockType, contract := e.getSymbol(stockType)
+	stockType, contract := e.getSymbol(symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, "", 0, 0, "GetTicker() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, symbol, 0, 0, "GetTicker() error, the error number is stockType")
 		return nil, fmt.Errorf("GetTicker() error, the error number is stockType")
 	}
-	exTicker, err := e.api.GetFutureTicker(exchangeStockType, contract)
+	var exTicker *goex.Ticker
+	err := e.call("GetTicker", func() (err error) {
+		exTicker, err = e.api.GetFutureTicker(exchangeStockType, contract)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
 			"GetTicker() error, the error number is "+err.Error())
-		return nil, fmt.Errorf("GetTicker() error, the error number is " + err.Error())
+		return nil, fmt.Errorf("GetTicker() error, the error number is %w", err)
 	}
 	ticker := e.tickerA2U(exTicker)
 	return ticker, nil
 }
+
+// getRecords get the klines of the symbol by the period and the size set
+func (e *FutureExchange) getRecords(symbol string) ([]constant.Record, error) {
+	stockType, contract := e.getSymbol(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
+	if !ok {
+		e.logger.Log(constant.ERROR, symbol, 0, 0, "GetRecords() error, the error number is stockType")
+		return nil, fmt.Errorf("GetRecords() error, the error number is stockType")
+	}
+	period, ok := e.GetRecordsPeriodMap()[e.GetPeriod()]
+	if !ok {
+		e.logger.Log(constant.ERROR, symbol, 0, 0, "GetRecords() error, the error number is invalid period "+e.GetPeriod())
+		return nil, fmt.Errorf("GetRecords() error, the error number is invalid period %s", e.GetPeriod())
+	}
+	var klines []goex.FutureKline
+	err := e.call("GetRecords", func() (err error) {
+		klines, err = e.api.GetKlineRecords(contract, exchangeStockType, goex.KlinePeriod(period), e.GetPeriodSize())
+		return
+	})
+	if err != nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
+			"GetRecords() error, the error number is "+err.Error())
+		return nil, fmt.Errorf("GetRecords() error, the error number is %w", err)
+	}
+	records := make([]constant.Record, 0, len(klines))
+	for _, kline := range klines {
+		if kline.Kline == nil {
+			continue
+		}
+		records = append(records, klineA2U([]goex.Kline{*kline.Kline})...)
+	}
+	return records, nil
+}
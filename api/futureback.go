@@ -51,6 +51,7 @@ type ExchangeFutureBack struct {
 	sortedCurrencies     constant.Account
 	longPosition         map[string]constant.Position // 多仓
 	shortPosition        map[string]constant.Position // 空仓
+	onFill               func(constant.Fill)
 }
 
 // NewExchangeFutureBack2Config ...
@@ -85,15 +86,20 @@ func NewExchangeFutureBack(config ExchangeBackConfig) *ExchangeFutureBack {
 
 // Debug ..,
 func (e *ExchangeFutureBack) Debug() error {
+	return e.debug(e.GetStockType())
+}
+
+// debug print the state of the backtest around the symbol
+func (e *ExchangeFutureBack) debug(stockType string) error {
 	log.Infof("---FutureBack info start---\n")
 	log.Infof("currTicker:\n")
-	v, err := json.Marshal(e.currData[e.stockType])
+	v, err := json.Marshal(e.currData[stockType])
 	if err != nil {
 		log.Infof("utilt ticker err :%s\n", err.Error())
 		return err
 	}
 	log.Infof("%s\n", string(v))
-	marginRatio, lft, rht := e.marginRatio()
+	marginRatio, lft, rht := e.marginRatio(stockType)
 	log.Infof("marginRatio %f lft %f  rht %f\n", marginRatio, lft, rht)
 	log.Infof("longPosition:\n")
 	v, err = json.Marshal(e.longPosition)
@@ -155,6 +161,7 @@ func (e *ExchangeFutureBack) Start() error {
 	e.pendingOrders = make(map[string]*constant.Order, 0)
 	e.finishedOrders = make(map[string]*constant.Order, 0)
 	e.dataLoader = make(map[string]*DataLoader, 0)
+	e.currData = make(map[string]constant.OHLC, 0)
 	e.longPosition = make(map[string]constant.Position, 0)
 	e.shortPosition = make(map[string]constant.Position, 0)
 
@@ -174,6 +181,10 @@ func (e *ExchangeFutureBack) Start() error {
 		e.dataLoader[name] = new(DataLoader)
 		e.dataLoader[name].Load(ohlcs)
 	}
+	// 未设置合约价值时使用品种的合约乘数
+	if e.contractRate == 0 && len(e.option.WatchList) > 0 {
+		e.contractRate = e.GetInstrument(e.option.WatchList[0]).Multiplier
+	}
 	currencyMap := e.BaseExchange.currencyMap
 	for key, val := range currencyMap {
 		var sub constant.SubAccount
@@ -245,6 +256,12 @@ func (ex *ExchangeFutureBack) fillOrder(isTaker bool, amount, price float64, ord
 	ord.Fee += tradeFee
 
 	ex.unFrozenAsset(tradeFee, dealAmount, price, *ord)
+	emitFill(ex.onFill, *ord, price, dealAmount, tradeFee, ord.FinishedTime)
+}
+
+// SetFillHandler set the handler called on every execution
+func (ex *ExchangeFutureBack) SetFillHandler(handler func(constant.Fill)) {
+	ex.onFill = handler
 }
 
 func (ex *ExchangeFutureBack) matchOrder(ord *constant.Order, isTaker bool) {
@@ -280,11 +297,11 @@ func (ex *ExchangeFutureBack) match() {
 func (ex *ExchangeFutureBack) coverPosition(stockType string) {
 	stocks := stockPair2Vec(stockType)
 	CurrencyA := stocks[0]
-	marginRatio, _, rht := ex.marginRatio()
+	marginRatio, _, rht := ex.marginRatio(stockType)
 	if marginRatio < 0 || rht > 0.0 && marginRatio < ex.coverRate {
 
 		log.Infof("force cover %f -> %f\n", marginRatio, ex.coverRate)
-		ex.Debug()
+		ex.debug(stockType)
 		//Force cover position
 		ex.longPosition[CurrencyA] = constant.Position{}
 		ex.shortPosition[CurrencyA] = constant.Position{}
@@ -304,8 +321,7 @@ func (ex *ExchangeFutureBack) coverPosition(stockType string) {
 	}
 }
 
-func (ex *ExchangeFutureBack) marginRatio() (float64, float64, float64) {
-	stockType := ex.BaseExchange.GetStockType()
+func (ex *ExchangeFutureBack) marginRatio(stockType string) (float64, float64, float64) {
 	stocks := stockPair2Vec(stockType)
 	CurrencyA := stocks[0]
 	asset := ex.acc.SubAccounts[CurrencyA]
@@ -315,52 +331,33 @@ func (ex *ExchangeFutureBack) marginRatio() (float64, float64, float64) {
 	rht := 0.0
 	rht = rht + util.SafefloatDivide(longposition.Amount*ex.BaseExchange.contractRate, longposition.Price)
 	rht = rht + util.SafefloatDivide(shortposition.Amount*ex.BaseExchange.contractRate, shortposition.Price)
-	rht = rht + asset.FrozenAmount*ex.lever
+	rht = rht + asset.FrozenAmount*ex.GetMarginLevel()
 	return util.SafefloatDivide(lft, rht), lft, rht
 }
 
 // LimitBuy ...
 func (ex *ExchangeFutureBack) LimitBuy(amount, price, currency string) (*constant.Order, error) {
-	ex.Lock()
-	defer ex.Unlock()
-
-	ord := constant.Order{
-		Price:     goex.ToFloat64(price),
-		Amount:    goex.ToFloat64(amount),
-		Id:        ex.idGen.Get(),
-		Time:      ex.currData[currency].Time / int64(time.Millisecond),
-		Status:    constant.ORDER_UNFINISH,
-		StockType: currency,
-		TradeType: ex.BaseExchange.GetDirection(),
-	}
-
-	err := ex.frozenAsset(ord)
-	if err != nil {
-		return nil, err
-	}
-
-	ex.pendingOrders[ord.Id] = &ord
-	ex.matchOrder(&ord, true)
-
-	var result constant.Order
-	util.DeepCopyStruct(ord, &result)
-	return &result, nil
+	return ex.limitOrder(amount, price, currency, ex.BaseExchange.GetDirection())
 }
 
 // LimitSell ...
 func (ex *ExchangeFutureBack) LimitSell(amount, price, currency string) (*constant.Order, error) {
+	return ex.limitOrder(amount, price, currency, ex.BaseExchange.GetDirection())
+}
+
+// limitOrder place a limit order, buy or sell decided by the direction
+func (ex *ExchangeFutureBack) limitOrder(amount, price, currency, direction string) (*constant.Order, error) {
 	ex.Lock()
 	defer ex.Unlock()
 
 	ord := constant.Order{
-		Price: goex.ToFloat64(price),
-		//OpenPrice: ex.currData.Close,
+		Price:     goex.ToFloat64(price),
 		Amount:    goex.ToFloat64(amount),
 		Id:        ex.idGen.Get(),
 		Time:      ex.currData[currency].Time / int64(time.Millisecond),
 		Status:    constant.ORDER_UNFINISH,
 		StockType: currency,
-		TradeType: ex.BaseExchange.GetDirection(),
+		TradeType: direction,
 	}
 
 	err := ex.frozenAsset(ord)
@@ -369,12 +366,10 @@ func (ex *ExchangeFutureBack) LimitSell(amount, price, currency string) (*consta
 	}
 
 	ex.pendingOrders[ord.Id] = &ord
-
 	ex.matchOrder(&ord, true)
 
 	var result constant.Order
 	util.DeepCopyStruct(ord, &result)
-
 	return &result, nil
 }
 
@@ -413,6 +408,18 @@ func (ex *ExchangeFutureBack) CancelOrder(orderID string, currency string) (bool
 	return true, nil
 }
 
+// setClientID bind the client order id to the order
+func (ex *ExchangeFutureBack) setClientID(orderID, clientID string) {
+	ex.Lock()
+	defer ex.Unlock()
+	if ord := ex.pendingOrders[orderID]; ord != nil {
+		ord.ClientID = clientID
+	}
+	if ord := ex.finishedOrders[orderID]; ord != nil {
+		ord.ClientID = clientID
+	}
+}
+
 // GetOneOrder ...
 func (ex *ExchangeFutureBack) GetOneOrder(orderID, currency string) (*constant.Order, error) {
 	ex.RLock()
@@ -494,6 +501,7 @@ func (ex *ExchangeFutureBack) GetTicker(currency string) (*constant.Ticker, erro
 			return nil, nil
 		}
 		ex.currData[currency] = *curr
+		ohlc = curr
 		ex.match()
 		ex.settlePosition(currency)
 		ex.coverPosition(currency)
@@ -516,6 +524,34 @@ func (ex *ExchangeFutureBack) GetTicker(currency string) (*constant.Ticker, erro
 	}, nil
 }
 
+// GetRecords the records of the currency fed so far
+func (ex *ExchangeFutureBack) GetRecords(currency string, size int) ([]constant.Record, error) {
+	loader := ex.dataLoader[currency]
+	if loader == nil {
+		return nil, errors.New("loader not found")
+	}
+	return loader.Records(size), nil
+}
+
+// GetPosition the long and short positions of the currency
+func (ex *ExchangeFutureBack) GetPosition(currency string) ([]constant.Position, error) {
+	ex.RLock()
+	defer ex.RUnlock()
+	CurrencyA := stockPair2Vec(currency)[0]
+	positions := []constant.Position{}
+	if position, ok := ex.longPosition[CurrencyA]; ok && position.Amount+position.FrozenAmount > 0 {
+		position.StockType = currency
+		position.TradeType = constant.TradeTypeLong
+		positions = append(positions, position)
+	}
+	if position, ok := ex.shortPosition[CurrencyA]; ok && position.Amount+position.FrozenAmount > 0 {
+		position.StockType = currency
+		position.TradeType = constant.TradeTypeShort
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
 // GetDepth ...
 func (ex *ExchangeFutureBack) GetDepth(size int, currency string) (*constant.Depth, error) {
 	return nil, fmt.Errorf("not support")
@@ -544,7 +580,7 @@ func (ex *ExchangeFutureBack) frozenAsset(order constant.Order) error {
 	if shortposition.Profit < 0 {
 		avaAmount += shortposition.Profit
 	}
-	lever := ex.BaseExchange.lever
+	lever := ex.BaseExchange.GetMarginLevel()
 	switch order.TradeType {
 	case constant.TradeTypeLong, constant.TradeTypeShort:
 		if avaAmount*lever*price < order.Amount*ex.BaseExchange.contractRate {
@@ -587,7 +623,7 @@ func (ex *ExchangeFutureBack) unFrozenAsset(fee, matchAmount, matchPrice float64
 	stocks := stockPair2Vec(stockType)
 	CurrencyA := stocks[0]
 	assetA := ex.acc.SubAccounts[CurrencyA]
-	lever := ex.BaseExchange.lever
+	lever := ex.BaseExchange.GetMarginLevel()
 	switch order.TradeType {
 	case constant.TradeTypeLong, constant.TradeTypeShort:
 		order.OpenPrice = ex.currData[order.StockType].Close
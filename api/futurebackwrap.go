@@ -1,6 +1,8 @@
 package api
 
 import (
+	"fmt"
+
 	"snack.com/xiyanxiyan10/stocktrader/constant"
 	"snack.com/xiyanxiyan10/stocktrader/util"
 )
@@ -34,10 +36,15 @@ func NewExchangeFutureBackWrap(opt constant.Option) *ExchangeFutureBackWrap {
 
 // GetDepth get depth from exchange
 func (e *ExchangeFutureBackWrap) GetDepth() (*constant.Depth, error) {
-	stockType := e.GetStockType()
+	return e.GetDepthOf(e.GetStockType())
+}
+
+// GetDepthOf get the depth of the symbol
+func (e *ExchangeFutureBackWrap) GetDepthOf(symbol string) (*constant.Depth, error) {
+	stockType := e.symbolOf(symbol)
 	depth, err := e.ExchangeFutureBack.GetDepth(constant.DepthSize, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetDepth() error, the error number is stockType")
 		return nil, nil
 	}
 	return depth, nil
@@ -45,7 +52,12 @@ func (e *ExchangeFutureBackWrap) GetDepth() (*constant.Depth, error) {
 
 // GetPosition get position from exchange
 func (e *ExchangeFutureBackWrap) GetPosition() ([]constant.Position, error) {
-	return nil, nil
+	return e.GetPositionOf(e.GetStockType())
+}
+
+// GetPositionOf get the positions of the symbol
+func (e *ExchangeFutureBackWrap) GetPositionOf(symbol string) ([]constant.Position, error) {
+	return e.ExchangeFutureBack.GetPosition(e.symbolOf(symbol))
 }
 
 // GetMinAmount get the min trade amount of this exchange
@@ -65,85 +77,80 @@ func (e *ExchangeFutureBackWrap) GetAccount() (*constant.Account, error) {
 
 // Buy buy from exchange
 func (e *ExchangeFutureBackWrap) Buy(price, amount string, msg string) (string, error) {
-	var err error
-	var ord *constant.Order
-	stockType := e.GetStockType()
-	if err := e.ValidBuy(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(),
-			util.Float64Must(amount), util.Float64Must(amount),
-			"Buy() error, the error number is ", err.Error())
-		return "", nil
-	}
-	if e.ExchangeFutureBack.GetDirection() == constant.TradeTypeLong {
-		if price == "-1" {
-			ord, err = e.ExchangeFutureBack.MarketBuy(amount, price, stockType)
-		} else {
-			ord, err = e.ExchangeFutureBack.LimitBuy(amount, price, stockType)
-		}
-	}
+	return placeString(e, constant.TradeTypeBuy, price, amount, msg)
+}
 
-	if e.ExchangeFutureBack.GetDirection() == constant.TradeTypeShortClose {
-		if price == "-1" {
-			ord, err = e.ExchangeFutureBack.MarketSell(amount, price, stockType)
-		} else {
-			ord, err = e.ExchangeFutureBack.LimitSell(amount, price, stockType)
-		}
-	}
+// Sell sell from exchange
+func (e *ExchangeFutureBackWrap) Sell(price, amount string, msg string) (string, error) {
+	return placeString(e, constant.TradeTypeSell, price, amount, msg)
+}
 
-	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Buy() error, the error number is ", err.Error())
-		return "", nil
-	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
-	return ord.Id, nil
+// PlaceOrder ...
+func (e *ExchangeFutureBackWrap) PlaceOrder(req constant.OrderRequest) (string, error) {
+	return e.submitOrder(nil, req, e.placeOrder)
+}
 
+// GetOrderByClientID get the order placed with the client order id
+func (e *ExchangeFutureBackWrap) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	return e.orderByClientID(e.GetOrderOf, clientID)
 }
 
-// Sell sell from exchange
-func (e *ExchangeFutureBackWrap) Sell(price, amount string, msg string) (string, error) {
-	var err error
-	var ord *constant.Order
-	stockType := e.GetStockType()
-	if err := e.ValidSell(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Sell() error, the error number is ", err.Error())
-		return "", nil
+// placeOrder ...
+func (e *ExchangeFutureBackWrap) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
 	}
-	if e.ExchangeFutureBack.GetDirection() == constant.TradeTypeShort {
-		if price == "-1" {
-			ord, err = e.ExchangeFutureBack.MarketSell(amount, price, stockType)
-		} else {
-			ord, err = e.ExchangeFutureBack.LimitSell(amount, price, stockType)
-		}
+	if err := e.prepareOrder(&req); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+		return "", err
 	}
-
-	if e.ExchangeFutureBack.GetDirection() == constant.TradeTypeLongClose {
-		if price == "-1" {
-			ord, err = e.ExchangeFutureBack.MarketBuy(amount, price, stockType)
-		} else {
-			ord, err = e.ExchangeFutureBack.LimitBuy(amount, price, stockType)
-		}
+	var err error
+	var ord *constant.Order
+	stockType := req.Symbol
+	direction := e.directionOf(req)
+	if err := validDirection(req.Side, direction); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %s", method, err.Error())
+	}
+	if req.ReduceOnly && direction != constant.TradeTypeLongClose && direction != constant.TradeTypeShortClose {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is reduce only order must close position")
+		return "", fmt.Errorf("%s() error, the error number is reduce only order must close position", method)
+	}
+	// 开多及平空为买入, 开空及平多为卖出
+	buy := direction == constant.TradeTypeLong || direction == constant.TradeTypeShortClose
+	price, amount := orderPrice(req), orderAmount(req)
+	switch {
+	case req.OrderType == constant.OrderTypeMarket && buy:
+		ord, err = e.ExchangeFutureBack.MarketBuy(amount, price, stockType)
+	case req.OrderType == constant.OrderTypeMarket:
+		ord, err = e.ExchangeFutureBack.MarketSell(amount, price, stockType)
+	default:
+		ord, err = e.ExchangeFutureBack.limitOrder(amount, price, stockType, direction)
 	}
-
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount),
-			util.Float64Must(amount), "Buy() error, the error number is ", err.Error())
-		return "", nil
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount,
+			method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %s", method, err.Error())
 	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
+	e.logger.Log(direction, stockType, req.Price, req.Amount, req.Msg)
+	e.ExchangeFutureBack.setClientID(ord.Id, req.ClientOrderID)
 	return ord.Id, nil
 }
 
 // GetOrder get detail of an order
 func (e *ExchangeFutureBackWrap) GetOrder(id string) (*constant.Order, error) {
-	order, err := e.ExchangeFutureBack.GetOneOrder(id, e.GetStockType())
+	return e.GetOrderOf(e.GetStockType(), id)
+}
+
+// GetOrderOf get detail of an order of the symbol
+func (e *ExchangeFutureBackWrap) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	order, err := e.ExchangeFutureBack.GetOneOrder(id, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(id),
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(id),
 			"GetOrder() error, the error number is ", err.Error())
 		return nil, nil
 	}
@@ -152,9 +159,15 @@ func (e *ExchangeFutureBackWrap) GetOrder(id string) (*constant.Order, error) {
 
 // GetOrders get all unfilled orders
 func (e *ExchangeFutureBackWrap) GetOrders() ([]constant.Order, error) {
-	orders, err := e.ExchangeFutureBack.GetUnfinishOrders(e.GetStockType())
+	return e.GetOrdersOf(e.GetStockType())
+}
+
+// GetOrdersOf get all unfilled orders of the symbol
+func (e *ExchangeFutureBackWrap) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	orders, err := e.ExchangeFutureBack.GetUnfinishOrders(stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0,
 			"GetOrders() error, the error number is ", err.Error())
 		return nil, nil
 	}
@@ -163,27 +176,56 @@ func (e *ExchangeFutureBackWrap) GetOrders() ([]constant.Order, error) {
 
 // CancelOrder cancel an order
 func (e *ExchangeFutureBackWrap) CancelOrder(orderID string) (bool, error) {
-	result, err := e.ExchangeFutureBack.CancelOrder(orderID, e.GetStockType())
+	return e.CancelOrderOf(e.GetStockType(), orderID)
+}
+
+// CancelOrderOf cancel an order of the symbol
+func (e *ExchangeFutureBackWrap) CancelOrderOf(symbol, orderID string) (bool, error) {
+	stockType := e.symbolOf(symbol)
+	result, err := e.ExchangeFutureBack.CancelOrder(orderID, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(orderID),
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(orderID),
 			"CancelOrder() error, the error number is ", err.Error())
 		return false, nil
 	}
 	if !result {
 		return false, nil
 	}
-	e.logger.Log(constant.TradeTypeCancel, e.GetStockType(), 0, util.Float64Must(orderID),
+	e.logger.Log(constant.TradeTypeCancel, stockType, 0, util.Float64Must(orderID),
 		"CancelOrder() success")
 	return false, nil
 }
 
 // GetTicker get market ticker
 func (e *ExchangeFutureBackWrap) GetTicker() (*constant.Ticker, error) {
-	ticker, err := e.ExchangeFutureBack.GetTicker(e.GetStockType())
+	return e.GetTickerOf(e.GetStockType())
+}
+
+// GetTickerOf get market ticker of the symbol
+func (e *ExchangeFutureBackWrap) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	stockType := e.symbolOf(symbol)
+	ticker, err := e.ExchangeFutureBack.GetTicker(stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ",
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetTicker() error, the error number is ",
 			err.Error())
 		return nil, nil
 	}
 	return ticker, nil
 }
+
+// GetRecords get the records fed so far
+func (e *ExchangeFutureBackWrap) GetRecords() ([]constant.Record, error) {
+	return e.GetRecordsOf(e.GetStockType())
+}
+
+// GetRecordsOf get the records of the symbol fed so far
+func (e *ExchangeFutureBackWrap) GetRecordsOf(symbol string) ([]constant.Record, error) {
+	stockType := e.symbolOf(symbol)
+	records, err := e.ExchangeFutureBack.GetRecords(stockType, e.GetPeriodSize())
+	if err != nil {
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetRecords() error, the error number is ",
+			err.Error())
+		return nil, fmt.Errorf("GetRecords() error, the error number is %s", err.Error())
+	}
+	return records, nil
+}
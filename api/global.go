@@ -1,8 +1,11 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"snack.com/xiyanxiyan10/stocktrader/config"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
@@ -28,11 +31,19 @@ type GlobalHandler interface {
 	DrawKLine(time string, open, closed, low, high float32)
 	DrawLine(name string, time string, data float32, shape string)
 	DrawPlot() error
+	SetState(key string, value interface{}) error
+	GetState(key string) interface{}
+	DelState(key string) error
 }
 
-var globalMap map[int64]*Global
+var (
+	globalMap   map[int64]*Global
+	globalMutex sync.RWMutex
+)
 
 func setGlobal(id int64, g *Global) {
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
 	if globalMap == nil {
 		globalMap = make(map[int64]*Global)
 	}
@@ -40,6 +51,8 @@ func setGlobal(id int64, g *Global) {
 }
 
 func getGlobal(id int64) (*Global, bool) {
+	globalMutex.RLock()
+	defer globalMutex.RUnlock()
 	g, ok := globalMap[id]
 	return g, ok
 }
@@ -50,7 +63,10 @@ type Global struct {
 
 	plugins map[string]Plugin
 
-	backtest  bool // 是否为回测模式
+	traderID  int64
+	states    map[string]string // 回测模式下的状态, 不写入数据库
+	statesMu  *sync.RWMutex     // ExecTasks 的协程并发读写状态
+	backtest  bool              // 是否为回测模式
 	backlog   bool
 	mail      notice.MailHandler // 邮件发送
 	ding      notice.DingHandler // dingtalk
@@ -98,7 +114,11 @@ func NewGlobalStruct(opt constant.Option) *Global {
 	trader.logger = model.Logger{
 		TraderID:     opt.TraderID,
 		ExchangeType: "global",
+		Back:         opt.BackLog,
 	}
+	trader.traderID = opt.TraderID
+	trader.states = make(map[string]string)
+	trader.statesMu = new(sync.RWMutex)
 	trader.backtest = opt.BackTest
 	trader.backlog = opt.BackLog
 	trader.mail = notice.NewMailHandler()
@@ -114,7 +134,12 @@ func (g *Global) Sleep(intervals int64) {
 	if g.backtest {
 		return
 	}
-	g.Sleep(intervals)
+	time.Sleep(time.Duration(intervals) * time.Millisecond)
+}
+
+// GetThrottleStats get the throttle metrics of the exchange requests
+func (g *Global) GetThrottleStats() []ThrottleStat {
+	return ThrottleStats()
 }
 
 // DingSet ...
@@ -186,6 +211,63 @@ func (g *Global) DrawPlot() error {
 	return nil
 }
 
+// SetState save the value as json, the state survives restarts of the trader
+func (g *Global) SetState(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		g.logger.Log(constant.ERROR, "", 0.0, 0.0, "SetState() error, the error number is ", err.Error())
+		return err
+	}
+	if g.backtest {
+		g.statesMu.Lock()
+		g.states[key] = string(data)
+		g.statesMu.Unlock()
+		return nil
+	}
+	if err := model.SetState(g.traderID, key, string(data)); err != nil {
+		g.logger.Log(constant.ERROR, "", 0.0, 0.0, "SetState() error, the error number is ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetState get the value saved by SetState, nil if not found
+func (g *Global) GetState(key string) interface{} {
+	var data string
+	if g.backtest {
+		g.statesMu.RLock()
+		v, ok := g.states[key]
+		g.statesMu.RUnlock()
+		if !ok {
+			return nil
+		}
+		data = v
+	} else {
+		state, err := model.GetState(g.traderID, key)
+		if err != nil {
+			return nil
+		}
+		data = state.Value
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		g.logger.Log(constant.ERROR, "", 0.0, 0.0, "GetState() error, the error number is ", err.Error())
+		return nil
+	}
+	return value
+}
+
+// DelState ...
+func (g *Global) DelState(key string) error {
+	if g.backtest {
+		g.statesMu.Lock()
+		delete(g.states, key)
+		g.statesMu.Unlock()
+		return nil
+	}
+	return model.DeleteState(g.traderID, key)
+}
+
 // Log ...
 func (g *Global) Log(action, symbol string, price, amount float64, messages string) {
 	g.logger.Log(action, symbol, price, amount, messages)
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestStateConcurrent(t *testing.T) {
+	g := NewGlobalStruct(constant.Option{BackTest: true, BackLog: true})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("k%d", i%2)
+			for j := 0; j < 100; j++ {
+				g.SetState(key, j)
+				g.GetState(key)
+				if j%10 == 0 {
+					g.DelState(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := g.SetState("last", 1); err != nil || g.GetState("last") != float64(1) {
+		t.Fatalf("unexpected state %v", g.GetState("last"))
+	}
+}
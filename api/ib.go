@@ -0,0 +1,466 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofinance/ib"
+	sdkib "snack.com/xiyanxiyan10/stocktrader/apisdk/ib"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// ibDepthRows the number of the depth levels subscribed
+const ibDepthRows = 5
+
+// ibSymbol the contract of a symbol like AAPL, AAPL@ISLAND/USD or ES.202112@GLOBEX
+func ibSymbol(symbol string) (ib.Contract, error) {
+	contract := ib.Contract{SecurityType: "STK", Exchange: "SMART", Currency: "USD"}
+	if i := strings.LastIndex(symbol, "/"); i >= 0 {
+		symbol, contract.Currency = symbol[:i], strings.ToUpper(symbol[i+1:])
+	}
+	if i := strings.LastIndex(symbol, "@"); i >= 0 {
+		symbol, contract.Exchange = symbol[:i], strings.ToUpper(symbol[i+1:])
+	}
+	if i := strings.Index(symbol, "."); i >= 0 {
+		// 带到期月份的为期货, 需指定交易所
+		symbol, contract.Expiry, contract.SecurityType = symbol[:i], symbol[i+1:], "FUT"
+		if contract.Exchange == "SMART" {
+			return contract, fmt.Errorf("the exchange of the future %s is not set", symbol)
+		}
+	}
+	contract.Symbol = strings.ToUpper(symbol)
+	if contract.Symbol == "" {
+		return contract, fmt.Errorf("invalid symbol")
+	}
+	return contract, nil
+}
+
+// ibStatus the trade status of the tws order status
+func ibStatus(order sdkib.Order) constant.TradeStatus {
+	switch order.Status {
+	case "Filled":
+		return constant.ORDER_FINISH
+	case "Cancelled", "ApiCancelled":
+		return constant.ORDER_CANCEL
+	case "Inactive":
+		return constant.ORDER_REJECT
+	case "PendingCancel":
+		return constant.ORDER_CANCEL_ING
+	}
+	if order.Filled > 0 {
+		return constant.ORDER_PART_FINISH
+	}
+	return constant.ORDER_UNFINISH
+}
+
+// ibTimeInForce ...
+var ibTimeInForce = map[string]string{
+	constant.TimeInForceGTC: "GTC",
+	constant.TimeInForceIOC: "IOC",
+	constant.TimeInForceFOK: "FOK",
+}
+
+// IBExchange the exchange struct of the stocks and futures through interactive brokers tws or gateway
+type IBExchange struct {
+	BaseExchange
+
+	client    *sdkib.Client
+	mu        sync.Mutex
+	contracts map[string]ib.ContractDetails
+	tickers   map[string]int64 // 品种 -> 行情订阅号
+	depths    map[string]int64
+	types     map[int64]string // 订单号 -> 交易类型
+}
+
+// NewIBExchange create an exchange struct of interactive brokers, the account code is the access key
+func NewIBExchange(opt constant.Option) (Exchange, error) {
+	gateway := config.String("ibgateway")
+	if gateway == "" {
+		gateway = "127.0.0.1:4001"
+	}
+	clientID, _ := strconv.ParseInt(config.String("ibclientid"), 10, 64)
+	return newIBExchange(opt, gateway, clientID+int64(opt.Index)), nil
+}
+
+// newIBExchange ...
+func newIBExchange(opt constant.Option, gateway string, clientID int64) *IBExchange {
+	e := &IBExchange{
+		client:    sdkib.NewClient(gateway, clientID, opt.AccessKey),
+		contracts: make(map[string]ib.ContractDetails),
+		tickers:   make(map[string]int64),
+		depths:    make(map[string]int64),
+		types:     make(map[int64]string),
+	}
+	e.BaseExchange.Init(opt)
+	e.SetID(opt.Index)
+	e.SetMinAmountMap(map[string]float64{})
+	e.BaseExchange.father = ExchangeBroker(e)
+	return e
+}
+
+// start connect to the gateway
+func (e *IBExchange) start() error {
+	if err := e.client.Connect(); err != nil {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+			"Start() error, the error number is "+err.Error())
+		return fmt.Errorf("Start() error, the error number is %s", err.Error())
+	}
+	return nil
+}
+
+// stop ...
+func (e *IBExchange) stop() error {
+	e.client.Close()
+	return nil
+}
+
+// contract resolve the contract of the symbol, cached after the first request
+func (e *IBExchange) contract(method, symbol string) (ib.ContractDetails, error) {
+	e.mu.Lock()
+	details, ok := e.contracts[symbol]
+	e.mu.Unlock()
+	if ok {
+		return details, nil
+	}
+	contract, err := ibSymbol(symbol)
+	if err == nil {
+		err = e.call("ContractDetails", func() (err error) {
+			details, err = e.client.ContractDetails(contract)
+			return
+		})
+	}
+	if err != nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is "+err.Error())
+		return details, fmt.Errorf("%s() error, the error number is %s", method, err.Error())
+	}
+	// 按解析的交易所路由, 而非合约的主交易所
+	details.Summary.Exchange = contract.Exchange
+	if _, ok := lookupInstrument(e.option.Type, symbol); !ok {
+		multiplier, _ := strconv.ParseFloat(details.Summary.Multiplier, 64)
+		RegisterInstrument(e.option.Type, constant.Instrument{
+			Symbol:     symbol,
+			Tick:       details.MinTick,
+			Lot:        1,
+			MinAmount:  1,
+			Multiplier: multiplier,
+			Expiry:     details.Summary.Expiry,
+		})
+	}
+	e.mu.Lock()
+	e.contracts[symbol] = details
+	e.mu.Unlock()
+	return details, nil
+}
+
+// subscription the id of the ticker or depth subscription of the symbol, subscribe if none
+func (e *IBExchange) subscription(method, symbol string, subs map[string]int64,
+	subscribe func(ib.Contract) (int64, error)) (int64, error) {
+	details, err := e.contract(method, symbol)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	id, ok := subs[symbol]
+	e.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	if id, err = subscribe(details.Summary); err != nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is "+err.Error())
+		return 0, fmt.Errorf("%s() error, the error number is %s", method, err.Error())
+	}
+	e.mu.Lock()
+	subs[symbol] = id
+	e.mu.Unlock()
+	return id, nil
+}
+
+// getTicker get market ticker
+func (e *IBExchange) getTicker(symbol string) (*constant.Ticker, error) {
+	id, err := e.subscription("GetTicker", symbol, e.tickers, e.client.SubscribeTicker)
+	if err != nil {
+		return nil, err
+	}
+	ticker, ok := e.client.Ticker(id)
+	if !ok {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetTicker() error, the error number is no market data")
+		return nil, fmt.Errorf("GetTicker() error, the error number is no market data")
+	}
+	return &constant.Ticker{
+		Last:  ticker.Last,
+		Buy:   ticker.Bid,
+		Sell:  ticker.Ask,
+		Open:  ticker.Open,
+		High:  ticker.High,
+		Low:   ticker.Low,
+		Close: ticker.Close,
+		Vol:   ticker.Volume,
+		Time:  ticker.Time.Unix(),
+	}, nil
+}
+
+// getRecords the historical data is not subscribed through the gateway yet
+func (e *IBExchange) getRecords(symbol string) ([]constant.Record, error) {
+	e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetRecords() error, the error number is not support")
+	return nil, fmt.Errorf("GetRecords() error, the error number is not support")
+}
+
+// getDepth get the market depth
+func (e *IBExchange) getDepth(symbol string) (*constant.Depth, error) {
+	subscribe := func(contract ib.Contract) (int64, error) {
+		return e.client.SubscribeDepth(contract, ibDepthRows)
+	}
+	id, err := e.subscription("GetDepth", symbol, e.depths, subscribe)
+	if err != nil {
+		return nil, err
+	}
+	book, ok := e.client.Depth(id)
+	if !ok {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetDepth() error, the error number is no market depth")
+		return nil, fmt.Errorf("GetDepth() error, the error number is no market depth")
+	}
+	depth := constant.Depth{StockType: symbol, Time: time.Now().Unix()}
+	for _, level := range book.Bids {
+		depth.Bids = append(depth.Bids, constant.DepthRecord{Price: level.Price, Amount: level.Size})
+	}
+	for _, level := range book.Asks {
+		depth.Asks = append(depth.Asks, constant.DepthRecord{Price: level.Price, Amount: level.Size})
+	}
+	return &depth, nil
+}
+
+// placeOrder place an order, the direction is checked for the futures
+func (e *IBExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method, action := "Buy", "BUY"
+	if req.Side == constant.TradeTypeSell {
+		method, action = "Sell", "SELL"
+	}
+	stockType := req.Symbol
+	fail := func(reason string) (string, error) {
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount,
+			method+"() error, the error number is "+reason)
+		return "", fmt.Errorf("%s() error, the error number is %s", method, reason)
+	}
+	details, err := e.contract(method, stockType)
+	if err != nil {
+		return "", err
+	}
+	direction := req.Side
+	if details.Summary.SecurityType == "FUT" {
+		direction = e.directionOf(req)
+		if err := validDirection(req.Side, direction); err != nil {
+			return fail(err.Error())
+		}
+		if req.ReduceOnly && direction != constant.TradeTypeLongClose && direction != constant.TradeTypeShortClose {
+			return fail("reduce only order must close position")
+		}
+	}
+	if req.PostOnly {
+		return fail("ib does not support post only orders")
+	}
+	tif, ok := ibTimeInForce[req.TimeInForce]
+	if !ok {
+		return fail("invalid time in force " + req.TimeInForce)
+	}
+	if req.Amount != math.Trunc(req.Amount) {
+		return fail(fmt.Sprintf("amount %v is not an integer", req.Amount))
+	}
+	order, _ := ib.NewOrder()
+	order.Action = action
+	order.TotalQty = int64(req.Amount)
+	order.TIF = tif
+	order.OrderRef = req.ClientOrderID
+	order.OrderType = "MKT"
+	if req.OrderType != constant.OrderTypeMarket {
+		order.OrderType, order.LimitPrice = "LMT", req.Price
+	}
+	var id int64
+	err = e.call("PlaceOrder", func() (err error) {
+		id, err = e.client.PlaceOrder(details.Summary, order)
+		return
+	})
+	if err != nil {
+		return fail(err.Error())
+	}
+	e.mu.Lock()
+	e.types[id] = direction
+	e.mu.Unlock()
+	e.logger.Log(direction, stockType, req.Price, req.Amount, req.Msg)
+	return fmt.Sprint(id), nil
+}
+
+// orderI2U convert the ib order to the usr order
+func (e *IBExchange) orderI2U(symbol string, order sdkib.Order) constant.Order {
+	e.mu.Lock()
+	tradeType := e.types[order.ID]
+	e.mu.Unlock()
+	if tradeType == "" {
+		// 之前会话的订单只知道买卖方向
+		tradeType = constant.TradeTypeBuy
+		if order.Action == "SELL" {
+			tradeType = constant.TradeTypeSell
+		}
+	}
+	price := order.Price
+	if order.Type == "MKT" {
+		price = 0
+	}
+	return constant.Order{
+		Id:         fmt.Sprint(order.ID),
+		ClientID:   order.Ref,
+		Price:      price,
+		Amount:     float64(order.Quantity),
+		DealAmount: float64(order.Filled),
+		AvgPrice:   order.AvgPrice,
+		TradeType:  tradeType,
+		StockType:  symbol,
+		Status:     ibStatus(order),
+		Time:       order.Time.Unix(),
+	}
+}
+
+// order the order placed by this exchange
+func (e *IBExchange) order(id string) (sdkib.Order, bool) {
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return sdkib.Order{}, false
+	}
+	return e.client.WaitOrder(orderID)
+}
+
+// getOrder get details of an order
+func (e *IBExchange) getOrder(symbol, id string) (*constant.Order, error) {
+	order, ok := e.order(id)
+	if !ok && order.ID == 0 {
+		return nil, ErrNotFoundOrder
+	}
+	res := e.orderI2U(symbol, order)
+	return &res, nil
+}
+
+// getOrderByClientID find the order by the OrderRef set to the client order id
+func (e *IBExchange) getOrderByClientID(symbol, clientID string) (*constant.Order, error) {
+	for _, order := range e.client.Orders() {
+		if order.Ref == clientID {
+			res := e.orderI2U(symbol, order)
+			return &res, nil
+		}
+	}
+	return nil, ErrNotFoundOrder
+}
+
+// getOrders get all unfilled orders of the symbol
+func (e *IBExchange) getOrders(symbol string) ([]constant.Order, error) {
+	details, err := e.contract("GetOrders", symbol)
+	if err != nil {
+		return nil, err
+	}
+	resOrders := make([]constant.Order, 0)
+	for _, order := range e.client.Orders() {
+		if order.Contract.ContractID != details.Summary.ContractID {
+			continue
+		}
+		res := e.orderI2U(symbol, order)
+		if res.Status == constant.ORDER_UNFINISH || res.Status == constant.ORDER_PART_FINISH {
+			resOrders = append(resOrders, res)
+		}
+	}
+	return resOrders, nil
+}
+
+// cancelOrder cancel an order
+func (e *IBExchange) cancelOrder(symbol, orderID string) (bool, error) {
+	order, _ := e.order(orderID)
+	if order.ID == 0 {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
+			"CancelOrder() error, the error number is not found order "+orderID)
+		return false, ErrNotFoundOrder
+	}
+	if status := ibStatus(order); status != constant.ORDER_UNFINISH && status != constant.ORDER_PART_FINISH {
+		return false, ErrCancelOrderFinished
+	}
+	if err := e.call("CancelOrder", func() error { return e.client.CancelOrder(order.ID) }); err != nil {
+		e.logger.Log(constant.ERROR, symbol, order.Price, float64(order.Quantity),
+			"CancelOrder() error, the error number is "+err.Error())
+		return false, fmt.Errorf("CancelOrder() error, the error number is %s", err.Error())
+	}
+	e.logger.Log(constant.TradeTypeCancel, symbol, order.Price, float64(order.Quantity),
+		"CancelOrder() success "+orderID)
+	return true, nil
+}
+
+// getPosition get the position of the symbol, a short position for a negative amount
+func (e *IBExchange) getPosition(symbol string) ([]constant.Position, error) {
+	details, err := e.contract("GetPosition", symbol)
+	if err != nil {
+		return nil, err
+	}
+	positions := []constant.Position{}
+	for _, p := range e.client.Portfolio() {
+		if p.Contract.ContractID != details.Summary.ContractID || p.Position == 0 {
+			continue
+		}
+		position := constant.Position{
+			StockType:    symbol,
+			ContractType: details.Summary.Expiry,
+			TradeType:    constant.TradeTypeLong,
+			Amount:       math.Abs(float64(p.Position)),
+			Available:    math.Abs(float64(p.Position)),
+			Price:        p.AverageCost,
+			Profit:       p.UnrealizedPNL,
+		}
+		if p.Position < 0 {
+			position.TradeType = constant.TradeTypeShort
+		}
+		// 期货的平均成本包含合约乘数
+		if multiplier, _ := strconv.ParseFloat(p.Contract.Multiplier, 64); multiplier > 0 {
+			position.Price /= multiplier
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// getAccount get the account detail of this exchange, one sub account per currency
+func (e *IBExchange) getAccount() (*constant.Account, error) {
+	values, ok := e.client.AccountValues()
+	if !ok {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+			"GetAccount() error, the error number is no account values")
+		return nil, fmt.Errorf("GetAccount() error, the error number is no account values")
+	}
+	account := constant.Account{SubAccounts: make(map[string]constant.SubAccount)}
+	set := func(key string, field func(*constant.SubAccount, float64)) {
+		for currency, value := range values[key] {
+			// BASE 为按基础货币汇总的值
+			if currency == "" || currency == "BASE" {
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			sub := account.SubAccounts[currency]
+			sub.StockType = currency
+			field(&sub, v)
+			account.SubAccounts[currency] = sub
+		}
+	}
+	set("CashBalance", func(sub *constant.SubAccount, v float64) { sub.Amount = v })
+	set("NetLiquidationByCurrency", func(sub *constant.SubAccount, v float64) { sub.AccountRights = v })
+	set("UnrealizedPnL", func(sub *constant.SubAccount, v float64) { sub.ProfitUnreal = v })
+	set("RealizedPnL", func(sub *constant.SubAccount, v float64) { sub.ProfitReal = v })
+	set("MaintMarginReq", func(sub *constant.SubAccount, v float64) { sub.KeepDeposit = v })
+	for currency, sub := range account.SubAccounts {
+		if sub.AccountRights > 0 {
+			sub.RiskRate = sub.KeepDeposit / sub.AccountRights
+			account.SubAccounts[currency] = sub
+		}
+	}
+	return &account, nil
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	sdkib "snack.com/xiyanxiyan10/stocktrader/apisdk/ib"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// ibScript a recorded conversation with tws, "> " the fields sent by the client,
+// "< " the fields replied by tws, the fields separated by "|" and "*" matches any field
+const ibScript = `
+> 71|1|7
+> 8|1|1
+> 17|1
+< 9|1|2
+< 15|1|DU123
+> 16|1
+< 53|1
+> 7|3|1073741825|7||*||||
+< 11|9|1073741825|1|265598|AAPL|STK||0|||NASDAQ|USD|AAPL|NMS|0001.01|20211130 15:00:00|DU123|NASDAQ|BOT|20|149|99|7|0|20|149|7.0.1638250000||0
+< 55|1|1073741825
+> 6|2|1|DU123
+< 6|2|NetLiquidationByCurrency|120000|USD|DU123
+< 6|2|CashBalance|50000|USD|DU123
+< 6|2|UnrealizedPnL|700|USD|DU123
+< 6|2|MaintMarginReq|24000|USD|DU123
+< 6|2|CashBalance|50000|BASE|DU123
+< 7|8|265598|AAPL|STK||0||1|NASDAQ|USD|AAPL|NMS|100|155|15500|148|700|0|DU123
+< 7|8|495512563|ES|FUT|20211217|0||50|GLOBEX|USD|ESZ1|ES|-2|4690|-469000|235000|2000|0|DU123
+< 54|1|DU123
+> 9|7|1073741826|0|AAPL|STK||0|||SMART|USD|||0||
+< 10|8|1073741826|AAPL|STK||0||NASDAQ|USD|AAPL|NMS|NMS|265598|0.01||LMT,MKT|SMART,NASDAQ|1|0|APPLE INC|NASDAQ||Technology|Computers|Computers|EST5EDT|||||0
+< 52|1|1073741826
+> 1|11|1073741827|265598|AAPL|STK||0|||SMART|NASDAQ|USD|AAPL|NMS|0||0|
+< 1|6|1073741827|1|149.9|300|1
+< 1|6|1073741827|2|150.1|200|1
+< 1|6|1073741827|4|150|100|0
+< 2|6|1073741827|8|12345
+> 10|5|1073741828|265598|AAPL|STK||0|||SMART|USD|AAPL|NMS|5|
+< 12|1|1073741828|0|0|1|149.9|300
+< 12|1|1073741828|0|0|0|150.1|200
+< 12|1|1073741828|1|0|1|149.8|500
+< 12|1|1073741828|0|0|1|149.95|100
+> 3|42|2|265598|AAPL|STK||0|||SMART|NASDAQ|USD|AAPL|NMS|||BUY|10|LMT|150||GTC||DU123|O|0|*|1|0|0|0|0|0|0|0||0|||||||0||-1|0|||0|||0|0||0||||||0|||||0|||||||||||0|||0|0||0|
+< 3|6|2|Submitted|0|10|0|111|0|0|7|
+> 4|1|2
+< 3|6|2|Cancelled|0|10|0|111|0|0|7|
+> 3|42|3|265598|AAPL|STK||0|||SMART|NASDAQ|USD|AAPL|NMS|||SELL|5|LMT|151||GTC||DU123|O|0|*|1|0|0|0|0|0|0|0||0|||||||0||-1|0|||0|||0|0||0||||||0|||||0|||||||||||0|||0|0||0|
+< 4|2|3|201|Order rejected - reason: no shares available
+> 3|42|4|265598|AAPL|STK||0|||SMART|NASDAQ|USD|AAPL|NMS|||BUY|10|MKT|||GTC||DU123|O|0|*|1|0|0|0|0|0|0|0||0|||||||0||-1|0|||0|||0|0||0||||||0|||||0|||||||||||0|||0|0||0|
+< 3|6|4|Filled|10|0|150.05|112|0|150.05|7|
+> 9|7|1073741829|0|ES|FUT|202112|0|||GLOBEX|USD|||0||
+< 10|8|1073741829|ES|FUT|20211217|0||GLOBEX|USD|ESZ1|ES|ES|495512563|0.25|50|LMT,MKT|GLOBEX|1|11004968|E-mini S&P 500||202112||||US/Central|||||0
+< 52|1|1073741829
+> 3|42|5|495512563|ES|FUT|20211217|0||50|GLOBEX||USD|ESZ1|ES|||BUY|2|LMT|4700||GTC||DU123|O|0|*|1|0|0|0|0|0|0|0||0|||||||0||-1|0|||0|||0|0||0||||||0|||||0|||||||||||0|||0|0||0|
+< 3|6|5|Submitted|0|2|0|113|0|0|7|
+`
+
+// ibStub a tws stub server replaying the recorded conversation
+type ibStub struct {
+	listener net.Listener
+	script   []string
+	done     chan error
+}
+
+func newIBStub(t *testing.T, script string) *ibStub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &ibStub{listener: l, done: make(chan error, 1)}
+	for _, line := range strings.Split(script, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			s.script = append(s.script, line)
+		}
+	}
+	go func() { s.done <- s.serve() }()
+	return s
+}
+
+// serve the handshake then the script, the client messages framed by the fields of the expected line
+func (s *ibStub) serve() error {
+	defer s.listener.Close()
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString(0); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("76\x0020211201 10:00:00 CST\x00")); err != nil {
+		return err
+	}
+	for i, line := range s.script {
+		fields := strings.Split(line[2:], "|")
+		if strings.HasPrefix(line, "<") {
+			if _, err := conn.Write([]byte(strings.Join(fields, "\x00") + "\x00")); err != nil {
+				return err
+			}
+			continue
+		}
+		got := make([]string, len(fields))
+		for j := range fields {
+			field, err := reader.ReadString(0)
+			if err != nil {
+				return fmt.Errorf("line %d: read %v after %s", i+1, err, strings.Join(got[:j], "|"))
+			}
+			got[j] = strings.TrimSuffix(field, "\x00")
+		}
+		for j, field := range fields {
+			if field != "*" && field != got[j] {
+				return fmt.Errorf("line %d: expected %s, got %s", i+1, line[2:], strings.Join(got, "|"))
+			}
+		}
+	}
+	return nil
+}
+
+// eventually poll the condition while the stub replies
+func eventually(t *testing.T, what string, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+func TestIBExchange(t *testing.T) {
+	sdkib.Timeout = time.Second
+	// 录制的期货合约在 20211217 到期
+	instrumentNow = func() time.Time { return time.Date(2021, 12, 1, 10, 0, 0, 0, time.Local) }
+	defer func() { instrumentNow = time.Now }()
+	stub := newIBStub(t, ibScript)
+	e := newIBExchange(constant.Option{BackLog: true, AccessKey: "DU123"}, stub.listener.Addr().String(), 7)
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer e.Stop()
+
+	e.SetStockType("AAPL")
+	eventually(t, "ticker", func() bool {
+		ticker, err := e.GetTicker()
+		return err == nil && ticker.Buy == 149.9 && ticker.Sell == 150.1 && ticker.Last == 150 && ticker.Vol == 12345
+	})
+	eventually(t, "depth", func() bool {
+		depth, err := e.GetDepth()
+		return err == nil && len(depth.Bids) == 3 && depth.Bids[0].Price == 149.95 && depth.Bids[2].Price == 149.8 &&
+			len(depth.Asks) == 1 && depth.Asks[0].Amount == 200
+	})
+
+	// 之前会话已成交的订单按执行回报载入, 订单号与请求号不冲突
+	if order, err := e.GetOrder("1"); err != nil || order.Status != constant.ORDER_FINISH || order.DealAmount != 20 ||
+		order.AvgPrice != 149 || order.TradeType != constant.TradeTypeBuy {
+		t.Fatalf("unexpected order of the earlier session %+v %v", order, err)
+	}
+	if order, err := e.getOrderByClientID("AAPL", "7.0.1638250000"); err != nil || order.Id != "1" {
+		t.Fatalf("unexpected order by client id %+v %v", order, err)
+	}
+
+	// 合约解析后按一股的步长取整
+	if _, err := e.Buy("150", "0.5", ""); err == nil {
+		t.Fatalf("less than one share should fail")
+	}
+	id, err := e.Buy("150", "10", "")
+	if err != nil || id != "2" {
+		t.Fatalf("buy: %v %v", id, err)
+	}
+	if orders, _ := e.GetOrders(); len(orders) != 1 || orders[0].Id != "2" || orders[0].TradeType != constant.TradeTypeBuy {
+		t.Fatalf("unexpected open orders %+v", orders)
+	}
+	if ok, err := e.CancelOrder(id); !ok || err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	eventually(t, "cancel", func() bool {
+		order, _ := e.GetOrder(id)
+		return order != nil && order.Status == constant.ORDER_CANCEL
+	})
+	if _, err := e.CancelOrder(id); err != ErrCancelOrderFinished {
+		t.Fatalf("cancel a canceled order: %v", err)
+	}
+
+	id, _ = e.Sell("151", "5", "")
+	if order, _ := e.GetOrder(id); order == nil || order.Status != constant.ORDER_REJECT {
+		t.Fatalf("the order should be rejected, got %+v", order)
+	}
+	id, _ = e.Buy("-1", "10", "")
+	if order, _ := e.GetOrder(id); order == nil || order.Status != constant.ORDER_FINISH || order.AvgPrice != 150.05 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	positions, err := e.GetPosition()
+	if err != nil || len(positions) != 1 || positions[0].Amount != 100 || positions[0].Price != 148 {
+		t.Fatalf("unexpected positions %+v %v", positions, err)
+	}
+	account, err := e.GetAccount()
+	if err != nil || len(account.SubAccounts) != 1 || account.SubAccounts["USD"].AccountRights != 120000 ||
+		account.SubAccounts["USD"].Amount != 50000 || account.SubAccounts["USD"].RiskRate != 0.2 {
+		t.Fatalf("unexpected account %+v %v", account, err)
+	}
+
+	e.SetStockType("ES.202112@GLOBEX")
+	e.SetDirection(constant.TradeTypeLongClose)
+	if _, err := e.Buy("4700", "2", ""); err == nil {
+		t.Fatalf("buy with close long direction should fail")
+	}
+	e.SetDirection(constant.TradeTypeShortClose)
+	id, err = e.Buy("4700", "2", "")
+	if order, _ := e.GetOrder(id); err != nil || order.Status != constant.ORDER_UNFINISH ||
+		order.TradeType != constant.TradeTypeShortClose {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	positions, err = e.GetPosition()
+	if err != nil || len(positions) != 1 || positions[0].TradeType != constant.TradeTypeShort ||
+		positions[0].Amount != 2 || positions[0].Price != 4700 {
+		t.Fatalf("unexpected positions %+v %v", positions, err)
+	}
+
+	e.Stop()
+	if err := <-stub.done; err != nil {
+		t.Fatalf("stub: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// instrumentFile the key of the instrument file in config.ini
+const instrumentFile = "instrumentfile"
+
+// instrumentAll the exchange type of the instruments shared by all the exchanges
+const instrumentAll = "*"
+
+// instrumentNow the clock of the expiry check
+var instrumentNow = time.Now
+
+// instruments the instruments registered by exchange type and symbol
+var instruments = struct {
+	sync.RWMutex
+	once  sync.Once
+	items map[string]map[string]constant.Instrument
+}{items: make(map[string]map[string]constant.Instrument)}
+
+// RegisterInstrument register the instrument of the exchange type, "*" for all the exchanges
+func RegisterInstrument(exchangeType string, instrument constant.Instrument) {
+	instruments.Lock()
+	defer instruments.Unlock()
+	if instruments.items[exchangeType] == nil {
+		instruments.items[exchangeType] = make(map[string]constant.Instrument)
+	}
+	instruments.items[exchangeType][instrument.Symbol] = instrument
+}
+
+// LoadInstruments load the instruments from a json file of exchange type -> instruments, e.g.
+// {"OKExFuture": [{"symbol": "BTC/USD", "tick": 0.1, "lot": 1, "multiplier": 100}]}
+func LoadInstruments(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file map[string][]constant.Instrument
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s error: %s", path, err.Error())
+	}
+	for exchangeType, list := range file {
+		for _, instrument := range list {
+			RegisterInstrument(exchangeType, instrument)
+		}
+	}
+	return nil
+}
+
+// lookupInstrument the registered instrument, the file in config.ini loaded at the first lookup
+func lookupInstrument(exchangeType, symbol string) (constant.Instrument, bool) {
+	instruments.once.Do(func() {
+		if path := config.String(instrumentFile); path != "" {
+			if err := LoadInstruments(path); err != nil {
+				log.Errorf("Load instruments from %s error %s", path, err.Error())
+			}
+		}
+	})
+	instruments.RLock()
+	defer instruments.RUnlock()
+	if instrument, ok := instruments.items[exchangeType][symbol]; ok {
+		return instrument, true
+	}
+	instrument, ok := instruments.items[instrumentAll][symbol]
+	return instrument, ok
+}
+
+// GetInstrument the trading rules of the symbol, the registered ones first,
+// then the min amount, tick size and contract rate set on this exchange
+func (e *BaseExchange) GetInstrument(symbol string) constant.Instrument {
+	if instrument, ok := lookupInstrument(e.option.Type, symbol); ok {
+		return instrument
+	}
+	base, _ := e.getSymbol(symbol)
+	if instrument, ok := lookupInstrument(e.option.Type, base); ok {
+		instrument.Symbol = symbol
+		return instrument
+	}
+	instrument := constant.Instrument{Symbol: symbol, Multiplier: e.contractRate}
+	for _, key := range []string{symbol, base} {
+		if instrument.MinAmount == 0 {
+			instrument.MinAmount = e.minAmountMap[key]
+		}
+		if instrument.Tick == 0 {
+			instrument.Tick = e.tickSizeMap[key]
+		}
+	}
+	return instrument
+}
+
+// roundStep round the value to a multiple of the step, down, up or to the nearest
+func roundStep(value, step float64, round func(float64) float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	// 先按步长精度取整, 避免 0.3/0.1 之类的浮点误差
+	n := round(math.Round(value/step*1e8) / 1e8)
+	decimals := 0
+	if s := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(s, ".") {
+		decimals = len(s) - strings.Index(s, ".") - 1
+	}
+	res, _ := strconv.ParseFloat(strconv.FormatFloat(n*step, 'f', decimals, 64), 64)
+	return res
+}
+
+// roundOrder round the price to the tick, away from the market, and the amount down to the lot,
+// then check the min amount, the min notional and the expiry of the instrument
+func roundOrder(req *constant.OrderRequest, instrument constant.Instrument) error {
+	if instrument.Expiry != "" {
+		if expiry, err := time.ParseInLocation("20060102", instrument.Expiry, time.Local); err == nil &&
+			!instrumentNow().Before(expiry.AddDate(0, 0, 1)) {
+			return fmt.Errorf("PlaceOrder() error, the error number is %s expired at %s", instrument.Symbol, instrument.Expiry)
+		}
+	}
+	if req.OrderType == constant.OrderTypeLimit {
+		if req.Side == constant.TradeTypeBuy {
+			req.Price = roundStep(req.Price, instrument.Tick, math.Floor)
+		} else {
+			req.Price = roundStep(req.Price, instrument.Tick, math.Ceil)
+		}
+		if req.Price <= 0 {
+			return fmt.Errorf("PlaceOrder() error, the error number is price below the tick %v", instrument.Tick)
+		}
+	}
+	req.Amount = roundStep(req.Amount, instrument.Lot, math.Floor)
+	if req.Amount <= 0 || req.Amount < instrument.MinAmount {
+		return fmt.Errorf("PlaceOrder() error, the error number is amount %v below the min amount %v",
+			req.Amount, math.Max(instrument.MinAmount, instrument.Lot))
+	}
+	if instrument.MinNotional > 0 && req.OrderType == constant.OrderTypeLimit {
+		if notional := req.Price * req.Amount * instrument.ContractSize(); notional < instrument.MinNotional {
+			return fmt.Errorf("PlaceOrder() error, the error number is notional %v below the min notional %v",
+				notional, instrument.MinNotional)
+		}
+	}
+	return nil
+}
+
+// prepareOrder fill the defaults of the request, then round and check it by the instrument of the symbol
+func (e *BaseExchange) prepareOrder(req *constant.OrderRequest) error {
+	// 一次读取当前的设置, 其他协程修改时订单仍使用同一组品种, 方向及杠杆
+	stockType, direction, lever := e.settings()
+	if req.Symbol == "" {
+		req.Symbol = stockType
+	}
+	if req.Direction == "" {
+		req.Direction = direction
+	}
+	if req.MarginLevel <= 0 {
+		req.MarginLevel = lever
+	}
+	req.Symbol = e.symbolOf(req.Symbol)
+	if err := normalizeOrder(req); err != nil {
+		return err
+	}
+	return roundOrder(req, e.GetInstrument(req.Symbol))
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestRoundStep(t *testing.T) {
+	for _, c := range []struct {
+		value, step float64
+		round       func(float64) float64
+		want        float64
+	}{
+		{0.3, 0.1, math.Floor, 0.3},
+		{100.07, 0.05, math.Floor, 100.05},
+		{100.07, 0.05, math.Ceil, 100.1},
+		{1.5, 1, math.Floor, 1},
+		{1.23456, 0, math.Floor, 1.23456},
+	} {
+		if got := roundStep(c.value, c.step, c.round); got != c.want {
+			t.Fatalf("roundStep(%v, %v) = %v, want %v", c.value, c.step, got, c.want)
+		}
+	}
+}
+
+func TestRoundOrder(t *testing.T) {
+	instrument := constant.Instrument{Symbol: "BTC/USD", Tick: 0.5, Lot: 0.01, MinAmount: 0.01, MinNotional: 10}
+	req := constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeLimit, Price: 100.7, Amount: 0.129}
+	if err := roundOrder(&req, instrument); err != nil || req.Price != 100.5 || req.Amount != 0.12 {
+		t.Fatalf("unexpected buy %+v %v", req, err)
+	}
+	req = constant.OrderRequest{Side: constant.TradeTypeSell, OrderType: constant.OrderTypeLimit, Price: 100.2, Amount: 0.12}
+	if err := roundOrder(&req, instrument); err != nil || req.Price != 100.5 {
+		t.Fatalf("unexpected sell %+v %v", req, err)
+	}
+	req = constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeLimit, Price: 100, Amount: 0.009}
+	if err := roundOrder(&req, instrument); err == nil {
+		t.Fatalf("amount below the lot should fail")
+	}
+	req = constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeLimit, Price: 100, Amount: 0.05}
+	if err := roundOrder(&req, instrument); err == nil {
+		t.Fatalf("notional below the min notional should fail")
+	}
+	req = constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeMarket, Amount: 0.05}
+	if err := roundOrder(&req, instrument); err != nil {
+		t.Fatalf("market order: %v", err)
+	}
+
+	instrument.Expiry = time.Now().AddDate(0, 0, -1).Format("20060102")
+	req = constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeLimit, Price: 100, Amount: 1}
+	if err := roundOrder(&req, instrument); err == nil {
+		t.Fatalf("expired instrument should fail")
+	}
+	instrument.Expiry = time.Now().Format("20060102")
+	if err := roundOrder(&req, instrument); err != nil {
+		t.Fatalf("instrument expiring today: %v", err)
+	}
+}
+
+// resetInstruments clear the registered and loaded instruments
+func resetInstruments() {
+	instruments.Lock()
+	instruments.items = make(map[string]map[string]constant.Instrument)
+	instruments.once = sync.Once{}
+	instruments.Unlock()
+	venueLoaded.Lock()
+	venueLoaded.types = make(map[string]bool)
+	venueLoaded.Unlock()
+}
+
+func TestGetInstrument(t *testing.T) {
+	defer resetInstruments()
+	path := filepath.Join(t.TempDir(), "instruments.json")
+	data := `{"OKExFuture": [{"symbol": "ETH/USD", "tick": 0.01, "lot": 1, "multiplier": 10}],
+		"*": [{"symbol": "ETH/USD.swap", "tick": 0.05}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := LoadInstruments(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	exchange, err := NewOKExFutureExchange(constant.Option{Type: constant.OKExFuture, BackLog: true})
+	if err != nil {
+		t.Fatalf("new exchange: %v", err)
+	}
+	e := exchange.(*FutureExchange)
+	if instrument := e.GetInstrument("ETH/USD.this_week"); instrument.Symbol != "ETH/USD.this_week" ||
+		instrument.Tick != 0.01 || instrument.Multiplier != 10 {
+		t.Fatalf("unexpected contract instrument %+v", instrument)
+	}
+	if instrument := e.GetInstrument("ETH/USD.swap"); instrument.Tick != 0.05 {
+		t.Fatalf("unexpected shared instrument %+v", instrument)
+	}
+	// 未注册的品种使用交易所的最小数量及 tick
+	if instrument := e.GetInstrument("BTC/USD"); instrument.Tick != 0.1 || instrument.MinAmount != 1 {
+		t.Fatalf("unexpected fallback instrument %+v", instrument)
+	}
+}
+
+func TestLoadVenueInstruments(t *testing.T) {
+	defer resetInstruments()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"symbols": [
+			{"status": "TRADING", "baseAsset": "BTC", "quoteAsset": "USDT", "filters": [
+				{"filterType": "PRICE_FILTER", "tickSize": "0.01000000"},
+				{"filterType": "LOT_SIZE", "minQty": "0.00001000", "stepSize": "0.00001000"},
+				{"filterType": "MIN_NOTIONAL", "minNotional": "10.00000000"}]},
+			{"status": "TRADING", "baseAsset": "ETH", "quoteAsset": "USDT", "filters": [
+				{"filterType": "PRICE_FILTER", "tickSize": "0.01000000"}]},
+			{"status": "BREAK", "baseAsset": "LTC", "quoteAsset": "USDT", "filters": []}]}`))
+	}))
+	defer server.Close()
+	loader := venueLoaders[constant.Binance]
+	venueLoaders[constant.Binance] = venueLoader{url: server.URL, parse: loader.parse}
+	defer func() { venueLoaders[constant.Binance] = loader }()
+
+	// 已注册的品种不被覆盖
+	RegisterInstrument(constant.Binance, constant.Instrument{Symbol: "ETH/USDT", Tick: 0.1})
+	if err := loadVenueInstruments(constant.Binance); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if instrument, ok := lookupInstrument(constant.Binance, "BTC/USDT"); !ok || instrument.Tick != 0.01 ||
+		instrument.Lot != 0.00001 || instrument.MinAmount != 0.00001 || instrument.MinNotional != 10 {
+		t.Fatalf("unexpected instrument %+v", instrument)
+	}
+	if instrument, _ := lookupInstrument(constant.Binance, "ETH/USDT"); instrument.Tick != 0.1 {
+		t.Fatalf("the registered instrument should be kept, got %+v", instrument)
+	}
+	if _, ok := lookupInstrument(constant.Binance, "LTC/USDT"); ok {
+		t.Fatalf("the symbol not trading should be skipped")
+	}
+
+	list, err := parseHuoBiInstruments([]byte(`{"status": "ok", "data": [{"base-currency": "btc", "quote-currency": "usdt",
+		"price-precision": 2, "amount-precision": 6, "min-order-amt": 0.0001, "min-order-value": 5, "state": "online"}]}`))
+	if err != nil || len(list) != 1 || list[0].Symbol != "BTC/USDT" || list[0].Tick != 0.01 || list[0].Lot != 0.000001 {
+		t.Fatalf("unexpected huobi instruments %+v %v", list, err)
+	}
+	list, err = parseOKExInstruments([]byte(`[{"base_currency": "ETH", "quote_currency": "BTC", "min_size": "0.001",
+		"size_increment": "0.000001", "tick_size": "0.00001"}]`))
+	if err != nil || len(list) != 1 || list[0].Symbol != "ETH/BTC" || list[0].Tick != 0.00001 || list[0].MinAmount != 0.001 {
+		t.Fatalf("unexpected okex instruments %+v %v", list, err)
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// venueLoader the public api of the trading rules of a venue and its parser,
+// the instruments are keyed by the symbol of this repo, e.g. BTC/USDT
+type venueLoader struct {
+	url   string
+	parse func(data []byte) ([]constant.Instrument, error)
+}
+
+// venueLoaders the venues publishing their trading rules, only the spot venues are loaded,
+// the futures of goex use the hard coded tick and min amount or the instrument file
+var venueLoaders = map[string]venueLoader{
+	constant.Binance: {url: "https://api.binance.com/api/v3/exchangeInfo", parse: parseBinanceInstruments},
+	constant.HuoBi:   {url: "https://api.huobi.pro/v1/common/symbols", parse: parseHuoBiInstruments},
+	constant.OKEx:    {url: "https://www.okex.com/api/spot/v3/instruments", parse: parseOKExInstruments},
+}
+
+// venueLoaded the exchange types loaded from the venues
+var venueLoaded = struct {
+	sync.Mutex
+	types map[string]bool
+}{types: make(map[string]bool)}
+
+// loadVenueInstruments load the trading rules of the venue once, the instruments already registered,
+// e.g. by the instrument file, are kept
+func loadVenueInstruments(exchangeType string) error {
+	loader, ok := venueLoaders[exchangeType]
+	if !ok {
+		return nil
+	}
+	venueLoaded.Lock()
+	defer venueLoaded.Unlock()
+	if venueLoaded.types[exchangeType] {
+		return nil
+	}
+	data, err := venueGet(loader.url)
+	if err != nil {
+		return err
+	}
+	list, err := loader.parse(data)
+	if err != nil {
+		return fmt.Errorf("parse the instruments of %s error: %s", exchangeType, err.Error())
+	}
+	// 先加载品种文件, 文件中的品种优先
+	lookupInstrument(exchangeType, "")
+	instruments.Lock()
+	if instruments.items[exchangeType] == nil {
+		instruments.items[exchangeType] = make(map[string]constant.Instrument)
+	}
+	for _, instrument := range list {
+		if _, ok := instruments.items[exchangeType][instrument.Symbol]; !ok {
+			instruments.items[exchangeType][instrument.Symbol] = instrument
+		}
+	}
+	instruments.Unlock()
+	venueLoaded.types[exchangeType] = true
+	log.Infof("Load %d instruments of %s", len(list), exchangeType)
+	return nil
+}
+
+// venueGet get the public api by the proxy in config.ini
+func venueGet(path string) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	if proxyURL := config.String("proxy"); proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+	}
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s error, the status is %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// venueSymbol the symbol of this repo by the base and quote currency
+func venueSymbol(base, quote string) string {
+	return strings.ToUpper(base) + "/" + strings.ToUpper(quote)
+}
+
+// parseFloat parse the number sent as a string, 0 if invalid
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// parseBinanceInstruments parse the exchangeInfo of binance
+func parseBinanceInstruments(data []byte) ([]constant.Instrument, error) {
+	var info struct {
+		Symbols []struct {
+			Status     string `json:"status"`
+			BaseAsset  string `json:"baseAsset"`
+			QuoteAsset string `json:"quoteAsset"`
+			Filters    []struct {
+				FilterType  string `json:"filterType"`
+				TickSize    string `json:"tickSize"`
+				MinQty      string `json:"minQty"`
+				StepSize    string `json:"stepSize"`
+				MinNotional string `json:"minNotional"`
+			} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	var res []constant.Instrument
+	for _, s := range info.Symbols {
+		if s.Status != "TRADING" {
+			continue
+		}
+		instrument := constant.Instrument{Symbol: venueSymbol(s.BaseAsset, s.QuoteAsset)}
+		for _, f := range s.Filters {
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				instrument.Tick = parseFloat(f.TickSize)
+			case "LOT_SIZE":
+				instrument.Lot, instrument.MinAmount = parseFloat(f.StepSize), parseFloat(f.MinQty)
+			case "MIN_NOTIONAL":
+				instrument.MinNotional = parseFloat(f.MinNotional)
+			}
+		}
+		res = append(res, instrument)
+	}
+	return res, nil
+}
+
+// parseHuoBiInstruments parse the common symbols of huobi, the steps given by the precisions
+func parseHuoBiInstruments(data []byte) ([]constant.Instrument, error) {
+	var info struct {
+		Status string `json:"status"`
+		Data   []struct {
+			Base            string  `json:"base-currency"`
+			Quote           string  `json:"quote-currency"`
+			PricePrecision  int     `json:"price-precision"`
+			AmountPrecision int     `json:"amount-precision"`
+			MinOrderAmt     float64 `json:"min-order-amt"`
+			MinOrderValue   float64 `json:"min-order-value"`
+			State           string  `json:"state"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Status != "ok" {
+		return nil, fmt.Errorf("the status is %s", info.Status)
+	}
+	var res []constant.Instrument
+	for _, s := range info.Data {
+		if s.State != "" && s.State != "online" {
+			continue
+		}
+		res = append(res, constant.Instrument{
+			Symbol:      venueSymbol(s.Base, s.Quote),
+			Tick:        math.Pow10(-s.PricePrecision),
+			Lot:         math.Pow10(-s.AmountPrecision),
+			MinAmount:   s.MinOrderAmt,
+			MinNotional: s.MinOrderValue,
+		})
+	}
+	return res, nil
+}
+
+// parseOKExInstruments parse the spot instruments of okex
+func parseOKExInstruments(data []byte) ([]constant.Instrument, error) {
+	var list []struct {
+		Base          string `json:"base_currency"`
+		Quote         string `json:"quote_currency"`
+		MinSize       string `json:"min_size"`
+		SizeIncrement string `json:"size_increment"`
+		TickSize      string `json:"tick_size"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var res []constant.Instrument
+	for _, s := range list {
+		res = append(res, constant.Instrument{
+			Symbol:    venueSymbol(s.Base, s.Quote),
+			Tick:      parseFloat(s.TickSize),
+			Lot:       parseFloat(s.SizeIncrement),
+			MinAmount: parseFloat(s.MinSize),
+		})
+	}
+	return res, nil
+}
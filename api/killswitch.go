@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// SetHalted halt or resume the order entry
+func (o *OMS) SetHalted(halted bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.halted = halted
+}
+
+// joinErrors ...
+func joinErrors(method string, errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s() error, the error number is %s", method, strings.Join(errs, "; "))
+}
+
+// openSymbols the current symbol and every symbol having local open orders
+func (o *OMS) openSymbols() []string {
+	symbols := []string{o.GetStockType()}
+	for _, symbol := range o.localSymbols() {
+		if symbol != symbols[0] {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// CancelAll cancel the open orders placed by this OMS, the orders of others on the account are kept
+func (o *OMS) CancelAll() (canceled int, err error) {
+	var errs []string
+	// 先对账, 已完成的订单不再撤销
+	for _, symbol := range o.localSymbols() {
+		if _, err := o.GetOrdersOf(symbol); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s", symbol, err.Error()))
+		}
+	}
+	for _, order := range o.GetLocalOrders(true) {
+		if order.OrderID == "" {
+			continue
+		}
+		if _, err := o.CancelOrderOf(order.StockType, order.OrderID); err != nil {
+			if err != ErrCancelOrderFinished {
+				errs = append(errs, fmt.Sprintf("%s %s", order.OrderID, err.Error()))
+			}
+			continue
+		}
+		canceled++
+	}
+	return canceled, joinErrors("CancelAll", errs)
+}
+
+// positionSymbols the current symbol and every symbol having a position in the ledger,
+// the ledgers of this exchange are reloaded from the database when persist
+func (o *OMS) positionSymbols() []string {
+	symbols := []string{o.GetStockType()}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.persist {
+		ledgers, err := model.ListTraderLedger(o.option.TraderID)
+		if err != nil {
+			o.logger.Log(constant.ERROR, "", 0.0, 0.0, "ListTraderLedger() error, the error number is ", err.Error())
+		}
+		for i := range ledgers {
+			if ledgers[i].ExchangeID == o.option.ExchangeID {
+				o.ledgers[ledgers[i].StockType] = &ledgers[i]
+			}
+		}
+	}
+	for symbol, ledger := range o.ledgers {
+		if ledger.Amount != 0 && symbol != symbols[0] {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols[1:])
+	return symbols
+}
+
+// closeRequest the market order closing the position of the ledger, capped at the futures position
+// of the exchange, which is shared by all the traders on the account
+func (o *OMS) closeRequest(symbol string, held float64) constant.OrderRequest {
+	req := constant.OrderRequest{Symbol: symbol, Side: constant.TradeTypeSell,
+		OrderType: constant.OrderTypeMarket, Amount: held, Msg: "kill switch flatten"}
+	side, direction := constant.TradeTypeBuy, constant.TradeTypeLongClose
+	if held < 0 {
+		req.Side, req.Amount = constant.TradeTypeBuy, -held
+		side, direction = constant.TradeTypeSell, constant.TradeTypeShortClose
+	}
+	positions, err := o.exchange.GetPositionOf(symbol)
+	if err != nil || len(positions) == 0 {
+		// 现货不支持查询持仓, 只平账本中的多头
+		if held < 0 {
+			req.Amount = 0
+		}
+		return req
+	}
+	venue := 0.0
+	for _, position := range positions {
+		if position.TradeType != side {
+			continue
+		}
+		if position.Available > 0 {
+			venue += position.Available
+		} else {
+			venue += position.Amount
+		}
+	}
+	req.Amount = math.Min(req.Amount, venue)
+	req.Direction = direction
+	return req
+}
+
+// Flatten close the positions of this trader in the ledger of every symbol with market orders,
+// the positions of the others on the same account are kept
+func (o *OMS) Flatten() (closed int, err error) {
+	var errs []string
+	for _, symbol := range o.positionSymbols() {
+		held := o.GetLedger(symbol).Amount
+		if held == 0 {
+			continue
+		}
+		req := o.closeRequest(symbol, held)
+		if req.Amount <= 0 {
+			continue
+		}
+		if _, err := o.submit(req, false); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s", symbol, err.Error()))
+			continue
+		}
+		closed++
+	}
+	return closed, joinErrors("Flatten", errs)
+}
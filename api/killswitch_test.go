@@ -0,0 +1,80 @@
+package api
+
+import (
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestKillSwitch(t *testing.T) {
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+	o.SetRiskLimit(constant.RiskLimit{MaxDailyLoss: 0.01})
+	if _, err := o.Buy("100", "2", ""); err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if _, err := o.Sell("110", "1", ""); err != nil {
+		t.Fatalf("sell: %v", err)
+	}
+
+	mock.SetTickerOf("ETH/USDT", constant.Ticker{Last: 10})
+	if _, err := o.PlaceOrder(constant.OrderRequest{Symbol: "ETH/USDT", Side: constant.TradeTypeBuy,
+		OrderType: constant.OrderTypeMarket, Amount: 3}); err != nil {
+		t.Fatalf("buy eth: %v", err)
+	}
+	// 其他程序在同一账户下的订单
+	foreign, _ := mock.placeOrder(constant.OrderRequest{Symbol: "BTC/USDT", Side: constant.TradeTypeSell, Price: 120, Amount: 1})
+
+	o.SetHalted(true)
+	if _, err := o.Buy("100", "1", ""); err == nil {
+		t.Fatalf("halted oms should reject orders")
+	}
+	if canceled, err := o.CancelAll(); err != nil || canceled != 1 {
+		t.Fatalf("cancel all: %d %v", canceled, err)
+	}
+	if order, _ := mock.getOrder("BTC/USDT", foreign); order.Status != constant.ORDER_UNFINISH {
+		t.Fatalf("the orders not placed by the oms should be kept, got %+v", order)
+	}
+	// 平仓不受紧急停止及风控限制, 所有品种均平仓
+	mock.SetTicker(constant.Ticker{Last: 90})
+	if closed, err := o.Flatten(); err != nil || closed != 2 {
+		t.Fatalf("flatten: %d %v", closed, err)
+	}
+	if ledger := o.GetLedger("BTC/USDT"); ledger.Amount != 0 || ledger.RealizedPnl != -20 {
+		t.Fatalf("unexpected ledger %+v", ledger)
+	}
+	if ledger := o.GetLedger("ETH/USDT"); ledger.Amount != 0 {
+		t.Fatalf("unexpected ledger %+v", ledger)
+	}
+}
+
+func TestFlattenOwnPositions(t *testing.T) {
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+	symbols := []string{"BTC/USD.quarter", "ETH/USD.quarter"}
+	for _, symbol := range symbols {
+		mock.SetTickerOf(symbol, constant.Ticker{Last: 100})
+		if _, err := o.PlaceOrder(constant.OrderRequest{Symbol: symbol, Side: constant.TradeTypeBuy,
+			OrderType: constant.OrderTypeMarket, Amount: 2, Direction: constant.TradeTypeLong}); err != nil {
+			t.Fatalf("buy %s: %v", symbol, err)
+		}
+	}
+	// 账户中还有其他交易员的持仓, 交易所的 ETH 持仓少于账本
+	mock.SetPositions([]constant.Position{
+		{StockType: "BTC/USD.quarter", TradeType: constant.TradeTypeBuy, Amount: 5},
+		{StockType: "ETH/USD.quarter", TradeType: constant.TradeTypeBuy, Amount: 1},
+	})
+	if closed, err := o.Flatten(); err != nil || closed != 2 {
+		t.Fatalf("flatten: %d %v", closed, err)
+	}
+	orders := o.GetLocalOrders(false)
+	for i, amount := range []float64{2, 1} {
+		order := orders[len(orders)-2+i]
+		if order.StockType != symbols[i] || order.Amount != amount || order.Side != constant.TradeTypeSell {
+			t.Fatalf("unexpected close order %+v", order)
+		}
+	}
+	if ledger := o.GetLedger("ETH/USD.quarter"); ledger.Amount != 1 {
+		t.Fatalf("the close should be capped at the position of the exchange, got %+v", ledger)
+	}
+}
@@ -0,0 +1,539 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// MockExchange an in-memory exchange with canned market data, used by dry runs and tests
+type MockExchange struct {
+	BaseExchange
+
+	mu        sync.Mutex
+	ticker    constant.Ticker
+	tickers   map[string]constant.Ticker // 各品种的行情, 未设置的品种使用 ticker
+	depth     constant.Depth
+	records   map[string][]constant.Record
+	account   constant.Account
+	positions []constant.Position
+	orders    []*constant.Order
+	seq       int64
+	fillRatio float64 // 每次撮合成交委托量的比例, 0 为不成交
+	logs      []MockLog
+	onSleep   func()
+	onFill    func(constant.Fill)
+}
+
+// MockLog a log recorded by the mock exchange or global
+type MockLog struct {
+	Action  string
+	Symbol  string
+	Price   float64
+	Amount  float64
+	Message string
+}
+
+// NewMockExchange create a mock exchange trading BTC/USDT around 100
+func NewMockExchange(opt constant.Option) *MockExchange {
+	e := &MockExchange{
+		ticker: constant.Ticker{Last: 100, Buy: 99.9, Sell: 100.1, Open: 100, Close: 100, High: 101, Low: 99, Vol: 1000},
+		depth: constant.Depth{
+			Asks: constant.DepthRecords{{Price: 100.1, Amount: 10}},
+			Bids: constant.DepthRecords{{Price: 99.9, Amount: 10}},
+		},
+		account: constant.Account{SubAccounts: map[string]constant.SubAccount{
+			"USDT": {StockType: "USDT", Amount: 10000},
+			"BTC":  {StockType: "BTC", Amount: 10},
+		}},
+		tickers:   make(map[string]constant.Ticker),
+		records:   make(map[string][]constant.Record),
+		fillRatio: 1,
+	}
+	e.BaseExchange.Init(opt)
+	e.SetID(opt.Index)
+	e.SetStockType("BTC/USDT")
+	e.BaseExchange.father = ExchangeBroker(e)
+	return e
+}
+
+// SetFillHandler set the handler called on every execution
+func (e *MockExchange) SetFillHandler(handler func(constant.Fill)) {
+	e.onFill = handler
+}
+
+// SetTicker set the ticker and fill the open orders crossed by it
+func (e *MockExchange) SetTicker(ticker constant.Ticker) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ticker = ticker
+	for _, order := range e.orders {
+		e.match(order)
+	}
+}
+
+// SetTickerOf set the ticker of the symbol and fill the open orders of the symbol crossed by it
+func (e *MockExchange) SetTickerOf(symbol string, ticker constant.Ticker) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tickers[symbol] = ticker
+	for _, order := range e.orders {
+		if order.StockType == symbol {
+			e.match(order)
+		}
+	}
+}
+
+// tickerOf the ticker of the symbol, called with the lock held
+func (e *MockExchange) tickerOf(symbol string) constant.Ticker {
+	if ticker, ok := e.tickers[symbol]; ok {
+		return ticker
+	}
+	return e.ticker
+}
+
+// SetRecords set the klines of the symbol
+func (e *MockExchange) SetRecords(symbol string, records []constant.Record) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records[symbol] = records
+}
+
+// SetDepth ...
+func (e *MockExchange) SetDepth(depth constant.Depth) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.depth = depth
+}
+
+// SetAccount ...
+func (e *MockExchange) SetAccount(account constant.Account) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.account = account
+}
+
+// SetPositions ...
+func (e *MockExchange) SetPositions(positions []constant.Position) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.positions = positions
+}
+
+// SetFillRatio set the ratio of the order amount filled every time the ticker crosses it
+func (e *MockExchange) SetFillRatio(ratio float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fillRatio = ratio
+}
+
+// SetSleepHook set the function called when the script sleeps
+func (e *MockExchange) SetSleepHook(fn func()) {
+	e.onSleep = fn
+}
+
+// Log record the log instead of writing database
+func (e *MockExchange) Log(action, symbol string, price, amount float64, messages string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.logs = append(e.logs, MockLog{Action: action, Symbol: symbol, Price: price, Amount: amount, Message: messages})
+}
+
+// Logs ...
+func (e *MockExchange) Logs() []MockLog {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]MockLog{}, e.logs...)
+}
+
+// Sleep ...
+func (e *MockExchange) Sleep(intervals int64) {
+	if e.onSleep != nil {
+		e.onSleep()
+	}
+}
+
+// AutoSleep ...
+func (e *MockExchange) AutoSleep() {
+	if e.onSleep != nil {
+		e.onSleep()
+	}
+}
+
+// Orders get all the orders placed, including the finished ones
+func (e *MockExchange) Orders() []constant.Order {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	orders := make([]constant.Order, 0, len(e.orders))
+	for _, order := range e.orders {
+		orders = append(orders, *order)
+	}
+	return orders
+}
+
+// match fill the order at the last price if the ticker crosses it
+func (e *MockExchange) match(order *constant.Order) {
+	if order.Status != constant.ORDER_UNFINISH && order.Status != constant.ORDER_PART_FINISH {
+		return
+	}
+	price := e.tickerOf(order.StockType).Last
+	switch order.TradeType {
+	case constant.TradeTypeBuy:
+		if order.Price >= 0 && order.Price < price {
+			return
+		}
+	case constant.TradeTypeSell:
+		if order.Price >= 0 && order.Price > price {
+			return
+		}
+	}
+	if e.fillRatio <= 0 {
+		return
+	}
+	deal := math.Min(order.Amount*e.fillRatio, order.Amount-order.DealAmount)
+	order.AvgPrice = (order.AvgPrice*order.DealAmount + price*deal) / (order.DealAmount + deal)
+	order.DealAmount += deal
+	e.settle(*order, price, deal)
+	emitFill(e.onFill, *order, price, deal, 0, time.Now().UnixNano()/int64(time.Millisecond))
+	if order.DealAmount < order.Amount {
+		order.Status = constant.ORDER_PART_FINISH
+		return
+	}
+	order.Status = constant.ORDER_FINISH
+	order.FinishedTime = time.Now().Unix()
+}
+
+// settle move the balances of the spot pair by the deal, contracts keep the balances
+func (e *MockExchange) settle(order constant.Order, price, deal float64) {
+	stocks := stockPair2Vec(order.StockType)
+	if stocks[0] == "" || strings.Contains(order.StockType, ".") || e.account.SubAccounts == nil {
+		return
+	}
+	base, quote := e.account.SubAccounts[stocks[0]], e.account.SubAccounts[stocks[1]]
+	base.StockType, quote.StockType = stocks[0], stocks[1]
+	switch order.TradeType {
+	case constant.TradeTypeBuy:
+		base.Amount += deal
+		quote.Amount -= deal * price
+	case constant.TradeTypeSell:
+		base.Amount -= deal
+		quote.Amount += deal * price
+	default:
+		return
+	}
+	e.account.SubAccounts[stocks[0]] = base
+	e.account.SubAccounts[stocks[1]] = quote
+}
+
+// placeOrder ...
+func (e *MockExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	price := req.Price
+	if req.OrderType == constant.OrderTypeMarket {
+		price = -1
+	}
+	e.mu.Lock()
+	last := e.tickerOf(req.Symbol).Last
+	crossed := price < 0 || req.Side == constant.TradeTypeBuy && price >= last ||
+		req.Side == constant.TradeTypeSell && price <= last
+	if req.PostOnly && crossed {
+		e.mu.Unlock()
+		return "", fmt.Errorf("PlaceOrder() error, the error number is post only order would take liquidity")
+	}
+	if req.TimeInForce == constant.TimeInForceFOK && (!crossed || e.fillRatio < 1) {
+		e.mu.Unlock()
+		return "", fmt.Errorf("PlaceOrder() error, the error number is fill or kill order can not be filled")
+	}
+	e.seq++
+	order := &constant.Order{
+		Id:        strconv.FormatInt(e.seq, 10),
+		ClientID:  req.ClientOrderID,
+		Price:     price,
+		Amount:    req.Amount,
+		TradeType: req.Side,
+		StockType: req.Symbol,
+		Time:      time.Now().Unix(),
+		Status:    constant.ORDER_UNFINISH,
+	}
+	e.orders = append(e.orders, order)
+	e.match(order)
+	if req.TimeInForce == constant.TimeInForceIOC && order.Status != constant.ORDER_FINISH {
+		order.Status = constant.ORDER_CANCEL
+	}
+	e.mu.Unlock()
+	e.Log(req.Side, order.StockType, price, req.Amount, req.Msg)
+	return order.Id, nil
+}
+
+// cancelOrder ...
+func (e *MockExchange) cancelOrder(symbol, orderID string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, order := range e.orders {
+		if order.Id != orderID || order.StockType != symbol {
+			continue
+		}
+		if order.Status != constant.ORDER_UNFINISH && order.Status != constant.ORDER_PART_FINISH {
+			return false, ErrCancelOrderFinished
+		}
+		order.Status = constant.ORDER_CANCEL
+		return true, nil
+	}
+	return false, ErrNotFoundOrder
+}
+
+// getOrder ...
+func (e *MockExchange) getOrder(symbol, id string) (*constant.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, order := range e.orders {
+		if order.Id == id {
+			result := *order
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFoundOrder
+}
+
+// getOrderByClientID ...
+func (e *MockExchange) getOrderByClientID(symbol, clientID string) (*constant.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, order := range e.orders {
+		if order.ClientID == clientID {
+			result := *order
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFoundOrder
+}
+
+// getOrders ...
+func (e *MockExchange) getOrders(symbol string) ([]constant.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	orders := []constant.Order{}
+	for _, order := range e.orders {
+		if order.StockType != symbol {
+			continue
+		}
+		if order.Status == constant.ORDER_UNFINISH || order.Status == constant.ORDER_PART_FINISH {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+// getTicker ...
+func (e *MockExchange) getTicker(symbol string) (*constant.Ticker, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ticker := e.tickerOf(symbol)
+	return &ticker, nil
+}
+
+// getRecords ...
+func (e *MockExchange) getRecords(symbol string) ([]constant.Record, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]constant.Record{}, e.records[symbol]...), nil
+}
+
+// getDepth ...
+func (e *MockExchange) getDepth(symbol string) (*constant.Depth, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	depth := e.depth
+	depth.StockType = symbol
+	return &depth, nil
+}
+
+// getAccount ...
+func (e *MockExchange) getAccount() (*constant.Account, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	account := constant.Account{SubAccounts: make(map[string]constant.SubAccount)}
+	for k, v := range e.account.SubAccounts {
+		account.SubAccounts[k] = v
+	}
+	return &account, nil
+}
+
+// getPosition ...
+func (e *MockExchange) getPosition(symbol string) ([]constant.Position, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	positions := []constant.Position{}
+	for _, position := range e.positions {
+		if position.StockType == symbol {
+			positions = append(positions, position)
+		}
+	}
+	return positions, nil
+}
+
+// start ...
+func (e *MockExchange) start() error {
+	return nil
+}
+
+// stop ...
+func (e *MockExchange) stop() error {
+	return nil
+}
+
+// MockGlobal a GlobalHandler recording the logs and messages in memory
+type MockGlobal struct {
+	mu        sync.Mutex
+	logs      []MockLog
+	messages  []string // ding 及邮件消息
+	states    map[string]string
+	statusLog string
+	drawPath  string
+	onSleep   func()
+}
+
+// NewMockGlobal ...
+func NewMockGlobal() *MockGlobal {
+	return &MockGlobal{states: make(map[string]string)}
+}
+
+// SetSleepHook set the function called when the script sleeps
+func (g *MockGlobal) SetSleepHook(fn func()) {
+	g.onSleep = fn
+}
+
+// Sleep ...
+func (g *MockGlobal) Sleep(intervals int64) {
+	if g.onSleep != nil {
+		g.onSleep()
+	}
+}
+
+// Log ...
+func (g *MockGlobal) Log(action, symbol string, price, amount float64, messages string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logs = append(g.logs, MockLog{Action: action, Symbol: symbol, Price: price, Amount: amount, Message: messages})
+}
+
+// Logs ...
+func (g *MockGlobal) Logs() []MockLog {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]MockLog{}, g.logs...)
+}
+
+// Messages get the messages sent by ding and mail
+func (g *MockGlobal) Messages() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string{}, g.messages...)
+}
+
+// LogStatus ...
+func (g *MockGlobal) LogStatus(messages string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.statusLog = messages
+}
+
+// DingSet ...
+func (g *MockGlobal) DingSet(token, key string) error {
+	return nil
+}
+
+// DingSend ...
+func (g *MockGlobal) DingSend(msg string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.messages = append(g.messages, msg)
+	return nil
+}
+
+// MailSet ...
+func (g *MockGlobal) MailSet(to, server, portStr, username, password string) error {
+	return nil
+}
+
+// MailSend ...
+func (g *MockGlobal) MailSend(msg string) error {
+	return g.DingSend(msg)
+}
+
+// RegisterPlugin ...
+func (g *MockGlobal) RegisterPlugin(pluginName, pluginType string) error {
+	return fmt.Errorf("RegisterPlugin() error, the error number is plugin not supported in mock")
+}
+
+// CallPlugin ...
+func (g *MockGlobal) CallPlugin(name string, params map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("CallPlugin() error, the error number is plugin not supported in mock")
+}
+
+// DrawSetPath ...
+func (g *MockGlobal) DrawSetPath(path string) {
+	g.drawPath = path
+}
+
+// DrawGetPath ...
+func (g *MockGlobal) DrawGetPath() string {
+	return g.drawPath
+}
+
+// DrawReset ...
+func (g *MockGlobal) DrawReset() {
+}
+
+// DrawKLine ...
+func (g *MockGlobal) DrawKLine(time string, open, closed, low, high float32) {
+}
+
+// DrawLine ...
+func (g *MockGlobal) DrawLine(name string, time string, data float32, shape string) {
+}
+
+// DrawPlot ...
+func (g *MockGlobal) DrawPlot() error {
+	return nil
+}
+
+// SetState ...
+func (g *MockGlobal) SetState(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.states[key] = string(data)
+	return nil
+}
+
+// GetState ...
+func (g *MockGlobal) GetState(key string) interface{} {
+	g.mu.Lock()
+	data, ok := g.states[key]
+	g.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// DelState ...
+func (g *MockGlobal) DelState(key string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.states, key)
+	return nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"strings"
+
+	goex "github.com/nntaoli-project/goex"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// okexRecordsPeriodMap the kline periods of okex.com
+var okexRecordsPeriodMap = map[string]int64{
+	"M1":  goex.KLINE_PERIOD_1MIN,
+	"M5":  goex.KLINE_PERIOD_5MIN,
+	"M15": goex.KLINE_PERIOD_15MIN,
+	"M30": goex.KLINE_PERIOD_30MIN,
+	"H1":  goex.KLINE_PERIOD_1H,
+	"H2":  goex.KLINE_PERIOD_2H,
+	"H4":  goex.KLINE_PERIOD_4H,
+	"D1":  goex.KLINE_PERIOD_1DAY,
+	"W1":  goex.KLINE_PERIOD_1WEEK,
+}
+
+// apiSecret the secret key and the passphrase of the exchange,
+// the secret key of okex is set as "secretkey:passphrase"
+func apiSecret(opt constant.Option) (string, string) {
+	switch opt.Type {
+	case constant.OKEx, constant.OKExFuture, constant.OKExSwap:
+		if i := strings.Index(opt.SecretKey, ":"); i >= 0 {
+			return opt.SecretKey[:i], opt.SecretKey[i+1:]
+		}
+	}
+	return opt.SecretKey, ""
+}
+
+// NewOKExExchange create an exchange struct of the spot of okex.com
+func NewOKExExchange(opt constant.Option) (Exchange, error) {
+	exchange := NewSpotExchange(opt)
+	exchange.SetStockTypeMap(map[string]goex.CurrencyPair{
+		"BTC/USDT": goex.BTC_USDT,
+		"ETH/USDT": goex.ETH_USDT,
+		"EOS/USDT": goex.EOS_USDT,
+		"LTC/USDT": goex.LTC_USDT,
+		"ETH/BTC":  goex.ETH_BTC,
+	})
+	exchange.SetMinAmountMap(map[string]float64{
+		"BTC/USDT": 0.00001,
+		"ETH/USDT": 0.0001,
+		"EOS/USDT": 0.01,
+		"LTC/USDT": 0.001,
+		"ETH/BTC":  0.001,
+	})
+	exchange.SetTickSizeMap(map[string]float64{
+		"BTC/USDT": 0.1,
+		"ETH/USDT": 0.01,
+		"EOS/USDT": 0.0001,
+		"LTC/USDT": 0.01,
+		"ETH/BTC":  0.00001,
+	})
+	exchange.SetRecordsPeriodMap(okexRecordsPeriodMap)
+	if err := exchange.Init(opt); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
+
+// NewOKExFutureExchange create an exchange struct of the delivery futures of okex.com,
+// e.g. BTC/USD.quarter, the quarter contract by default
+func NewOKExFutureExchange(opt constant.Option) (Exchange, error) {
+	exchange := NewFutureExchange(opt)
+	exchange.SetStockTypeMap(map[string]goex.CurrencyPair{
+		"BTC/USD": goex.BTC_USD,
+		"ETH/USD": goex.ETH_USD,
+		"EOS/USD": goex.EOS_USD,
+		"LTC/USD": goex.LTC_USD,
+	})
+	exchange.SetContractTypeMap(map[string]string{
+		"":           goex.QUARTER_CONTRACT,
+		"this_week":  goex.THIS_WEEK_CONTRACT,
+		"next_week":  goex.NEXT_WEEK_CONTRACT,
+		"quarter":    goex.QUARTER_CONTRACT,
+		"bi_quarter": goex.BI_QUARTER_CONTRACT,
+	})
+	// 数量为合约张数
+	exchange.SetMinAmountMap(map[string]float64{
+		"BTC/USD": 1,
+		"ETH/USD": 1,
+		"EOS/USD": 1,
+		"LTC/USD": 1,
+	})
+	exchange.SetTickSizeMap(map[string]float64{
+		"BTC/USD": 0.1,
+		"ETH/USD": 0.01,
+		"EOS/USD": 0.001,
+		"LTC/USD": 0.01,
+	})
+	exchange.SetRecordsPeriodMap(okexRecordsPeriodMap)
+	if err := exchange.Init(opt); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
+
+// NewOKExSwapExchange create an exchange struct of the perpetual swaps of okex.com, e.g. BTC/USDT.swap
+func NewOKExSwapExchange(opt constant.Option) (Exchange, error) {
+	exchange := NewFutureExchange(opt)
+	exchange.SetStockTypeMap(map[string]goex.CurrencyPair{
+		"BTC/USD":  goex.BTC_USD,
+		"ETH/USD":  goex.ETH_USD,
+		"BTC/USDT": goex.BTC_USDT,
+		"ETH/USDT": goex.ETH_USDT,
+	})
+	exchange.SetContractTypeMap(map[string]string{
+		"":     goex.SWAP_CONTRACT,
+		"swap": goex.SWAP_CONTRACT,
+	})
+	exchange.SetMinAmountMap(map[string]float64{
+		"BTC/USD":  1,
+		"ETH/USD":  1,
+		"BTC/USDT": 1,
+		"ETH/USDT": 1,
+	})
+	exchange.SetTickSizeMap(map[string]float64{
+		"BTC/USD":  0.1,
+		"ETH/USD":  0.01,
+		"BTC/USDT": 0.1,
+		"ETH/USDT": 0.01,
+	})
+	exchange.SetRecordsPeriodMap(okexRecordsPeriodMap)
+	if err := exchange.Init(opt); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	goex "github.com/nntaoli-project/goex"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestOKExFutureSymbol(t *testing.T) {
+	exchange, err := NewOKExFutureExchange(constant.Option{Type: constant.OKExFuture, BackLog: true})
+	if err != nil {
+		t.Fatalf("new exchange: %v", err)
+	}
+	e := exchange.(*FutureExchange)
+	for stockType, want := range map[string][2]string{
+		"BTC/USD":           {"BTC/USD", goex.QUARTER_CONTRACT},
+		"BTC/USD.this_week": {"BTC/USD", goex.THIS_WEEK_CONTRACT},
+		"BTC/USD.swap":      {"", "swap"},
+	} {
+		if symbol, contract := e.getSymbol(stockType); symbol != want[0] || contract != want[1] {
+			t.Fatalf("%s: got %s %s", stockType, symbol, contract)
+		}
+	}
+	if e.GetTickSizeMap()["BTC/USD"] != 0.1 || e.GetMinAmountMap()["BTC/USD"] != 1 {
+		t.Fatalf("unexpected tick size or min amount")
+	}
+}
+
+func TestAPISecret(t *testing.T) {
+	if secret, passphrase := apiSecret(constant.Option{Type: constant.OKExSwap, SecretKey: "abc:p:q"}); secret != "abc" || passphrase != "p:q" {
+		t.Fatalf("got %s %s", secret, passphrase)
+	}
+	if secret, passphrase := apiSecret(constant.Option{Type: constant.Binance, SecretKey: "abc:p"}); secret != "abc:p" || passphrase != "" {
+		t.Fatalf("got %s %s", secret, passphrase)
+	}
+}
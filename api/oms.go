@@ -0,0 +1,583 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// exchange the embedded Exchange, otto can not look up the fields of an embedded interface by its name
+type exchange = Exchange
+
+// openStatus the status of the orders still working
+var openStatus = []constant.TradeStatus{constant.ORDER_UNFINISH, constant.ORDER_PART_FINISH, constant.ORDER_CANCEL_ING}
+
+// OMS track the orders placed through the exchange and persist their lifecycle
+type OMS struct {
+	exchange
+	mu      sync.Mutex
+	logger  model.Logger
+	option  constant.Option
+	persist bool
+	orders  map[string]*model.Order // order id -> order
+	clients map[string]string       // client id -> order id
+	list    []*model.Order          // orders in the placed sequence
+	pushed  bool                    // the exchange pushes its fills
+	dealt   map[string]float64      // pushed fills of the orders not tracked yet
+	ledgers map[string]*model.Ledger
+	fills   []model.Fill // 回测的成交只保存在内存中
+	risk    constant.RiskLimit
+	halted  bool               // 被紧急停止, 不再接受下单
+	marks   map[string]float64 // 各品种最新价
+	day     string             // 当日
+	dayBase float64            // 当日开始时的已实现盈亏
+	done    chan struct{}      // 停止定时对账
+}
+
+// NewOMS wrap the exchange, the working orders of the last run are loaded when persist
+func NewOMS(e Exchange, opt constant.Option) *OMS {
+	o := &OMS{
+		exchange: e,
+		logger:   model.Logger{TraderID: opt.TraderID, ExchangeType: opt.Type, Back: opt.BackLog},
+		option:   opt,
+		persist:  !opt.BackTest && !opt.BackLog,
+		orders:   make(map[string]*model.Order),
+		clients:  make(map[string]string),
+		ledgers:  make(map[string]*model.Ledger),
+		dealt:    make(map[string]float64),
+		marks:    make(map[string]float64),
+	}
+	if notifier, ok := e.(fillNotifier); ok {
+		notifier.SetFillHandler(o.fill)
+		o.pushed = true
+	}
+	if !o.persist {
+		return o
+	}
+	var status []string
+	for _, s := range openStatus {
+		status = append(status, s.String())
+	}
+	orders, err := model.ListOpenOrder(opt.TraderID, opt.Type, opt.Name, status)
+	if err != nil {
+		o.logger.Log(constant.ERROR, "", 0.0, 0.0, "NewOMS() error, the error number is ", err.Error())
+		return o
+	}
+	for i := range orders {
+		o.track(&orders[i])
+	}
+	ledgers, err := model.ListTraderLedger(opt.TraderID)
+	if err != nil {
+		o.logger.Log(constant.ERROR, "", 0.0, 0.0, "NewOMS() error, the error number is ", err.Error())
+		return o
+	}
+	for i := range ledgers {
+		if ledgers[i].ExchangeID == opt.ExchangeID {
+			o.ledgers[ledgers[i].StockType] = &ledgers[i]
+		}
+	}
+	return o
+}
+
+// parseStatus ...
+func parseStatus(status string) constant.TradeStatus {
+	for s := constant.ORDER_UNFINISH; s <= constant.ORDER_FAIL; s++ {
+		if constant.TradeStatus(s).String() == status {
+			return constant.TradeStatus(s)
+		}
+	}
+	return constant.ORDER_UNFINISH
+}
+
+// finished whether the order will not change any more
+func finished(status constant.TradeStatus) bool {
+	for _, s := range openStatus {
+		if s == status {
+			return false
+		}
+	}
+	return true
+}
+
+// track add the order to the local order book
+func (o *OMS) track(order *model.Order) {
+	o.list = append(o.list, order)
+	if order.OrderID != "" {
+		o.orders[order.OrderID] = order
+	}
+	if order.ClientID != "" {
+		o.clients[order.ClientID] = order.OrderID
+	}
+	if amount, ok := o.dealt[order.OrderID]; ok && order.OrderID != "" {
+		delete(o.dealt, order.OrderID)
+		o.deal(order, amount)
+	}
+}
+
+// deal apply the pushed execution to the order
+func (o *OMS) deal(order *model.Order, amount float64) {
+	from := parseStatus(order.Status)
+	if finished(from) {
+		return
+	}
+	order.DealAmount += amount
+	to := constant.TradeStatus(constant.ORDER_PART_FINISH)
+	if order.DealAmount >= order.Amount {
+		to = constant.ORDER_FINISH
+	}
+	order.Status = to.String()
+	if from != to {
+		o.logger.Log(constant.INFO, order.StockType, order.Price, order.Amount,
+			fmt.Sprintf("order %s %s -> %s", order.OrderID, from, to))
+	}
+	o.save(order)
+}
+
+// save persist the order
+func (o *OMS) save(order *model.Order) {
+	if !o.persist {
+		return
+	}
+	if err := model.SaveOrder(order); err != nil {
+		o.logger.Log(constant.ERROR, order.StockType, order.Price, order.Amount, "SaveOrder() error, the error number is ", err.Error())
+	}
+}
+
+// Buy ...
+func (o *OMS) Buy(price, amount, msg string) (string, error) {
+	return placeString(o, constant.TradeTypeBuy, price, amount, msg)
+}
+
+// Sell ...
+func (o *OMS) Sell(price, amount, msg string) (string, error) {
+	return placeString(o, constant.TradeTypeSell, price, amount, msg)
+}
+
+// PlaceOrder place the order with a client order id and record it
+func (o *OMS) PlaceOrder(req constant.OrderRequest) (string, error) {
+	return o.submit(req, true)
+}
+
+// submit place and record the order, the halt and risk limits are not checked when closing by the kill switch
+func (o *OMS) submit(req constant.OrderRequest, check bool) (string, error) {
+	if req.ClientOrderID == "" {
+		req.ClientOrderID = o.exchange.NewClientOrderID()
+	}
+	if req.Symbol == "" {
+		req.Symbol = o.GetStockType()
+	}
+	o.mu.Lock()
+	_, placed := o.clients[req.ClientOrderID]
+	o.mu.Unlock()
+	if placed {
+		return o.exchange.PlaceOrder(req)
+	}
+	var id string
+	var err error
+	checked := req
+	o.mu.Lock()
+	halted := o.halted
+	o.mu.Unlock()
+	if check && halted {
+		err = fmt.Errorf("PlaceOrder() error, the error number is trading halted by the kill switch")
+		o.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+	} else if check && normalizeOrder(&checked) == nil {
+		// 无效的请求交由交易所返回错误
+		if err = o.checkRisk(checked); err != nil {
+			err = fmt.Errorf("PlaceOrder() error, the error number is risk: %s", err.Error())
+			o.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+		}
+	}
+	if err == nil {
+		id, err = o.exchange.PlaceOrder(req)
+	}
+	order := &model.Order{
+		TraderID:     o.option.TraderID,
+		ExchangeType: o.option.Type,
+		ExchangeName: o.option.Name,
+		StockType:    req.Symbol,
+		OrderID:      id,
+		ClientID:     req.ClientOrderID,
+		Side:         req.Side,
+		OrderType:    checked.OrderType,
+		TimeInForce:  checked.TimeInForce,
+		Price:        req.Price,
+		Amount:       req.Amount,
+		Status:       constant.TradeStatus(constant.ORDER_UNFINISH).String(),
+		Message:      req.Msg,
+	}
+	if err != nil {
+		order.Status = constant.TradeStatus(constant.ORDER_REJECT).String()
+		order.Message = err.Error()
+	}
+	o.mu.Lock()
+	if err == nil {
+		o.track(order)
+	} else {
+		o.list = append(o.list, order)
+	}
+	o.save(order)
+	o.mu.Unlock()
+	return id, err
+}
+
+// unplaced the local order placed with the client id whose result is unknown, must hold the lock
+func (o *OMS) unplaced(clientID string) *model.Order {
+	if clientID == "" {
+		return nil
+	}
+	for _, order := range o.list {
+		if order.ClientID == clientID && order.OrderID == "" {
+			return order
+		}
+	}
+	return nil
+}
+
+// update apply the order queried from the exchange to the local order book,
+// only the orders placed by this OMS are tracked, the others are ignored
+func (o *OMS) update(order constant.Order) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	local, matched := o.orders[order.Id], false
+	if local == nil {
+		// 下单结果未知的订单, 按客户端订单号找回
+		if local = o.unplaced(order.ClientID); local == nil {
+			return
+		}
+		matched = true
+		local.OrderID = order.Id
+		o.orders[order.Id] = local
+		o.clients[local.ClientID] = order.Id
+		delete(o.dealt, order.Id)
+	}
+	from := parseStatus(local.Status)
+	if finished(from) && !matched {
+		return
+	}
+	changed := matched || from != order.Status || local.DealAmount != order.DealAmount
+	if fill, ok := inferFill(*local, order); ok && !o.pushed {
+		o.record(fill)
+	}
+	local.Status = order.Status.String()
+	local.DealAmount = order.DealAmount
+	local.AvgPrice = order.AvgPrice
+	local.Fee = order.Fee
+	if !changed {
+		return
+	}
+	if from != order.Status {
+		o.logger.Log(constant.INFO, local.StockType, local.Price, local.Amount,
+			fmt.Sprintf("order %s %s -> %s", local.OrderID, from, order.Status))
+	}
+	o.save(local)
+}
+
+// fill the handler of the fills pushed by the exchange
+func (o *OMS) fill(fill constant.Fill) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if order := o.orders[fill.OrderID]; order != nil {
+		o.deal(order, fill.Amount)
+	} else {
+		// 下单时立即成交, 订单还未记录
+		o.dealt[fill.OrderID] += fill.Amount
+	}
+	o.record(fill)
+}
+
+// record persist the fill and apply it to the position ledger
+func (o *OMS) record(fill constant.Fill) {
+	if fill.StockType == "" {
+		fill.StockType = o.GetStockType()
+	}
+	o.rollDay()
+	ledger := o.ledgers[fill.StockType]
+	if o.persist {
+		// 账本按交易员, 交易所及品种记录, 每次从数据库读取
+		l, err := model.GetLedger(o.option.TraderID, o.option.ExchangeID, fill.StockType)
+		if err != nil {
+			o.logger.Log(constant.ERROR, fill.StockType, fill.Price, fill.Amount, "GetLedger() error, the error number is ", err.Error())
+			return
+		}
+		ledger = &l
+	} else if ledger == nil {
+		ledger = &model.Ledger{TraderID: o.option.TraderID, ExchangeID: o.option.ExchangeID, StockType: fill.StockType}
+	}
+	o.ledgers[fill.StockType] = ledger
+	ledger.Apply(fill)
+	if o.marks[fill.StockType] == 0 {
+		o.marks[fill.StockType] = fill.Price
+	}
+	record := model.Fill{
+		TraderID:     o.option.TraderID,
+		ExchangeType: o.option.Type,
+		ExchangeName: o.option.Name,
+		StockType:    fill.StockType,
+		OrderID:      fill.OrderID,
+		ClientID:     fill.ClientID,
+		Side:         fill.Side,
+		Price:        fill.Price,
+		Amount:       fill.Amount,
+		Fee:          fill.Fee,
+		Time:         fill.Time,
+	}
+	if !o.persist {
+		o.fills = append(o.fills, record)
+		return
+	}
+	if err := model.AddFill(&record); err != nil {
+		o.logger.Log(constant.ERROR, fill.StockType, fill.Price, fill.Amount, "AddFill() error, the error number is ", err.Error())
+	}
+	if err := model.SaveLedger(ledger); err != nil {
+		o.logger.Log(constant.ERROR, fill.StockType, fill.Price, fill.Amount, "SaveLedger() error, the error number is ", err.Error())
+	}
+}
+
+// GetTicker get the ticker and keep the last price as the mark of the symbol
+func (o *OMS) GetTicker() (*constant.Ticker, error) {
+	return o.GetTickerOf(o.GetStockType())
+}
+
+// GetTickerOf get the ticker of the symbol and keep the last price as its mark
+func (o *OMS) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	if symbol == "" {
+		symbol = o.GetStockType()
+	}
+	ticker, err := o.exchange.GetTickerOf(symbol)
+	if err == nil && ticker != nil && ticker.Last > 0 {
+		o.mu.Lock()
+		o.marks[symbol] = ticker.Last
+		o.mu.Unlock()
+	}
+	return ticker, err
+}
+
+// mark the last price of the symbol
+func (o *OMS) mark(stockType string) float64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.marks[stockType]
+}
+
+// Marks the last prices of the symbols queried
+func (o *OMS) Marks() map[string]float64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	marks := make(map[string]float64, len(o.marks))
+	for symbol, price := range o.marks {
+		marks[symbol] = price
+	}
+	return marks
+}
+
+// GetOption ...
+func (o *OMS) GetOption() constant.Option {
+	return o.option
+}
+
+// GetLedger get the position ledger of the symbol
+func (o *OMS) GetLedger(stockType string) model.Ledger {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ledger := o.ledgers[stockType]; ledger != nil {
+		return *ledger
+	}
+	return model.Ledger{TraderID: o.option.TraderID, ExchangeID: o.option.ExchangeID, StockType: stockType}
+}
+
+// GetFills the fills recorded in memory by the backtest, the live ones are saved in the database
+func (o *OMS) GetFills() []model.Fill {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]model.Fill(nil), o.fills...)
+}
+
+// refresh query the order of the symbol from the exchange and update the local order book
+func (o *OMS) refresh(symbol, id string) (*constant.Order, error) {
+	order, err := o.exchange.GetOrderOf(symbol, id)
+	if err == nil && order != nil {
+		o.update(*order)
+	}
+	return order, err
+}
+
+// symbolOf the symbol of the local order, the current stock type for the unknown ones
+func (o *OMS) symbolOf(id string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if order := o.orders[id]; order != nil && order.StockType != "" {
+		return order.StockType
+	}
+	return o.GetStockType()
+}
+
+// GetOrder ...
+func (o *OMS) GetOrder(id string) (*constant.Order, error) {
+	return o.refresh(o.symbolOf(id), id)
+}
+
+// GetOrderOf ...
+func (o *OMS) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	if symbol == "" {
+		symbol = o.symbolOf(id)
+	}
+	return o.refresh(symbol, id)
+}
+
+// GetOrderByClientID ...
+func (o *OMS) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	o.mu.Lock()
+	id, ok := o.clients[clientID]
+	o.mu.Unlock()
+	if !ok {
+		order, err := o.exchange.GetOrderByClientID(clientID)
+		if err == nil && order != nil {
+			o.update(*order)
+		}
+		return order, err
+	}
+	order, err := o.refresh(o.symbolOf(id), id)
+	if order != nil {
+		order.ClientID = clientID
+	}
+	return order, err
+}
+
+// GetOrders get the unfilled orders and reconcile the local order book with them
+func (o *OMS) GetOrders() ([]constant.Order, error) {
+	return o.GetOrdersOf(o.GetStockType())
+}
+
+// GetOrdersOf get the unfilled orders of the symbol and reconcile the local order book with them
+func (o *OMS) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	if symbol == "" {
+		symbol = o.GetStockType()
+	}
+	orders, err := o.exchange.GetOrdersOf(symbol)
+	if err != nil {
+		return orders, err
+	}
+	o.reconcile(symbol, orders)
+	return orders, nil
+}
+
+// reconcile the orders of the symbol missing from the unfilled orders have been finished, query their final status
+func (o *OMS) reconcile(stockType string, orders []constant.Order) {
+	open := make(map[string]bool)
+	for _, order := range orders {
+		open[order.Id] = true
+		o.update(order)
+	}
+	var missing []string
+	o.mu.Lock()
+	for id, order := range o.orders {
+		if !open[id] && order.StockType == stockType && !finished(parseStatus(order.Status)) {
+			missing = append(missing, id)
+		}
+	}
+	o.mu.Unlock()
+	for _, id := range missing {
+		o.refresh(stockType, id)
+	}
+}
+
+// Reconcile sync the local order book of the current symbol and every symbol having local open orders with the exchange
+func (o *OMS) Reconcile() error {
+	var errs []string
+	for _, symbol := range o.openSymbols() {
+		if _, err := o.GetOrdersOf(symbol); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s", symbol, err.Error()))
+		}
+	}
+	return joinErrors("Reconcile", errs)
+}
+
+// StartReconcile reconcile the symbols having local open orders every interval until StopReconcile,
+// so the fills of the orders the strategy does not poll are recorded
+func (o *OMS) StartReconcile(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done != nil {
+		return
+	}
+	done := make(chan struct{})
+	o.done = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, symbol := range o.localSymbols() {
+					if _, err := o.GetOrdersOf(symbol); err != nil {
+						o.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "Reconcile() error, the error number is ", err.Error())
+					}
+				}
+			}
+		}
+	}()
+}
+
+// StopReconcile ...
+func (o *OMS) StopReconcile() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done != nil {
+		close(o.done)
+		o.done = nil
+	}
+}
+
+// localSymbols the symbols having local open orders
+func (o *OMS) localSymbols() []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, order := range o.GetLocalOrders(true) {
+		if order.StockType != "" && !seen[order.StockType] {
+			seen[order.StockType] = true
+			symbols = append(symbols, order.StockType)
+		}
+	}
+	return symbols
+}
+
+// CancelOrder ...
+func (o *OMS) CancelOrder(orderID string) (bool, error) {
+	return o.CancelOrderOf(o.symbolOf(orderID), orderID)
+}
+
+// CancelOrderOf ...
+func (o *OMS) CancelOrderOf(symbol, orderID string) (bool, error) {
+	if symbol == "" {
+		symbol = o.symbolOf(orderID)
+	}
+	result, err := o.exchange.CancelOrderOf(symbol, orderID)
+	if err != nil {
+		return result, err
+	}
+	o.refresh(symbol, orderID)
+	return result, nil
+}
+
+// GetLocalOrders get the orders in the local order book, only the working ones if open
+func (o *OMS) GetLocalOrders(open bool) []model.Order {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var orders []model.Order
+	for _, order := range o.list {
+		if open && finished(parseStatus(order.Status)) {
+			continue
+		}
+		orders = append(orders, *order)
+	}
+	return orders
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+func TestOMS(t *testing.T) {
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	mock.SetTicker(constant.Ticker{Last: 100})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+
+	id, err := o.Buy("99", "1", "")
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if _, err := o.PlaceOrder(constant.OrderRequest{Side: "long", Price: 1, Amount: 1}); err == nil {
+		t.Fatalf("invalid side should fail")
+	}
+	orders := o.GetLocalOrders(false)
+	if len(orders) != 2 || orders[0].OrderID != id || orders[0].ClientID == "" || orders[1].Status != "REJECT" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+
+	// 成交后从未完成订单中消失, 对账时查询最终状态
+	mock.SetTicker(constant.Ticker{Last: 98})
+	if err := o.Reconcile(); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if open := o.GetLocalOrders(true); len(open) != 0 {
+		t.Fatalf("expect no open orders, got %+v", open)
+	}
+	if order := o.GetLocalOrders(false)[0]; order.Status != "FINISH" || order.DealAmount != 1 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	if ledger := o.GetLedger("BTC/USDT"); ledger.Amount != 1 || ledger.AvgPrice != 98 {
+		t.Fatalf("unexpected ledger %+v", ledger)
+	}
+	if fills := o.GetFills(); len(fills) != 1 || fills[0].OrderID != id || fills[0].Price != 98 || fills[0].Amount != 1 {
+		t.Fatalf("the backtest fills should be kept in memory, got %+v", fills)
+	}
+
+	id, _ = o.Sell("105", "2", "")
+	o.CancelOrder(id)
+	if order := o.GetLocalOrders(false)[2]; order.Status != "CANCEL" {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	// 其他程序下的订单不记录
+	mock.placeOrder(constant.OrderRequest{Symbol: "BTC/USDT", Side: constant.TradeTypeBuy, Price: 90, Amount: 1})
+	if o.Reconcile(); len(o.GetLocalOrders(false)) != 3 {
+		t.Fatalf("foreign orders should be ignored, got %+v", o.GetLocalOrders(false))
+	}
+
+	// 下单结果未知的订单, 按客户端订单号找回
+	o.mu.Lock()
+	o.list = append(o.list, &model.Order{StockType: "BTC/USDT", ClientID: "lost", Side: constant.TradeTypeBuy,
+		Price: 91, Amount: 1, Status: "REJECT"})
+	o.mu.Unlock()
+	mock.placeOrder(constant.OrderRequest{Symbol: "BTC/USDT", Side: constant.TradeTypeBuy, Price: 91, Amount: 1, ClientOrderID: "lost"})
+	if order, err := o.GetOrderByClientID("lost"); err != nil || order.ClientID != "lost" {
+		t.Fatalf("get by client id: %+v %v", order, err)
+	}
+	if order := o.GetLocalOrders(false)[3]; order.OrderID == "" || order.Status != "UNFINISH" {
+		t.Fatalf("the unknown order should be matched, got %+v", order)
+	}
+}
+
+func TestOMSReconcileTimer(t *testing.T) {
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	mock.SetTicker(constant.Ticker{Last: 100})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+	if _, err := o.Buy("99", "1", ""); err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	mock.SetTicker(constant.Ticker{Last: 98})
+	o.StartReconcile(10 * time.Millisecond)
+	defer o.StopReconcile()
+	// 策略不查询订单, 成交由定时对账记录
+	deadline := time.Now().Add(time.Second)
+	for o.GetLedger("BTC/USDT").Amount != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the fill should be recorded by the reconciliation, got %+v", o.GetLedger("BTC/USDT"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInferFill(t *testing.T) {
+	last := model.Order{Side: constant.TradeTypeBuy, Price: 100, Amount: 3, DealAmount: 1, AvgPrice: 100}
+	fill, ok := inferFill(last, constant.Order{Price: 100, Amount: 3, DealAmount: 3, AvgPrice: 99})
+	if !ok || fill.Amount != 2 || fill.Price != 98.5 || fill.Side != constant.TradeTypeBuy {
+		t.Fatalf("unexpected fill %+v", fill)
+	}
+	if _, ok := inferFill(last, constant.Order{DealAmount: 1}); ok {
+		t.Fatalf("no execution should not infer a fill")
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	goex "github.com/nntaoli-project/goex"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/util"
+)
+
+// orderPlacer ...
+type orderPlacer interface {
+	PlaceOrder(req constant.OrderRequest) (string, error)
+}
+
+// parseOrder convert the string arguments of Buy and Sell, price "-1" means market order
+func parseOrder(side, price, amount, msg string) (req constant.OrderRequest, err error) {
+	req = constant.OrderRequest{Side: side, OrderType: constant.OrderTypeLimit, Msg: msg}
+	if price == "-1" {
+		req.OrderType = constant.OrderTypeMarket
+	} else if req.Price, err = util.Float64(price); err != nil {
+		return req, fmt.Errorf("invalid price %s", price)
+	}
+	if req.Amount, err = util.Float64(amount); err != nil {
+		return req, fmt.Errorf("invalid amount %s", amount)
+	}
+	return
+}
+
+// placeString the string API of Buy and Sell
+func placeString(placer orderPlacer, side, price, amount, msg string) (string, error) {
+	req, err := parseOrder(side, price, amount, msg)
+	if err != nil {
+		if side == constant.TradeTypeBuy {
+			return "", fmt.Errorf("Buy() error, the error number is %s", err.Error())
+		}
+		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
+	}
+	return placer.PlaceOrder(req)
+}
+
+// normalizeOrder fill the defaults and check the request
+func normalizeOrder(req *constant.OrderRequest) error {
+	if req.OrderType == "" {
+		req.OrderType = constant.OrderTypeLimit
+	}
+	if req.TimeInForce == "" {
+		req.TimeInForce = constant.TimeInForceGTC
+	}
+	switch {
+	case req.Side != constant.TradeTypeBuy && req.Side != constant.TradeTypeSell:
+		return fmt.Errorf("PlaceOrder() error, the error number is invalid side %s", req.Side)
+	case req.Amount <= 0:
+		return fmt.Errorf("PlaceOrder() error, the error number is invalid amount %v", req.Amount)
+	}
+	switch req.OrderType {
+	case constant.OrderTypeLimit:
+		if req.Price <= 0 {
+			return fmt.Errorf("PlaceOrder() error, the error number is invalid price %v", req.Price)
+		}
+	case constant.OrderTypeMarket:
+		if req.PostOnly {
+			return fmt.Errorf("PlaceOrder() error, the error number is market order can not be post only")
+		}
+	default:
+		return fmt.Errorf("PlaceOrder() error, the error number is invalid order type %s", req.OrderType)
+	}
+	switch req.TimeInForce {
+	case constant.TimeInForceGTC:
+	case constant.TimeInForceIOC, constant.TimeInForceFOK:
+		if req.PostOnly {
+			return fmt.Errorf("PlaceOrder() error, the error number is post only order must be GTC")
+		}
+	default:
+		return fmt.Errorf("PlaceOrder() error, the error number is invalid time in force %s", req.TimeInForce)
+	}
+	return nil
+}
+
+// orderPrice the price argument of the goex api, "-1" for market order
+func orderPrice(req constant.OrderRequest) string {
+	if req.OrderType == constant.OrderTypeMarket {
+		return "-1"
+	}
+	return strconv.FormatFloat(req.Price, 'f', -1, 64)
+}
+
+// orderAmount ...
+func orderAmount(req constant.OrderRequest) string {
+	return strconv.FormatFloat(req.Amount, 'f', -1, 64)
+}
+
+// limitOptions convert post only and time in force to the goex options
+func limitOptions(req constant.OrderRequest) (opts []goex.LimitOrderOptionalParameter) {
+	switch {
+	case req.PostOnly:
+		opts = append(opts, goex.PostOnly)
+	case req.TimeInForce == constant.TimeInForceIOC:
+		opts = append(opts, goex.Ioc)
+	case req.TimeInForce == constant.TimeInForceFOK:
+		opts = append(opts, goex.Fok)
+	}
+	return
+}
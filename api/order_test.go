@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestParseOrder(t *testing.T) {
+	req, err := parseOrder(constant.TradeTypeBuy, "-1", "2", "")
+	if err != nil || req.OrderType != constant.OrderTypeMarket || req.Amount != 2 {
+		t.Fatalf("market order: %+v %v", req, err)
+	}
+	if _, err := parseOrder(constant.TradeTypeBuy, "abc", "2", ""); err == nil {
+		t.Fatalf("invalid price should fail")
+	}
+	if _, err := parseOrder(constant.TradeTypeSell, "100", "", ""); err == nil {
+		t.Fatalf("invalid amount should fail")
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	e := NewMockExchange(constant.Option{BackLog: true})
+	cases := []struct {
+		req    constant.OrderRequest
+		ok     bool
+		status constant.TradeStatus
+	}{
+		{constant.OrderRequest{Side: "long", Price: 100, Amount: 1}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Amount: 1}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, OrderType: constant.OrderTypeMarket, Amount: 1, PostOnly: true}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 99, Amount: 1, TimeInForce: "DAY"}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 101, Amount: 1, PostOnly: true}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 99, Amount: 1, PostOnly: true}, true, constant.ORDER_UNFINISH},
+		{constant.OrderRequest{Side: constant.TradeTypeSell, Price: 101, Amount: 1, TimeInForce: constant.TimeInForceIOC}, true, constant.ORDER_CANCEL},
+		{constant.OrderRequest{Side: constant.TradeTypeSell, Price: 101, Amount: 1, TimeInForce: constant.TimeInForceFOK}, false, 0},
+		{constant.OrderRequest{Side: constant.TradeTypeSell, OrderType: constant.OrderTypeMarket, Amount: 1, ClientOrderID: "c1"}, true, constant.ORDER_FINISH},
+	}
+	for i, c := range cases {
+		id, err := e.PlaceOrder(c.req)
+		if (err == nil) != c.ok {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		order, err := e.GetOrder(id)
+		if err != nil || order.Status != c.status || order.ClientID == "" ||
+			c.req.ClientOrderID != "" && order.ClientID != c.req.ClientOrderID {
+			t.Fatalf("case %d: unexpected order %+v %v", i, order, err)
+		}
+	}
+}
+
+func TestSubmitOrder(t *testing.T) {
+	e := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	req := constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 99, Amount: 1, ClientOrderID: "c1"}
+	id, err := e.PlaceOrder(req)
+	if err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+	if again, err := e.PlaceOrder(req); err != nil || again != id || len(e.Orders()) != 1 {
+		t.Fatalf("same client id should not resubmit: %s %v", again, err)
+	}
+	if order, err := e.GetOrderByClientID("c1"); err != nil || order.Id != id {
+		t.Fatalf("get by client id: %+v %v", order, err)
+	}
+
+	// 请求超时但订单已提交, 应按客户端订单号查询到该订单而不重复下单
+	calls := 0
+	timeout := func(req constant.OrderRequest) (string, error) {
+		calls++
+		e.placeOrder(req)
+		return "", fmt.Errorf("net/http: request timeout")
+	}
+	req = constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 98, Amount: 2, OrderType: constant.OrderTypeLimit}
+	id, err = e.submitOrder(e.clientLookup(), req, timeout)
+	if err != nil || calls != 1 || len(e.Orders()) != 2 {
+		t.Fatalf("uncertain submit: %s %v, %d calls", id, err, calls)
+	}
+	if order, _ := e.GetOrder(id); order == nil || order.Price != 98 {
+		t.Fatalf("found the wrong order %+v", order)
+	}
+
+	// 另一个相同价格数量的订单不能被认领, 网关超时同样结果未知
+	calls = 0
+	lost := func(req constant.OrderRequest) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", fmt.Errorf("HttpStatusCode:504 ,Desc:Gateway Timeout")
+		}
+		return e.placeOrder(req)
+	}
+	id, err = e.submitOrder(e.clientLookup(), req, lost)
+	if err != nil || calls != 2 || len(e.Orders()) != 3 {
+		t.Fatalf("not found order should be resubmitted: %s %v, %d calls", id, err, calls)
+	}
+	if order, _ := e.GetOrder(id); order == nil || order.Id != e.Orders()[2].Id {
+		t.Fatalf("claimed the wrong order %+v", order)
+	}
+
+	// 不支持按客户端订单号查询时, 结果未知不重复提交
+	calls = 0
+	if _, err = e.submitOrder(nil, req, lost); err == nil || calls != 1 || len(e.Orders()) != 3 {
+		t.Fatalf("order should not be resubmitted without a lookup: %v, %d calls", err, calls)
+	}
+}
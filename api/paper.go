@@ -0,0 +1,383 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// paperAccount the key of the initial paper account in config.ini, e.g. "USDT:10000,BTC:1"
+const paperAccount = "paperaccount"
+
+// paperKeepOrders the finished orders kept in the paper account
+const paperKeepOrders = 500
+
+// paperState the simulated account persisted per trader
+type paperState struct {
+	Account  constant.Account
+	Pending  map[string]*constant.Order
+	Finished map[string]*constant.Order
+	Prefix   string
+	Seq      int64
+}
+
+// PaperExchange a live exchange trading on paper, the market data forwarded to the venue
+// and the orders matched by the spot backtest engine against the live tickers
+type PaperExchange struct {
+	Exchange // 实盘交易所, 只用于行情
+
+	engine *ExchangeBack
+	store  paperStore
+}
+
+// NewPaperExchange wrap the live exchange with a simulated account, the spot symbols like BTC/USDT supported
+func NewPaperExchange(live Exchange, opt constant.Option) *PaperExchange {
+	name := fmt.Sprintf("paper.%s.%d", opt.Type, opt.ExchangeID)
+	return newPaperExchange(live, opt, stateStore{traderID: opt.TraderID, name: name})
+}
+
+// newPaperExchange ...
+func newPaperExchange(live Exchange, opt constant.Option, store paperStore) *PaperExchange {
+	engine := &ExchangeBack{name: opt.Type}
+	engine.BaseExchange.Init(opt)
+	engine.SetID(opt.Index)
+	engine.Start()
+	return &PaperExchange{Exchange: live, engine: engine, store: store}
+}
+
+// Start start the live exchange and load the simulated account
+func (e *PaperExchange) Start() error {
+	if err := e.Exchange.Start(); err != nil {
+		return err
+	}
+	var state paperState
+	if data, err := e.store.load(); err == nil && data != "" {
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			e.engine.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "Start() error, the error number is "+err.Error())
+			return fmt.Errorf("Start() error, the error number is %s", err.Error())
+		}
+	} else {
+		state.Account.SubAccounts = make(map[string]constant.SubAccount)
+		for _, item := range strings.Split(config.String(paperAccount), ",") {
+			vec := strings.Split(item, ":")
+			if len(vec) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(vec[0])
+			amount, err := strconv.ParseFloat(strings.TrimSpace(vec[1]), 64)
+			if err != nil {
+				continue
+			}
+			state.Account.SubAccounts[key] = constant.SubAccount{StockType: key, Amount: amount}
+		}
+	}
+	ex := e.engine
+	ex.Lock()
+	defer ex.Unlock()
+	if state.Account.SubAccounts != nil {
+		ex.acc.SubAccounts = state.Account.SubAccounts
+	}
+	if state.Pending != nil {
+		ex.pendingOrders = state.Pending
+	}
+	if state.Finished != nil {
+		ex.finishedOrders = state.Finished
+	}
+	if state.Prefix != "" {
+		ex.idGen.Prefix, ex.idGen.ID = state.Prefix, state.Seq
+	}
+	return nil
+}
+
+// save persist the simulated account, keeping the latest finished orders
+func (e *PaperExchange) save() {
+	ex := e.engine
+	ex.Lock()
+	if len(ex.finishedOrders) > paperKeepOrders {
+		orders := make([]*constant.Order, 0, len(ex.finishedOrders))
+		for _, ord := range ex.finishedOrders {
+			orders = append(orders, ord)
+		}
+		sort.Slice(orders, func(i, j int) bool { return orders[i].Time > orders[j].Time })
+		for _, ord := range orders[paperKeepOrders:] {
+			delete(ex.finishedOrders, ord.Id)
+		}
+	}
+	data, err := json.Marshal(paperState{
+		Account:  *ex.acc,
+		Pending:  ex.pendingOrders,
+		Finished: ex.finishedOrders,
+		Prefix:   ex.idGen.Prefix,
+		Seq:      ex.idGen.ID,
+	})
+	ex.Unlock()
+	if err == nil {
+		err = e.store.save(string(data))
+	}
+	if err != nil {
+		ex.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "save account error, the error number is "+err.Error())
+	}
+}
+
+// SetStockType ...
+func (e *PaperExchange) SetStockType(stockType string) {
+	e.Exchange.SetStockType(stockType)
+	e.engine.SetStockType(stockType)
+}
+
+// SetBackCommission set the taker and maker fee of the paper trades
+func (e *PaperExchange) SetBackCommission(taker, maker, contractRate, coverRate float64) {
+	e.engine.SetBackCommission(taker, maker, contractRate, coverRate)
+	e.engine.Lock()
+	e.engine.takerFee, e.engine.makerFee = taker, maker
+	e.engine.Unlock()
+}
+
+// GetBackCommission ...
+func (e *PaperExchange) GetBackCommission() []float64 {
+	return e.engine.GetBackCommission()
+}
+
+// SetBackAccount set the amount of the currency in the paper account
+func (e *PaperExchange) SetBackAccount(key string, val float64) {
+	e.engine.Lock()
+	sub := e.engine.acc.SubAccounts[key]
+	sub.StockType, sub.Amount = key, val
+	e.engine.acc.SubAccounts[key] = sub
+	e.engine.Unlock()
+	e.save()
+}
+
+// GetBackAccount get the available amounts of the paper account
+func (e *PaperExchange) GetBackAccount() map[string]float64 {
+	e.engine.RLock()
+	defer e.engine.RUnlock()
+	res := make(map[string]float64)
+	for key, sub := range e.engine.acc.SubAccounts {
+		res[key] = sub.Amount
+	}
+	return res
+}
+
+// SetFillHandler set the handler called on every paper execution
+func (e *PaperExchange) SetFillHandler(handler func(constant.Fill)) {
+	e.engine.SetFillHandler(handler)
+}
+
+// pending whether the currency has pending orders
+func (e *PaperExchange) pending(currency string) bool {
+	e.engine.RLock()
+	defer e.engine.RUnlock()
+	for _, ord := range e.engine.pendingOrders {
+		if ord.StockType == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// feed match the pending orders of the symbol with the ticker of the live exchange
+func (e *PaperExchange) feed(stockType string, ticker *constant.Ticker) {
+	matched := e.pending(stockType)
+	e.engine.feed(stockType, constant.OHLC{
+		Time:   time.Now().UnixNano(),
+		Open:   ticker.Open,
+		High:   ticker.High,
+		Low:    ticker.Low,
+		Close:  ticker.Last,
+		Volume: math.MaxFloat64, // 模拟成交不受成交量限制
+	})
+	if matched {
+		e.save()
+	}
+}
+
+// GetTicker get the ticker of the live exchange, matching the paper orders with it
+func (e *PaperExchange) GetTicker() (*constant.Ticker, error) {
+	return e.GetTickerOf(e.GetStockType())
+}
+
+// GetTickerOf get the ticker of the symbol on the live exchange, matching the paper orders of the symbol with it
+func (e *PaperExchange) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	stockType := e.engine.symbolOf(symbol)
+	ticker, err := e.Exchange.GetTickerOf(stockType)
+	if err != nil {
+		return nil, err
+	}
+	e.feed(stockType, ticker)
+	return ticker, nil
+}
+
+// Buy ...
+func (e *PaperExchange) Buy(price, amount, msg string) (string, error) {
+	return placeString(e, constant.TradeTypeBuy, price, amount, msg)
+}
+
+// Sell ...
+func (e *PaperExchange) Sell(price, amount, msg string) (string, error) {
+	return placeString(e, constant.TradeTypeSell, price, amount, msg)
+}
+
+// PlaceOrder check the order by the rules of the live exchange, then place it on paper
+func (e *PaperExchange) PlaceOrder(req constant.OrderRequest) (string, error) {
+	req.Symbol = e.engine.symbolOf(req.Symbol)
+	var err error
+	if live, ok := e.Exchange.(interface {
+		prepareOrder(req *constant.OrderRequest) error
+	}); ok {
+		err = live.prepareOrder(&req)
+	} else {
+		err = normalizeOrder(&req)
+	}
+	if err != nil {
+		e.engine.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+		return "", err
+	}
+	return e.engine.submitOrder(nil, req, e.placeOrder)
+}
+
+// placeOrder match the order with the latest ticker of the live exchange
+func (e *PaperExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
+	}
+	stockType := req.Symbol
+	fail := func(reason string) (string, error) {
+		e.engine.logger.Log(constant.ERROR, stockType, req.Price, req.Amount,
+			method+"() error, the error number is "+reason)
+		return "", fmt.Errorf("%s() error, the error number is %s", method, reason)
+	}
+	ticker, err := e.GetTickerOf(stockType)
+	if err != nil {
+		return fail(err.Error())
+	}
+	crossed := req.OrderType == constant.OrderTypeMarket ||
+		req.Side == constant.TradeTypeBuy && req.Price >= ticker.Last ||
+		req.Side == constant.TradeTypeSell && req.Price <= ticker.Last
+	if req.PostOnly && crossed {
+		return fail("post only order would take liquidity")
+	}
+	if req.TimeInForce == constant.TimeInForceFOK && !crossed {
+		return fail("fill or kill order can not be filled")
+	}
+	price, amount := orderPrice(req), orderAmount(req)
+	var ord *constant.Order
+	switch {
+	case req.OrderType == constant.OrderTypeMarket && req.Side == constant.TradeTypeBuy:
+		ord, err = e.engine.MarketBuy(amount, price, stockType)
+	case req.OrderType == constant.OrderTypeMarket:
+		ord, err = e.engine.MarketSell(amount, price, stockType)
+	case req.Side == constant.TradeTypeBuy:
+		ord, err = e.engine.LimitBuy(amount, price, stockType)
+	default:
+		ord, err = e.engine.LimitSell(amount, price, stockType)
+	}
+	if err != nil {
+		return fail(err.Error())
+	}
+	e.engine.setClientID(ord.Id, req.ClientOrderID)
+	if req.TimeInForce == constant.TimeInForceIOC && ord.Status != constant.ORDER_FINISH {
+		e.engine.CancelOrder(ord.Id, stockType)
+	}
+	e.save()
+	e.engine.logger.Log(req.Side, stockType, ord.Price, req.Amount, req.Msg)
+	return ord.Id, nil
+}
+
+// NewClientOrderID generate a client order id of the simulated orders
+func (e *PaperExchange) NewClientOrderID() string {
+	return e.engine.NewClientOrderID()
+}
+
+// GetOrderByClientID get the order placed with the client order id
+func (e *PaperExchange) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	return e.engine.orderByClientID(e.GetOrderOf, clientID)
+}
+
+// refresh match the pending orders of the symbol with the latest ticker
+func (e *PaperExchange) refresh(symbol string) {
+	if e.pending(symbol) {
+		e.GetTickerOf(symbol)
+	}
+}
+
+// GetOrder get details of a paper order
+func (e *PaperExchange) GetOrder(id string) (*constant.Order, error) {
+	return e.GetOrderOf(e.GetStockType(), id)
+}
+
+// GetOrderOf get details of a paper order of the symbol
+func (e *PaperExchange) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	stockType := e.engine.symbolOf(symbol)
+	e.refresh(stockType)
+	order, err := e.engine.GetOneOrder(id, stockType)
+	if err != nil {
+		e.engine.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetOrder() error, the error number is ", err.Error())
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrders get all unfilled paper orders of the stock type
+func (e *PaperExchange) GetOrders() ([]constant.Order, error) {
+	return e.GetOrdersOf(e.GetStockType())
+}
+
+// GetOrdersOf get all unfilled paper orders of the symbol
+func (e *PaperExchange) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	stockType := e.engine.symbolOf(symbol)
+	e.refresh(stockType)
+	orders, err := e.engine.GetUnfinishOrders(stockType)
+	if err != nil {
+		return nil, err
+	}
+	res := []constant.Order{}
+	for _, ord := range orders {
+		if ord.StockType == stockType {
+			res = append(res, ord)
+		}
+	}
+	return res, nil
+}
+
+// CancelOrder cancel a paper order
+func (e *PaperExchange) CancelOrder(orderID string) (bool, error) {
+	return e.CancelOrderOf(e.GetStockType(), orderID)
+}
+
+// CancelOrderOf cancel a paper order of the symbol
+func (e *PaperExchange) CancelOrderOf(symbol, orderID string) (bool, error) {
+	stockType := e.engine.symbolOf(symbol)
+	result, err := e.engine.CancelOrder(orderID, stockType)
+	if err != nil {
+		e.engine.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "CancelOrder() error, the error number is ", err.Error())
+		return false, err
+	}
+	e.save()
+	e.engine.logger.Log(constant.TradeTypeCancel, stockType, 0, 0, "CancelOrder() success "+orderID)
+	return result, nil
+}
+
+// GetAccount get the paper account
+func (e *PaperExchange) GetAccount() (*constant.Account, error) {
+	e.refresh(e.GetStockType())
+	return e.engine.GetAccount()
+}
+
+// GetPosition the spot paper account holds no position
+func (e *PaperExchange) GetPosition() ([]constant.Position, error) {
+	return []constant.Position{}, nil
+}
+
+// GetPositionOf ...
+func (e *PaperExchange) GetPositionOf(symbol string) ([]constant.Position, error) {
+	return []constant.Position{}, nil
+}
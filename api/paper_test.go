@@ -0,0 +1,88 @@
+package api
+
+import (
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestPaperExchange(t *testing.T) {
+	live := NewMockExchange(constant.Option{BackLog: true})
+	store := &memoryStore{}
+	e := newPaperExchange(live, constant.Option{Type: constant.Paper + "Mock", BackLog: true}, store)
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	e.SetStockType("BTC/USDT")
+	e.SetBackAccount("USDT", 10000)
+	e.SetBackCommission(0.001, 0.001, 0, 0)
+
+	id, err := e.Buy("99", "2", "")
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if orders, _ := e.GetOrders(); len(orders) != 1 || orders[0].Id != id {
+		t.Fatalf("unexpected open orders %+v", orders)
+	}
+	if account, _ := e.GetAccount(); account.SubAccounts["USDT"].Amount != 9802 || account.SubAccounts["USDT"].FrozenAmount != 198 {
+		t.Fatalf("unexpected account %+v", account)
+	}
+	live.SetTicker(constant.Ticker{Last: 98, Buy: 97.9, Sell: 98.1})
+	order, err := e.GetOrder(id)
+	if err != nil || order.Status != constant.ORDER_FINISH || order.AvgPrice != 98 || order.Fee != 0.002 {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	account, _ := e.GetAccount()
+	if account.SubAccounts["USDT"].Amount != 9804 || account.SubAccounts["USDT"].FrozenAmount != 0 ||
+		account.SubAccounts["BTC"].Amount != 1.998 {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	id, err = e.Sell("-1", "1", "")
+	if order, _ := e.GetOrder(id); err != nil || order.Status != constant.ORDER_FINISH || order.AvgPrice != 98 {
+		t.Fatalf("unexpected market order %+v %v", order, err)
+	}
+	if _, err := e.Sell("-1", "5", ""); err == nil {
+		t.Fatalf("sell more than held should fail")
+	}
+	id, _ = e.Sell("120", "0.5", "")
+	if ok, err := e.CancelOrder(id); !ok || err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if _, err := e.CancelOrder(id); err != ErrCancelOrderFinished {
+		t.Fatalf("cancel a canceled order: %v", err)
+	}
+	if orders := live.Orders(); len(orders) != 0 {
+		t.Fatalf("paper orders should not reach the live exchange, got %+v", orders)
+	}
+
+	// 重启后从存储恢复模拟账户
+	e = newPaperExchange(live, constant.Option{Type: constant.Paper + "Mock", BackLog: true}, store)
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	e.SetStockType("BTC/USDT")
+	if order, err := e.GetOrder(id); err != nil || order.Status != constant.ORDER_CANCEL {
+		t.Fatalf("unexpected restored order %+v %v", order, err)
+	}
+	account, _ = e.GetAccount()
+	if account.SubAccounts["BTC"].Amount != 0.998 || account.SubAccounts["USDT"].Amount != 9804+98-0.098 {
+		t.Fatalf("unexpected restored account %+v", account)
+	}
+	if next, _ := e.Buy("90", "1", ""); next == id {
+		t.Fatalf("the order id %s should not be reused", next)
+	}
+}
+
+func TestGetPaperExchange(t *testing.T) {
+	for _, venue := range []string{constant.OKExFuture, constant.HuoBiDm, constant.CTP, constant.SpotBack} {
+		if _, err := GetExchange(constant.Option{Type: constant.Paper + venue, BackLog: true}); err == nil {
+			t.Fatalf("paper trading of %s should fail", venue)
+		}
+	}
+	if e, err := GetExchange(constant.Option{Type: constant.Paper + constant.Binance, BackLog: true}); err != nil {
+		t.Fatalf("paper binance: %v", err)
+	} else if _, ok := e.(*PaperExchange); !ok {
+		t.Fatalf("unexpected exchange %T", e)
+	}
+}
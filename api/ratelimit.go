@@ -0,0 +1,381 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+var (
+	// ErrRateLimited the request is throttled by the exchange
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNetwork the request failed or timeout on the network
+	ErrNetwork = errors.New("network error")
+	// ErrUnavailable the exchange is under maintenance or overloaded
+	ErrUnavailable = errors.New("exchange unavailable")
+	// ErrAuth the api key is invalid or has no permission
+	ErrAuth = errors.New("authentication failed")
+	// ErrInsufficientBalance the account has not enough balance for the order
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrInvalidOrder the order is rejected by the exchange for the price, amount or symbol
+	ErrInvalidOrder = errors.New("invalid order")
+)
+
+// the keys of the rate limiter in config.ini
+const (
+	rateLimitKey    = "ratelimit"    // e.g. "Binance:20:40,OKEx:10", 每秒请求数:突发请求数
+	retryTimesKey   = "retrytimes"   // 可重试错误的最大重试次数
+	retryBackoffKey = "retrybackoff" // 首次重试的退避毫秒数, 之后每次翻倍
+)
+
+// defaultRate the requests per second of the venue without config
+const defaultRate = 10
+
+// the retry policy without config
+const (
+	defaultRetryTimes   = 3
+	defaultRetryBackoff = 200 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+)
+
+// venueRates the requests per second of the venues
+var venueRates = map[string]float64{
+	constant.HuoBi:      10,
+	constant.HuoBiDm:    10,
+	constant.Binance:    20,
+	constant.OKEx:       10,
+	constant.OKExFuture: 10,
+	constant.OKExSwap:   10,
+	constant.Bitmex:     1,
+	constant.IB:         50,
+	constant.CTP:        1, // 查询每秒一次
+}
+
+// endpointWeights the tokens an endpoint takes, the endpoints not listed take 1
+var endpointWeights = map[string]float64{
+	"GetDepth":    2,
+	"GetRecords":  2,
+	"GetAccount":  5,
+	"GetPosition": 5,
+	"GetOrders":   3,
+}
+
+// the clock of the limiter, replaced by the tests
+var (
+	limiterNow   = time.Now
+	limiterSleep = time.Sleep
+)
+
+// errorKinds the keywords of the exchange error messages, checked in order
+var errorKinds = []struct {
+	kind error
+	keys []string
+}{
+	{ErrRateLimited, []string{"statuscode:429", "statuscode:418", "too many", "rate limit", "request limit",
+		"frequency", "\"code\":-1003", "code\":\"30014\"", "code\":30014", "频繁"}},
+	{ErrAuth, []string{"statuscode:401", "statuscode:403", "api key", "apikey", "signature", "permission",
+		"unauthorized", "\"code\":-2014", "\"code\":-2015", "code\":\"30006\"", "code\":30006",
+		"code\":\"30012\"", "code\":30012"}},
+	{ErrInsufficientBalance, []string{"insufficient", "not enough", "\"code\":-2010", "code\":\"35008\"",
+		"code\":35008", "余额不足"}},
+	{ErrInvalidOrder, []string{"invalid", "precision", "min_notional", "lot_size", "price_filter",
+		"\"code\":-1013", "\"code\":-1111"}},
+	{ErrUnavailable, []string{"statuscode:500", "statuscode:502", "statuscode:503", "statuscode:504",
+		"maintenance", "unavailable", "overload", "system busy"}},
+	{ErrNetwork, []string{"timeout", "deadline exceeded", "eof", "connection reset", "connection refused", "broken pipe",
+		"i/o", "no such host"}},
+}
+
+// ExchangeError an error of the exchange classified by the kind
+type ExchangeError struct {
+	Kind     error  // ErrRateLimited, ErrNetwork ...
+	Endpoint string // GetTicker, PlaceOrder ...
+	Err      error  // the error returned by the exchange
+}
+
+// Error keep the message of the exchange
+func (e *ExchangeError) Error() string {
+	return e.Err.Error()
+}
+
+// Is errors.Is(err, ErrRateLimited) ...
+func (e *ExchangeError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap ...
+func (e *ExchangeError) Unwrap() error {
+	return e.Err
+}
+
+// classify wrap the error of the endpoint into an ExchangeError, the unknown errors returned as is
+func classify(endpoint string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var exErr *ExchangeError
+	if errors.As(err, &exErr) {
+		return err
+	}
+	msg := strings.ToLower(err.Error())
+	for _, item := range errorKinds {
+		for _, key := range item.keys {
+			if strings.Contains(msg, key) {
+				return &ExchangeError{Kind: item.kind, Endpoint: endpoint, Err: err}
+			}
+		}
+	}
+	return err
+}
+
+// retriable whether the call can be retried after the error,
+// placing an order is only retried when it is rejected by the throttle
+func retriable(endpoint string, err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	if endpoint == "PlaceOrder" {
+		return false
+	}
+	return errors.Is(err, ErrNetwork) || errors.Is(err, ErrUnavailable)
+}
+
+// ThrottleStat the throttle metrics of an endpoint of the venue
+type ThrottleStat struct {
+	Venue       string
+	Endpoint    string
+	Calls       int64 // 请求次数
+	Waits       int64 // 被本地限流等待的次数
+	WaitTime    int64 // 本地限流等待的总毫秒数
+	Retries     int64 // 重试次数
+	RateLimited int64 // 被交易所限流的次数
+	Errors      int64 // 重试后仍失败的次数
+}
+
+// rateLimiter a token bucket shared by the exchanges of a venue
+type rateLimiter struct {
+	mu     sync.Mutex
+	venue  string
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+	stats  map[string]*ThrottleStat
+}
+
+// limiters the rate limiters of the venues
+var limiters = struct {
+	sync.Mutex
+	m map[string]*rateLimiter
+}{m: make(map[string]*rateLimiter)}
+
+// venueRate the rate and burst of the venue in config.ini or the defaults
+func venueRate(venue string) (float64, float64) {
+	rate, ok := venueRates[venue]
+	if !ok {
+		rate = defaultRate
+	}
+	burst := rate
+	for _, item := range strings.Split(config.String(rateLimitKey), ",") {
+		vec := strings.Split(strings.TrimSpace(item), ":")
+		if len(vec) < 2 || !strings.EqualFold(vec[0], venue) {
+			continue
+		}
+		if v, err := strconv.ParseFloat(vec[1], 64); err == nil && v > 0 {
+			rate, burst = v, v
+		}
+		if len(vec) > 2 {
+			if v, err := strconv.ParseFloat(vec[2], 64); err == nil && v >= 1 {
+				burst = v
+			}
+		}
+	}
+	return rate, burst
+}
+
+// newRateLimiter ...
+func newRateLimiter(venue string, rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		venue:  venue,
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   limiterNow(),
+		stats:  make(map[string]*ThrottleStat),
+	}
+}
+
+// limiterOf get the rate limiter of the venue
+func limiterOf(venue string) *rateLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+	if l, ok := limiters.m[venue]; ok {
+		return l
+	}
+	l := newRateLimiter(venue, 0, 0)
+	l.rate, l.burst = venueRate(venue)
+	l.tokens = l.burst
+	limiters.m[venue] = l
+	return l
+}
+
+// stat get the metrics of the endpoint, the lock held
+func (l *rateLimiter) stat(endpoint string) *ThrottleStat {
+	s, ok := l.stats[endpoint]
+	if !ok {
+		s = &ThrottleStat{Venue: l.venue, Endpoint: endpoint}
+		l.stats[endpoint] = s
+	}
+	return s
+}
+
+// getRate ...
+func (l *rateLimiter) getRate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// reserve take the tokens of the weight, return how long to wait for them
+func (l *rateLimiter) reserve(endpoint string, weight float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := limiterNow()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= math.Min(weight, l.burst)
+	s := l.stat(endpoint)
+	s.Calls++
+	if l.tokens >= 0 {
+		return 0
+	}
+	// 令牌可以透支, 等待补足后再请求, 保证并发请求排队
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	s.Waits++
+	s.WaitTime += wait.Milliseconds()
+	return wait
+}
+
+// wait block until the tokens of the endpoint are available
+func (l *rateLimiter) wait(endpoint string) {
+	weight, ok := endpointWeights[endpoint]
+	if !ok {
+		weight = 1
+	}
+	if d := l.reserve(endpoint, weight); d > 0 {
+		limiterSleep(d)
+	}
+}
+
+// record count the retries and the failures of the endpoint
+func (l *rateLimiter) record(endpoint string, err error, retry bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.stat(endpoint)
+	if errors.Is(err, ErrRateLimited) {
+		s.RateLimited++
+	}
+	if retry {
+		s.Retries++
+	} else {
+		s.Errors++
+	}
+}
+
+// snapshot ...
+func (l *rateLimiter) snapshot() []ThrottleStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make([]ThrottleStat, 0, len(l.stats))
+	for _, s := range l.stats {
+		res = append(res, *s)
+	}
+	return res
+}
+
+// ThrottleStats get the throttle metrics of all the venues
+func ThrottleStats() []ThrottleStat {
+	limiters.Lock()
+	list := make([]*rateLimiter, 0, len(limiters.m))
+	for _, l := range limiters.m {
+		list = append(list, l)
+	}
+	limiters.Unlock()
+	res := []ThrottleStat{}
+	for _, l := range list {
+		res = append(res, l.snapshot()...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Venue != res[j].Venue {
+			return res[i].Venue < res[j].Venue
+		}
+		return res[i].Endpoint < res[j].Endpoint
+	})
+	return res
+}
+
+// retryPolicy ...
+func retryPolicy() (int, time.Duration) {
+	times, backoff := defaultRetryTimes, defaultRetryBackoff
+	if v, err := strconv.Atoi(config.String(retryTimesKey)); err == nil && v >= 0 {
+		times = v
+	}
+	if v, err := strconv.Atoi(config.String(retryBackoffKey)); err == nil && v > 0 {
+		backoff = time.Duration(v) * time.Millisecond
+	}
+	return times, backoff
+}
+
+// backoff the exponential backoff of the retry with full jitter
+func backoff(base time.Duration, retry int) time.Duration {
+	d := base << uint(retry)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// throttle wait for the limit of this exchange, then the limit of the venue shared by the exchanges
+func (e *BaseExchange) throttle(endpoint string) {
+	if e.limiter == nil {
+		e.limiter = limiterOf(e.option.Type)
+	}
+	if e.ownLimiter != nil {
+		e.ownLimiter.wait(endpoint)
+	}
+	e.limiter.wait(endpoint)
+}
+
+// call request the endpoint of the exchange under the rate limiter of the venue,
+// the error classified and the retriable errors retried with backoff
+func (e *BaseExchange) call(endpoint string, fn func() error) error {
+	if e.option.BackTest {
+		return classify(endpoint, fn())
+	}
+	times, base := retryPolicy()
+	for i := 0; ; i++ {
+		e.throttle(endpoint)
+		err := classify(endpoint, fn())
+		if err == nil {
+			return nil
+		}
+		retry := i < times && retriable(endpoint, err)
+		e.limiter.record(endpoint, err, retry)
+		if !retry {
+			return err
+		}
+		d := backoff(base, i)
+		e.logger.Log(constant.INFO, e.GetStockType(), 0.0, 0.0,
+			fmt.Sprintf("%s() retry %d after %v, the error number is %s", endpoint, i+1, d, err.Error()))
+		limiterSleep(d)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestClassify(t *testing.T) {
+	for msg, want := range map[string]error{
+		"HttpStatusCode:429 ,Desc:Too Many Requests":                     ErrRateLimited,
+		`HttpStatusCode:400 ,Desc:{"code":-1013,"msg":"Filter failure"}`: ErrInvalidOrder,
+		`{"code":-2010,"msg":"Account has insufficient balance"}`:        ErrInsufficientBalance,
+		"HttpStatusCode:401 ,Desc:Invalid API-key":                       ErrAuth,
+		"HttpStatusCode:503 ,Desc:Service Unavailable":                   ErrUnavailable,
+		"net/http: request canceled (Client.Timeout exceeded)":           ErrNetwork,
+		`{"code":"30014","message":"request too frequent"}`:              ErrRateLimited,
+		`{"error_code":"35008","error_message":"Risk ratio too high"}`:   ErrInsufficientBalance,
+	} {
+		err := fmt.Errorf("GetTicker() error, the error number is %w", classify("GetTicker", errors.New(msg)))
+		if !errors.Is(err, want) || err.Error() != "GetTicker() error, the error number is "+msg {
+			t.Fatalf("%s: got %v", msg, err)
+		}
+	}
+	if err := errors.New("unknown"); classify("GetTicker", err) != err {
+		t.Fatalf("the unknown error should be returned as is")
+	}
+	// 数字错误码不匹配价格, 数量等数字
+	if err := errors.New(`{"price":"30014.5"}`); classify("PlaceOrder", err) != err {
+		t.Fatalf("the code in a number should not be classified")
+	}
+}
+
+// resetLimiter drop the limiter of the venue shared by the earlier runs
+func resetLimiter(venue string) {
+	limiters.Lock()
+	delete(limiters.m, venue)
+	limiters.Unlock()
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	limiterNow = func() time.Time { return now }
+	limiterSleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	defer func() { limiterNow, limiterSleep = time.Now, time.Sleep }()
+
+	resetLimiter("TestRateLimiter")
+	l := limiterOf("TestRateLimiter")
+	for i := 0; i < 10; i++ {
+		l.wait("GetTicker")
+	}
+	if slept != 0 {
+		t.Fatalf("the burst should not wait, slept %v", slept)
+	}
+	l.wait("GetTicker")
+	if slept != 100*time.Millisecond {
+		t.Fatalf("unexpected wait %v", slept)
+	}
+	// 权重为 5 的请求需要等待补充 5 个令牌
+	l.wait("GetAccount")
+	if slept != 600*time.Millisecond {
+		t.Fatalf("unexpected weighted wait %v", slept)
+	}
+	now = now.Add(time.Minute)
+	l.wait("GetAccount")
+	if slept != 600*time.Millisecond {
+		t.Fatalf("the refilled bucket should not wait, slept %v", slept)
+	}
+
+	e := &BaseExchange{}
+	e.Init(constant.Option{Type: "TestRateLimiter", BackLog: true})
+	if e.limiter != l || e.SetLimit(2) != 2 || l.getRate() != defaultRate {
+		t.Fatalf("the limit of an exchange should not change the limiter of the venue")
+	}
+	// 本实例限流每秒 2 次, 交易所限流仍为每秒 10 次
+	slept = 0
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		e.AutoSleep()
+	}
+	if slept != 500*time.Millisecond {
+		t.Fatalf("unexpected wait of the exchange limit %v", slept)
+	}
+	if e.SetLimit(100) != defaultRate {
+		t.Fatalf("the limit of an exchange should not exceed the venue")
+	}
+	if e.SetLimit(0) != defaultRate || e.ownLimiter != nil {
+		t.Fatalf("SetLimit(0) should use the limit of the venue")
+	}
+}
+
+func TestCallRetry(t *testing.T) {
+	var sleeps []time.Duration
+	limiterSleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	defer func() { limiterSleep = time.Sleep }()
+
+	resetLimiter("TestCallRetry")
+	e := &BaseExchange{}
+	e.Init(constant.Option{Type: "TestCallRetry", BackLog: true})
+	calls := 0
+	err := e.call("GetTicker", func() error {
+		if calls++; calls < 3 {
+			return errors.New("HttpStatusCode:429 ,Desc:Too Many Requests")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || len(sleeps) != 2 {
+		t.Fatalf("unexpected retries %v, %d calls, %v", err, calls, sleeps)
+	}
+	for i, d := range sleeps {
+		if d <= 0 || d > defaultRetryBackoff<<uint(i) {
+			t.Fatalf("the backoff %v of retry %d out of range", d, i)
+		}
+	}
+
+	calls = 0
+	err = e.call("GetTicker", func() error {
+		calls++
+		return errors.New("read tcp: i/o timeout")
+	})
+	if !errors.Is(err, ErrNetwork) || calls != defaultRetryTimes+1 {
+		t.Fatalf("unexpected result %v, %d calls", err, calls)
+	}
+	// 下单超时不重试, 由 submitOrder 查询确认
+	calls = 0
+	err = e.call("PlaceOrder", func() error {
+		calls++
+		return errors.New("read tcp: i/o timeout")
+	})
+	if !errors.Is(err, ErrNetwork) || calls != 1 {
+		t.Fatalf("the order should not be retried on timeout, %v, %d calls", err, calls)
+	}
+	calls = 0
+	err = e.call("GetAccount", func() error {
+		calls++
+		return errors.New("HttpStatusCode:401 ,Desc:Invalid API-key")
+	})
+	if !errors.Is(err, ErrAuth) || calls != 1 {
+		t.Fatalf("the auth error should not be retried, %v, %d calls", err, calls)
+	}
+
+	var stat ThrottleStat
+	for _, s := range ThrottleStats() {
+		if s.Venue == "TestCallRetry" && s.Endpoint == "GetTicker" {
+			stat = s
+		}
+	}
+	if stat.Calls != 3+defaultRetryTimes+1 || stat.Retries != 2+defaultRetryTimes || stat.RateLimited != 2 || stat.Errors != 1 {
+		t.Fatalf("unexpected stat %+v", stat)
+	}
+}
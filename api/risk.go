@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// ParseRiskLimit parse the risk limits of a trader, empty means no limit
+func ParseRiskLimit(data string) (limit constant.RiskLimit, err error) {
+	if strings.TrimSpace(data) == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(data), &limit); err != nil {
+		return limit, fmt.Errorf("invalid risk limit: %s", err.Error())
+	}
+	if limit.MaxOrderAmount < 0 || limit.MaxNotional < 0 || limit.MaxPosition < 0 ||
+		limit.PriceBand < 0 || limit.MaxOpenOrders < 0 || limit.MaxDailyLoss < 0 {
+		return limit, fmt.Errorf("invalid risk limit: negative value")
+	}
+	return
+}
+
+// ParseAccountLimit parse the account-wide limits of an exchange, empty means no limit
+func ParseAccountLimit(data string) (limit constant.AccountLimit, err error) {
+	if strings.TrimSpace(data) == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(data), &limit); err != nil {
+		return limit, fmt.Errorf("invalid account limit: %s", err.Error())
+	}
+	if limit.MaxExposure < 0 || limit.MaxUnrealizedLoss < 0 {
+		return limit, fmt.Errorf("invalid account limit: negative value")
+	}
+	return
+}
+
+// portfolioCheck check the order against the account-wide limits, set by the portfolio service,
+// size is the contract size of the symbol, 1 for spot
+var portfolioCheck func(opt constant.Option, stockType string, req constant.OrderRequest, price, size float64) error
+
+// SetPortfolioCheck ...
+func SetPortfolioCheck(check func(opt constant.Option, stockType string, req constant.OrderRequest, price, size float64) error) {
+	portfolioCheck = check
+}
+
+// SetRiskLimit set the pre-trade risk limits checked before every order
+func (o *OMS) SetRiskLimit(limit constant.RiskLimit) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.risk = limit
+}
+
+// realized the realized pnl of all the symbols
+func (o *OMS) realized() (pnl float64) {
+	for _, ledger := range o.ledgers {
+		pnl += ledger.RealizedPnl
+	}
+	return
+}
+
+// dayBaseState the name of the state keeping the realized pnl at the start of the day on the exchange
+func dayBaseState(exchangeID int64) string {
+	return fmt.Sprintf("__risk.daybase.%d", exchangeID)
+}
+
+// dayBase the realized pnl at the start of a day
+type dayBase struct {
+	Day  string  `json:"day"`
+	Base float64 `json:"base"`
+}
+
+// rollDay reset the daily pnl base at the start of a new day, the base is persisted so a restart keeps it
+func (o *OMS) rollDay() error {
+	today := time.Now().Format("2006-01-02")
+	if o.day == today {
+		return nil
+	}
+	o.dayBase = o.realized()
+	if !o.persist {
+		o.day = today
+		return nil
+	}
+	name := dayBaseState(o.option.ExchangeID)
+	state, found, err := model.FindState(o.option.TraderID, name)
+	if err != nil {
+		// 读取失败时当日基准未知, 下次重新读取
+		o.logger.Log(constant.ERROR, "", 0.0, 0.0, "GetState() error, the error number is ", err.Error())
+		return err
+	}
+	o.day = today
+	var base dayBase
+	if found && json.Unmarshal([]byte(state.Value), &base) == nil && base.Day == today {
+		o.dayBase = base.Base
+		return nil
+	}
+	data, _ := json.Marshal(dayBase{Day: today, Base: o.dayBase})
+	if err := model.SetState(o.option.TraderID, name, string(data)); err != nil {
+		o.logger.Log(constant.ERROR, "", 0.0, 0.0, "SetState() error, the error number is ", err.Error())
+	}
+	return nil
+}
+
+// position the position of the symbol in the ledger
+func (o *OMS) position(stockType string) float64 {
+	if o.persist {
+		if ledger, err := model.GetLedger(o.option.TraderID, o.option.ExchangeID, stockType); err == nil {
+			o.ledgers[stockType] = &ledger
+		}
+	}
+	if ledger := o.ledgers[stockType]; ledger != nil {
+		return ledger.Amount
+	}
+	return 0
+}
+
+// checkRisk check the order against the risk limits
+func (o *OMS) checkRisk(req constant.OrderRequest) error {
+	o.mu.Lock()
+	limit := o.risk
+	o.mu.Unlock()
+	if portfolioCheck != nil {
+		price := req.Price
+		if req.OrderType == constant.OrderTypeMarket {
+			if price = o.mark(req.Symbol); price <= 0 {
+				// 没有最新价时无法估算市价单的敞口, 拒绝下单
+				ticker, err := o.GetTickerOf(req.Symbol)
+				if err != nil || ticker == nil || ticker.Last <= 0 {
+					return fmt.Errorf("can not get the last price to check the order")
+				}
+				price = ticker.Last
+			}
+		}
+		size := o.exchange.GetInstrument(req.Symbol).ContractSize()
+		if err := portfolioCheck(o.option, req.Symbol, req, price, size); err != nil {
+			return err
+		}
+	}
+	if limit == (constant.RiskLimit{}) {
+		return nil
+	}
+	if limit.MaxOrderAmount > 0 && req.Amount > limit.MaxOrderAmount {
+		return fmt.Errorf("order amount %v exceeds the max order amount %v", req.Amount, limit.MaxOrderAmount)
+	}
+	price := req.Price
+	if limit.PriceBand > 0 || limit.MaxNotional > 0 && req.OrderType == constant.OrderTypeMarket {
+		ticker, err := o.exchange.GetTickerOf(req.Symbol)
+		if err != nil || ticker == nil || ticker.Last <= 0 {
+			return fmt.Errorf("can not get the last price to check the order")
+		}
+		if req.OrderType == constant.OrderTypeMarket {
+			price = ticker.Last
+		} else if limit.PriceBand > 0 && math.Abs(price-ticker.Last)/ticker.Last > limit.PriceBand {
+			return fmt.Errorf("order price %v is out of the price band %v of the last price %v",
+				price, limit.PriceBand, ticker.Last)
+		}
+	}
+	if limit.MaxNotional > 0 {
+		// 期货的数量为合约张数, 按合约乘数换算
+		notional := price * req.Amount * o.exchange.GetInstrument(req.Symbol).ContractSize()
+		if notional > limit.MaxNotional {
+			return fmt.Errorf("order notional %v exceeds the max notional %v", notional, limit.MaxNotional)
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if limit.MaxPosition > 0 {
+		qty := req.Amount
+		if req.Side == constant.TradeTypeSell {
+			qty = -qty
+		}
+		current := o.position(req.Symbol)
+		// 减仓不受限制
+		if after := current + qty; math.Abs(after) > limit.MaxPosition && math.Abs(after) > math.Abs(current) {
+			return fmt.Errorf("position %v after the order exceeds the max position %v", after, limit.MaxPosition)
+		}
+	}
+	if limit.MaxOpenOrders > 0 {
+		open := 0
+		for _, order := range o.orders {
+			if !finished(parseStatus(order.Status)) {
+				open++
+			}
+		}
+		if open >= limit.MaxOpenOrders {
+			return fmt.Errorf("open orders %d reach the max open orders %d", open, limit.MaxOpenOrders)
+		}
+	}
+	if limit.MaxDailyLoss > 0 {
+		if err := o.rollDay(); err != nil {
+			return fmt.Errorf("can not get the pnl at the start of the day: %s", err.Error())
+		}
+		if loss := o.dayBase - o.realized(); loss >= limit.MaxDailyLoss {
+			return fmt.Errorf("daily loss %v reaches the max daily loss %v", loss, limit.MaxDailyLoss)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+func TestRiskLimit(t *testing.T) {
+	if _, err := ParseRiskLimit(`{"maxOrderAmount": -1}`); err == nil {
+		t.Fatalf("negative limit should fail")
+	}
+	limit, err := ParseRiskLimit(`{"maxOrderAmount": 5, "maxNotional": 400, "maxPosition": 6,
+		"priceBand": 0.05, "maxOpenOrders": 2, "maxDailyLoss": 10}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+	o.SetRiskLimit(limit)
+
+	cases := []struct {
+		req constant.OrderRequest
+		ok  bool
+	}{
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 90, Amount: 1}, false},  // price band
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 99, Amount: 6}, false},  // order amount
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 99, Amount: 5}, false},  // notional
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 100, Amount: 4}, true},  // filled
+		{constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 100, Amount: 3}, false}, // position
+		{constant.OrderRequest{Side: constant.TradeTypeSell, Price: 104, Amount: 1}, true},
+		{constant.OrderRequest{Side: constant.TradeTypeSell, Price: 104, Amount: 1}, true},
+		{constant.OrderRequest{Side: constant.TradeTypeSell, Price: 104, Amount: 1}, false}, // open orders
+	}
+	for i, c := range cases {
+		if _, err := o.PlaceOrder(c.req); (err == nil) != c.ok {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+	}
+
+	// 亏损卖出后触发当日亏损限制
+	o.SetRiskLimit(constant.RiskLimit{MaxDailyLoss: 10})
+	mock.SetTicker(constant.Ticker{Last: 95})
+	if _, err := o.Sell("-1", "2", ""); err != nil {
+		t.Fatalf("sell: %v", err)
+	}
+	if _, err := o.Buy("95", "1", ""); err == nil {
+		t.Fatalf("daily loss should reject the order")
+	}
+}
+
+func TestDailyLossAfterRestart(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	db.AutoMigrate(&model.Log{}, &model.State{}, &model.Order{}, &model.Fill{}, &model.Ledger{})
+	saved := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = saved })
+
+	// 重启前当日已亏损 20
+	opt := constant.Option{TraderID: 1, ExchangeID: 2, Type: "mock"}
+	db.Create(&model.Ledger{TraderID: 1, ExchangeID: 2, StockType: "BTC/USDT", RealizedPnl: 30})
+	data, _ := json.Marshal(dayBase{Day: time.Now().Format("2006-01-02"), Base: 50})
+	model.SetState(1, dayBaseState(2), string(data))
+
+	o := NewOMS(NewMockExchange(constant.Option{BackTest: true, BackLog: true}), opt)
+	o.SetRiskLimit(constant.RiskLimit{MaxDailyLoss: 10})
+	if _, err := o.Buy("99", "1", ""); err == nil {
+		t.Fatalf("the daily loss before the restart should reject the order")
+	}
+}
+
+func TestNotionalMultiplier(t *testing.T) {
+	defer resetInstruments()
+	RegisterInstrument(instrumentAll, constant.Instrument{Symbol: "BTC/USD.quarter", Multiplier: 100})
+	mock := NewMockExchange(constant.Option{BackTest: true, BackLog: true})
+	o := NewOMS(mock, constant.Option{BackTest: true, BackLog: true})
+	o.SetRiskLimit(constant.RiskLimit{MaxNotional: 5000})
+
+	// 1 张合约价值 100 * 100
+	if _, err := o.PlaceOrder(constant.OrderRequest{Symbol: "BTC/USD.quarter", Side: constant.TradeTypeBuy,
+		Price: 100, Amount: 1}); err == nil || !strings.Contains(err.Error(), "notional 10000") {
+		t.Fatalf("the notional of the contracts should count the multiplier, got %v", err)
+	}
+	if _, err := o.PlaceOrder(constant.OrderRequest{Side: constant.TradeTypeBuy, Price: 100, Amount: 1}); err != nil {
+		t.Fatalf("spot: %v", err)
+	}
+}
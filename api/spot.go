@@ -41,7 +41,9 @@ func NewSpotExchange(opt constant.Option) *SpotExchange {
 			goex.CLOSE_SELL: constant.TradeTypeShortClose,
 		},
 		exchangeTypeMap: map[string]string{
-			constant.HuoBi: goex.HUOBI_PRO,
+			constant.HuoBi:   goex.HUOBI_PRO,
+			constant.Binance: goex.BINANCE,
+			constant.OKEx:    goex.OKEX_V3,
 		},
 		//apiBuilder: builder.NewAPIBuilder().HttpTimeout(5 * time.Second),
 	}
@@ -69,7 +71,13 @@ func (e *SpotExchange) Start() error {
 		return fmt.Errorf("api builder fail")
 	}
 	exchangeName := e.exchangeTypeMap[e.option.Type]
-	e.api = e.apiBuilder.APIKey(e.option.AccessKey).APISecretkey(e.option.SecretKey).Build(exchangeName)
+	secretKey, passphrase := apiSecret(e.option)
+	e.api = e.apiBuilder.APIKey(e.option.AccessKey).APISecretkey(secretKey).ApiPassphrase(passphrase).Build(exchangeName)
+	// 加载失败时使用自带的最小数量及 tick
+	if err := loadVenueInstruments(e.option.Type); err != nil {
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0,
+			"Start() error, the error number is load instruments "+err.Error())
+	}
 	return nil
 }
 
@@ -97,19 +105,29 @@ func (e *SpotExchange) GetStockTypeMap() map[string]goex.CurrencyPair {
 
 // GetDepth ...
 func (e *SpotExchange) GetDepth() (*constant.Depth, error) {
+	return e.GetDepthOf(e.GetStockType())
+}
+
+// GetDepthOf get the depth of the symbol
+func (e *SpotExchange) GetDepthOf(symbol string) (*constant.Depth, error) {
 	var resDepth constant.Depth
-	stockType := e.GetStockType()
+	stockType := e.symbolOf(symbol)
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetDepth() error, the error number is stockType")
 		return nil, fmt.Errorf("GetDepth() error, the error number is stockType")
 	}
-	depth, err := e.api.GetDepth(constant.DepthSize, exchangeStockType)
+	var depth *goex.Depth
+	err := e.call("GetDepth", func() (err error) {
+		depth, err = e.api.GetDepth(constant.DepthSize, exchangeStockType)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetDepth() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetDepth() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetDepth() error, the error number is %w", err)
 	}
 	resDepth.Time = depth.UTime.Unix()
+	resDepth.StockType = stockType
 	for _, ask := range depth.AskList {
 		var resAsk constant.DepthRecord
 		resAsk.Amount = ask.Amount
@@ -127,15 +145,24 @@ func (e *SpotExchange) GetDepth() (*constant.Depth, error) {
 
 // GetPosition ...
 func (e *SpotExchange) GetPosition() ([]constant.Position, error) {
+	return e.GetPositionOf(e.GetStockType())
+}
+
+// GetPositionOf ...
+func (e *SpotExchange) GetPositionOf(symbol string) ([]constant.Position, error) {
 	return nil, fmt.Errorf("not support")
 }
 
 // GetAccount get the account detail of this exchange
 func (e *SpotExchange) GetAccount() (*constant.Account, error) {
-	account, err := e.api.GetAccount()
+	var account *goex.Account
+	err := e.call("GetAccount", func() (err error) {
+		account, err = e.api.GetAccount()
+		return
+	})
 	if err != nil {
 		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetAccount() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetAccount() error, the error number is %s", err.Error())
+		return nil, fmt.Errorf("GetAccount() error, the error number is %w", err)
 	}
 	var resAccount constant.Account
 	resAccount.SubAccounts = make(map[string]constant.SubAccount)
@@ -152,75 +179,88 @@ func (e *SpotExchange) GetAccount() (*constant.Account, error) {
 
 // Buy ...
 func (e *SpotExchange) Buy(price, amount string, msg string) (string, error) {
-	var err error
-	var order *goex.Order
-	stockType := e.GetStockType()
-	exchangeStockType, ok := e.stockTypeMap[stockType]
-	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Buy() error, the error number is stockType")
-		return "", fmt.Errorf("Buy() error, the error number is stockType")
-	}
-	var matchPrice = 0
-	if price == "-1" {
-		matchPrice = 1
-	}
-	if matchPrice == 1 {
-		order, err = e.api.MarketBuy(amount, price, exchangeStockType)
-	} else {
-		order, err = e.api.LimitBuy(amount, price, exchangeStockType)
-	}
-
-	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Sell() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
-	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
-	return order.Cid, nil
+	return placeString(e, constant.TradeTypeBuy, price, amount, msg)
 }
 
 // Sell ...
 func (e *SpotExchange) Sell(price, amount string, msg string) (string, error) {
-	var err error
-	var order *goex.Order
-	stockType := e.GetStockType()
+	return placeString(e, constant.TradeTypeSell, price, amount, msg)
+}
+
+// PlaceOrder ...
+func (e *SpotExchange) PlaceOrder(req constant.OrderRequest) (string, error) {
+	return e.submitOrder(nil, req, e.placeOrder)
+}
+
+// GetOrderByClientID get the order placed with the client order id
+func (e *SpotExchange) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	return e.orderByClientID(e.GetOrderOf, clientID)
+}
+
+// placeOrder ...
+func (e *SpotExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
+	}
+	if err := e.prepareOrder(&req); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+		return "", err
+	}
+	stockType := req.Symbol
 	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Sell() error, the error number is stockType")
-		return "", fmt.Errorf("Sell() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount, method+"() error, the error number is stockType")
+		return "", fmt.Errorf("%s() error, the error number is stockType", method)
 	}
-	var matchPrice = 0
-	if price == "-1" {
-		matchPrice = 1
-	}
-	if matchPrice == 1 {
-		order, err = e.api.MarketSell(amount, price, exchangeStockType)
-	} else {
-		order, err = e.api.LimitSell(amount, price, exchangeStockType)
+	if req.ReduceOnly {
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount, method+"() error, the error number is reduce only not support")
+		return "", fmt.Errorf("%s() error, the error number is reduce only not support", method)
 	}
-
+	var order *goex.Order
+	price, amount := orderPrice(req), orderAmount(req)
+	err := e.call("PlaceOrder", func() (err error) {
+		switch {
+		case req.OrderType == constant.OrderTypeMarket && req.Side == constant.TradeTypeBuy:
+			order, err = e.api.MarketBuy(amount, price, exchangeStockType)
+		case req.OrderType == constant.OrderTypeMarket:
+			order, err = e.api.MarketSell(amount, price, exchangeStockType)
+		case req.Side == constant.TradeTypeBuy:
+			order, err = e.api.LimitBuy(amount, price, exchangeStockType, limitOptions(req)...)
+		default:
+			order, err = e.api.LimitSell(amount, price, exchangeStockType, limitOptions(req)...)
+		}
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Sell() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount, method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %w", method, err)
 	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
+	e.logger.Log(e.GetDirection(), stockType, req.Price, req.Amount, req.Msg)
 	return order.Cid, nil
 }
 
 // GetOrder get details of an order
 func (e *SpotExchange) GetOrder(id string) (*constant.Order, error) {
-	exchangeStockType, ok := e.stockTypeMap[e.GetStockType()]
+	return e.GetOrderOf(e.GetStockType(), id)
+}
+
+// GetOrderOf get details of an order of the symbol
+func (e *SpotExchange) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0, util.Float64Must(id), "GetOrder() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0, util.Float64Must(id), "GetOrder() error, the error number is stockType")
 		return nil, fmt.Errorf("GetOrder() error, the error number is stockType")
 	}
-	order, err := e.api.GetOneOrder(id, exchangeStockType)
+	var order *goex.Order
+	err := e.call("GetOrder", func() (err error) {
+		order, err = e.api.GetOneOrder(id, exchangeStockType)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(id), "GetOrder() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetOrder() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(id), "GetOrder() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetOrder() error, the error number is %w", err)
 	}
 
 	var TradeType string
@@ -236,21 +276,31 @@ func (e *SpotExchange) GetOrder(id string) (*constant.Order, error) {
 		Amount:     order.Amount,
 		DealAmount: order.DealAmount,
 		TradeType:  TradeType,
-		StockType:  e.GetStockType(),
+		StockType:  stockType,
 	}, nil
 }
 
 // GetOrders get all unfilled orders
 func (e *SpotExchange) GetOrders() ([]constant.Order, error) {
-	exchangeStockType, ok := e.stockTypeMap[e.GetStockType()]
+	return e.GetOrdersOf(e.GetStockType())
+}
+
+// GetOrdersOf get all unfilled orders of the symbol
+func (e *SpotExchange) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, "", 0, 0, "GetOrders() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0, 0, "GetOrders() error, the error number is stockType")
 		return nil, fmt.Errorf("GetOrders() error, the error number is stockType")
 	}
-	orders, err := e.api.GetUnfinishOrders(exchangeStockType)
+	var orders []goex.Order
+	err := e.call("GetOrders", func() (err error) {
+		orders, err = e.api.GetUnfinishOrders(exchangeStockType)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetOrders() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetOrders() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetOrders() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetOrders() error, the error number is %w", err)
 	}
 	resOrders := []constant.Order{}
 	for _, order := range orders {
@@ -266,7 +316,7 @@ func (e *SpotExchange) GetOrders() ([]constant.Order, error) {
 			Amount:     order.Amount,
 			DealAmount: order.DealAmount,
 			TradeType:  TradeType,
-			StockType:  e.GetStockType(),
+			StockType:  stockType,
 		}
 		resOrders = append(resOrders, resOrder)
 	}
@@ -275,34 +325,54 @@ func (e *SpotExchange) GetOrders() ([]constant.Order, error) {
 
 // CancelOrder cancel an order
 func (e *SpotExchange) CancelOrder(orderID string) (bool, error) {
-	exchangeStockType, ok := e.stockTypeMap[e.GetStockType()]
+	return e.CancelOrderOf(e.GetStockType(), orderID)
+}
+
+// CancelOrderOf cancel an order of the symbol
+func (e *SpotExchange) CancelOrderOf(symbol, orderID string) (bool, error) {
+	stockType := e.symbolOf(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0, util.Float64Must(orderID), "CancelOrder() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0, util.Float64Must(orderID), "CancelOrder() error, the error number is stockType")
 		return false, fmt.Errorf("CancelOrder() error, the error number is stockType")
 	}
-	result, err := e.api.CancelOrder(orderID, exchangeStockType)
+	var result bool
+	err := e.call("CancelOrder", func() (err error) {
+		result, err = e.api.CancelOrder(orderID, exchangeStockType)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(orderID), "CancelOrder() error, the error number is ", err.Error())
-		return false, fmt.Errorf("CancelOrder() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(orderID), "CancelOrder() error, the error number is ", err.Error())
+		return false, fmt.Errorf("CancelOrder() error, the error number is %w", err)
 	}
 	if !result {
 		return false, fmt.Errorf("CancelOrder() error, the error number is false")
 	}
-	e.logger.Log(constant.TradeTypeCancel, e.GetStockType(), 0, util.Float64Must(orderID), "CancelOrder() success")
+	e.logger.Log(constant.TradeTypeCancel, stockType, 0, util.Float64Must(orderID), "CancelOrder() success")
 	return true, nil
 }
 
 // GetTicker get market ticker
 func (e *SpotExchange) GetTicker() (*constant.Ticker, error) {
-	exchangeStockType, ok := e.stockTypeMap[e.GetStockType()]
+	return e.GetTickerOf(e.GetStockType())
+}
+
+// GetTickerOf get market ticker of the symbol
+func (e *SpotExchange) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	stockType := e.symbolOf(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
 	if !ok {
-		e.logger.Log(constant.ERROR, "", 0, 0, "GetTicker() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0, 0, "GetTicker() error, the error number is stockType")
 		return nil, fmt.Errorf("GetTicker() error, the error number is stockType")
 	}
-	exTicker, err := e.api.GetTicker(exchangeStockType)
+	var exTicker *goex.Ticker
+	err := e.call("GetTicker", func() (err error) {
+		exTicker, err = e.api.GetTicker(exchangeStockType)
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetTicker() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetTicker() error, the error number is %w", err)
 	}
 	//force covert
 	tickStr := fmt.Sprint(exTicker.Date)
@@ -317,3 +387,49 @@ func (e *SpotExchange) GetTicker() (*constant.Ticker, error) {
 	}
 	return &ticker, nil
 }
+
+// GetRecords get the klines of the stock type by the period and the size set
+func (e *SpotExchange) GetRecords() ([]constant.Record, error) {
+	return e.GetRecordsOf(e.GetStockType())
+}
+
+// GetRecordsOf get the klines of the symbol by the period and the size set
+func (e *SpotExchange) GetRecordsOf(symbol string) ([]constant.Record, error) {
+	stockType := e.symbolOf(symbol)
+	exchangeStockType, ok := e.stockTypeMap[stockType]
+	if !ok {
+		e.logger.Log(constant.ERROR, stockType, 0, 0, "GetRecords() error, the error number is stockType")
+		return nil, fmt.Errorf("GetRecords() error, the error number is stockType")
+	}
+	period, ok := e.GetRecordsPeriodMap()[e.GetPeriod()]
+	if !ok {
+		e.logger.Log(constant.ERROR, stockType, 0, 0, "GetRecords() error, the error number is invalid period "+e.GetPeriod())
+		return nil, fmt.Errorf("GetRecords() error, the error number is invalid period %s", e.GetPeriod())
+	}
+	var klines []goex.Kline
+	err := e.call("GetRecords", func() (err error) {
+		klines, err = e.api.GetKlineRecords(exchangeStockType, goex.KlinePeriod(period), e.GetPeriodSize())
+		return
+	})
+	if err != nil {
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetRecords() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetRecords() error, the error number is %w", err)
+	}
+	return klineA2U(klines), nil
+}
+
+// klineA2U covert the klines of the api to the records
+func klineA2U(klines []goex.Kline) []constant.Record {
+	records := make([]constant.Record, 0, len(klines))
+	for _, kline := range klines {
+		records = append(records, constant.Record{
+			Time:   kline.Timestamp,
+			Open:   kline.Open,
+			High:   kline.High,
+			Low:    kline.Low,
+			Close:  kline.Close,
+			Volume: kline.Vol,
+		})
+	}
+	return records
+}
@@ -39,13 +39,14 @@ type ExchangeBack struct {
 	pendingOrders        map[string]*constant.Order
 	finishedOrders       map[string]*constant.Order
 	dataLoader           map[string]*DataLoader
-	currData             constant.OHLC
+	currData             map[string]constant.OHLC // 各品种当前的行情
 	idGen                *util.IDGen
 	contractRate         float64 // contract price
 	CurrencyStandard     bool    // stand money ?
 	sortedCurrencies     constant.Account
 	longPosition         map[string]constant.Position // long
 	shortPosition        map[string]constant.Position // short
+	onFill               func(constant.Fill)
 }
 
 // NewExchangeBack ...
@@ -62,6 +63,7 @@ func NewExchangeBack(config ExchangeBackConfig) *ExchangeBack {
 		pendingOrders:        make(map[string]*constant.Order, 100),
 		finishedOrders:       make(map[string]*constant.Order, 100),
 		dataLoader:           make(map[string]*DataLoader, 1),
+		currData:             make(map[string]constant.OHLC, 1),
 		longPosition:         make(map[string]constant.Position, 1),
 		shortPosition:        make(map[string]constant.Position, 1),
 	}
@@ -86,10 +88,12 @@ func (e *ExchangeBack) Start() error {
 	e.makerFee = e.BaseExchange.maker
 	e.takerFee = e.BaseExchange.taker
 	e.acc = &account
+	e.acc.SubAccounts = make(map[string]constant.SubAccount)
 
 	e.pendingOrders = make(map[string]*constant.Order, 100)
 	e.finishedOrders = make(map[string]*constant.Order, 100)
 	e.dataLoader = make(map[string]*DataLoader, 1)
+	e.currData = make(map[string]constant.OHLC, 1)
 	e.longPosition = make(map[string]constant.Position, 1)
 	e.shortPosition = make(map[string]constant.Position, 1)
 	//todo
@@ -97,6 +101,7 @@ func (e *ExchangeBack) Start() error {
 	currencyMap := e.BaseExchange.currencyMap
 	for key, val := range currencyMap {
 		var sub constant.SubAccount
+		sub.StockType = key
 		sub.Amount = val
 		e.acc.SubAccounts[key] = sub
 	}
@@ -104,7 +109,7 @@ func (e *ExchangeBack) Start() error {
 }
 
 func (ex *ExchangeBack) fillOrder(isTaker bool, amount, price float64, ord *constant.Order) {
-	ord.FinishedTime = ex.currData.Time / int64(time.Millisecond) //set filled time
+	ord.FinishedTime = ex.currData[ord.StockType].Time / int64(time.Millisecond) //set filled time
 	dealAmount := 0.0
 	remain := ord.Amount - ord.DealAmount
 	if remain > amount {
@@ -114,7 +119,7 @@ func (ex *ExchangeBack) fillOrder(isTaker bool, amount, price float64, ord *cons
 	}
 
 	ratio := dealAmount / (ord.DealAmount + dealAmount)
-	ord.AvgPrice = math.Round(ratio*price+(1-ratio)*ord.AvgPrice*100000000) / 100000000
+	ord.AvgPrice = math.Round((ratio*price+(1-ratio)*ord.AvgPrice)*100000000) / 100000000
 	ord.DealAmount += dealAmount
 	if ord.Amount == ord.DealAmount {
 		ord.Status = constant.ORDER_FINISH
@@ -141,10 +146,16 @@ func (ex *ExchangeBack) fillOrder(isTaker bool, amount, price float64, ord *cons
 	ord.Fee += tradeFee
 
 	ex.unFrozenAsset(tradeFee, dealAmount, price, *ord)
+	emitFill(ex.onFill, *ord, price, dealAmount, tradeFee, ord.FinishedTime)
+}
+
+// SetFillHandler set the handler called on every execution
+func (ex *ExchangeBack) SetFillHandler(handler func(constant.Fill)) {
+	ex.onFill = handler
 }
 
 func (ex *ExchangeBack) matchOrder(ord *constant.Order, isTaker bool) {
-	ticker := ex.currData
+	ticker := ex.currData[ord.StockType]
 	switch ord.TradeType {
 	case constant.TradeTypeSell:
 		if ticker.Close >= ord.Price && ticker.Volume > 0 {
@@ -165,14 +176,25 @@ func (ex *ExchangeBack) matchOrder(ord *constant.Order, isTaker bool) {
 	}
 }
 
-func (ex *ExchangeBack) match() {
+// match the pending orders of the currency with the current data
+func (ex *ExchangeBack) match(currency string) {
 	ex.Lock()
 	defer ex.Unlock()
-	for id := range ex.pendingOrders {
-		ex.matchOrder(ex.pendingOrders[id], false)
+	for id, ord := range ex.pendingOrders {
+		if ord.StockType == currency {
+			ex.matchOrder(ex.pendingOrders[id], false)
+		}
 	}
 }
 
+// feed set the current data of the currency and match its pending orders
+func (ex *ExchangeBack) feed(currency string, ohlc constant.OHLC) {
+	ex.Lock()
+	ex.currData[currency] = ohlc
+	ex.Unlock()
+	ex.match(currency)
+}
+
 // LimitBuy ...
 func (ex *ExchangeBack) LimitBuy(amount, price, currency string) (*constant.Order, error) {
 	ex.Lock()
@@ -182,7 +204,7 @@ func (ex *ExchangeBack) LimitBuy(amount, price, currency string) (*constant.Orde
 		Price:     goex.ToFloat64(price),
 		Amount:    goex.ToFloat64(amount),
 		Id:        ex.idGen.Get(),
-		Time:      ex.currData.Time / int64(time.Millisecond),
+		Time:      ex.currData[currency].Time / int64(time.Millisecond),
 		Status:    constant.ORDER_UNFINISH,
 		StockType: currency,
 		TradeType: constant.TradeTypeBuy,
@@ -211,7 +233,7 @@ func (ex *ExchangeBack) LimitSell(amount, price, currency string) (*constant.Ord
 		Price:     goex.ToFloat64(price),
 		Amount:    goex.ToFloat64(amount),
 		Id:        ex.idGen.Get(),
-		Time:      ex.currData.Time / int64(time.Millisecond),
+		Time:      ex.currData[currency].Time / int64(time.Millisecond),
 		Status:    constant.ORDER_UNFINISH,
 		StockType: currency,
 		TradeType: constant.TradeTypeSell,
@@ -232,14 +254,52 @@ func (ex *ExchangeBack) LimitSell(amount, price, currency string) (*constant.Ord
 	return &result, nil
 }
 
-// MarketBuy ...
+// MarketBuy buy at the close of the current data
 func (ex *ExchangeBack) MarketBuy(amount, price, currency string) (*constant.Order, error) {
-	panic("not support")
+	return ex.marketOrder(amount, currency, constant.TradeTypeBuy)
 }
 
-// MarketSell ...
+// MarketSell sell at the close of the current data
 func (ex *ExchangeBack) MarketSell(amount, price, currency string) (*constant.Order, error) {
-	panic("not support")
+	return ex.marketOrder(amount, currency, constant.TradeTypeSell)
+}
+
+// marketOrder fill the order at once as a taker, the part not filled canceled
+func (ex *ExchangeBack) marketOrder(amount, currency, tradeType string) (*constant.Order, error) {
+	ex.Lock()
+	defer ex.Unlock()
+
+	curr := ex.currData[currency]
+	if curr.Close <= 0 {
+		return nil, ErrDataInsufficient
+	}
+	ord := constant.Order{
+		Price:     curr.Close,
+		Amount:    goex.ToFloat64(amount),
+		Id:        ex.idGen.Get(),
+		Time:      curr.Time / int64(time.Millisecond),
+		Status:    constant.ORDER_UNFINISH,
+		StockType: currency,
+		TradeType: tradeType,
+	}
+
+	err := ex.frozenAsset(ord)
+	if err != nil {
+		return nil, err
+	}
+
+	ex.pendingOrders[ord.Id] = &ord
+	ex.matchOrder(&ord, true)
+	if ord.Status != constant.ORDER_FINISH {
+		delete(ex.pendingOrders, ord.Id)
+		ord.Status = constant.ORDER_CANCEL
+		ex.finishedOrders[ord.Id] = &ord
+		ex.unFrozenAsset(0, 0, 0, ord)
+	}
+
+	var result constant.Order
+	util.DeepCopyStruct(ord, &result)
+	return &result, nil
 }
 
 // CancelOrder ...
@@ -267,6 +327,18 @@ func (ex *ExchangeBack) CancelOrder(orderID string, currency string) (bool, erro
 	return true, nil
 }
 
+// setClientID bind the client order id to the order
+func (ex *ExchangeBack) setClientID(orderID, clientID string) {
+	ex.Lock()
+	defer ex.Unlock()
+	if ord := ex.pendingOrders[orderID]; ord != nil {
+		ord.ClientID = clientID
+	}
+	if ord := ex.finishedOrders[orderID]; ord != nil {
+		ord.ClientID = clientID
+	}
+}
+
 // GetOneOrder ...
 func (ex *ExchangeBack) GetOneOrder(orderID, currency string) (*constant.Order, error) {
 	ex.RLock()
@@ -337,8 +409,7 @@ func (ex *ExchangeBack) GetTicker(currency string) (*constant.Ticker, error) {
 	if ohlc == nil {
 		return nil, ErrDataFinished
 	}
-	ex.currData = *ohlc
-	ex.match()
+	ex.feed(currency, *ohlc)
 	return &constant.Ticker{
 		Last: ohlc.Close,
 		Buy:  ohlc.Close,
@@ -348,6 +419,15 @@ func (ex *ExchangeBack) GetTicker(currency string) (*constant.Ticker, error) {
 	}, nil
 }
 
+// GetRecords the records of the currency fed so far
+func (ex *ExchangeBack) GetRecords(currency string, size int) ([]constant.Record, error) {
+	loader := ex.dataLoader[currency]
+	if loader == nil {
+		return nil, errors.New("loader not found")
+	}
+	return loader.Records(size), nil
+}
+
 // GetDepth ...
 func (ex *ExchangeBack) GetDepth(size int, currency string) (*constant.Depth, error) {
 	return nil, fmt.Errorf("error")
@@ -358,14 +438,14 @@ func (ex *ExchangeBack) GetExchangeName() string {
 	return ex.name
 }
 
-//冻结
+// frozenAsset 冻结
 func (ex *ExchangeBack) frozenAsset(order constant.Order) error {
 	stocks := stockPair2Vec(order.StockType)
 	CurrencyA := stocks[0]
 	CurrencyB := stocks[1]
 	switch order.TradeType {
 	case constant.TradeTypeSell:
-		avaAmount := ex.acc.SubAccounts[order.StockType].Amount
+		avaAmount := ex.acc.SubAccounts[CurrencyA].Amount
 		if avaAmount < order.Amount {
 			return ErrDataInsufficient
 		}
@@ -402,21 +482,21 @@ func (ex *ExchangeBack) unFrozenAsset(fee, matchAmount, matchPrice float64, orde
 	switch order.TradeType {
 	case constant.TradeTypeSell:
 		if order.Status == constant.ORDER_CANCEL {
-			ex.acc.SubAccounts[assetA.StockType] = constant.SubAccount{
-				StockType:    assetA.StockType,
+			ex.acc.SubAccounts[CurrencyA] = constant.SubAccount{
+				StockType:    CurrencyA,
 				Amount:       assetA.Amount + order.Amount - order.DealAmount,
 				FrozenAmount: assetA.FrozenAmount - (order.Amount - order.DealAmount),
 				LoanAmount:   0,
 			}
 		} else {
-			ex.acc.SubAccounts[assetA.StockType] = constant.SubAccount{
-				StockType:    assetA.StockType,
+			ex.acc.SubAccounts[CurrencyA] = constant.SubAccount{
+				StockType:    CurrencyA,
 				Amount:       assetA.Amount,
 				FrozenAmount: assetA.FrozenAmount - matchAmount,
 				LoanAmount:   0,
 			}
-			ex.acc.SubAccounts[assetB.StockType] = constant.SubAccount{
-				StockType:    assetB.StockType,
+			ex.acc.SubAccounts[CurrencyB] = constant.SubAccount{
+				StockType:    CurrencyB,
 				Amount:       assetB.Amount + matchAmount*matchPrice - fee,
 				FrozenAmount: assetB.FrozenAmount,
 			}
@@ -425,20 +505,20 @@ func (ex *ExchangeBack) unFrozenAsset(fee, matchAmount, matchPrice float64, orde
 	case constant.TradeTypeBuy:
 		if order.Status == constant.ORDER_CANCEL {
 			unFrozen := (order.Amount - order.DealAmount) * order.Price
-			ex.acc.SubAccounts[assetB.StockType] = constant.SubAccount{
-				StockType:    assetB.StockType,
+			ex.acc.SubAccounts[CurrencyB] = constant.SubAccount{
+				StockType:    CurrencyB,
 				Amount:       assetB.Amount + unFrozen,
 				FrozenAmount: assetB.FrozenAmount - unFrozen,
 			}
 		} else {
-			ex.acc.SubAccounts[assetA.StockType] = constant.SubAccount{
-				StockType:    assetA.StockType,
+			ex.acc.SubAccounts[CurrencyA] = constant.SubAccount{
+				StockType:    CurrencyA,
 				Amount:       assetA.Amount + matchAmount - fee,
 				FrozenAmount: assetA.FrozenAmount,
 				LoanAmount:   0,
 			}
-			ex.acc.SubAccounts[assetB.StockType] = constant.SubAccount{
-				StockType:    assetB.StockType,
+			ex.acc.SubAccounts[CurrencyB] = constant.SubAccount{
+				StockType:    CurrencyB,
 				Amount:       assetB.Amount + matchAmount*(order.Price-matchPrice),
 				FrozenAmount: assetB.FrozenAmount - matchAmount*order.Price,
 			}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestSpotBackAccounting(t *testing.T) {
+	symbol := "BTC/USDT"
+	e := &ExchangeBack{}
+	e.BaseExchange.Init(constant.Option{Type: constant.SpotBack, BackLog: true, BackTest: true})
+	e.SetBackAccount("USDT", 1000)
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	e.dataLoader[symbol] = &DataLoader{}
+	e.dataLoader[symbol].Load([]constant.OHLC{
+		{Close: 100, Volume: 1},
+		{Close: 90, Volume: 1},
+		{Close: 95, Volume: 10},
+		{Close: 95, Volume: 10},
+	})
+
+	if _, err := e.GetTicker(symbol); err != nil {
+		t.Fatalf("ticker: %v", err)
+	}
+	ord, err := e.LimitBuy("2", "110", symbol)
+	if err != nil || ord.DealAmount != 1 {
+		t.Fatalf("the order should be filled by the volume of the bar, got %+v %v", ord, err)
+	}
+	e.GetTicker(symbol)
+	ord, _ = e.GetOneOrder(ord.Id, symbol)
+	if ord.Status != constant.ORDER_FINISH || ord.AvgPrice != 95 {
+		t.Fatalf("the average price should be weighted by the amounts, got %+v", ord)
+	}
+	account, _ := e.GetAccount()
+	if btc := account.SubAccounts["BTC"]; btc.StockType != "BTC" || btc.Amount != 2 {
+		t.Fatalf("unexpected BTC %+v", btc)
+	}
+
+	// 卖出冻结基础币种
+	ord, err = e.LimitSell("1", "100", symbol)
+	if err != nil || ord.Status != constant.ORDER_UNFINISH {
+		t.Fatalf("limit sell: %+v %v", ord, err)
+	}
+	account, _ = e.GetAccount()
+	if btc := account.SubAccounts["BTC"]; btc.Amount != 1 || btc.FrozenAmount != 1 {
+		t.Fatalf("the sell order should freeze BTC, got %+v", btc)
+	}
+
+	e.GetTicker(symbol)
+	ord, err = e.MarketSell("1", "-1", symbol)
+	if err != nil || ord.Status != constant.ORDER_FINISH || ord.AvgPrice != 95 {
+		t.Fatalf("the market order should be filled at the close, got %+v %v", ord, err)
+	}
+	account, _ = e.GetAccount()
+	if usdt := account.SubAccounts["USDT"]; usdt.Amount != 1000-100-90+95 {
+		t.Fatalf("unexpected USDT %+v", usdt)
+	}
+}
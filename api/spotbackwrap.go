@@ -91,10 +91,15 @@ func (e *ExchangeBackWrap) GetStockTypeMap() map[string]goex.CurrencyPair {
 
 // GetDepth get depth from exchange
 func (e *ExchangeBackWrap) GetDepth() (*constant.Depth, error) {
-	stockType := e.GetStockType()
+	return e.GetDepthOf(e.GetStockType())
+}
+
+// GetDepthOf get the depth of the symbol
+func (e *ExchangeBackWrap) GetDepthOf(symbol string) (*constant.Depth, error) {
+	stockType := e.symbolOf(symbol)
 	depth, err := e.ExchangeBack.GetDepth(constant.DepthSize, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is stockType")
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetDepth() error, the error number is stockType")
 		return nil, fmt.Errorf("GetDepth() error, the error number is stockType")
 	}
 	return depth, nil
@@ -102,6 +107,11 @@ func (e *ExchangeBackWrap) GetDepth() (*constant.Depth, error) {
 
 // GetPosition get position from exchange
 func (e *ExchangeBackWrap) GetPosition() ([]constant.Position, error) {
+	return e.GetPositionOf(e.GetStockType())
+}
+
+// GetPositionOf ...
+func (e *ExchangeBackWrap) GetPositionOf(symbol string) ([]constant.Position, error) {
 	return nil, fmt.Errorf("spot without position")
 }
 
@@ -117,60 +127,72 @@ func (e *ExchangeBackWrap) GetAccount() (*constant.Account, error) {
 
 // Buy buy from exchange
 func (e *ExchangeBackWrap) Buy(price, amount string, msg string) (string, error) {
-	var err error
-	var ord *constant.Order
-	stockType := e.GetStockType()
-	if err := e.ValidBuy(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Buy() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Buy() error, the error number is %s", err.Error())
-	}
-	if price == "-1" {
-		ord, err = e.ExchangeBack.MarketBuy(amount, price, stockType)
-	} else {
-		ord, err = e.ExchangeBack.LimitBuy(amount, price, stockType)
-	}
-
-	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Buy() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Buy() error, the error number is %s", err.Error())
-	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
-	return ord.Id, nil
-
+	return placeString(e, constant.TradeTypeBuy, price, amount, msg)
 }
 
 // Sell sell from exchange
 func (e *ExchangeBackWrap) Sell(price, amount string, msg string) (string, error) {
+	return placeString(e, constant.TradeTypeSell, price, amount, msg)
+}
+
+// PlaceOrder ...
+func (e *ExchangeBackWrap) PlaceOrder(req constant.OrderRequest) (string, error) {
+	return e.submitOrder(nil, req, e.placeOrder)
+}
+
+// GetOrderByClientID get the order placed with the client order id
+func (e *ExchangeBackWrap) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	return e.orderByClientID(e.GetOrderOf, clientID)
+}
+
+// placeOrder ...
+func (e *ExchangeBackWrap) placeOrder(req constant.OrderRequest) (string, error) {
+	method, valid := "Buy", e.ValidBuy
+	if req.Side == constant.TradeTypeSell {
+		method, valid = "Sell", e.ValidSell
+	}
+	if err := e.prepareOrder(&req); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, err.Error())
+		return "", err
+	}
 	var err error
 	var ord *constant.Order
-	stockType := e.GetStockType()
-	if err := e.ValidSell(); err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Sell() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Sell() error, the error number is %s", err.Error())
+	stockType := req.Symbol
+	if err := valid(); err != nil {
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %s", method, err.Error())
 	}
-	if price == "-1" {
+	price, amount := orderPrice(req), orderAmount(req)
+	switch {
+	case req.OrderType == constant.OrderTypeMarket && req.Side == constant.TradeTypeBuy:
+		ord, err = e.ExchangeBack.MarketBuy(amount, price, stockType)
+	case req.OrderType == constant.OrderTypeMarket:
 		ord, err = e.ExchangeBack.MarketSell(amount, price, stockType)
-	} else {
+	case req.Side == constant.TradeTypeBuy:
+		ord, err = e.ExchangeBack.LimitBuy(amount, price, stockType)
+	default:
 		ord, err = e.ExchangeBack.LimitSell(amount, price, stockType)
 	}
-
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), util.Float64Must(amount), util.Float64Must(amount), "Buy() error, the error number is ", err.Error())
-		return "", fmt.Errorf("Buy() error, the error number is %s", err.Error())
+		e.logger.Log(constant.ERROR, req.Symbol, req.Price, req.Amount, method+"() error, the error number is ", err.Error())
+		return "", fmt.Errorf("%s() error, the error number is %s", method, err.Error())
 	}
-	priceFloat := util.Float64Must(price)
-	amountFloat := util.Float64Must(amount)
-	e.logger.Log(e.direction, stockType, priceFloat, amountFloat, msg)
+	e.logger.Log(e.GetDirection(), stockType, req.Price, req.Amount, req.Msg)
+	e.ExchangeBack.setClientID(ord.Id, req.ClientOrderID)
 	return ord.Id, nil
 }
 
 // GetOrder get detail of an order
 func (e *ExchangeBackWrap) GetOrder(id string) (*constant.Order, error) {
-	order, err := e.ExchangeBack.GetOneOrder(id, e.GetStockType())
+	return e.GetOrderOf(e.GetStockType(), id)
+}
+
+// GetOrderOf get detail of an order of the symbol
+func (e *ExchangeBackWrap) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	order, err := e.ExchangeBack.GetOneOrder(id, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(id), "GetOrder() error, the error number is ", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(id), "GetOrder() error, the error number is ", err.Error())
 		return nil, fmt.Errorf("GetOrder() error, the error number is %s", err.Error())
 	}
 	return order, nil
@@ -178,9 +200,15 @@ func (e *ExchangeBackWrap) GetOrder(id string) (*constant.Order, error) {
 
 // GetOrders get all unfilled orders
 func (e *ExchangeBackWrap) GetOrders() ([]constant.Order, error) {
-	orders, err := e.ExchangeBack.GetUnfinishOrders(e.GetStockType())
+	return e.GetOrdersOf(e.GetStockType())
+}
+
+// GetOrdersOf get all unfilled orders of the symbol
+func (e *ExchangeBackWrap) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	stockType := e.symbolOf(symbol)
+	orders, err := e.ExchangeBack.GetUnfinishOrders(stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetOrders() error, the error number is ", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetOrders() error, the error number is ", err.Error())
 		return nil, fmt.Errorf("GetOrders() error, the error number is %s", err.Error())
 	}
 	return orders, nil
@@ -188,24 +216,52 @@ func (e *ExchangeBackWrap) GetOrders() ([]constant.Order, error) {
 
 // CancelOrder cancel an order
 func (e *ExchangeBackWrap) CancelOrder(orderID string) (bool, error) {
-	result, err := e.ExchangeBack.CancelOrder(orderID, e.GetStockType())
+	return e.CancelOrderOf(e.GetStockType(), orderID)
+}
+
+// CancelOrderOf cancel an order of the symbol
+func (e *ExchangeBackWrap) CancelOrderOf(symbol, orderID string) (bool, error) {
+	stockType := e.symbolOf(symbol)
+	result, err := e.ExchangeBack.CancelOrder(orderID, stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, util.Float64Must(orderID), "CancelOrder() error, the error number is ", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, util.Float64Must(orderID), "CancelOrder() error, the error number is ", err.Error())
 		return false, fmt.Errorf("CancelOrder() error, the error number is %s", err.Error())
 	}
 	if !result {
 		return false, fmt.Errorf("CancelOrder() error, the error number is result fail")
 	}
-	e.logger.Log(constant.TradeTypeCancel, e.GetStockType(), 0, util.Float64Must(orderID), "CancelOrder() success")
+	e.logger.Log(constant.TradeTypeCancel, stockType, 0, util.Float64Must(orderID), "CancelOrder() success")
 	return true, nil
 }
 
 // GetTicker get market ticker
 func (e *ExchangeBackWrap) GetTicker() (*constant.Ticker, error) {
-	ticker, err := e.ExchangeBack.GetTicker(e.GetStockType())
+	return e.GetTickerOf(e.GetStockType())
+}
+
+// GetTickerOf get market ticker of the symbol
+func (e *ExchangeBackWrap) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	stockType := e.symbolOf(symbol)
+	ticker, err := e.ExchangeBack.GetTicker(stockType)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
 		return nil, fmt.Errorf("GetTicker() error, the error number is %s", err.Error())
 	}
 	return ticker, nil
 }
+
+// GetRecords get the records fed so far
+func (e *ExchangeBackWrap) GetRecords() ([]constant.Record, error) {
+	return e.GetRecordsOf(e.GetStockType())
+}
+
+// GetRecordsOf get the records of the symbol fed so far
+func (e *ExchangeBackWrap) GetRecordsOf(symbol string) ([]constant.Record, error) {
+	stockType := e.symbolOf(symbol)
+	records, err := e.ExchangeBack.GetRecords(stockType, e.GetPeriodSize())
+	if err != nil {
+		e.logger.Log(constant.ERROR, stockType, 0.0, 0.0, "GetRecords() error, the error number is ", err.Error())
+		return nil, fmt.Errorf("GetRecords() error, the error number is %s", err.Error())
+	}
+	return records, nil
+}
@@ -1,16 +1,21 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/axgle/mahonia"
 	simplejson "github.com/bitly/go-simplejson"
+	"snack.com/xiyanxiyan10/stocktrader/config"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
 	"snack.com/xiyanxiyan10/stocktrader/util"
 )
 
@@ -18,50 +23,75 @@ const (
 	timeTemplate1 = "2006-01-02 15:04:05"
 	tickerURL     = "http://hq.sinajs.cn/list="
 	//depthURL      = "http://hq.sinajs.cn/list="
-	recordURL = "http://money.finance.sina.com.cn/quotes_service/api/json_v2.php/CN_MarketData.getKLineData?"
+	recordURL   = "http://money.finance.sina.com.cn/quotes_service/api/json_v2.php/CN_MarketData.getKLineData?"
+	sinaReferer = "https://finance.sina.com.cn"
 )
 
-// NewSZExchange create an exchange struct of futureExchange.com
+// 模拟交易的资金及费用
+const (
+	szBalance       = "szbalance"  // config.ini 中的初始资金
+	szHolidayKey    = "szholidays" // config.ini 中的休市日期
+	szDefaultCash   = 1000000.0
+	szLot           = 100.0   // 一手
+	szTick          = 0.01    // 最小价格变动
+	szCommission    = 0.00025 // 佣金费率, SetBackCommission 的 taker 可以修改
+	szMinCommission = 5.0     // 最低佣金
+	szStampTax      = 0.0005  // 卖出印花税
+)
+
+// szLocation the time zone of the shanghai and shenzhen exchanges
+var szLocation = time.FixedZone("CST", 8*3600)
+
+// szNow the clock of the calendar and the sessions
+var szNow = func() time.Time { return time.Now().In(szLocation) }
+
+// szSessions the continuous trading sessions in minutes of the day, orders accepted from 9:15
+var szSessions = [][2]int{{9*60 + 30, 11*60 + 30}, {13 * 60, 15 * 60}}
+
+// szOpenOrder the minute orders accepted from
+const szOpenOrder = 9*60 + 15
+
+// NewSZExchange create a paper trading exchange of the shanghai and shenzhen stocks on sina quotes
 func NewSZExchange(opt constant.Option) (Exchange, error) {
-	exchange := NewSZSpotExchange(opt)
-	exchange.SetRecordsPeriodMap(map[string]int64{
-		"M5":  5,
-		"M15": 15,
-		"M30": 30,
-	})
-	if err := exchange.Init(opt); err != nil {
-		return nil, err
-	}
-	return exchange, nil
+	name := fmt.Sprintf("paper.%s.%d", opt.Type, opt.ExchangeID)
+	return newSZExchange(opt, sinaQuoter{}, stateStore{traderID: opt.TraderID, name: name}), nil
 }
 
 // getRecords ...
 func getRecords(symbol string, period, ma, size int) (string, error) {
-	client := &http.Client{}
-	url := recordURL
-	url = url + "symbol=" + symbol + "&scale=" + strconv.Itoa(period) + "&ma=" + strconv.Itoa(ma) + "&datalen=" + strconv.Itoa(size)
-	fmt.Printf("call address:%s\n", url)
+	url := recordURL + "symbol=" + symbol + "&scale=" + strconv.Itoa(period) + "&ma=" + strconv.Itoa(ma) + "&datalen=" + strconv.Itoa(size)
+	return sinaGet(url)
+}
+
+// sinaGet get the page of sina, decoded from gbk
+func sinaGet(url string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
 	reqest, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", err
 	}
 	reqest.Header.Add("Accept-Language", "zh-CN,zh;q=0.8")
 	reqest.Header.Add("Content-Type", "text/html; charset=utf-8")
+	// 新浪行情需要 Referer, 否则返回 403
+	reqest.Header.Add("Referer", sinaReferer)
 	resp, err := client.Do(reqest)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http status %s", resp.Status)
+	}
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
 	}
-
-	return string(data), nil
+	dec := mahonia.NewDecoder("GBK")
+	return dec.ConvertString(string(data)), nil
 }
 
-// pareseRecords ...
-func pareseRecords(str string, ma int) []constant.Record {
+// parseRecords parse the klines of sina, the day is the close time of the kline
+func parseRecords(str string) []constant.Record {
 	var records []constant.Record
 	res, err := simplejson.NewJson([]byte(str))
 	if err != nil {
@@ -74,14 +104,20 @@ func pareseRecords(str string, ma int) []constant.Record {
 	for _, row := range rows {
 		if maps, ok := row.(map[string]interface{}); ok {
 			var record constant.Record
+			day := fmt.Sprint(maps["day"])
+			stamp, err := time.ParseInLocation(timeTemplate1, day, szLocation)
+			if err != nil {
+				stamp, err = time.ParseInLocation("2006-01-02", day, szLocation)
+			}
+			if err != nil {
+				continue
+			}
+			record.Time = stamp.Unix()
 			record.Open = util.Float64Must(maps["open"])
 			record.Close = util.Float64Must(maps["close"])
 			record.High = util.Float64Must(maps["high"])
 			record.Low = util.Float64Must(maps["low"])
 			record.Volume = util.Float64Must(maps["volume"])
-
-			//record.MaPrice = util.Float64Must(maps["ma_price"+strconv.Itoa(ma)])
-			//record.MaVolume = util.Float64Must(maps["ma_volume"+strconv.Itoa(ma)])
 			records = append(records, record)
 		}
 	}
@@ -90,30 +126,14 @@ func pareseRecords(str string, ma int) []constant.Record {
 
 // getTickerAndDepth ...
 func getTickerAndDepth(no string) (string, error) {
-	client := &http.Client{}
-	url := tickerURL + no
-	fmt.Printf("ticker call address:%s\n", url)
-	reqest, err := http.NewRequest("GET", url, nil)
-
+	s, err := sinaGet(tickerURL + no)
 	if err != nil {
 		return "", err
 	}
-	reqest.Header.Add("Accept-Language", "zh-CN,zh;q=0.8")
-	reqest.Header.Add("Content-Type", "text/html; charset=utf-8")
-	resp, err := client.Do(reqest)
-	if err != nil {
-		return "", err
+	if strings.Count(s, "\"") < 2 {
+		return "", fmt.Errorf("invalid quote %s", s)
 	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	dec := mahonia.NewDecoder("GBK")
-	s := dec.ConvertString(string(data))
-	s = s[strings.Index(s, "\"")+1 : strings.LastIndex(s, "\"")]
-	//s = tickerFormat(s)
-	return s, nil
+	return s[strings.Index(s, "\"")+1 : strings.LastIndex(s, "\"")], nil
 }
 
 // parseTicker ...
@@ -132,7 +152,7 @@ func parseTicker(data string) (*constant.Ticker, error) {
 	ticker.Sell = util.Float64Must(arr[7])
 	ticker.Vol = util.Float64Must(arr[8])
 	t := arr[30] + " " + arr[31]
-	stamp, err := time.ParseInLocation(timeTemplate1, t, time.Local)
+	stamp, err := time.ParseInLocation(timeTemplate1, t, szLocation)
 	if err != nil {
 		return nil, err
 	}
@@ -144,21 +164,25 @@ func parseTicker(data string) (*constant.Ticker, error) {
 func parseDepth(data string) (*constant.Depth, error) {
 	var depth constant.Depth
 	arr := strings.Split(data, ",")
-	if len(arr) < 31 {
+	if len(arr) < 32 {
 		return nil, fmt.Errorf("len too samall")
 	}
 	for i := 0; i < 5; i++ {
 		var record constant.DepthRecord
 		record.Amount = util.Float64Must(arr[10+2*i])
 		record.Price = util.Float64Must(arr[10+2*i+1])
-		depth.Bids = append(depth.Bids, record)
+		if record.Price > 0 {
+			depth.Bids = append(depth.Bids, record)
+		}
 
 		record.Amount = util.Float64Must(arr[20+2*i])
 		record.Price = util.Float64Must(arr[20+2*i+1])
-		depth.Asks = append(depth.Asks, record)
+		if record.Price > 0 {
+			depth.Asks = append(depth.Asks, record)
+		}
 	}
 	t := arr[30] + " " + arr[31]
-	stamp, err := time.ParseInLocation(timeTemplate1, t, time.Local)
+	stamp, err := time.ParseInLocation(timeTemplate1, t, szLocation)
 	if err != nil {
 		return nil, err
 	}
@@ -166,121 +190,690 @@ func parseDepth(data string) (*constant.Depth, error) {
 	return &depth, nil
 }
 
-// SZExchange the exchange struct of futureExchange.com
-type SZExchange struct {
-	BaseExchange
+// sinaSymbol the sina code of the stock, e.g. 600000 -> sh600000, 000001 -> sz000001
+func sinaSymbol(symbol string) string {
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if len(symbol) != 6 {
+		return symbol
+	}
+	switch symbol[0] {
+	case '5', '6', '9':
+		return "sh" + symbol
+	}
+	return "sz" + symbol
+}
 
-	tradeTypeMap        map[int]string
-	tradeTypeMapReverse map[string]int
-	exchangeTypeMap     map[string]string
+// szLimitRate the daily price limit rate of the stock
+func szLimitRate(code, name string) float64 {
+	switch {
+	case strings.HasPrefix(code, "sh688") || strings.HasPrefix(code, "sh689") ||
+		strings.HasPrefix(code, "sz300") || strings.HasPrefix(code, "sz301"):
+		// 科创板及创业板
+		return 0.2
+	case strings.Contains(strings.ToUpper(name), "ST"):
+		return 0.05
+	}
+	return 0.1
+}
+
+// szRound round the money or the price to the fen
+func szRound(value float64) float64 {
+	return math.Round(value*100) / 100
+}
 
-	records map[string][]constant.Record
+// szQuote a quote of sina with the price limits
+type szQuote struct {
+	constant.Ticker
+	Date  string // 行情日期 2006-01-02
+	Upper float64
+	Lower float64
 }
 
-// NewSZSpotExchange create an exchange struct of futureExchange.com
-func NewSZSpotExchange(opt constant.Option) *SZExchange {
-	spotExchange := SZExchange{
-		records: make(map[string][]constant.Record),
+// parseQuote parse the quote of the stock and compute the price limits from the last close
+func parseQuote(code, data string) (*szQuote, error) {
+	ticker, err := parseTicker(data)
+	if err != nil {
+		return nil, err
 	}
-	spotExchange.SetMinAmountMap(map[string]float64{
-		"BTC/USD": 0.001,
-	})
-	return &spotExchange
+	arr := strings.Split(data, ",")
+	quote := &szQuote{Ticker: *ticker, Date: arr[30]}
+	rate := szLimitRate(code, arr[0])
+	quote.Upper = szRound(ticker.Close * (1 + rate))
+	quote.Lower = szRound(ticker.Close * (1 - rate))
+	return quote, nil
 }
 
-// Stop ...
-func (e *SZExchange) Stop() error {
-	return nil
+// szQuoter the quotes and klines of the stocks
+type szQuoter interface {
+	quote(code string) (string, error)
+	records(code string, period, size int) (string, error)
 }
 
-// Start ...
-func (e *SZExchange) Start() error {
-	return nil
+// sinaQuoter the quotes of hq.sinajs.cn
+type sinaQuoter struct{}
+
+func (sinaQuoter) quote(code string) (string, error) {
+	return getTickerAndDepth(code)
 }
 
-// Init get the type of this exchange
-func (e *SZExchange) Init(opt constant.Option) error {
-	e.BaseExchange.Init(opt)
-	return nil
+func (sinaQuoter) records(code string, period, size int) (string, error) {
+	return getRecords(code, period, 5, size)
 }
 
-// GetType get the type of this exchange
-func (e *SZExchange) GetType() string {
-	return e.option.Type
+// paperStore the storage of a simulated account
+type paperStore interface {
+	load() (string, error)
+	save(value string) error
 }
 
-// GetName get the name of this exchange
-func (e *SZExchange) GetName() string {
-	return e.option.Name
+// stateStore save the simulated account as a state of the trader
+type stateStore struct {
+	traderID int64
+	name     string
 }
 
-// GetPosition ...
-func (e *SZExchange) GetPosition() ([]constant.Position, error) {
-	return nil, fmt.Errorf("not support")
+func (s stateStore) load() (string, error) {
+	state, err := model.GetState(s.traderID, s.name)
+	if err != nil {
+		return "", err
+	}
+	return state.Value, nil
 }
 
-// GetAccount get the account detail of this exchange
-func (e *SZExchange) GetAccount() (*constant.Account, error) {
-	return nil, fmt.Errorf("not support")
+func (s stateStore) save(value string) error {
+	return model.SetState(s.traderID, s.name, value)
 }
 
-// Buy ...
-func (e *SZExchange) Buy(price, amount string, msg string) (string, error) {
-	return "", fmt.Errorf("not support")
+// szPosition a stock held by the simulated account
+type szPosition struct {
+	Amount float64 // 持股数量
+	Frozen float64 // 卖出挂单冻结
+	Today  float64 // 当日买入, T+1 不可卖出
+	Price  float64 // 持仓均价
 }
 
-// Sell ...
-func (e *SZExchange) Sell(price, amount string, msg string) (string, error) {
-	return "", fmt.Errorf("not support")
+// available the shares can be sold today
+func (p *szPosition) available() float64 {
+	return p.Amount - p.Frozen - p.Today
 }
 
-// GetOrder get details of an order
-func (e *SZExchange) GetOrder(id string) (*constant.Order, error) {
-	return nil, fmt.Errorf("not support")
+// szAccount the simulated account persisted per trader
+type szAccount struct {
+	Date      string                 // 交易日 20060102, 换日时解冻当日买入的股票
+	Cash      float64                // 资金余额, 含挂单冻结
+	Frozen    map[string]float64     // 买入挂单冻结的资金, 按订单 ID
+	Positions map[string]*szPosition // 按新浪代码
+	Orders    []*constant.Order      // 当日订单
+	Seq       int64
 }
 
-// GetOrders get all unfilled orders
-func (e *SZExchange) GetOrders() ([]constant.Order, error) {
-	return nil, fmt.Errorf("not support")
+// SZExchange a paper trading exchange of the shanghai and shenzhen stocks, filled against the sina quotes
+type SZExchange struct {
+	BaseExchange
+
+	quoter   szQuoter
+	store    paperStore
+	holidays map[string]bool
+
+	mu      sync.Mutex
+	account *szAccount
+	onFill  func(constant.Fill)
 }
 
-// CancelOrder cancel an order
-func (e *SZExchange) CancelOrder(orderID string) (bool, error) {
-	return false, fmt.Errorf("not support")
+// newSZExchange ...
+func newSZExchange(opt constant.Option, quoter szQuoter, store paperStore) *SZExchange {
+	e := &SZExchange{
+		quoter:   quoter,
+		store:    store,
+		holidays: make(map[string]bool),
+	}
+	e.BaseExchange.Init(opt)
+	e.SetID(opt.Index)
+	e.SetMinAmountMap(map[string]float64{})
+	e.SetRecordsPeriodMap(map[string]int64{
+		"M5":  5,
+		"M15": 15,
+		"M30": 30,
+		"H1":  60,
+		"D1":  240,
+	})
+	e.SetPeriod("D1")
+	for _, day := range strings.Split(config.String(szHolidayKey), ",") {
+		if day = strings.TrimSpace(day); day != "" {
+			e.holidays[day] = true
+		}
+	}
+	e.BaseExchange.father = ExchangeBroker(e)
+	return e
 }
 
-// GetTicker get market ticker
-func (e *SZExchange) GetTicker() (*constant.Ticker, error) {
-	stockType := e.GetStockType()
-	res, err := getTickerAndDepth(stockType)
-	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetTicker() error, the error number is %s ", err.Error())
+// SetFillHandler set the handler called on every execution
+func (e *SZExchange) SetFillHandler(handler func(constant.Fill)) {
+	e.onFill = handler
+}
+
+// tradingDay whether the exchanges open on the day, the weekends and the holidays in config.ini closed
+func (e *SZExchange) tradingDay(now time.Time) bool {
+	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
+		return false
+	}
+	return !e.holidays[now.Format("20060102")]
+}
+
+// inSession whether in the continuous trading sessions
+func (e *SZExchange) inSession(now time.Time) bool {
+	if !e.tradingDay(now) {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	for _, session := range szSessions {
+		if minute >= session[0] && minute < session[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// accepting whether the orders are accepted, from 9:15 to the close of the trading day
+func (e *SZExchange) accepting(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	return e.tradingDay(now) && minute >= szOpenOrder && minute < szSessions[len(szSessions)-1][1]
+}
+
+// start load the simulated account of the trader
+func (e *SZExchange) start() error {
+	account := &szAccount{}
+	if data, err := e.store.load(); err == nil && data != "" {
+		if err := json.Unmarshal([]byte(data), account); err != nil {
+			e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "Start() error, the error number is "+err.Error())
+			return fmt.Errorf("Start() error, the error number is %s", err.Error())
+		}
+	} else {
+		account.Cash = szDefaultCash
+		if cash, err := strconv.ParseFloat(config.String(szBalance), 64); err == nil && cash > 0 {
+			account.Cash = cash
+		}
+	}
+	if account.Frozen == nil {
+		account.Frozen = make(map[string]float64)
+	}
+	if account.Positions == nil {
+		account.Positions = make(map[string]*szPosition)
+	}
+	e.mu.Lock()
+	e.account = account
+	e.mu.Unlock()
+	return nil
+}
+
+// stop ...
+func (e *SZExchange) stop() error {
+	return nil
+}
+
+// save persist the simulated account, called with the lock held
+func (e *SZExchange) save() {
+	data, err := json.Marshal(e.account)
+	if err == nil {
+		err = e.store.save(string(data))
 	}
-	ticker, err := parseTicker(res)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ", err.Error())
-		return nil, fmt.Errorf("GetTicker() error, the error number is %s ", err.Error())
+		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "save account error, the error number is "+err.Error())
+	}
+}
+
+// quote get the quote of the stock
+func (e *SZExchange) quote(method, symbol string) (*szQuote, error) {
+	code := sinaSymbol(symbol)
+	var res string
+	err := e.call(method, func() (err error) {
+		res, err = e.quoter.quote(code)
+		return
+	})
+	if err == nil {
+		var quote *szQuote
+		if quote, err = parseQuote(code, res); err == nil {
+			return quote, nil
+		}
 	}
-	if ticker == nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetTicker() error, the error number is ticker parse fail")
-		return nil, fmt.Errorf("GetTicker() error, the error number is ticker parse fail")
+	e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is "+err.Error())
+	return nil, fmt.Errorf("%s() error, the error number is %s", method, err.Error())
+}
+
+// getTicker get market ticker
+func (e *SZExchange) getTicker(symbol string) (*constant.Ticker, error) {
+	quote, err := e.quote("GetTicker", symbol)
+	if err != nil {
+		return nil, err
 	}
-	return ticker, nil
+	return &quote.Ticker, nil
 }
 
-// GetDepth ...
-func (e *SZExchange) GetDepth() (*constant.Depth, error) {
-	stockType := e.GetStockType()
-	res, err := getTickerAndDepth(stockType)
+// getDepth get the five levels of the depth
+func (e *SZExchange) getDepth(symbol string) (*constant.Depth, error) {
+	var res string
+	err := e.call("GetDepth", func() (err error) {
+		res, err = e.quoter.quote(sinaSymbol(symbol))
+		return
+	})
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is:%s\n", err.Error())
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetDepth() error, the error number is "+err.Error())
 		return nil, fmt.Errorf("GetDepth() error, the error number is %s", err.Error())
 	}
 	depth, err := parseDepth(res)
 	if err != nil {
-		e.logger.Log(constant.ERROR, e.GetStockType(), 0.0, 0.0, "GetDepth() error, the error number is:%s\n", err.Error())
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetDepth() error, the error number is "+err.Error())
 		return nil, fmt.Errorf("GetDepth() error, the error number is depth parse fail")
 	}
+	depth.StockType = symbol
 	return depth, nil
 }
+
+// getRecords get the klines of the stock by the period and the size set
+func (e *SZExchange) getRecords(symbol string) ([]constant.Record, error) {
+	period, ok := e.GetRecordsPeriodMap()[e.GetPeriod()]
+	if !ok {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetRecords() error, the error number is invalid period "+e.GetPeriod())
+		return nil, fmt.Errorf("GetRecords() error, the error number is invalid period %s", e.GetPeriod())
+	}
+	var res string
+	err := e.call("GetRecords", func() (err error) {
+		res, err = e.quoter.records(sinaSymbol(symbol), int(period), e.GetPeriodSize())
+		return
+	})
+	if err != nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, "GetRecords() error, the error number is "+err.Error())
+		return nil, fmt.Errorf("GetRecords() error, the error number is %s", err.Error())
+	}
+	return parseRecords(res), nil
+}
+
+// szFee the commission and the stamp tax of the trade
+func (e *SZExchange) szFee(side string, notional float64) float64 {
+	rate := e.taker
+	if rate <= 0 {
+		rate = szCommission
+	}
+	fee := math.Max(notional*rate, szMinCommission)
+	if side == constant.TradeTypeSell {
+		fee += notional * szStampTax
+	}
+	return szRound(fee)
+}
+
+// settle roll the account to the trading day and expire the day orders after the close, with the lock held
+func (e *SZExchange) settle(now time.Time) bool {
+	changed := false
+	if date := now.Format("20060102"); e.account.Date != date {
+		e.expire(now)
+		orders := e.account.Orders[:0]
+		for _, order := range e.account.Orders {
+			if order.Status == constant.ORDER_UNFINISH || order.Status == constant.ORDER_PART_FINISH {
+				orders = append(orders, order)
+			}
+		}
+		e.account.Orders = orders
+		for code, position := range e.account.Positions {
+			position.Today = 0
+			if position.Amount <= 0 {
+				delete(e.account.Positions, code)
+			}
+		}
+		e.account.Date = date
+		changed = true
+	}
+	if now.Hour()*60+now.Minute() >= szSessions[len(szSessions)-1][1] && e.expire(now) {
+		changed = true
+	}
+	return changed
+}
+
+// expire cancel all the open orders, the a-share orders valid for the day only
+func (e *SZExchange) expire(now time.Time) bool {
+	expired := false
+	for _, order := range e.account.Orders {
+		if order.Status == constant.ORDER_UNFINISH || order.Status == constant.ORDER_PART_FINISH {
+			e.release(order)
+			order.Status = constant.ORDER_CANCEL
+			order.FinishedTime = now.Unix()
+			expired = true
+		}
+	}
+	return expired
+}
+
+// release the cash or the shares frozen by the open order
+func (e *SZExchange) release(order *constant.Order) {
+	if order.TradeType == constant.TradeTypeBuy {
+		delete(e.account.Frozen, order.Id)
+		return
+	}
+	if position := e.account.Positions[sinaSymbol(order.StockType)]; position != nil {
+		position.Frozen -= order.Amount - order.DealAmount
+	}
+}
+
+// frozenCash the cash frozen by all the open buy orders
+func (e *SZExchange) frozenCash() float64 {
+	frozen := 0.0
+	for _, v := range e.account.Frozen {
+		frozen += v
+	}
+	return frozen
+}
+
+// match fill the order against the quote at the best price of the other side, all or nothing
+func (e *SZExchange) match(order *constant.Order, quote *szQuote, now time.Time) bool {
+	if order.Status != constant.ORDER_UNFINISH && order.Status != constant.ORDER_PART_FINISH {
+		return false
+	}
+	// 非交易时段或者行情不是当日的不撮合
+	if !e.inSession(now) || quote.Date != now.Format("2006-01-02") {
+		return false
+	}
+	price := quote.Sell
+	if order.TradeType == constant.TradeTypeSell {
+		price = quote.Buy
+	}
+	if price <= 0 {
+		return false
+	}
+	if order.Price > 0 && (order.TradeType == constant.TradeTypeBuy && order.Price < price ||
+		order.TradeType == constant.TradeTypeSell && order.Price > price) {
+		return false
+	}
+	amount := order.Amount - order.DealAmount
+	notional := szRound(price * amount)
+	fee := e.szFee(order.TradeType, notional)
+	code := sinaSymbol(order.StockType)
+	position := e.account.Positions[code]
+	e.release(order)
+	if order.TradeType == constant.TradeTypeBuy {
+		if position == nil {
+			position = &szPosition{}
+			e.account.Positions[code] = position
+		}
+		position.Price = (position.Price*position.Amount + notional) / (position.Amount + amount)
+		position.Amount += amount
+		position.Today += amount
+		e.account.Cash = szRound(e.account.Cash - notional - fee)
+	} else {
+		position.Amount -= amount
+		e.account.Cash = szRound(e.account.Cash + notional - fee)
+	}
+	order.AvgPrice = (order.AvgPrice*order.DealAmount + notional) / order.Amount
+	order.DealAmount = order.Amount
+	order.Fee += fee
+	order.Status = constant.ORDER_FINISH
+	order.FinishedTime = now.Unix()
+	emitFill(e.onFill, *order, price, amount, fee, now.UnixNano()/int64(time.Millisecond))
+	return true
+}
+
+// sync settle the account and match the open orders of the symbol, all the symbols if empty
+func (e *SZExchange) sync(method, symbol string) error {
+	if e.account == nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0, method+"() error, the error number is exchange not started")
+		return fmt.Errorf("%s() error, the error number is exchange not started", method)
+	}
+	now := szNow()
+	changed := e.settle(now)
+	if e.inSession(now) {
+		quotes := make(map[string]*szQuote)
+		for _, order := range e.account.Orders {
+			code := sinaSymbol(order.StockType)
+			if order.Status != constant.ORDER_UNFINISH || symbol != "" && code != sinaSymbol(symbol) {
+				continue
+			}
+			if _, ok := quotes[code]; !ok {
+				quotes[code], _ = e.quote(method, order.StockType)
+			}
+			if quote := quotes[code]; quote != nil && e.match(order, quote, now) {
+				changed = true
+			}
+		}
+	}
+	if changed {
+		e.save()
+	}
+	return nil
+}
+
+// placeOrder place a day order, checked by the sessions, the lots, T+1 and the price limits
+func (e *SZExchange) placeOrder(req constant.OrderRequest) (string, error) {
+	method := "Buy"
+	if req.Side == constant.TradeTypeSell {
+		method = "Sell"
+	}
+	stockType := req.Symbol
+	fail := func(reason string) (string, error) {
+		e.logger.Log(constant.ERROR, stockType, req.Price, req.Amount,
+			method+"() error, the error number is "+reason)
+		return "", fmt.Errorf("%s() error, the error number is %s", method, reason)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync(method, ""); err != nil {
+		return "", err
+	}
+	now := szNow()
+	if !e.accepting(now) {
+		return fail("market closed at " + now.Format(timeTemplate1))
+	}
+	if req.ReduceOnly && req.Side == constant.TradeTypeBuy {
+		return fail("reduce only order must sell")
+	}
+	quote, err := e.quote(method, stockType)
+	if err != nil {
+		return "", err
+	}
+	code := sinaSymbol(stockType)
+	position := e.account.Positions[code]
+	if req.Side == constant.TradeTypeBuy && math.Mod(req.Amount, szLot) != 0 {
+		return fail(fmt.Sprintf("buy amount %v is not a multiple of %v shares", req.Amount, szLot))
+	}
+	if req.Side == constant.TradeTypeSell {
+		available := 0.0
+		if position != nil {
+			available = position.available()
+		}
+		if req.Amount > available {
+			return fail(fmt.Sprintf("available shares %v, the shares bought today can be sold from the next trading day", available))
+		}
+		// 零股只能一次性卖出, 可以与整手一起卖出
+		if odd := math.Mod(req.Amount, szLot); odd != 0 && odd != math.Mod(available, szLot) {
+			return fail(fmt.Sprintf("sell amount %v is not a multiple of %v shares plus all the odd shares", req.Amount, szLot))
+		}
+	}
+
+	price := -1.0
+	crossed := false
+	if req.OrderType == constant.OrderTypeLimit {
+		if req.Side == constant.TradeTypeBuy {
+			price = roundStep(req.Price, szTick, math.Floor)
+			crossed = quote.Sell > 0 && price >= quote.Sell
+		} else {
+			price = roundStep(req.Price, szTick, math.Ceil)
+			crossed = quote.Buy > 0 && price <= quote.Buy
+		}
+		if price > quote.Upper || price < quote.Lower {
+			return fail(fmt.Sprintf("price %v out of the limits [%v, %v]", price, quote.Lower, quote.Upper))
+		}
+	} else {
+		crossed = req.Side == constant.TradeTypeBuy && quote.Sell > 0 || req.Side == constant.TradeTypeSell && quote.Buy > 0
+	}
+	crossed = crossed && e.inSession(now) && quote.Date == now.Format("2006-01-02")
+	if price < 0 && !crossed {
+		return fail("market order can not be filled now")
+	}
+	if req.PostOnly && crossed {
+		return fail("post only order would take liquidity")
+	}
+	if req.TimeInForce == constant.TimeInForceFOK && !crossed {
+		return fail("fill or kill order can not be filled")
+	}
+
+	e.account.Seq++
+	order := &constant.Order{
+		Id:        strconv.FormatInt(e.account.Seq, 10),
+		ClientID:  req.ClientOrderID,
+		Price:     price,
+		Amount:    req.Amount,
+		TradeType: req.Side,
+		StockType: stockType,
+		Time:      now.Unix(),
+		Status:    constant.ORDER_UNFINISH,
+	}
+	if req.Side == constant.TradeTypeBuy {
+		freeze := szRound(quote.Upper * req.Amount)
+		if price > 0 {
+			freeze = szRound(price * req.Amount)
+		}
+		freeze += e.szFee(req.Side, freeze)
+		if available := e.account.Cash - e.frozenCash(); freeze > available {
+			return fail(fmt.Sprintf("insufficient cash %v, %v required", available, freeze))
+		}
+		e.account.Frozen[order.Id] = freeze
+	} else {
+		position.Frozen += req.Amount
+	}
+	e.account.Orders = append(e.account.Orders, order)
+	e.match(order, quote, now)
+	if req.TimeInForce == constant.TimeInForceIOC && order.Status == constant.ORDER_UNFINISH {
+		e.release(order)
+		order.Status = constant.ORDER_CANCEL
+		order.FinishedTime = now.Unix()
+	}
+	e.save()
+	e.logger.Log(req.Side, stockType, price, req.Amount, req.Msg)
+	return order.Id, nil
+}
+
+// findOrder the order of today, with the lock held
+func (e *SZExchange) findOrder(id string) *constant.Order {
+	for _, order := range e.account.Orders {
+		if order.Id == id {
+			return order
+		}
+	}
+	return nil
+}
+
+// getOrder get details of an order
+func (e *SZExchange) getOrder(symbol, id string) (*constant.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync("GetOrder", symbol); err != nil {
+		return nil, err
+	}
+	order := e.findOrder(id)
+	if order == nil {
+		return nil, ErrNotFoundOrder
+	}
+	res := *order
+	return &res, nil
+}
+
+// getOrders get all unfilled orders of the stock
+func (e *SZExchange) getOrders(symbol string) ([]constant.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync("GetOrders", symbol); err != nil {
+		return nil, err
+	}
+	orders := []constant.Order{}
+	for _, order := range e.account.Orders {
+		if sinaSymbol(order.StockType) == sinaSymbol(symbol) && order.Status == constant.ORDER_UNFINISH {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+// cancelOrder cancel an order
+func (e *SZExchange) cancelOrder(symbol, orderID string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync("CancelOrder", ""); err != nil {
+		return false, err
+	}
+	order := e.findOrder(orderID)
+	if order == nil {
+		e.logger.Log(constant.ERROR, symbol, 0.0, 0.0,
+			"CancelOrder() error, the error number is not found order "+orderID)
+		return false, ErrNotFoundOrder
+	}
+	if order.Status != constant.ORDER_UNFINISH {
+		return false, ErrCancelOrderFinished
+	}
+	e.release(order)
+	order.Status = constant.ORDER_CANCEL
+	order.FinishedTime = szNow().Unix()
+	e.save()
+	e.logger.Log(constant.TradeTypeCancel, order.StockType, order.Price, order.Amount, "CancelOrder() success "+orderID)
+	return true, nil
+}
+
+// getPosition get the shares held of the stock
+func (e *SZExchange) getPosition(symbol string) ([]constant.Position, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync("GetPosition", symbol); err != nil {
+		return nil, err
+	}
+	positions := []constant.Position{}
+	position := e.account.Positions[sinaSymbol(symbol)]
+	if position == nil || position.Amount <= 0 {
+		return positions, nil
+	}
+	res := constant.Position{
+		Price:        position.Price,
+		Amount:       position.Amount,
+		Available:    position.available(),
+		FrozenAmount: position.Frozen,
+		TradeType:    constant.TradeTypeLong,
+		StockType:    symbol,
+	}
+	if quote, err := e.quote("GetPosition", symbol); err == nil && quote.Last > 0 {
+		res.Profit = (quote.Last - position.Price) * position.Amount
+		res.ProfitRate = quote.Last/position.Price - 1
+	}
+	return append(positions, res), nil
+}
+
+// getAccount get the cash in CNY and a sub account of the shares per stock
+func (e *SZExchange) getAccount() (*constant.Account, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.sync("GetAccount", ""); err != nil {
+		return nil, err
+	}
+	frozen := e.frozenCash()
+	cash := constant.SubAccount{
+		StockType:     "CNY",
+		AccountRights: e.account.Cash,
+		Amount:        e.account.Cash - frozen,
+		FrozenAmount:  frozen,
+	}
+	account := constant.Account{SubAccounts: make(map[string]constant.SubAccount)}
+	for code, position := range e.account.Positions {
+		if position.Amount <= 0 {
+			continue
+		}
+		price := position.Price
+		if quote, err := e.quote("GetAccount", code); err == nil && quote.Last > 0 {
+			price = quote.Last
+		}
+		cash.AccountRights += price * position.Amount
+		cash.ProfitUnreal += (price - position.Price) * position.Amount
+		account.SubAccounts[code] = constant.SubAccount{
+			StockType:     code,
+			AccountRights: price * position.Amount,
+			Amount:        position.available(),
+			FrozenAmount:  position.Frozen + position.Today,
+			ProfitUnreal:  (price - position.Price) * position.Amount,
+		}
+	}
+	account.SubAccounts["CNY"] = cash
+	return &account, nil
+}
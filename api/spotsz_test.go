@@ -0,0 +1,171 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// fakeSinaQuoter the quotes set by the test in the format of hq.sinajs.cn
+type fakeSinaQuoter struct {
+	quotes map[string]string
+}
+
+func (q *fakeSinaQuoter) quote(code string) (string, error) {
+	if res, ok := q.quotes[code]; ok {
+		return res, nil
+	}
+	return "", fmt.Errorf("no quote of %s", code)
+}
+
+func (q *fakeSinaQuoter) records(code string, period, size int) (string, error) {
+	return `[{"day":"2021-12-01","open":"10.00","high":"10.20","low":"9.90","close":"10.10","volume":"1000000"},
+		{"day":"2021-12-02","open":"10.10","high":"10.30","low":"10.00","close":"10.20","volume":"800000"}]`, nil
+}
+
+// set the quote of the stock with the last close of 10
+func (q *fakeSinaQuoter) set(code, name string, bid, ask float64, at time.Time) {
+	fields := []string{name, "10.00", "10.00", fmt.Sprint(bid), "10.50", "9.80", fmt.Sprint(bid), fmt.Sprint(ask), "1000000", "10000000"}
+	for i := 0; i < 5; i++ {
+		fields = append(fields, "1000", fmt.Sprint(bid))
+	}
+	for i := 0; i < 5; i++ {
+		fields = append(fields, "1000", fmt.Sprint(ask))
+	}
+	fields = append(fields, at.Format("2006-01-02"), at.Format("15:04:05"), "00")
+	q.quotes[code] = strings.Join(fields, ",")
+}
+
+// memoryStore ...
+type memoryStore struct {
+	value string
+}
+
+func (s *memoryStore) load() (string, error) { return s.value, nil }
+func (s *memoryStore) save(value string) error {
+	s.value = value
+	return nil
+}
+
+func TestSZExchange(t *testing.T) {
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, szLocation) // 周三
+	szNow = func() time.Time { return now }
+	defer func() { szNow = func() time.Time { return time.Now().In(szLocation) } }()
+	quoter := &fakeSinaQuoter{quotes: map[string]string{}}
+	quoter.set("sz000001", "平安银行", 10.0, 10.01, now)
+	store := &memoryStore{}
+	e := newSZExchange(constant.Option{Type: constant.SZ, BackLog: true}, quoter, store)
+	e.SetStockType("000001")
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if ticker, err := e.GetTicker(); err != nil || ticker.Buy != 10 || ticker.Sell != 10.01 {
+		t.Fatalf("unexpected ticker %+v %v", ticker, err)
+	}
+	if records, err := e.GetRecords(); err != nil || len(records) != 2 || records[1].Close != 10.2 {
+		t.Fatalf("unexpected records %+v %v", records, err)
+	}
+	if _, err := e.Buy("10.05", "150", ""); err == nil {
+		t.Fatalf("buy of odd lots should fail")
+	}
+	if _, err := e.Buy("11.01", "100", ""); err == nil {
+		t.Fatalf("buy above the limit up should fail")
+	}
+	id, err := e.Buy("10.05", "100", "")
+	if order, _ := e.GetOrder(id); err != nil || order.Status != constant.ORDER_FINISH || order.AvgPrice != 10.01 || order.Fee != 5 {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	if _, err := e.Sell("10", "100", ""); err == nil {
+		t.Fatalf("sell of the shares bought today should fail")
+	}
+
+	id, _ = e.Buy("9.95", "200", "")
+	if orders, _ := e.GetOrders(); len(orders) != 1 || orders[0].Id != id {
+		t.Fatalf("unexpected open orders %+v", orders)
+	}
+	if account, _ := e.GetAccount(); account.SubAccounts["CNY"].FrozenAmount != 1995 {
+		t.Fatalf("unexpected account %+v", account)
+	}
+	quoter.set("sz000001", "平安银行", 9.89, 9.9, now)
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_FINISH || order.AvgPrice != 9.9 {
+		t.Fatalf("the order crossed should be filled, got %+v", order)
+	}
+	id, _ = e.Buy("9.5", "100", "")
+	if ok, err := e.CancelOrder(id); !ok || err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	account, _ := e.GetAccount()
+	if cash := account.SubAccounts["CNY"]; cash.FrozenAmount != 0 || cash.Amount != 1000000-1001-5-1980-5 {
+		t.Fatalf("unexpected cash %+v", cash)
+	}
+
+	// 重启后从存储恢复账户, 次日可以卖出
+	now = time.Date(2021, 12, 2, 9, 35, 0, 0, szLocation)
+	quoter.set("sz000001", "平安银行", 10.2, 10.21, now)
+	e = newSZExchange(constant.Option{Type: constant.SZ, BackLog: true}, quoter, store)
+	e.SetStockType("000001")
+	if err := e.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	positions, err := e.GetPosition()
+	if err != nil || len(positions) != 1 || positions[0].Amount != 300 || positions[0].Available != 300 {
+		t.Fatalf("unexpected positions %+v %v", positions, err)
+	}
+	if _, err := e.Sell("10.2", "250", ""); err == nil {
+		t.Fatalf("sell of odd lots not clearing the position should fail")
+	}
+	e.mu.Lock()
+	e.account.Positions["sz000001"].Amount += 50
+	e.mu.Unlock()
+	if _, err := e.Sell("10.2", "120", ""); err == nil {
+		t.Fatalf("sell of a part of the odd shares should fail")
+	}
+	id, err = e.Sell("10.2", "50", "")
+	if order, _ := e.GetOrder(id); err != nil || order.Status != constant.ORDER_FINISH {
+		t.Fatalf("sell of all the odd shares should be filled, got %+v %v", order, err)
+	}
+	id, err = e.Sell("-1", "300", "")
+	if order, _ := e.GetOrder(id); err != nil || order.Status != constant.ORDER_FINISH || order.AvgPrice != 10.2 ||
+		order.Fee != 5+1.53 {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	if positions, _ := e.GetPosition(); len(positions) != 0 {
+		t.Fatalf("unexpected positions %+v", positions)
+	}
+
+	// 行情不是当日的不撮合, 收盘后挂单失效
+	quoter.set("sz000001", "平安银行", 10.2, 10.21, now.AddDate(0, 0, -1))
+	id, _ = e.Buy("10.3", "100", "")
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_UNFINISH {
+		t.Fatalf("the order should not be filled by a stale quote, got %+v", order)
+	}
+	now = time.Date(2021, 12, 2, 15, 1, 0, 0, szLocation)
+	if order, _ := e.GetOrder(id); order.Status != constant.ORDER_CANCEL {
+		t.Fatalf("the day order should expire after the close, got %+v", order)
+	}
+	if _, err := e.Buy("10.3", "100", ""); err == nil {
+		t.Fatalf("buy after the close should fail")
+	}
+	now = time.Date(2021, 12, 4, 10, 0, 0, 0, szLocation)
+	if _, err := e.Buy("10.3", "100", ""); err == nil {
+		t.Fatalf("buy on saturday should fail")
+	}
+}
+
+func TestSZLimitRate(t *testing.T) {
+	for code, want := range map[string]float64{"sh600000": 0.1, "sz300750": 0.2, "sh688981": 0.2} {
+		if rate := szLimitRate(code, "股票"); rate != want {
+			t.Fatalf("%s: got %v", code, rate)
+		}
+	}
+	if rate := szLimitRate("sz000001", "*ST股票"); rate != 0.05 {
+		t.Fatalf("st: got %v", rate)
+	}
+	if sinaSymbol("600000") != "sh600000" || sinaSymbol("000001") != "sz000001" || sinaSymbol("SZ000001") != "sz000001" {
+		t.Fatalf("unexpected sina symbols")
+	}
+}
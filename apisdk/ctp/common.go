@@ -214,6 +214,8 @@ type OrderListStruct struct {
 	LimitPrice float64
 	// 数量
 	Volume int
+	// 成交数量
+	VolumeTraded int
 	// 状态信息
 	StatusMsg string
 	// 报单状态
@@ -228,6 +230,22 @@ type OrderListStruct struct {
 	CombOffsetFlagTitle string
 }
 
+// 成交列表
+type TradeStruct struct {
+	// 交易所代码
+	ExchangeID string
+	// 报单编号
+	OrderSysID string
+	// 成交编号
+	TradeID string
+	// 买卖方向
+	Direction string
+	// 成交价格
+	Price float64
+	// 成交数量
+	Volume int
+}
+
 // 持仓列表
 type InvestorPositionStruct struct {
 	// 更新 map 时用到
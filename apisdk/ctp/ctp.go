@@ -34,6 +34,15 @@ type CtpMaster struct {
 	// 报单列表（已成交、未成交、撤单等状态）的列表数据 OrderListStruct
 	MapOrderList sync.Map
 
+	// 成交列表 TradeStruct, 按交易所、成交编号及方向去重
+	MapTradeList sync.Map
+
+	// 持仓列表 InvestorPositionStruct
+	MapInvestorPositions sync.Map
+
+	// 资金账户 AccountInfoStruct
+	MapAccountInfos sync.Map
+
 	// ctp 服务器，及交易账号
 	MdFront     []string
 	TraderFront []string
@@ -190,6 +199,10 @@ type CtpClient struct {
 	// 当前交易日期
 	TradingDay string
 
+	// 登录后的前置编号及会话编号, 与报单引用一起唯一确定本会话的报单
+	FrontID   int
+	SessionID int
+
 	// 当前交易月份
 	TradeMonth string
 
@@ -319,118 +332,6 @@ func (ctp *CtpMaster) Start() error {
 	// .Join() 如果后面有其它需要处理的功能可以不写，但必须保证程序不能退出，Join 就是保证程序不退出的
 }
 
-// 设置交易账号
-/*
-func SetTradeAccount() {
-
-	switch RunMode {
-
-	// 迈科期货
-	case "prod":
-		MdFront = []string{}
-		TraderFront = []string{}
-		BrokerID = ""
-		InvestorID = ""
-		Password = ""
-		AppID = ""
-		AuthCode = ""
-
-	// 与实际生产环境保持一致
-	case "test":
-		MdFront = []string{"tcp://180.168.146.187:10110", "tcp://180.168.146.187:10111", "tcp://218.202.237.33:10112"}
-		TraderFront = []string{"tcp://180.168.146.187:10100", "tcp://180.168.146.187:10101", "tcp://218.202.237.33:10102"}
-		BrokerID = "9999"
-		InvestorID = ""
-		Password = ""
-		AppID = ""
-		AuthCode = ""
-
-	// 7*24 服务器，交易日，16：00～次日09：00；非交易日，16：00～次日15：00
-	case "dev":
-		MdFront = []string{"tcp://180.168.146.187:10131"}
-		TraderFront = []string{"tcp://180.168.146.187:10130"}
-		BrokerID = "9999"
-		InvestorID = ""
-		Password = ""
-		AppID = ""
-		AuthCode = ""
-
-	default:
-		Println("该模式未设置交易账号信息")
-		os.Exit(1)
-	}
-}
-*/
-
-/*
-func init() {
-	// 全局 行情、交易 函数句柄
-	MdSpi = FtdcMdSpi{}
-	TraderSpi = FtdcTraderSpi{}
-}
-*/
-/*
-func main() {
-
-	// 运行模式【运行程序时带上参数可设置】
-	if len(os.Args) < 2 {
-		RunMode = "test"
-	} else {
-		RunMode = os.Args[1]
-	}
-
-	// 设置交易账号
-	SetTradeAccount()
-
-	log.Println("启动交易程序")
-
-	// 检查流文件目录是否存在
-	fileExists, _ := PathExists(StreamFile)
-	if !fileExists {
-		err := os.Mkdir(StreamFile, os.ModePerm)
-		if err != nil {
-			fmt.Println("创建目录失败，请检查是否有操作权限")
-		}
-	}
-
-	Ctp = CtpClient{
-		MdApi:              goctp.CThostFtdcMdApiCreateFtdcMdApi(StreamFile),
-		TraderApi:          goctp.CThostFtdcTraderApiCreateFtdcTraderApi(StreamFile),
-		BrokerID:           BrokerID,
-		InvestorID:         InvestorID,
-		Password:           Password,
-		AppID:              AppID,
-		AuthCode:           AuthCode,
-		MdRequestId:        1,
-		TraderRequestId:    1,
-		IsTraderInit:       false,
-		IsTraderInitFinish: false,
-		IsMdLogin:          false,
-		IsTraderLogin:      false,
-	}
-
-	Ctp.MdApi.RegisterSpi(goctp.NewDirectorCThostFtdcMdSpi(&FtdcMdSpi{Client: Ctp}))
-
-	for _, val := range MdFront {
-		Ctp.MdApi.RegisterFront(val)
-	}
-	Ctp.MdApi.Init()
-
-	Ctp.TraderApi.RegisterSpi(goctp.NewDirectorCThostFtdcTraderSpi(&FtdcTraderSpi{Client: Ctp}))
-
-	for _, val := range TraderFront {
-		Ctp.TraderApi.RegisterFront(val)
-	}
-
-	Ctp.TraderApi.SubscribePublicTopic(goctp.THOST_TERT_QUICK)
-	Ctp.TraderApi.SubscribePrivateTopic(goctp.THOST_TERT_QUICK)
-	Ctp.TraderApi.Init()
-	//Ctp.TraderApi.Join()
-
-	// .Join() 如果后面有其它需要处理的功能可以不写，但必须保证程序不能退出，Join 就是保证程序不退出的
-}
-*/
-
 func (master *CtpMaster) SubscribeMarketData(vals []string) int {
 	return master.MdSpi.SubscribeMarketData(vals)
 }
@@ -459,6 +360,55 @@ func (master *CtpMaster) OrderCancel(InstrumentID string, OrderSysID string) int
 	return master.TraderSpi.OrderCancel(InstrumentID, OrderSysID)
 }
 
+// GetOrderList 报单列表（已成交、未成交、撤单等状态）
+func (master *CtpMaster) GetOrderList() []OrderListStruct {
+	var orders []OrderListStruct
+	master.MapOrderList.Range(func(k, v interface{}) bool {
+		orders = append(orders, v.(OrderListStruct))
+		return true
+	})
+	return orders
+}
+
+// GetTradeList 成交列表
+func (master *CtpMaster) GetTradeList() []TradeStruct {
+	var trades []TradeStruct
+	master.MapTradeList.Range(func(k, v interface{}) bool {
+		trades = append(trades, v.(TradeStruct))
+		return true
+	})
+	return trades
+}
+
+// GetSession 登录后的前置编号及会话编号
+func (master *CtpMaster) GetSession() (int, int) {
+	if master.Client == nil {
+		return 0, 0
+	}
+	return master.Client.FrontID, master.Client.SessionID
+}
+
+// GetInvestorPositions 最近一次查询的持仓列表
+func (master *CtpMaster) GetInvestorPositions() []InvestorPositionStruct {
+	var positions []InvestorPositionStruct
+	master.MapInvestorPositions.Range(func(k, v interface{}) bool {
+		positions = append(positions, v.(InvestorPositionStruct))
+		return true
+	})
+	return positions
+}
+
+// GetAccountInfo 最近一次查询的资金账户
+func (master *CtpMaster) GetAccountInfo() (AccountInfoStruct, bool) {
+	var info AccountInfoStruct
+	found := false
+	master.MapAccountInfos.Range(func(k, v interface{}) bool {
+		info, found = v.(AccountInfoStruct), true
+		return false
+	})
+	return info, found
+}
+
 type CtpHandler interface {
 	SetTradeAccount(MdFront, TraderFront []string, BrokerID, InvestorID, Password, AppID, AuthCode, StreamFile string)
 	Start() error
@@ -472,6 +422,11 @@ type CtpHandler interface {
 	OrderOpen(Input InputOrderStruct) int
 	OrderClose(Input InputOrderStruct) int
 	OrderCancel(InstrumentID string, OrderSysID string) int
+	GetOrderList() []OrderListStruct
+	GetTradeList() []TradeStruct
+	GetSession() (int, int)
+	GetInvestorPositions() []InvestorPositionStruct
+	GetAccountInfo() (AccountInfoStruct, bool)
 }
 
 // NewCtp ...
@@ -141,6 +141,12 @@ func (p *FtdcMdSpi) OnRtnDepthMarketData(pDepthMarketData goctp.CThostFtdcDepthM
 	data.HighestPrice = pDepthMarketData.GetHighestPrice()
 	data.LowestPrice = pDepthMarketData.GetLowestPrice()
 	data.Volume = pDepthMarketData.GetVolume()
+	data.BidPrice1 = pDepthMarketData.GetBidPrice1()
+	data.BidVolume1 = pDepthMarketData.GetBidVolume1()
+	data.AskPrice1 = pDepthMarketData.GetAskPrice1()
+	data.AskVolume1 = pDepthMarketData.GetAskVolume1()
+	data.UpperLimitPrice = pDepthMarketData.GetUpperLimitPrice()
+	data.LowerLimitPrice = pDepthMarketData.GetLowerLimitPrice()
 
 	master.MapMarketDatas.Store(pDepthMarketData.GetInstrumentID(), data)
 
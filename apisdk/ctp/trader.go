@@ -114,6 +114,8 @@ func (p *FtdcTraderSpi) OnRspUserLogin(pRspUserLogin goctp.CThostFtdcRspUserLogi
 	if bIsLast && !p.IsErrorRspInfo(pRspInfo) {
 
 		client.IsTraderLogin = true
+		client.FrontID = pRspUserLogin.GetFrontID()
+		client.SessionID = pRspUserLogin.GetSessionID()
 
 		log.Printf("交易账号已登录，当前交易日：%v\n", TraderApi.GetTradingDay())
 
@@ -327,6 +329,8 @@ func (p *FtdcTraderSpi) OnRspQryTradingAccount(pTradingAccount goctp.CThostFtdcT
 			"-------------------------------------------------------------------------------------------------"
 		fmt.Println(AccountInfoStr)
 
+		p.Master.MapAccountInfos.Store(mAccountInfo.MapKey, mAccountInfo)
+
 		if !client.IsTraderInitFinish {
 			// 请求查询投资者报单（委托单）
 			p.ReqQryOrder()
@@ -412,6 +416,13 @@ func (p *FtdcTraderSpi) ReqQryInvestorPosition() int {
 	TraderApi := p.Master.TraderApi
 
 	p.ReqMsg("查询投资者持仓中...")
+
+	// 清空上次查询的持仓，已平掉的持仓不会再返回
+	p.Master.MapInvestorPositions.Range(func(k, v interface{}) bool {
+		p.Master.MapInvestorPositions.Delete(k)
+		return true
+	})
+
 	req := goctp.NewCThostFtdcQryInvestorPositionField()
 	req.SetBrokerID(client.BrokerID)
 	req.SetInvestorID(client.InvestorID)
@@ -445,6 +456,10 @@ func (p *FtdcTraderSpi) OnRspQryInvestorPosition(pInvestorPosition goctp.CThostF
 			// 获得持仓结构体数据
 			mInvestorPosition := master.GetInvestorPositionStruct(pInvestorPosition)
 
+			// 持仓列表数据 key 键
+			mInvestorPosition.MapKey = mInvestorPosition.InstrumentID + "_" + mInvestorPosition.PosiDirection + "_" + mInvestorPosition.PositionDate
+			master.MapInvestorPositions.Store(mInvestorPosition.MapKey, mInvestorPosition)
+
 			if mInvestorPosition.Position != 0 {
 				fmt.Printf("- 合约：%v   \t%v:%v   \t总持仓：%v   \t持仓均价：%v   \t持仓盈亏：%v\n", mInvestorPosition.InstrumentID, mInvestorPosition.PositionDateTitle, mInvestorPosition.PosiDirectionTitle, mInvestorPosition.Position, mInvestorPosition.OpenCost, mInvestorPosition.PositionProfit)
 			}
@@ -494,6 +509,10 @@ func (p *FtdcTraderSpi) OnRtnOrder(pOrder goctp.CThostFtdcOrderField) {
 				"- 错误代码：-1   \t错误消息：" + mOrder.StatusMsg + "\n" +
 				"-------------------------------------------------------------------------------------------------"
 			fmt.Println(OrderErrorStr)
+
+			// 没有报单编号的错单按报单引用记录，便于查询报单结果
+			mOrder.MapKey = mOrder.InstrumentID + "_ref" + TrimSpace(mOrder.OrderRef)
+			p.Master.MapOrderList.Store(mOrder.MapKey, mOrder)
 		}
 
 		return
@@ -532,6 +551,17 @@ func (p *FtdcTraderSpi) OnRtnTrade(pTrade goctp.CThostFtdcTradeField) {
 		"- 成交开平：" + OffsetFlagTitle + " \t成交数量：" + IntToString(pTrade.GetVolume()) + "\n" +
 		"-------------------------------------------------------------------------------------------------"
 	fmt.Println(OrderStr)
+
+	// 记录成交, 用于计算报单的成交均价
+	trade := TradeStruct{
+		ExchangeID: pTrade.GetExchangeID(),
+		OrderSysID: TrimSpace(pTrade.GetOrderSysID()),
+		TradeID:    TrimSpace(pTrade.GetTradeID()),
+		Direction:  string(pTrade.GetDirection()),
+		Price:      pTrade.GetPrice(),
+		Volume:     pTrade.GetVolume(),
+	}
+	p.Master.MapTradeList.Store(trade.ExchangeID+"_"+trade.TradeID+"_"+trade.Direction, trade)
 }
 
 // 报单出错响应（综合交易平台交易核心返回的包含错误信息的报单响应）
@@ -551,6 +581,23 @@ func (p *FtdcTraderSpi) OnRspOrderInsert(pInputOrder goctp.CThostFtdcInputOrderF
 		"- 错误代码：" + string(pRspInfo.GetErrorID()) + "    \t错误消息：" + ConvertToString(pRspInfo.GetErrorMsg(), "gbk", "utf-8") + "\n" +
 		"-------------------------------------------------------------------------------------------------"
 	fmt.Println(OrderStr)
+
+	// 被综合交易平台拒绝的报单没有报单编号，按报单引用记录为已撤单
+	var mOrder OrderListStruct
+	mOrder.InstrumentID = pInputOrder.GetInstrumentID()
+	mOrder.ExchangeID = pInputOrder.GetExchangeID()
+	mOrder.OrderRef = pInputOrder.GetOrderRef()
+	mOrder.LimitPrice = pInputOrder.GetLimitPrice()
+	mOrder.Volume = pInputOrder.GetVolumeTotalOriginal()
+	mOrder.Direction = string(pInputOrder.GetDirection())
+	mOrder.CombOffsetFlag = string(pInputOrder.GetCombOffsetFlag())
+	mOrder.OrderStatus = string(goctp.THOST_FTDC_OST_Canceled)
+	mOrder.StatusMsg = ConvertToString(pRspInfo.GetErrorMsg(), "gbk", "utf-8")
+	mOrder.DirectionTitle = GetDirectionTitle(mOrder.Direction)
+	mOrder.OrderStatusTitle = GetOrderStatusTitle(mOrder.OrderStatus)
+	mOrder.CombOffsetFlagTitle = GetOffsetFlagTitle(mOrder.CombOffsetFlag)
+	mOrder.MapKey = mOrder.InstrumentID + "_ref" + TrimSpace(mOrder.OrderRef)
+	p.Master.MapOrderList.Store(mOrder.MapKey, mOrder)
 }
 
 // 错误应答
@@ -794,6 +841,7 @@ func GetOrderListStruct(pOrder goctp.CThostFtdcOrderField) OrderListStruct {
 	mOrder.OrderSysID = pOrder.GetOrderSysID()
 	mOrder.LimitPrice = pOrder.GetLimitPrice()
 	mOrder.Volume = pOrder.GetVolumeTotalOriginal()
+	mOrder.VolumeTraded = pOrder.GetVolumeTraded()
 	mOrder.Direction = string(pOrder.GetDirection())
 	mOrder.CombOffsetFlag = string(pOrder.GetCombOffsetFlag())
 	mOrder.CombHedgeFlag = string(pOrder.GetCombHedgeFlag())
@@ -1,7 +1,617 @@
 package sdkib
 
-import "github.com/gofinance/ib"
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
-func Reverse() *ib.AccountSummary {
-	return &ib.AccountSummary{}
+	"github.com/gofinance/ib"
+)
+
+// Timeout how long to wait for the replies of TWS
+var Timeout = 5 * time.Second
+
+// requestIDBase the request ids start here, TWS uses the same id field for the requests and the orders
+// so the ids of both must not overlap
+const requestIDBase int64 = 1 << 30
+
+// isOrderID ...
+func isOrderID(id int64) bool {
+	return id > 0 && id < requestIDBase
+}
+
+// Ticker the top of book and statistics of a market data subscription
+type Ticker struct {
+	Bid, BidSize, Ask, AskSize, Last, High, Low, Open, Close, Volume float64
+	Time                                                             time.Time
+}
+
+// Level a price level of the market depth
+type Level struct {
+	Price float64
+	Size  float64
+}
+
+// Depth the market depth of a subscription
+type Depth struct {
+	Bids []Level
+	Asks []Level
+}
+
+// Order an order placed by this client
+type Order struct {
+	ID       int64
+	Contract ib.Contract
+	Action   string // BUY/SELL
+	Type     string // LMT/MKT
+	Price    float64
+	Quantity int64
+	Ref      string // OrderRef, 下单时的客户端订单号
+	Filled   int64
+	AvgPrice float64
+	Status   string // TWS 订单状态, 如 Submitted, Filled, Cancelled, Inactive
+	Message  string
+	Time     time.Time
+}
+
+// Client a connection to TWS or IB gateway keeping the market data, orders and account it receives
+type Client struct {
+	Gateway  string
+	ClientID int64
+	Account  string
+
+	mu        sync.Mutex
+	engine    *ib.Engine
+	replies   chan ib.Reply
+	ready     chan struct{}
+	nextID    int64
+	reqID     int64
+	loaded    bool // 已收到 OpenOrderEnd
+	accounts  []string
+	waiters   map[int64]chan ib.Reply
+	tickers   map[int64]*Ticker
+	depths    map[int64]*Depth
+	orders    map[int64]*Order
+	values    map[ib.AccountValueKey]map[string]string // key -> currency -> value
+	portfolio map[int64]ib.PortfolioValue
+	updated   chan struct{}
+	err       error
+}
+
+// NewClient ...
+func NewClient(gateway string, clientID int64, account string) *Client {
+	return &Client{
+		Gateway:   gateway,
+		ClientID:  clientID,
+		Account:   account,
+		reqID:     requestIDBase,
+		waiters:   make(map[int64]chan ib.Reply),
+		tickers:   make(map[int64]*Ticker),
+		depths:    make(map[int64]*Depth),
+		orders:    make(map[int64]*Order),
+		values:    make(map[ib.AccountValueKey]map[string]string),
+		portfolio: make(map[int64]ib.PortfolioValue),
+		updated:   make(chan struct{}),
+	}
+}
+
+// Connect connect to the gateway, wait for the next order id and the managed accounts
+// and subscribe the account updates
+func (c *Client) Connect() error {
+	engine, err := ib.NewEngine(ib.EngineOptions{Gateway: c.Gateway, Client: c.ClientID})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.engine = engine
+	c.replies = make(chan ib.Reply, 100)
+	ready := make(chan struct{})
+	c.ready = ready
+	c.mu.Unlock()
+	engine.SubscribeAll(c.replies)
+	go c.loop(c.replies)
+	// 连接时推送的下一订单号及账户可能早于订阅到达, 重新请求
+	for _, r := range []ib.Request{&ib.RequestIDs{}, &ib.RequestManagedAccounts{}} {
+		if err := engine.Send(r); err != nil {
+			engine.Stop()
+			return err
+		}
+	}
+	select {
+	case <-ready:
+	case <-time.After(Timeout):
+		engine.Stop()
+		return fmt.Errorf("wait for the next order id and accounts timeout")
+	}
+	c.mu.Lock()
+	if c.Account == "" && len(c.accounts) > 0 {
+		c.Account = c.accounts[0]
+	}
+	account := c.Account
+	c.mu.Unlock()
+	if err := c.loadOrders(); err != nil {
+		engine.Stop()
+		return err
+	}
+	return engine.Send(&ib.RequestAccountUpdates{Subscribe: true, AccountCode: account})
+}
+
+// loadOrders load the open orders and the executions of today placed by this client id in the earlier sessions
+func (c *Client) loadOrders() error {
+	c.mu.Lock()
+	c.loaded = false
+	c.mu.Unlock()
+	if err := c.send(&ib.RequestAllOpenOrders{}); err != nil {
+		return err
+	}
+	if !c.wait(func() bool { return c.loaded }) {
+		return fmt.Errorf("request open orders timeout")
+	}
+	id, err := c.requestID()
+	if err != nil {
+		return err
+	}
+	waiter := make(chan ib.Reply, 100)
+	c.mu.Lock()
+	c.waiters[id] = waiter
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, id)
+		c.mu.Unlock()
+	}()
+	req := &ib.RequestExecutions{Filter: ib.ExecutionFilter{ClientID: c.ClientID}}
+	req.SetID(id)
+	if err := c.send(req); err != nil {
+		return err
+	}
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case r := <-waiter:
+			switch r := r.(type) {
+			case *ib.ExecutionDataEnd:
+				return nil
+			case *ib.ErrorMessage:
+				return r.Error()
+			}
+		case <-deadline:
+			return fmt.Errorf("request executions timeout")
+		}
+	}
+}
+
+// Close ...
+func (c *Client) Close() {
+	c.mu.Lock()
+	engine := c.engine
+	c.engine = nil
+	c.mu.Unlock()
+	if engine != nil {
+		engine.Stop()
+	}
+}
+
+// send a request to the gateway
+func (c *Client) send(r ib.Request) error {
+	c.mu.Lock()
+	engine := c.engine
+	c.mu.Unlock()
+	if engine == nil {
+		return fmt.Errorf("ib client is not connected")
+	}
+	return engine.Send(r)
+}
+
+// requestID the next request id, above all the order ids
+func (c *Client) requestID() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.engine == nil {
+		return 0, fmt.Errorf("ib client is not connected")
+	}
+	c.reqID++
+	return c.reqID, nil
+}
+
+// notify wake up the goroutines waiting for an update, must hold the lock
+func (c *Client) notify() {
+	close(c.updated)
+	c.updated = make(chan struct{})
+}
+
+// wait until the condition is true or timeout
+func (c *Client) wait(cond func() bool) bool {
+	deadline := time.After(Timeout)
+	for {
+		c.mu.Lock()
+		ok, updated := cond(), c.updated
+		c.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-updated:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// loop handle the replies of the gateway
+func (c *Client) loop(replies chan ib.Reply) {
+	for r := range replies {
+		c.mu.Lock()
+		c.handle(r)
+		c.notify()
+		c.mu.Unlock()
+	}
+}
+
+// handle a reply, must hold the lock
+func (c *Client) handle(r ib.Reply) {
+	if mr, ok := r.(ib.MatchedReply); ok {
+		if waiter := c.waiters[mr.ID()]; waiter != nil {
+			waiter <- r
+		}
+	}
+	switch r := r.(type) {
+	case *ib.NextValidID:
+		c.nextID = r.OrderID
+		c.checkReady()
+	case *ib.ManagedAccounts:
+		c.accounts = r.AccountsList
+		c.checkReady()
+	case *ib.TickPrice:
+		if ticker := c.tickers[r.ID()]; ticker != nil {
+			switch r.Type {
+			case ib.TickBid:
+				ticker.Bid, ticker.BidSize = r.Price, float64(r.Size)
+			case ib.TickAsk:
+				ticker.Ask, ticker.AskSize = r.Price, float64(r.Size)
+			case ib.TickLast:
+				ticker.Last = r.Price
+			case ib.TickHigh:
+				ticker.High = r.Price
+			case ib.TickLow:
+				ticker.Low = r.Price
+			case ib.TickOpen:
+				ticker.Open = r.Price
+			case ib.TickClose:
+				ticker.Close = r.Price
+			}
+			ticker.Time = time.Now()
+		}
+	case *ib.TickSize:
+		if ticker := c.tickers[r.ID()]; ticker != nil {
+			switch r.Type {
+			case int64(ib.TickBidSize):
+				ticker.BidSize = float64(r.Size)
+			case ib.TickAskSize:
+				ticker.AskSize = float64(r.Size)
+			case ib.TickVolume:
+				ticker.Volume = float64(r.Size)
+			}
+		}
+	case *ib.MarketDepth:
+		c.updateDepth(r.ID(), r.Position, r.Operation, r.Side, r.Price, r.Size)
+	case *ib.MarketDepthL2:
+		c.updateDepth(r.ID(), r.Position, r.Operation, r.Side, r.Price, r.Size)
+	case *ib.OpenOrder:
+		c.openOrder(r)
+	case *ib.OpenOrderEnd:
+		c.loaded = true
+	case *ib.ExecutionData:
+		c.execution(r)
+	case *ib.OrderStatus:
+		if order := c.orders[r.ID()]; isOrderID(r.ID()) && order != nil {
+			order.Status = r.Status
+			order.Filled = r.Filled
+			if r.AverageFillPrice > 0 && r.AverageFillPrice < 1e300 {
+				order.AvgPrice = r.AverageFillPrice
+			}
+		}
+	case *ib.ErrorMessage:
+		if order := c.orders[r.ID()]; isOrderID(r.ID()) && order != nil && !r.SeverityWarning() && order.Filled == 0 &&
+			(order.Status == "" || order.Status == "PendingSubmit") {
+			// 报单被拒绝
+			order.Status, order.Message = "Inactive", r.Message
+		}
+	case *ib.AccountValue:
+		values := c.values[r.Key]
+		if values == nil {
+			values = make(map[string]string)
+			c.values[r.Key] = values
+		}
+		values[r.Currency] = r.Value
+	case *ib.PortfolioValue:
+		c.portfolio[r.Contract.ContractID] = *r
+	}
+}
+
+// openOrder keep the open order placed by this client id in an earlier session, must hold the lock
+func (c *Client) openOrder(r *ib.OpenOrder) {
+	if !isOrderID(r.ID()) || r.Order.ClientID != c.ClientID {
+		return
+	}
+	if c.orders[r.ID()] == nil {
+		c.orders[r.ID()] = &Order{
+			ID:       r.ID(),
+			Contract: r.Contract,
+			Action:   r.Order.Action,
+			Type:     r.Order.OrderType,
+			Price:    r.Order.LimitPrice,
+			Quantity: r.Order.TotalQty,
+			Ref:      r.Order.OrderRef,
+			Status:   r.OrderState.Status,
+			Time:     time.Now(),
+		}
+	}
+}
+
+// execution update the fills of the order by the execution, the orders not open any more
+// but traded today by this client id are kept as filled, must hold the lock
+func (c *Client) execution(r *ib.ExecutionData) {
+	exec := r.Exec
+	if !isOrderID(exec.OrderID) || exec.ClientID != c.ClientID {
+		return
+	}
+	order := c.orders[exec.OrderID]
+	if order == nil {
+		action := "BUY"
+		if exec.Side == "SLD" {
+			action = "SELL"
+		}
+		order = &Order{
+			ID:       exec.OrderID,
+			Contract: r.Contract,
+			Action:   action,
+			Ref:      exec.OrderRef,
+			Status:   "Filled",
+			Time:     exec.Time,
+		}
+		c.orders[exec.OrderID] = order
+	}
+	if exec.CumQty >= order.Filled {
+		order.Filled = exec.CumQty
+		order.AvgPrice = exec.AveragePrice
+	}
+	if order.Quantity < order.Filled {
+		order.Quantity = order.Filled
+	}
+}
+
+// checkReady ...
+func (c *Client) checkReady() {
+	if c.nextID > 0 && len(c.accounts) > 0 && c.ready != nil {
+		close(c.ready)
+		c.ready = nil
+	}
+}
+
+// updateDepth apply an insert(0), update(1) or delete(2) on the ask(0) or bid(1) side
+func (c *Client) updateDepth(id, position, operation, side int64, price float64, size int64) {
+	depth := c.depths[id]
+	if depth == nil {
+		return
+	}
+	levels := &depth.Asks
+	if side == 1 {
+		levels = &depth.Bids
+	}
+	pos := int(position)
+	switch {
+	case operation == 0 && pos <= len(*levels):
+		*levels = append(*levels, Level{})
+		copy((*levels)[pos+1:], (*levels)[pos:])
+		(*levels)[pos] = Level{Price: price, Size: float64(size)}
+	case operation == 1 && pos < len(*levels):
+		(*levels)[pos] = Level{Price: price, Size: float64(size)}
+	case operation == 2 && pos < len(*levels):
+		*levels = append((*levels)[:pos], (*levels)[pos+1:]...)
+	}
+}
+
+// ContractDetails resolve the contract, the first match is returned
+func (c *Client) ContractDetails(contract ib.Contract) (ib.ContractDetails, error) {
+	var details ib.ContractDetails
+	id, err := c.requestID()
+	if err != nil {
+		return details, err
+	}
+	waiter := make(chan ib.Reply, 100)
+	c.mu.Lock()
+	c.waiters[id] = waiter
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, id)
+		c.mu.Unlock()
+	}()
+	req := &ib.RequestContractData{Contract: contract}
+	req.SetID(id)
+	if err := c.send(req); err != nil {
+		return details, err
+	}
+	var found []ib.ContractDetails
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case r := <-waiter:
+			switch r := r.(type) {
+			case *ib.ContractData:
+				found = append(found, r.Contract)
+			case *ib.ContractDataEnd:
+				if len(found) == 0 {
+					return details, fmt.Errorf("no contract found for %s", contract.Symbol)
+				}
+				return found[0], nil
+			case *ib.ErrorMessage:
+				return details, r.Error()
+			}
+		case <-deadline:
+			return details, fmt.Errorf("request contract %s timeout", contract.Symbol)
+		}
+	}
+}
+
+// SubscribeTicker subscribe the market data of the contract
+func (c *Client) SubscribeTicker(contract ib.Contract) (int64, error) {
+	id, err := c.requestID()
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.tickers[id] = &Ticker{}
+	c.mu.Unlock()
+	req := &ib.RequestMarketData{Contract: contract}
+	req.SetID(id)
+	return id, c.send(req)
+}
+
+// Ticker the latest market data of the subscription, wait for the first price if none yet
+func (c *Client) Ticker(id int64) (Ticker, bool) {
+	var ticker Ticker
+	ok := c.wait(func() bool {
+		t := c.tickers[id]
+		if t != nil {
+			ticker = *t
+		}
+		return t != nil && (t.Last > 0 || t.Bid > 0 || t.Ask > 0)
+	})
+	return ticker, ok
+}
+
+// SubscribeDepth subscribe the market depth of the contract
+func (c *Client) SubscribeDepth(contract ib.Contract, rows int64) (int64, error) {
+	id, err := c.requestID()
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.depths[id] = &Depth{}
+	c.mu.Unlock()
+	req := &ib.RequestMarketDepth{Contract: contract, NumRows: rows}
+	req.SetID(id)
+	return id, c.send(req)
+}
+
+// Depth the market depth of the subscription, wait for the first level if none yet
+func (c *Client) Depth(id int64) (Depth, bool) {
+	var depth Depth
+	ok := c.wait(func() bool {
+		d := c.depths[id]
+		if d != nil {
+			depth = Depth{Bids: append([]Level{}, d.Bids...), Asks: append([]Level{}, d.Asks...)}
+		}
+		return d != nil && (len(d.Bids) > 0 || len(d.Asks) > 0)
+	})
+	return depth, ok
+}
+
+// PlaceOrder place the order with the next order id
+func (c *Client) PlaceOrder(contract ib.Contract, order ib.Order) (int64, error) {
+	c.mu.Lock()
+	if c.nextID == 0 {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("ib client is not connected")
+	}
+	id := c.nextID
+	c.nextID++
+	order.OrderID = id
+	order.Account = c.Account
+	c.orders[id] = &Order{
+		ID:       id,
+		Contract: contract,
+		Action:   order.Action,
+		Type:     order.OrderType,
+		Price:    order.LimitPrice,
+		Quantity: order.TotalQty,
+		Ref:      order.OrderRef,
+		Time:     time.Now(),
+	}
+	c.mu.Unlock()
+	req := &ib.PlaceOrder{Contract: contract, Order: order}
+	req.SetID(id)
+	if err := c.send(req); err != nil {
+		c.mu.Lock()
+		delete(c.orders, id)
+		c.mu.Unlock()
+		return 0, err
+	}
+	return id, nil
+}
+
+// CancelOrder ...
+func (c *Client) CancelOrder(id int64) error {
+	req := &ib.CancelOrder{}
+	req.SetID(id)
+	return c.send(req)
+}
+
+// Order the order placed by this client id
+func (c *Client) Order(id int64) (Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if order := c.orders[id]; order != nil {
+		return *order, true
+	}
+	return Order{}, false
+}
+
+// WaitOrder wait until the status of the order is reported
+func (c *Client) WaitOrder(id int64) (Order, bool) {
+	var order Order
+	ok := c.wait(func() bool {
+		if o := c.orders[id]; o != nil {
+			order = *o
+			return o.Status != "" && o.Status != "PendingSubmit"
+		}
+		return false
+	})
+	return order, ok
+}
+
+// Orders the orders placed by this client id in this and the earlier sessions of today, sorted by id
+func (c *Client) Orders() []Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	orders := make([]Order, 0, len(c.orders))
+	for _, order := range c.orders {
+		orders = append(orders, *order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// AccountValues the account values by key and currency, wait for the first download
+func (c *Client) AccountValues() (map[string]map[string]string, bool) {
+	values := make(map[string]map[string]string)
+	ok := c.wait(func() bool { return len(c.values) > 0 })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, byCurrency := range c.values {
+		if key.AccountCode != c.Account {
+			continue
+		}
+		values[key.Key] = make(map[string]string)
+		for currency, value := range byCurrency {
+			values[key.Key][currency] = value
+		}
+	}
+	return values, ok
+}
+
+// Portfolio the positions of the account
+func (c *Client) Portfolio() []ib.PortfolioValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	positions := make([]ib.PortfolioValue, 0, len(c.portfolio))
+	for _, p := range c.portfolio {
+		if p.Key.AccountCode == c.Account {
+			positions = append(positions, p)
+		}
+	}
+	return positions
 }
@@ -7,6 +7,7 @@ import (
 	"snack.com/xiyanxiyan10/stocktrader/config"
 	"snack.com/xiyanxiyan10/stocktrader/handler"
 	"snack.com/xiyanxiyan10/stocktrader/model"
+	"snack.com/xiyanxiyan10/stocktrader/trader"
 )
 
 func main() {
@@ -24,5 +25,8 @@ func main() {
 		fmt.Printf("model init error is %s\n", err.Error())
 		return
 	}
+	if err := trader.Restore(); err != nil {
+		fmt.Printf("trader restore error is %s\n", err.Error())
+	}
 	handler.Init()
 }
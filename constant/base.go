@@ -83,6 +83,7 @@ type Depth struct {
 // Order struct
 type Order struct {
 	Id        string  //订单ID
+	ClientID  string  //客户端订单ID
 	Price     float64 //价格
 	OpenPrice float64 //open price
 	AvgPrice  float64
@@ -100,6 +101,53 @@ type Order struct {
 	Status TradeStatus // trader status
 }
 
+// Fill an execution of an order
+type Fill struct {
+	OrderID   string
+	ClientID  string
+	StockType string
+	Side      string // buy, sell, closebuy, closesell
+	Price     float64
+	Amount    float64
+	Fee       float64
+	Time      int64 // 成交时间, 毫秒
+}
+
+// OrderRequest a typed order placed by PlaceOrder
+type OrderRequest struct {
+	Symbol        string  `json:"symbol"`        //品种, 默认为当前设置的品种
+	Side          string  `json:"side"`          //买卖方向 buy/sell
+	Price         float64 `json:"price"`         //价格, 市价单忽略
+	Amount        float64 `json:"amount"`        //数量
+	OrderType     string  `json:"orderType"`     //limit/market, 默认 limit
+	TimeInForce   string  `json:"timeInForce"`   //GTC/IOC/FOK, 默认 GTC
+	ClientOrderID string  `json:"clientOrderId"` //客户端订单ID
+	ReduceOnly    bool    `json:"reduceOnly"`    //只减仓
+	PostOnly      bool    `json:"postOnly"`      //只做 maker
+	Direction     string  `json:"direction"`     //期货开平方向, 默认为 SetDirection 设置的方向
+	MarginLevel   float64 `json:"marginLevel"`   //期货杠杆倍数, 默认为 SetMarginLevel 设置的倍数
+	Msg           string  `json:"msg"`           //日志信息
+}
+
+// Instrument the trading rules of a symbol, zero means no rule
+type Instrument struct {
+	Symbol      string  `json:"symbol"`
+	Tick        float64 `json:"tick"`        //最小价格变动
+	Lot         float64 `json:"lot"`         //数量步长
+	MinAmount   float64 `json:"minAmount"`   //最小下单量
+	MinNotional float64 `json:"minNotional"` //最小下单金额
+	Multiplier  float64 `json:"multiplier"`  //合约乘数, 每张合约的价值
+	Expiry      string  `json:"expiry"`      //到期日, 如 20211217
+}
+
+// ContractSize the value of one lot by the multiplier, 1 for spot without it
+func (i Instrument) ContractSize() float64 {
+	if i.Multiplier <= 0 {
+		return 1
+	}
+	return i.Multiplier
+}
+
 // OHLC is a candlestick struct
 type OHLC struct {
 	Time   int64   `json:"Time"`
@@ -112,14 +160,31 @@ type OHLC struct {
 
 type Record OHLC
 
+// RiskLimit the pre-trade risk limits of a trader, zero means no limit
+type RiskLimit struct {
+	MaxOrderAmount float64 `json:"maxOrderAmount"` // 单笔最大下单量
+	MaxNotional    float64 `json:"maxNotional"`    // 单笔最大下单金额
+	MaxPosition    float64 `json:"maxPosition"`    // 单个品种最大持仓量
+	PriceBand      float64 `json:"priceBand"`      // 委托价偏离最新价的最大比例, 如 0.05
+	MaxOpenOrders  int     `json:"maxOpenOrders"`  // 单个交易所最大挂单数
+	MaxDailyLoss   float64 `json:"maxDailyLoss"`   // 当日最大已实现亏损
+}
+
+// AccountLimit the account-wide limits in the reference currency, zero means no limit
+type AccountLimit struct {
+	MaxExposure       float64 `json:"maxExposure"`       // 账户所有交易员的最大持仓市值
+	MaxUnrealizedLoss float64 `json:"maxUnrealizedLoss"` // 账户最大浮动亏损
+}
+
 // Option is an exchange option
 type Option struct {
-	Index     int
-	TraderID  int64
-	Type      string
-	Name      string
-	AccessKey string
-	SecretKey string
+	Index      int
+	TraderID   int64
+	ExchangeID int64
+	Type       string
+	Name       string
+	AccessKey  string
+	SecretKey  string
 
 	Limit     int64
 	LastSleep int64
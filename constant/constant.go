@@ -29,15 +29,31 @@ const (
 	SZ         = "SZ"
 	SpotBack   = "SpotaBack"
 	FutureBack = "FutureBack"
+	CTP        = "CTP"
+	IB         = "IB"
+	Binance    = "Binance"
+	OKEx       = "OKEx"
+	OKExFuture = "OKExFuture"
+	OKExSwap   = "OKExSwap"
+	Bitmex     = "Bitmex"
+
+	// Paper the prefix of the live exchange trading on paper, e.g. PaperBinance
+	Paper = "Paper"
 )
 
 // log types
 const (
-	ERROR  = "ERROR"
-	INFO   = "INFO"
-	PROFIT = "PROFIT"
+	ERROR     = "ERROR"
+	INFO      = "INFO"
+	PROFIT    = "PROFIT"
+	RECOVER   = "RECOVER"
+	LIFECYCLE = "LIFECYCLE"
+	AUDIT     = "AUDIT"
 )
 
+// AdminLevel the level of the administrator
+const AdminLevel = 99
+
 const (
 	// STOCKDBURL ...
 	STOCKDBURL = "stockdburl"
@@ -55,12 +71,17 @@ const (
 	TradeTypeShortClose = "closesell"
 	TradeTypeCancel     = "cancel"
 	TradeTypeHold       = "hold"
+
+	// 平今仓, 上期所及能源中心区分今昨仓
+	TradeTypeLongCloseToday  = "closebuytoday"
+	TradeTypeShortCloseToday = "closeselltoday"
 )
 
 // some variables
 var (
-	ExchangeTypes = []string{HuoBiDm, FutureBack, HuoBi, SpotBack}
-	ScriptTypes   = []string{ScriptJs}
+	ExchangeTypes = []string{HuoBiDm, FutureBack, HuoBi, SpotBack, Binance, OKEx, OKExFuture, OKExSwap, Bitmex, CTP, IB, SZ,
+		Paper + HuoBi, Paper + Binance, Paper + OKEx}
+	ScriptTypes = []string{ScriptJs}
 )
 
 // future userInfo string
@@ -73,6 +94,19 @@ const (
 	RiskRate      = "RiskRate" //保证金率
 )
 
+// order types
+const (
+	OrderTypeLimit  = "limit"
+	OrderTypeMarket = "market"
+)
+
+// time in force of the orders
+const (
+	TimeInForceGTC = "GTC" // good till cancel
+	TimeInForceIOC = "IOC" // immediate or cancel
+	TimeInForceFOK = "FOK" // fill or kill
+)
+
 const (
 	ORDER_UNFINISH    = 0
 	ORDER_PART_FINISH = 1
@@ -2,10 +2,13 @@ package handler
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hprose/hprose-golang/rpc"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
 	"snack.com/xiyanxiyan10/stocktrader/model"
+	"snack.com/xiyanxiyan10/stocktrader/trader"
+	"snack.com/xiyanxiyan10/stocktrader/util"
 )
 
 type algorithm struct{}
@@ -45,6 +48,24 @@ func (algorithm) ScriptTypes(_ string, ctx rpc.Context) (resp response) {
 	return
 }
 
+// Lint check the script without saving it
+func (algorithm) Lint(req model.Algorithm, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	req.UserID = self.ID
+	resp.Data = trader.Lint(req)
+	resp.Success = true
+	return
+}
+
 // Put
 func (algorithm) Put(req model.Algorithm, ctx rpc.Context) (resp response) {
 	username := ctx.GetString("username")
@@ -57,18 +78,53 @@ func (algorithm) Put(req model.Algorithm, ctx rpc.Context) (resp response) {
 		resp.Message = fmt.Sprint(err)
 		return
 	}
+	if strings.Contains(req.Name, "@") || strings.Contains(req.Version, "@") {
+		resp.Message = "algorithm name and version can not contain @"
+		return
+	}
+	check := req
+	check.UserID = self.ID
+	diagnostics := trader.Lint(check)
+	resp.Data = diagnostics
+	if trader.HasError(diagnostics) {
+		resp.Message = "the script has errors"
+		return
+	}
+	db, err := model.NewOrm()
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	defer db.Close()
+	db = db.Begin()
 	algorithm := req
 	if req.ID > 0 {
-		if err := model.DB.First(&algorithm, req.ID).Error; err != nil {
+		if err := db.First(&algorithm, req.ID).Error; err != nil {
+			db.Rollback()
 			resp.Message = fmt.Sprint(err)
 			return
 		}
+		changed := algorithm.Script != req.Script || algorithm.EvnDefault != req.EvnDefault
 		algorithm.Name = req.Name
 		algorithm.Description = req.Description
 		algorithm.Script = req.Script
 		algorithm.Type = req.Type
 		algorithm.EvnDefault = req.EvnDefault
-		if err := model.DB.Save(&algorithm).Error; err != nil {
+		algorithm.Library = req.Library
+		algorithm.Version = req.Version
+		if err := db.Save(&algorithm).Error; err != nil {
+			db.Rollback()
+			resp.Message = fmt.Sprint(err)
+			return
+		}
+		if changed {
+			if _, err := model.AddRevision(db, algorithm, self, ""); err != nil {
+				db.Rollback()
+				resp.Message = fmt.Sprint(err)
+				return
+			}
+		}
+		if err := db.Commit().Error; err != nil {
 			resp.Message = fmt.Sprint(err)
 			return
 		}
@@ -76,7 +132,17 @@ func (algorithm) Put(req model.Algorithm, ctx rpc.Context) (resp response) {
 		return
 	}
 	req.UserID = self.ID
-	if err := model.DB.Create(&req).Error; err != nil {
+	if err := db.Create(&req).Error; err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if _, err := model.AddRevision(db, req, self, ""); err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := db.Commit().Error; err != nil {
 		resp.Message = fmt.Sprint(err)
 		return
 	}
@@ -105,10 +171,180 @@ func (algorithm) Delete(ids []int64, ctx rpc.Context) (resp response) {
 	for _, u := range users {
 		userIds = append(userIds, u.ID)
 	}
-	if err := model.DB.Where("id in (?) AND user_id in (?)", ids, userIds).Delete(&model.Algorithm{}).Error; err != nil {
+	var algorithms []model.Algorithm
+	if err := model.DB.Where("id in (?) AND user_id in (?)", ids, userIds).Find(&algorithms).Error; err != nil {
 		resp.Message = fmt.Sprint(err)
-	} else {
+		return
+	}
+	if len(algorithms) == 0 {
 		resp.Success = true
+		return
+	}
+	ids = []int64{}
+	for _, a := range algorithms {
+		ids = append(ids, a.ID)
+	}
+	db, err := model.NewOrm()
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	defer db.Close()
+	db = db.Begin()
+	if err := db.Where("id in (?)", ids).Delete(&model.Algorithm{}).Error; err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := db.Where("algorithm_id in (?)", ids).Delete(&model.AlgorithmRevision{}).Error; err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := db.Commit().Error; err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
+
+// Revisions list the saved revisions of the algorithm
+func (algorithm) Revisions(id int64, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if _, err := self.GetAlgorithm(id); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	revisions, err := model.ListRevision(id)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Data = revisions
+	resp.Success = true
+	return
+}
+
+// Diff compare the scripts of two revisions, the current script if to is 0
+func (algorithm) Diff(id, from, to int64, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	current, err := self.GetAlgorithm(id)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	old, err := model.GetRevision(id, from)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	script := current.Script
+	if to > 0 {
+		revision, err := model.GetRevision(id, to)
+		if err != nil {
+			resp.Message = fmt.Sprint(err)
+			return
+		}
+		script = revision.Script
+	}
+	resp.Data = util.DiffLines(old.Script, script)
+	resp.Success = true
+	return
+}
+
+// Rollback restore the script of a revision, which is saved as a new revision
+func (algorithm) Rollback(id, revision int64, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	current, err := self.GetAlgorithm(id)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	target, err := model.GetRevision(id, revision)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	db, err := model.NewOrm()
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	defer db.Close()
+	db = db.Begin()
+	current.Script = target.Script
+	current.EvnDefault = target.EvnDefault
+	if err := db.Save(&current).Error; err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	saved, err := model.AddRevision(db, current, self, fmt.Sprintf("rollback to revision %d", revision))
+	if err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := db.Commit().Error; err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
 	}
+	resp.Data = saved.Revision
+	resp.Success = true
+	return
+}
+
+// Test run the algorithm against the scenarios in json
+func (algorithm) Test(id int64, scenarios string, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	current, err := self.GetAlgorithm(id)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	list, err := trader.LoadScenarios([]byte(scenarios))
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Data = trader.RunScenarios(current, list)
+	resp.Success = true
 	return
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/hprose/hprose-golang/rpc"
 
+	"snack.com/xiyanxiyan10/stocktrader/api"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
 	"snack.com/xiyanxiyan10/stocktrader/model"
 )
@@ -58,6 +59,10 @@ func (exchange) Put(req model.Exchange, ctx rpc.Context) (resp response) {
 		resp.Message = fmt.Sprint(err)
 		return
 	}
+	if _, err := api.ParseAccountLimit(req.Limit); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
 	exchange := req
 	if req.ID > 0 {
 		if err := model.DB.First(&exchange, req.ID).Error; err != nil {
@@ -67,7 +72,11 @@ func (exchange) Put(req model.Exchange, ctx rpc.Context) (resp response) {
 		exchange.Name = req.Name
 		exchange.Type = req.Type
 		exchange.AccessKey = req.AccessKey
-		exchange.SecretKey = req.SecretKey
+		// 列表不返回密钥, 为空时保留原密钥
+		if req.SecretKey != "" {
+			exchange.SecretKey = req.SecretKey
+		}
+		exchange.Limit = req.Limit
 		if err := model.DB.Save(&exchange).Error; err != nil {
 			resp.Message = fmt.Sprint(err)
 			return
@@ -36,6 +36,7 @@ func Init() {
 		Algorithm algorithm
 		Trader    runner
 		Log       logger
+		Order     order
 	}{}
 	service.Event = event{}
 	service.AddBeforeFilterHandler(func(request []byte, ctx rpc.Context, next rpc.NextFilterHandler) (response []byte, err error) {
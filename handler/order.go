@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/hprose/hprose-golang/rpc"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+type order struct{}
+
+// List the orders of the trader, status is optional, e.g. ["UNFINISH", "PART_FINISH"]
+func (order) List(trader model.Trader, pagination pagination, status []string, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if trader, err = self.GetTrader(trader.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	total, orders, err := self.ListOrder(trader.ID, status, pagination.PageSize, pagination.Current)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Data = struct {
+		Total int64
+		List  []model.Order
+	}{
+		Total: total,
+		List:  orders,
+	}
+	resp.Success = true
+	return
+}
+
+// Fills list the executions of the trader
+func (order) Fills(trader model.Trader, pagination pagination, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if trader, err = self.GetTrader(trader.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	total, fills, err := self.ListFill(trader.ID, pagination.PageSize, pagination.Current)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Data = struct {
+		Total int64
+		List  []model.Fill
+	}{
+		Total: total,
+		List:  fills,
+	}
+	resp.Success = true
+	return
+}
+
+// Ledgers list the positions, average entry prices and realized pnl of the trader
+func (order) Ledgers(trader model.Trader, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if trader, err = self.GetTrader(trader.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if resp.Data, err = self.ListLedger(trader.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/hprose/hprose-golang/rpc"
 
+	"snack.com/xiyanxiyan10/stocktrader/api"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
 	"snack.com/xiyanxiyan10/stocktrader/model"
 	"snack.com/xiyanxiyan10/stocktrader/trader"
@@ -31,6 +32,7 @@ func (runner) List(algorithmID int64, ctx rpc.Context) (resp response) {
 	}
 	for i, t := range traders {
 		traders[i].Status = trader.GetTraderStatus(t.ID)
+		traders[i].State = trader.GetTraderState(t.ID)
 	}
 	resp.Data = traders
 	resp.Success = true
@@ -49,6 +51,10 @@ func (runner) Put(req model.Trader, ctx rpc.Context) (resp response) {
 		resp.Message = fmt.Sprint(err)
 		return
 	}
+	if _, err := api.ParseRiskLimit(req.Risk); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
 	db, err := model.NewOrm()
 	if err != nil {
 		resp.Message = fmt.Sprint(err)
@@ -123,6 +129,10 @@ func (runner) Delete(req model.Trader, ctx rpc.Context) (resp response) {
 		db.Rollback()
 		resp.Message = fmt.Sprint(err)
 	}
+	if err := db.Where("trader_id = ?", req.ID).Delete(&model.State{}).Error; err != nil {
+		db.Rollback()
+		resp.Message = fmt.Sprint(err)
+	}
 	if err := db.Commit().Error; err != nil {
 		db.Rollback()
 		resp.Message = fmt.Sprint(err)
@@ -156,3 +166,95 @@ func (runner) Switch(req model.Trader, ctx rpc.Context) (resp response) {
 	resp.Success = true
 	return
 }
+
+// KillSwitch halt the trader, cancel its open orders and flatten the positions if required
+func (runner) KillSwitch(req model.Trader, flatten bool, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if req, err = self.GetTrader(req.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := trader.KillSwitch(req.ID, flatten, self.Username); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
+
+// KillAll trigger the kill switch of every running trader, administrator only
+func (runner) KillAll(flatten bool, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if self.Level < constant.AdminLevel {
+		resp.Message = constant.ErrInsufficientPermissions
+		return
+	}
+	if err := trader.KillAll(flatten, self.Username); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
+
+// Rearm allow the trader halted by the kill switch to run again
+func (runner) Rearm(req model.Trader, ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if req, err = self.GetTrader(req.ID); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if err := trader.Rearm(req.ID, self.Username); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
+
+// Portfolio the positions, exposures and pnl across the running traders in the reference currency
+func (runner) Portfolio(ctx rpc.Context) (resp response) {
+	username := ctx.GetString("username")
+	if username == "" {
+		resp.Message = constant.ErrAuthorizationError
+		return
+	}
+	self, err := model.GetUser(username)
+	if err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	if resp.Data, err = trader.GetPortfolio(self); err != nil {
+		resp.Message = fmt.Sprint(err)
+		return
+	}
+	resp.Success = true
+	return
+}
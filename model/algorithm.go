@@ -1,7 +1,11 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
 )
 
 // Algorithm struct
@@ -13,6 +17,8 @@ type Algorithm struct {
 	Description string     `gorm:"type:text" json:"description"`
 	Script      string     `gorm:"type:text" json:"script"`
 	EvnDefault  string     `gorm:"type:text" json:"evnDefault"`
+	Library     bool       `gorm:"default:false" json:"library"`    // 是否为可被 require 的公共库
+	Version     string     `gorm:"type:varchar(50)" json:"version"` // 公共库版本
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
 	DeletedAt   *time.Time `sql:"index" json:"-"`
@@ -40,3 +46,50 @@ func (user User) ListAlgorithm(size, page int64, order string) (total int64, alg
 	err = DB.Where("user_id in (?)", userIDs).Order(toUnderScoreCase(order)).Limit(size).Offset((page - 1) * size).Find(&algorithms).Error
 	return
 }
+
+// GetAlgorithm ...
+func (user User) GetAlgorithm(id interface{}) (algorithm Algorithm, err error) {
+	if err = DB.Where("id = ?", id).First(&algorithm).Error; err != nil {
+		return
+	}
+	self, err := GetUserByID(algorithm.UserID)
+	if err != nil {
+		return
+	}
+	if user.ID != self.ID && user.Level <= self.Level {
+		err = fmt.Errorf(constant.ErrInsufficientPermissions)
+	}
+	return
+}
+
+// GetLibrary find the library algorithm visible to the user, the latest one if version is empty
+func (user User) GetLibrary(name, version string) (library Algorithm, err error) {
+	_, users, err := user.ListUser(-1, 1, "id")
+	if err != nil {
+		return
+	}
+	userIDs := []int64{}
+	for _, u := range users {
+		userIDs = append(userIDs, u.ID)
+	}
+	query := DB.Where("user_id in (?) AND name = ? AND library = ?", userIDs, name, true)
+	if version != "" {
+		query = query.Where("version = ?", version)
+	}
+	if err = query.Order("updated_at DESC").First(&library).Error; err != nil {
+		if version != "" {
+			name += "@" + version
+		}
+		err = fmt.Errorf("can not found the library %s", name)
+	}
+	return
+}
+
+// ParseLibrary split the library spec like "name@version"
+func ParseLibrary(spec string) (name, version string) {
+	spec = strings.TrimSpace(spec)
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
@@ -11,12 +11,26 @@ type Exchange struct {
 	Name      string     `gorm:"type:varchar(50)" json:"name"`
 	Type      string     `gorm:"type:varchar(50)" json:"type"`
 	AccessKey string     `gorm:"type:varchar(200)" json:"accessKey"`
-	SecretKey string     `gorm:"type:varchar(200)" json:"secretKey"`
+	SecretKey string     `gorm:"type:text" json:"secretKey"` // 主密钥加密保存, 只在运行策略时解密
+	Limit     string     `gorm:"type:text" json:"limit"`     // 账户级风控限制, json 格式
 	CreatedAt time.Time  `json:"createdAt"`
 	UpdatedAt time.Time  `json:"updatedAt"`
 	DeletedAt *time.Time `sql:"index" json:"-"`
 }
 
+// BeforeSave seal the secret before it is stored
+func (e *Exchange) BeforeSave() (err error) {
+	e.SecretKey, err = sealSecret(e.SecretKey)
+	return
+}
+
+// redactExchanges clear the secrets of the exchanges listed
+func redactExchanges(exchanges []Exchange) {
+	for i := range exchanges {
+		exchanges[i].SecretKey = ""
+	}
+}
+
 // ListExchange ...
 func (user User) ListExchange(size, page int64, order string) (total int64, exchanges []Exchange, err error) {
 	_, users, err := user.ListUser(-1, 1, "id")
@@ -35,5 +49,6 @@ func (user User) ListExchange(size, page int64, order string) (total int64, exch
 		size = 1000
 	}
 	err = DB.Where("user_id in (?)", userIDs).Order(toUnderScoreCase(order)).Limit(size).Offset((page - 1) * size).Find(&exchanges).Error
+	redactExchanges(exchanges)
 	return
 }
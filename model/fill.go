@@ -0,0 +1,116 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// Fill struct, an execution of an order
+type Fill struct {
+	ID           int64     `gorm:"primary_key" json:"id"`
+	TraderID     int64     `gorm:"index" json:"traderId"`
+	ExchangeType string    `gorm:"type:varchar(50)" json:"exchangeType"`
+	ExchangeName string    `gorm:"type:varchar(200)" json:"exchangeName"`
+	StockType    string    `gorm:"type:varchar(50)" json:"stockType"`
+	OrderID      string    `gorm:"type:varchar(100);index" json:"orderId"`
+	ClientID     string    `gorm:"type:varchar(100)" json:"clientId"`
+	Side         string    `gorm:"type:varchar(20)" json:"side"`
+	Price        float64   `json:"price"`
+	Amount       float64   `json:"amount"`
+	Fee          float64   `json:"fee"`
+	Time         int64     `gorm:"index" json:"time"` // 成交时间, 毫秒
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Ledger struct, the position of a trader on a symbol of an exchange rebuilt from the fills
+type Ledger struct {
+	ID          int64     `gorm:"primary_key" json:"id"`
+	TraderID    int64     `gorm:"index" json:"traderId"`
+	ExchangeID  int64     `json:"exchangeId"`
+	StockType   string    `gorm:"type:varchar(50)" json:"stockType"`
+	Amount      float64   `json:"amount"` // 正数为多头, 负数为空头
+	AvgPrice    float64   `json:"avgPrice"`
+	RealizedPnl float64   `json:"realizedPnl"`
+	Fee         float64   `json:"fee"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// fillSign buy and close short increase the position, sell and close long decrease it
+func fillSign(side string) float64 {
+	switch side {
+	case constant.TradeTypeSell, constant.TradeTypeLongClose, constant.TradeTypeLongCloseToday:
+		return -1
+	}
+	return 1
+}
+
+// Apply update the position, average entry price and realized pnl with the fill
+func (l *Ledger) Apply(fill constant.Fill) {
+	l.Fee += fill.Fee
+	qty := fill.Amount * fillSign(fill.Side)
+	switch {
+	case l.Amount == 0 || l.Amount*qty > 0:
+		// 开仓或加仓
+		total := math.Abs(l.Amount) + math.Abs(qty)
+		l.AvgPrice = (math.Abs(l.Amount)*l.AvgPrice + math.Abs(qty)*fill.Price) / total
+		l.Amount += qty
+	default:
+		// 减仓, 超出部分反向开仓
+		closed := math.Min(math.Abs(qty), math.Abs(l.Amount))
+		if l.Amount > 0 {
+			l.RealizedPnl += closed * (fill.Price - l.AvgPrice)
+		} else {
+			l.RealizedPnl += closed * (l.AvgPrice - fill.Price)
+		}
+		reversed := math.Abs(qty) > math.Abs(l.Amount)
+		l.Amount += qty
+		if reversed {
+			l.AvgPrice = fill.Price
+		}
+	}
+	if math.Abs(l.Amount) < 1e-12 {
+		l.Amount, l.AvgPrice = 0, 0
+	}
+}
+
+// AddFill ...
+func AddFill(fill *Fill) error {
+	return DB.Create(fill).Error
+}
+
+// GetLedger get the ledger of the trader on the symbol of the exchange, an empty one if not exists
+func GetLedger(traderID, exchangeID int64, stockType string) (ledger Ledger, err error) {
+	err = DB.Where("trader_id = ? AND exchange_id = ? AND stock_type = ?", traderID, exchangeID, stockType).
+		Attrs(Ledger{TraderID: traderID, ExchangeID: exchangeID, StockType: stockType}).FirstOrInit(&ledger).Error
+	return
+}
+
+// SaveLedger ...
+func SaveLedger(ledger *Ledger) error {
+	return DB.Save(ledger).Error
+}
+
+// ListFill ...
+func (user User) ListFill(traderID int64, size, page int64) (total int64, fills []Fill, err error) {
+	if err = DB.Model(&Fill{}).Where("trader_id = ?", traderID).Count(&total).Error; err != nil {
+		return
+	}
+	if size == -1 {
+		size = 1000
+	}
+	err = DB.Where("trader_id = ?", traderID).Order("time desc, id desc").Limit(size).Offset((page - 1) * size).Find(&fills).Error
+	return
+}
+
+// ListTraderLedger ...
+func ListTraderLedger(traderID int64) (ledgers []Ledger, err error) {
+	err = DB.Where("trader_id = ?", traderID).Order("exchange_id, stock_type").Find(&ledgers).Error
+	return
+}
+
+// ListLedger ...
+func (user User) ListLedger(traderID int64) ([]Ledger, error) {
+	return ListTraderLedger(traderID)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestLedgerApply(t *testing.T) {
+	var l Ledger
+	steps := []struct {
+		fill     constant.Fill
+		amount   float64
+		avgPrice float64
+		pnl      float64
+	}{
+		{constant.Fill{Side: constant.TradeTypeBuy, Price: 100, Amount: 1}, 1, 100, 0},
+		{constant.Fill{Side: constant.TradeTypeBuy, Price: 110, Amount: 1}, 2, 105, 0},
+		{constant.Fill{Side: constant.TradeTypeSell, Price: 115, Amount: 1}, 1, 105, 10},
+		{constant.Fill{Side: constant.TradeTypeSell, Price: 95, Amount: 3}, -2, 95, 0},
+		{constant.Fill{Side: constant.TradeTypeShortClose, Price: 90, Amount: 2, Fee: 0.5}, 0, 0, 10},
+	}
+	for i, s := range steps {
+		l.Apply(s.fill)
+		if l.Amount != s.amount || l.AvgPrice != s.avgPrice || l.RealizedPnl != s.pnl {
+			t.Fatalf("step %d: unexpected ledger %+v", i, l)
+		}
+	}
+	if l.Fee != 0.5 {
+		t.Fatalf("unexpected fee %v", l.Fee)
+	}
+}
+
+func TestLedgerByExchange(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+	db.AutoMigrate(&Ledger{})
+	saved := DB
+	DB = db
+	defer func() { DB = saved }()
+
+	db.Create(&Ledger{TraderID: 1, ExchangeID: 2, StockType: "BTC/USDT", Amount: 1})
+	if l, err := GetLedger(1, 2, "BTC/USDT"); err != nil || l.ID == 0 || l.Amount != 1 {
+		t.Fatalf("unexpected ledger %+v %v", l, err)
+	}
+	if l, err := GetLedger(1, 3, "BTC/USDT"); err != nil || l.ID != 0 || l.ExchangeID != 3 {
+		t.Fatalf("the ledgers of the exchanges should be apart, got %+v %v", l, err)
+	}
+}
@@ -78,6 +78,8 @@ func (l Logger) Log(method string, stockType string, price, amount float64, mess
 		return
 	}
 
+	// 使用记录时的数据库, 之后替换 DB 不影响异步写入
+	db := DB
 	go func(now int64) {
 		message := l.messages2message(method, messages...)
 		log := Log{
@@ -90,6 +92,6 @@ func (l Logger) Log(method string, stockType string, price, amount float64, mess
 			Amount:       amount,
 			Message:      message,
 		}
-		DB.Create(&log)
+		db.Create(&log)
 	}(now)
 }
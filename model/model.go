@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 
 	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
 )
 
 var (
@@ -27,6 +29,8 @@ func Init() error {
 	io.Register((*Algorithm)(nil), "Algorithm", "json")
 	io.Register((*Trader)(nil), "Trader", "json")
 	io.Register((*Log)(nil), "Log", "json")
+	io.Register((*State)(nil), "State", "json")
+	io.Register((*AlgorithmRevision)(nil), "AlgorithmRevision", "json")
 
 	dbType := config.String("dbtype")
 	dbURL := config.String("dburl")
@@ -42,18 +46,29 @@ func Init() error {
 			return err
 		}
 	}
-	DB.AutoMigrate(&User{}, &Exchange{}, &Algorithm{}, &TraderExchange{}, &Trader{}, &Log{})
+	DB.AutoMigrate(&User{}, &Exchange{}, &Algorithm{}, &TraderExchange{}, &Trader{}, &Log{}, &State{}, &AlgorithmRevision{}, &Order{}, &Fill{}, &Ledger{})
+	if DB.Dialect().GetName() != "sqlite3" {
+		// 加密后的密钥超过原来的 varchar(200)
+		DB.Model(&Exchange{}).ModifyColumn("secret_key", "text")
+	}
+	if err := LoadVault(); err != nil {
+		return fmt.Errorf("load master key error: %s", err.Error())
+	}
+	if count, err := RotateSecrets(); err != nil {
+		return fmt.Errorf("seal exchange secrets error: %s", err.Error())
+	} else if count > 0 {
+		log.Printf("%d exchange secrets sealed with the master key\n", count)
+	}
 	users := []User{}
 	DB.Find(&users)
 	if len(users) == 0 {
 		admin := User{
 			Username: "admin",
 			Password: "admin",
-			Level:    99,
+			Level:    constant.AdminLevel,
 		}
 		if err := DB.Create(&admin).Error; err != nil {
-			log.Fatalln("Create admin error:", err)
-			return err
+			return fmt.Errorf("create admin error: %s", err.Error())
 		}
 	}
 	DB.LogMode(false)
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+)
+
+// Order struct, an order placed by a trader and tracked by the oms
+type Order struct {
+	ID           int64     `gorm:"primary_key" json:"id"`
+	TraderID     int64     `gorm:"index" json:"traderId"`
+	ExchangeType string    `gorm:"type:varchar(50)" json:"exchangeType"`
+	ExchangeName string    `gorm:"type:varchar(200)" json:"exchangeName"`
+	StockType    string    `gorm:"type:varchar(50)" json:"stockType"`
+	OrderID      string    `gorm:"type:varchar(100);index" json:"orderId"`
+	ClientID     string    `gorm:"type:varchar(100);index" json:"clientId"`
+	Side         string    `gorm:"type:varchar(20)" json:"side"`
+	OrderType    string    `gorm:"type:varchar(20)" json:"orderType"`
+	TimeInForce  string    `gorm:"type:varchar(20)" json:"timeInForce"`
+	Price        float64   `json:"price"`
+	Amount       float64   `json:"amount"`
+	DealAmount   float64   `json:"dealAmount"`
+	AvgPrice     float64   `json:"avgPrice"`
+	Fee          float64   `json:"fee"`
+	Status       string    `gorm:"type:varchar(20);index" json:"status"` // UNFINISH, PART_FINISH, FINISH, CANCEL ...
+	Message      string    `gorm:"type:varchar(500)" json:"message"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// SaveOrder create or update the order
+func SaveOrder(order *Order) error {
+	return DB.Save(order).Error
+}
+
+// ListOpenOrder list the orders of the exchange which are not finished
+func ListOpenOrder(traderID int64, exchangeType, exchangeName string, status []string) (orders []Order, err error) {
+	err = DB.Where("trader_id = ? AND exchange_type = ? AND exchange_name = ? AND status IN (?)",
+		traderID, exchangeType, exchangeName, status).Order("id").Find(&orders).Error
+	return
+}
+
+// ListOrder ...
+func (user User) ListOrder(traderID int64, status []string, size, page int64) (total int64, orders []Order, err error) {
+	db := DB.Model(&Order{}).Where("trader_id = ?", traderID)
+	if len(status) > 0 {
+		db = db.Where("status IN (?)", status)
+	}
+	if err = db.Count(&total).Error; err != nil {
+		return
+	}
+	if size == -1 {
+		size = 1000
+	}
+	err = db.Order("id desc").Limit(size).Offset((page - 1) * size).Find(&orders).Error
+	return
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AlgorithmRevision struct, every saved script of an algorithm
+type AlgorithmRevision struct {
+	ID          int64     `gorm:"primary_key" json:"id"`
+	AlgorithmID int64     `gorm:"unique_index:idx_algorithm_revision" json:"algorithmId"`
+	Revision    int64     `gorm:"unique_index:idx_algorithm_revision" json:"revision"` // 算法内递增的版本号
+	UserID      int64     `json:"userId"`
+	Author      string    `gorm:"type:varchar(200)" json:"author"`
+	Message     string    `gorm:"type:varchar(500)" json:"message"`
+	Script      string    `gorm:"type:text" json:"script"`
+	EvnDefault  string    `gorm:"type:text" json:"evnDefault"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AddRevision record the current script of the algorithm as a new revision,
+// the number is allocated inside a transaction, a new one if db is not
+func AddRevision(db *gorm.DB, algorithm Algorithm, author User, message string) (revision AlgorithmRevision, err error) {
+	if _, ok := db.CommonDB().(*sql.Tx); !ok {
+		tx := db.Begin()
+		if revision, err = AddRevision(tx, algorithm, author, message); err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit().Error
+		return
+	}
+	if db.Dialect().GetName() != "sqlite3" {
+		// 锁住算法记录, 并发保存时依次分配版本号
+		if err = db.Set("gorm:query_option", "FOR UPDATE").Select("id").First(&Algorithm{}, algorithm.ID).Error; err != nil {
+			return
+		}
+	}
+	var last AlgorithmRevision
+	if err = db.Where("algorithm_id = ?", algorithm.ID).Order("revision DESC").FirstOrInit(&last).Error; err != nil {
+		return
+	}
+	revision = AlgorithmRevision{
+		AlgorithmID: algorithm.ID,
+		Revision:    last.Revision + 1,
+		UserID:      author.ID,
+		Author:      author.Username,
+		Message:     message,
+		Script:      algorithm.Script,
+		EvnDefault:  algorithm.EvnDefault,
+	}
+	err = db.Create(&revision).Error
+	return
+}
+
+// GetRevision ...
+func GetRevision(algorithmID, revision int64) (r AlgorithmRevision, err error) {
+	err = DB.Where("algorithm_id = ? AND revision = ?", algorithmID, revision).First(&r).Error
+	return
+}
+
+// GetLatestRevision ...
+func GetLatestRevision(algorithmID int64) (r AlgorithmRevision, err error) {
+	err = DB.Where("algorithm_id = ?", algorithmID).Order("revision DESC").First(&r).Error
+	return
+}
+
+// ListRevision list the revisions of the algorithm without the scripts, newest first
+func ListRevision(algorithmID int64) (revisions []AlgorithmRevision, err error) {
+	err = DB.Select("id, algorithm_id, revision, user_id, author, message, created_at").
+		Where("algorithm_id = ?", algorithmID).Order("revision DESC").Find(&revisions).Error
+	return
+}
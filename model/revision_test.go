@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestAddRevision(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+	db.AutoMigrate(&Algorithm{}, &AlgorithmRevision{})
+
+	algorithm := Algorithm{Name: "a", Script: "function main() {}"}
+	db.Create(&algorithm)
+	author := User{ID: 1, Username: "admin"}
+	for i := int64(1); i <= 2; i++ {
+		revision, err := AddRevision(db, algorithm, author, "")
+		if err != nil || revision.Revision != i {
+			t.Fatalf("unexpected revision %+v %v", revision, err)
+		}
+	}
+	tx := db.Begin()
+	if revision, err := AddRevision(tx, algorithm, author, ""); err != nil || revision.Revision != 3 {
+		t.Fatalf("unexpected revision in transaction %+v %v", revision, err)
+	}
+	tx.Rollback()
+
+	// 同一算法的版本号唯一
+	duplicate := AlgorithmRevision{AlgorithmID: algorithm.ID, Revision: 2}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Fatalf("duplicate revision saved")
+	}
+	other := AlgorithmRevision{AlgorithmID: algorithm.ID + 1, Revision: 2}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("revision of another algorithm: %v", err)
+	}
+}
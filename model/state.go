@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// State struct, key-value store of a trader which survives restarts
+type State struct {
+	ID        int64     `gorm:"primary_key" json:"id"`
+	TraderID  int64     `gorm:"unique_index:idx_state_trader_name" json:"traderId"`
+	Name      string    `gorm:"type:varchar(200);unique_index:idx_state_trader_name" json:"name"`
+	Value     string    `gorm:"type:text" json:"value"` // json encoded value
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetState ...
+func GetState(traderID int64, name string) (state State, err error) {
+	err = DB.Where("trader_id = ? AND name = ?", traderID, name).First(&state).Error
+	return
+}
+
+// FindState get the state of the trader, found is false when the state does not exist
+func FindState(traderID int64, name string) (state State, found bool, err error) {
+	state, err = GetState(traderID, name)
+	if gorm.IsRecordNotFoundError(err) {
+		return state, false, nil
+	}
+	return state, err == nil, err
+}
+
+// SetState create or update the state of the trader, the unique index of the trader and name
+// keeps one row when the first writes race
+func SetState(traderID int64, name, value string) error {
+	update := func() *gorm.DB {
+		return DB.Model(&State{}).Where("trader_id = ? AND name = ?", traderID, name).Update("value", value)
+	}
+	res := update()
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	if err := DB.Create(&State{TraderID: traderID, Name: name, Value: value}).Error; err != nil {
+		// 并发的首次写入已创建, 改为更新
+		return update().Error
+	}
+	return nil
+}
+
+// DeleteState ...
+func DeleteState(traderID int64, name string) error {
+	return DB.Where("trader_id = ? AND name = ?", traderID, name).Delete(&State{}).Error
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestSetState(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1)
+	db.AutoMigrate(&State{})
+	saved := DB
+	DB = db
+	defer func() { DB = saved }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := SetState(1, "last", fmt.Sprint(i)); err != nil {
+				t.Errorf("set state: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := SetState(1, "last", "done"); err != nil {
+		t.Fatalf("set state: %v", err)
+	}
+	var count int
+	db.Model(&State{}).Where("trader_id = ? AND name = ?", 1, "last").Count(&count)
+	if state, err := GetState(1, "last"); count != 1 || err != nil || state.Value != "done" {
+		t.Fatalf("unexpected state %+v %d %v", state, count, err)
+	}
+	if err := db.Create(&State{TraderID: 1, Name: "last"}).Error; err == nil {
+		t.Fatalf("the trader and name should be unique")
+	}
+}
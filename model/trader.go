@@ -14,6 +14,10 @@ type Trader struct {
 	AlgorithmID int64      `gorm:"index" json:"algorithmId"`
 	Name        string     `gorm:"type:varchar(200)" json:"name"`
 	Environment string     `gorm:"type:text" json:"environment"`
+	RunStatus   int64      `gorm:"default:0" json:"runStatus"`  // 期望的运行状态, 服务重启后据此恢复
+	Revision    int64      `gorm:"default:0" json:"revision"`   // 最近一次运行的算法版本
+	Risk        string     `gorm:"type:text" json:"risk"`       // 风控限制, json 格式
+	Halted      bool       `gorm:"default:false" json:"halted"` // 被紧急停止, 重新启用前不能运行
 	LastRunAt   time.Time  `json:"lastRunAt"`
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
@@ -21,10 +25,32 @@ type Trader struct {
 
 	Exchanges []Exchange `gorm:"-" json:"exchanges"`
 	Status    int64      `gorm:"-" json:"status"`
+	State     string     `gorm:"-" json:"state"`
 	Pending   int64      `gorm:"-" json:"pending"`
 	Algorithm Algorithm  `gorm:"-" json:"algorithm"`
 }
 
+// ListRunningTrader list traders which should be running
+func ListRunningTrader() (traders []Trader, err error) {
+	err = DB.Where("run_status = ? AND halted = ?", constant.Running, false).Find(&traders).Error
+	return
+}
+
+// SetTraderRunStatus persist the desired run status of the trader
+func SetTraderRunStatus(id, status int64) error {
+	return DB.Model(&Trader{}).Where("id = ?", id).Update("run_status", status).Error
+}
+
+// SetTraderRevision record the algorithm revision the trader runs
+func SetTraderRevision(id, revision int64) error {
+	return DB.Model(&Trader{}).Where("id = ?", id).Update("revision", revision).Error
+}
+
+// SetTraderHalted halt the trader by the kill switch or re-arm it
+func SetTraderHalted(id int64, halted bool) error {
+	return DB.Model(&Trader{}).Where("id = ?", id).Update("halted", halted).Error
+}
+
 // TraderExchange struct
 type TraderExchange struct {
 	ID         int64 `gorm:"primary_key"`
@@ -42,6 +68,7 @@ func (user User) ListTrader(algorithmID int64) (traders []Trader, err error) {
 		= ? AND e.id = r.exchange_id`, t.ID).Scan(&traders[i].Exchanges).Error; err != nil {
 			return
 		}
+		redactExchanges(traders[i].Exchanges)
 	}
 	return
 }
@@ -65,6 +92,7 @@ func (user User) GetTrader(id interface{}) (trader Trader, err error) {
 	}
 	err = DB.Raw(`SELECT e.* FROM exchanges e, trader_exchanges r WHERE r.trader_id
 		= ? AND e.id = r.exchange_id`, trader.ID).Scan(&trader.Exchanges).Error
+	redactExchanges(trader.Exchanges)
 	return
 }
 
@@ -99,6 +127,7 @@ func (user User) UpdateTrader(req Trader) (err error) {
 	}
 	runner.Name = req.Name
 	runner.Environment = req.Environment
+	runner.Risk = req.Risk
 	rs, err := user.GetTraderExchanges(runner.ID)
 	if err != nil {
 		db.Rollback()
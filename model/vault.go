@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/util"
+)
+
+// the master keys of the exchange secrets, base64 of 32 bytes separated by commas or lines,
+// the first key seals the secrets and the others only open the secrets sealed before the rotation
+const (
+	masterKeyEnv  = "QUANTBOT_MASTER_KEY"
+	masterKeyFile = "masterkeyfile"
+	plainSecrets  = "plainsecrets" // 为 true 时允许没有主密钥, 密钥明文保存
+)
+
+var vault struct {
+	sync.RWMutex
+	v *util.Vault
+}
+
+// LoadVault load the master keys from the environment or the key file in config.ini,
+// without any master key it fails unless plainsecrets is enabled in config.ini
+func LoadVault() error {
+	str := os.Getenv(masterKeyEnv)
+	if str == "" {
+		if path := config.String(masterKeyFile); path != "" {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("load master key error, %s", err.Error())
+			}
+			str = string(data)
+		}
+	}
+	var v *util.Vault
+	if strings.TrimSpace(str) != "" {
+		var err error
+		if v, err = util.ParseVault(str); err != nil {
+			return err
+		}
+	} else if strings.EqualFold(config.String(plainSecrets), "true") {
+		log.Printf("no master key in $%s or %s, the exchange secrets are stored in plain text\n", masterKeyEnv, masterKeyFile)
+	} else {
+		return fmt.Errorf("no master key in $%s or %s, set %s = true to store the exchange secrets in plain text",
+			masterKeyEnv, masterKeyFile, plainSecrets)
+	}
+	setVault(v)
+	return nil
+}
+
+// setVault ...
+func setVault(v *util.Vault) {
+	vault.Lock()
+	vault.v = v
+	vault.Unlock()
+}
+
+// getVault ...
+func getVault() *util.Vault {
+	vault.RLock()
+	defer vault.RUnlock()
+	return vault.v
+}
+
+// sealSecret seal the secret with the current master key, the sealed ones kept
+func sealSecret(secret string) (string, error) {
+	v := getVault()
+	if v == nil || secret == "" || util.Sealed(secret) {
+		return secret, nil
+	}
+	return v.Seal(secret)
+}
+
+// OpenSecret open the sealed secret, the plain ones stored before the vault returned as is
+func OpenSecret(secret string) (string, error) {
+	if !util.Sealed(secret) {
+		return secret, nil
+	}
+	v := getVault()
+	if v == nil {
+		return "", fmt.Errorf("open secret error, no master key in $%s or %s", masterKeyEnv, masterKeyFile)
+	}
+	return v.Open(secret)
+}
+
+// RotateSecrets seal the secrets in plain text or sealed by an old key with the current key
+func RotateSecrets() (count int, err error) {
+	v := getVault()
+	if v == nil {
+		return
+	}
+	var exchanges []Exchange
+	if err = DB.Find(&exchanges).Error; err != nil {
+		return
+	}
+	for _, e := range exchanges {
+		if e.SecretKey == "" || util.SealedBy(e.SecretKey) == v.Current() {
+			continue
+		}
+		var plain, sealed string
+		if plain, err = OpenSecret(e.SecretKey); err != nil {
+			return
+		}
+		if sealed, err = v.Seal(plain); err != nil {
+			return
+		}
+		if err = DB.Model(&Exchange{}).Where("id = ?", e.ID).UpdateColumn("secret_key", sealed).Error; err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
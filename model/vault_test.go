@@ -0,0 +1,34 @@
+package model
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/config"
+)
+
+func TestLoadVault(t *testing.T) {
+	t.Setenv(masterKeyEnv, "")
+	defer setVault(nil)
+	load := func(conf string) error {
+		path := filepath.Join(t.TempDir(), "config.ini")
+		if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := config.Init(path); err != nil {
+			t.Fatalf("config: %v", err)
+		}
+		return LoadVault()
+	}
+	if err := load("masterkeyfile = \"\"\nplainsecrets = false\n"); err == nil {
+		t.Fatalf("no master key should fail unless plain secrets are enabled")
+	}
+	if err := load("masterkeyfile = \"\"\nplainsecrets = true\n"); err != nil || getVault() != nil {
+		t.Fatalf("plain secrets: %v", err)
+	}
+	t.Setenv(masterKeyEnv, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	if err := load("plainsecrets = false\n"); err != nil || getVault() == nil {
+		t.Fatalf("master key: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package trader
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread RUSAGE_THREAD of linux
+const rusageThread = 1
+
+// threadCPU cpu time used by the calling thread
+func threadCPU() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// threadID ...
+func threadID() int {
+	return syscall.Gettid()
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package trader
+
+import "time"
+
+var started = time.Now()
+
+// threadCPU no thread cpu clock, the wall time is used instead
+func threadCPU() time.Duration {
+	return time.Since(started)
+}
+
+// threadID the thread is unknown
+func threadID() int {
+	return 0
+}
@@ -1,6 +1,7 @@
 package trader
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/robertkrimen/otto"
@@ -12,7 +13,7 @@ import (
 // Tasks ...
 type Tasks map[string][]task
 
-//js中的一个任务,目的是可以并发工作
+// js中的一个任务,目的是可以并发工作
 type task struct {
 	ctx  *otto.Otto    //js虚拟机
 	fn   otto.Value    //代表该任务的js函数
@@ -23,12 +24,84 @@ type task struct {
 type Global struct {
 	api.Global
 	model.Trader
+	lifecycle
 
 	ctx        *otto.Otto     // js虚拟机
 	es         []api.Exchange // 交易所列表
 	tasks      Tasks          // 任务列表
 	running    bool           // 运行中
 	scriptType string         // 脚本语言
+	recovery   []Recovery     // 服务重启后恢复的订单及持仓
+	watchdog   *watchdog      // 虚拟机资源限制
+	dry        *dryRun        // 保存算法时的试运行
+	oms        []*api.OMS     // 各交易所的订单管理
+}
+
+// Sleep ...
+func (g *Global) Sleep(intervals int64) {
+	if g.dry != nil {
+		g.drySleep()
+		return
+	}
+	if g.watchdog != nil {
+		g.watchdog.touch()
+	}
+	g.Global.Sleep(intervals)
+}
+
+// NewArbitrage watch the symbol on the exchanges of the indexes in Es, all the exchanges without indexes
+func (g *Global) NewArbitrage(symbol string, indexes ...int) (*api.Arbitrage, error) {
+	if len(indexes) == 0 {
+		return api.NewArbitrage(symbol, g.es...), nil
+	}
+	es := []api.Exchange{}
+	for _, i := range indexes {
+		if i < 0 || i >= len(g.es) {
+			return nil, fmt.Errorf("NewArbitrage() error, the error number is invalid exchange index %d", i)
+		}
+		es = append(es, g.es[i])
+	}
+	return api.NewArbitrage(symbol, es...), nil
+}
+
+// DingSend ...
+func (g *Global) DingSend(msg string) error {
+	if g.dry != nil {
+		return nil
+	}
+	return g.Global.DingSend(msg)
+}
+
+// MailSend ...
+func (g *Global) MailSend(msg string) error {
+	if g.dry != nil {
+		return nil
+	}
+	return g.Global.MailSend(msg)
+}
+
+// RegisterPlugin the plugin is not loaded into the server in a dry run
+func (g *Global) RegisterPlugin(pluginName, pluginType string) error {
+	if g.dry != nil {
+		return nil
+	}
+	return g.Global.RegisterPlugin(pluginName, pluginType)
+}
+
+// CallPlugin ...
+func (g *Global) CallPlugin(name string, params map[string]interface{}) (interface{}, error) {
+	if g.dry != nil {
+		return nil, nil
+	}
+	return g.Global.CallPlugin(name, params)
+}
+
+// LogFile ...
+func (g *Global) LogFile(name, strContent string) error {
+	if g.dry != nil {
+		return nil
+	}
+	return g.Global.LogFile(name, strContent)
 }
 
 // AddTask ...
@@ -107,6 +180,21 @@ func (g *Global) ExecTasks(group otto.Value) (results []interface{}) {
 	for i, t := range ts {
 		wg.Add(1)
 		go func(i int, t task) {
+			defer wg.Done()
+			if g.watchdog != nil {
+				// 任务的虚拟机同样受资源限制, 停止时一并中断
+				v := &watchedVM{ctx: t.ctx}
+				g.watchdog.enter(v)
+				defer g.watchdog.leave(v)
+			}
+			defer func() {
+				if err := recover(); err != nil {
+					results[i] = false
+					if err != errHalt && err != errDryRunDone {
+						g.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
+					}
+				}
+			}()
 			if f, err := t.ctx.Get(t.fn.String()); err != nil || !f.IsFunction() {
 				g.Log(constant.ERROR, "", 0.0, 0.0, "Can not get the task function")
 			} else {
@@ -117,7 +205,6 @@ func (g *Global) ExecTasks(group otto.Value) (results []interface{}) {
 					results[i] = result
 				}
 			}
-			wg.Done()
 		}(i, t)
 	}
 	wg.Wait()
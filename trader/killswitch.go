@@ -0,0 +1,117 @@
+package trader
+
+import (
+	"fmt"
+	"strings"
+
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// checkHalted a trader halted by the kill switch can not run until re-armed
+func checkHalted(id int64) error {
+	var trader model.Trader
+	if err := model.DB.First(&trader, id).Error; err != nil {
+		return err
+	}
+	if trader.Halted {
+		return fmt.Errorf("trader is halted by the kill switch, please re-arm it first")
+	}
+	return nil
+}
+
+// KillSwitch halt the order entry of the trader, cancel its open orders on every exchange,
+// flatten the positions if required and stop it, it can not run again until re-armed
+func KillSwitch(id int64, flatten bool, operator string) error {
+	if err := model.SetTraderHalted(id, true); err != nil {
+		return err
+	}
+	t := executor.get(id)
+	running := t != nil && t.state() == StateRunning
+	if t != nil && !running && t.active() {
+		// 启动中的交易员在运行前自行停止
+		stop(id)
+	}
+	if !running {
+		// 交易员未运行, 单独连接交易所撤单, 不加载算法, 不改变运行的版本
+		t = &Global{}
+		t.Global = *(api.NewGlobalStruct(traderOption(id, false, false)))
+		if err := model.DB.First(&t.Trader, id).Error; err != nil {
+			return err
+		}
+		self, err := model.GetUserByID(t.UserID)
+		if err != nil {
+			return err
+		}
+		if err := loadExchanges(t, self, false, false); err != nil {
+			return err
+		}
+		for _, oms := range t.oms {
+			if err := oms.Start(); err != nil {
+				return fmt.Errorf("start exchange %s fail:%s", oms.GetName(), err.Error())
+			}
+		}
+	}
+	t.Log(constant.AUDIT, "", 0.0, 0.0, fmt.Sprintf("kill switch by %s, flatten %v", operator, flatten))
+	for _, oms := range t.oms {
+		oms.SetHalted(true)
+	}
+	var errs []string
+	for _, oms := range t.oms {
+		canceled, err := oms.CancelAll()
+		t.Log(constant.AUDIT, oms.GetStockType(), 0.0, 0.0, fmt.Sprintf("%s canceled %d orders", oms.GetName(), canceled))
+		if err != nil {
+			errs = append(errs, err.Error())
+			t.Log(constant.ERROR, oms.GetStockType(), 0.0, 0.0, err.Error())
+		}
+		if !flatten {
+			continue
+		}
+		closed, err := oms.Flatten()
+		t.Log(constant.AUDIT, oms.GetStockType(), 0.0, 0.0, fmt.Sprintf("%s flattened %d positions", oms.GetName(), closed))
+		if err != nil {
+			errs = append(errs, err.Error())
+			t.Log(constant.ERROR, oms.GetStockType(), 0.0, 0.0, err.Error())
+		}
+	}
+	if running {
+		if err := stop(id); err != nil {
+			t.Log(constant.ERROR, "", 0.0, 0.0, "kill switch stop trader fail:"+err.Error())
+		}
+	}
+	if err := model.SetTraderRunStatus(id, constant.Stop); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// KillAll trigger the kill switch of every running trader
+func KillAll(flatten bool, operator string) error {
+	var errs []string
+	for _, t := range executor.list() {
+		if !t.active() {
+			continue
+		}
+		if err := KillSwitch(t.ID, flatten, operator); err != nil {
+			errs = append(errs, fmt.Sprintf("trader %d: %s", t.ID, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Rearm allow the trader halted by the kill switch to run again
+func Rearm(id int64, operator string) error {
+	if err := model.SetTraderHalted(id, false); err != nil {
+		return err
+	}
+	logger := model.Logger{TraderID: id}
+	logger.Log(constant.AUDIT, "", 0.0, 0.0, fmt.Sprintf("kill switch re-armed by %s", operator))
+	return nil
+}
@@ -0,0 +1,140 @@
+package trader
+
+import (
+	"fmt"
+	"sync"
+
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// trader lifecycle states
+const (
+	StateCreated  = "created"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+	StateFailed   = "failed"
+)
+
+// transitions allowed from every state
+var transitions = map[string][]string{
+	StateCreated:  {StateStarting},
+	StateStarting: {StateRunning, StateStopping, StateFailed},
+	StateRunning:  {StateStopping, StateStopped, StateFailed},
+	StateStopping: {StateStopped, StateFailed},
+	StateStopped:  {StateStarting},
+	StateFailed:   {StateStarting},
+}
+
+// lifecycle state machine of a trader
+type lifecycle struct {
+	mu      sync.RWMutex
+	current string
+}
+
+// state get the current state
+func (l *lifecycle) state() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.current == "" {
+		return StateCreated
+	}
+	return l.current
+}
+
+// transit move to the state if the transition is allowed
+func (l *lifecycle) transit(to string) (from string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	from = l.current
+	if from == "" {
+		from = StateCreated
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			l.current = to
+			return from, nil
+		}
+	}
+	return from, fmt.Errorf("trader can not change from %s to %s", from, to)
+}
+
+// active the trader is starting, running or stopping
+func (l *lifecycle) active() bool {
+	switch l.state() {
+	case StateStarting, StateRunning, StateStopping:
+		return true
+	}
+	return false
+}
+
+// status convert the state to the status shown in dashboard
+func (l *lifecycle) status() int64 {
+	switch l.state() {
+	case StateRunning:
+		return constant.Running
+	case StateStarting, StateStopping:
+		return constant.Pending
+	}
+	return constant.Stop
+}
+
+// transit change the state of the trader and record the event in the log
+func (g *Global) transit(to, msg string) error {
+	from, err := g.lifecycle.transit(to)
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		msg = ", " + msg
+	}
+	g.Log(constant.LIFECYCLE, "", 0.0, 0.0, fmt.Sprintf("%s -> %s%s", from, to, msg))
+	return nil
+}
+
+// registry of the traders, safe for concurrent use
+type registry struct {
+	sync.RWMutex
+	traders map[int64]*Global
+}
+
+// newRegistry ...
+func newRegistry() *registry {
+	return &registry{traders: make(map[int64]*Global)}
+}
+
+// get ...
+func (r *registry) get(id int64) *Global {
+	r.RLock()
+	defer r.RUnlock()
+	return r.traders[id]
+}
+
+// list ...
+func (r *registry) list() []*Global {
+	r.RLock()
+	defer r.RUnlock()
+	traders := make([]*Global, 0, len(r.traders))
+	for _, t := range r.traders {
+		traders = append(traders, t)
+	}
+	return traders
+}
+
+// create register a new trader in starting state, fail if the old one is still active
+func (r *registry) create(id int64, opt constant.Option) (*Global, error) {
+	r.Lock()
+	defer r.Unlock()
+	if t := r.traders[id]; t != nil && t.active() {
+		return nil, fmt.Errorf("trader is %s", t.state())
+	}
+	trader := &Global{}
+	trader.Global = *(api.NewGlobalStruct(opt))
+	if err := trader.transit(StateStarting, ""); err != nil {
+		return nil, err
+	}
+	r.traders[id] = trader
+	return trader, nil
+}
@@ -0,0 +1,38 @@
+package trader
+
+import (
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestLifecycleTransit(t *testing.T) {
+	var l lifecycle
+	if l.state() != StateCreated || l.active() {
+		t.Fatalf("new lifecycle should be created and inactive, got %s", l.state())
+	}
+	steps := []struct {
+		to     string
+		ok     bool
+		status int64
+	}{
+		{StateRunning, false, constant.Stop},
+		{StateStarting, true, constant.Pending},
+		{StateStarting, false, constant.Pending},
+		{StateRunning, true, constant.Running},
+		{StateStopping, true, constant.Pending},
+		{StateRunning, false, constant.Pending},
+		{StateStopped, true, constant.Stop},
+		{StateStarting, true, constant.Pending},
+		{StateFailed, true, constant.Stop},
+	}
+	for i, step := range steps {
+		_, err := l.transit(step.to)
+		if (err == nil) != step.ok {
+			t.Fatalf("step %d to %s: unexpected error %v", i, step.to, err)
+		}
+		if l.status() != step.status {
+			t.Fatalf("step %d to %s: status %d, want %d", i, step.to, l.status(), step.status)
+		}
+	}
+}
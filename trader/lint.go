@@ -0,0 +1,256 @@
+package trader
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// severities of the diagnostics
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic a problem found in the script
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// dry run limits
+const (
+	dryRunTimeout = 2 * time.Second
+	dryRunSleeps  = 3 // main 中的循环运行几轮后结束
+)
+
+var (
+	errDryRunDone  = fmt.Errorf("DRYRUN")
+	errorPosition  = regexp.MustCompile(`<anonymous>:(\d+):(\d+)`)
+	membersOnce    sync.Once
+	globalMembers  map[string]bool
+	exchangeMember map[string]bool
+)
+
+// Lint check the script of the algorithm, the script can not run if any error is found
+func Lint(algorithm model.Algorithm) (diagnostics []Diagnostic) {
+	program, err := parser.ParseFile(nil, "", algorithm.Script, 0)
+	if err != nil {
+		if list, ok := err.(parser.ErrorList); ok {
+			for _, e := range list {
+				diagnostics = append(diagnostics, Diagnostic{
+					Line:     e.Position.Line,
+					Column:   e.Position.Column,
+					Severity: SeverityError,
+					Message:  e.Message,
+				})
+			}
+			return
+		}
+		return []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+	}
+	diagnostics = append(diagnostics, lintMembers(program)...)
+	diagnostics = append(diagnostics, runDry(algorithm)...)
+	return
+}
+
+// HasError ...
+func HasError(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// members collect the names can be called on G and E
+func members() (globals, exchanges map[string]bool) {
+	membersOnce.Do(func() {
+		globalMembers = make(map[string]bool)
+		t := reflect.TypeOf(&Global{})
+		for i := 0; i < t.NumMethod(); i++ {
+			globalMembers[t.Method(i).Name] = true
+		}
+		for _, f := range reflect.VisibleFields(t.Elem()) {
+			if f.IsExported() {
+				globalMembers[f.Name] = true
+			}
+		}
+		exchangeMember = make(map[string]bool)
+		t = reflect.TypeOf((*api.Exchange)(nil)).Elem()
+		for i := 0; i < t.NumMethod(); i++ {
+			exchangeMember[t.Method(i).Name] = true
+		}
+	})
+	return globalMembers, exchangeMember
+}
+
+// memberVisitor find the calls of unknown methods on G and E
+type memberVisitor struct {
+	program     *ast.Program
+	diagnostics []Diagnostic
+}
+
+// Enter ...
+func (v *memberVisitor) Enter(n ast.Node) ast.Visitor {
+	call, ok := n.(*ast.CallExpression)
+	if !ok {
+		return v
+	}
+	dot, ok := call.Callee.(*ast.DotExpression)
+	if !ok {
+		return v
+	}
+	globals, exchanges := members()
+	var known map[string]bool
+	var object string
+	switch left := dot.Left.(type) {
+	case *ast.Identifier:
+		switch left.Name {
+		case "G", "Global":
+			known, object = globals, left.Name
+		case "E", "Exchange":
+			known, object = exchanges, left.Name
+		}
+	case *ast.BracketExpression:
+		if ident, ok := left.Left.(*ast.Identifier); ok && (ident.Name == "Es" || ident.Name == "Exchanges") {
+			known, object = exchanges, ident.Name+"[]"
+		}
+	}
+	if known == nil || known[dot.Identifier.Name] {
+		return v
+	}
+	position := v.program.File.Position(dot.Identifier.Idx)
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Line:     position.Line,
+		Column:   position.Column,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("unknown method %s.%s", object, dot.Identifier.Name),
+	})
+	return v
+}
+
+// Exit ...
+func (v *memberVisitor) Exit(n ast.Node) {}
+
+// lintMembers ...
+func lintMembers(program *ast.Program) []Diagnostic {
+	v := &memberVisitor{program: program}
+	ast.Walk(v, program)
+	return v.diagnostics
+}
+
+// dryRun state of a trader running against the mock exchange
+type dryRun struct {
+	sleeps int32 // 主线程及任务的协程都会调用 Sleep
+}
+
+// drySleep end the dry run after main loops several times
+func (g *Global) drySleep() {
+	if atomic.AddInt32(&g.dry.sleeps, 1) >= dryRunSleeps {
+		g.dryStop()
+	}
+}
+
+// dryStop interrupt main and the vms of ExecTasks, including those started later
+func (g *Global) dryStop() {
+	g.watchdog.interrupt(func() { panic(errDryRunDone) }, true)
+}
+
+// dryExchange ...
+type dryExchange struct {
+	exchange
+	trader *Global
+}
+
+// Sleep ...
+func (e *dryExchange) Sleep(intervals int64) {
+	e.trader.drySleep()
+}
+
+// AutoSleep ...
+func (e *dryExchange) AutoSleep() {
+	e.trader.drySleep()
+}
+
+// runDry run the script for a short time against the mock exchange
+func runDry(algorithm model.Algorithm) (diagnostics []Diagnostic) {
+	opt := constant.Option{Name: "mock", BackTest: true, BackLog: true}
+	trader := &Global{dry: &dryRun{}}
+	trader.Global = *(api.NewGlobalStruct(opt))
+	trader.UserID = algorithm.UserID
+	trader.Algorithm = algorithm
+	trader.tasks = make(Tasks)
+	trader.ctx = otto.New()
+	trader.ctx.Interrupt = make(chan func(), 1)
+	trader.es = []api.Exchange{&dryExchange{exchange: api.NewMockExchange(opt), trader: trader}}
+	// 只用于中断所有的虚拟机, 不启动时间片
+	trader.watchdog = newWatchdog(trader)
+	if err := initializeJs(trader); err != nil {
+		return []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	defer trader.watchdog.stop()
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(dryRunTimeout):
+			trader.dryStop()
+		}
+	}()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil && r != errDryRunDone {
+				err = fmt.Errorf("%s", err2String(r))
+			}
+		}()
+		if _, err = trader.ctx.Run(algorithm.Script); err != nil || algorithm.Library {
+			return
+		}
+		main, err := trader.ctx.Get("main")
+		if err != nil || !main.IsFunction() {
+			diagnostics = append(diagnostics, Diagnostic{
+				Line:     1,
+				Column:   1,
+				Severity: SeverityError,
+				Message:  "can not get the main function",
+			})
+			return nil
+		}
+		_, err = main.Call(main)
+		return
+	}()
+	if err != nil {
+		diagnostics = append(diagnostics, runtimeDiagnostic(err))
+	}
+	return
+}
+
+// runtimeDiagnostic convert the error thrown in dry run
+func runtimeDiagnostic(err error) Diagnostic {
+	d := Diagnostic{Severity: SeverityWarning, Message: "dry run: " + err.Error()}
+	if e, ok := err.(*otto.Error); ok {
+		if m := errorPosition.FindStringSubmatch(e.String()); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Column, _ = strconv.Atoi(m[2])
+		}
+	}
+	return d
+}
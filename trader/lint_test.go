@@ -0,0 +1,113 @@
+package trader
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		script   string
+		line     int
+		severity string
+		message  string
+	}{
+		{"function main() {\n    var a = ;\n}", 2, SeverityError, "Unexpected token"},
+		{"function main() {\n    while (true) {\n        E.GetTickr();\n        G.Sleep(1000);\n    }\n}", 3, SeverityError, "E.GetTickr"},
+		{"function start() {\n}", 1, SeverityError, "main"},
+		{"function main() {\n    var t = E.GetTicker();\n    t.Foo.Bar = 1;\n}", 3, SeverityWarning, "dry run"},
+	}
+	for i, c := range cases {
+		diagnostics := Lint(model.Algorithm{Script: c.script})
+		if len(diagnostics) == 0 {
+			t.Fatalf("case %d: no diagnostic", i)
+		}
+		d := diagnostics[0]
+		if d.Line != c.line || d.Severity != c.severity || !strings.Contains(d.Message, c.message) {
+			t.Fatalf("case %d: unexpected diagnostic %+v", i, d)
+		}
+	}
+
+	script := `function main() {
+    while (true) {
+        var ticker = E.GetTicker();
+        if (ticker[0].Last > 0) {
+            E.Buy("-1", "1", "dry");
+        }
+        G.Sleep(60000);
+    }
+}`
+	if diagnostics := Lint(model.Algorithm{Script: script}); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", diagnostics)
+	}
+}
+
+func TestDryRunSideEffects(t *testing.T) {
+	g := &Global{dry: &dryRun{}}
+	g.Global = *(api.NewGlobalStruct(constant.Option{BackTest: true, BackLog: true}))
+	if err := g.RegisterPlugin("p", "missing"); err != nil {
+		t.Fatalf("the plugin should not be loaded in a dry run: %v", err)
+	}
+	if result, err := g.CallPlugin("p", nil); result != nil || err != nil {
+		t.Fatalf("unexpected plugin call %v %v", result, err)
+	}
+	if err := g.LogFile("/nonexistent/dry.log", "x"); err != nil {
+		t.Fatalf("the file should not be written in a dry run: %v", err)
+	}
+
+	script := `function main() {
+    G.RegisterPlugin("p", "missing");
+    G.CallPlugin("p", {});
+    G.Sleep(1000);
+}`
+	if diagnostics := Lint(model.Algorithm{Script: script}); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", diagnostics)
+	}
+}
+
+func TestDryRunTasks(t *testing.T) {
+	cases := []string{
+		// 任务不调用任何 api, 超时后中断
+		`function spin() {
+    while (true) {}
+}
+function main() {
+    G.AddTask("g", "spin");
+    G.AddTask("g", "spin");
+    G.ExecTasks("g");
+}`,
+		// 任务循环 Sleep, 达到次数后中断
+		`function loop() {
+    while (true) {
+        G.Sleep(1000);
+    }
+}
+function main() {
+    G.AddTask("g", "loop");
+    G.AddTask("g", "loop");
+    G.ExecTasks("g");
+    while (true) {}
+}`,
+	}
+	for i, script := range cases {
+		start := time.Now()
+		done := make(chan []Diagnostic, 1)
+		go func() { done <- Lint(model.Algorithm{Script: script}) }()
+		select {
+		case diagnostics := <-done:
+			if len(diagnostics) != 0 {
+				t.Fatalf("case %d: unexpected diagnostics %+v", i, diagnostics)
+			}
+		case <-time.After(2 * dryRunTimeout):
+			t.Fatalf("case %d: the dry run of the tasks did not end", i)
+		}
+		if elapsed := time.Since(start); elapsed > dryRunTimeout+time.Second {
+			t.Fatalf("case %d: the dry run took %s", i, elapsed)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package trader
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/robertkrimen/otto"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// modules the libraries required by the script of a trader
+type modules struct {
+	sync.Mutex
+	trader  *Global
+	user    *model.User
+	cache   map[*otto.Otto]map[string]otto.Value // 各虚拟机已加载的库, 以 name@version 为键
+	loading map[*otto.Otto][]string              // 各虚拟机加载中的库, 用于检测循环引用
+}
+
+// newModules ...
+func newModules(trader *Global) *modules {
+	return &modules{
+		trader:  trader,
+		cache:   make(map[*otto.Otto]map[string]otto.Value),
+		loading: make(map[*otto.Otto][]string),
+	}
+}
+
+// getUser the owner of the trader, the libraries visible to
+func (m *modules) getUser() (*model.User, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.user == nil {
+		user, err := model.GetUserByID(m.trader.UserID)
+		if err != nil {
+			return nil, err
+		}
+		m.user = &user
+	}
+	return m.user, nil
+}
+
+// enter return the exports cached in the vm, or mark the library loading in it
+func (m *modules) enter(vm *otto.Otto, key string) (otto.Value, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	if exports, ok := m.cache[vm][key]; ok {
+		return exports, true, nil
+	}
+	loading := m.loading[vm]
+	for i, k := range loading {
+		if k == key {
+			chain := append(append([]string{}, loading[i:]...), key)
+			return otto.UndefinedValue(), false, fmt.Errorf("circular require %s", strings.Join(chain, " -> "))
+		}
+	}
+	m.loading[vm] = append(loading, key)
+	return otto.UndefinedValue(), false, nil
+}
+
+// leave cache the exports loaded, the library is no longer loading
+func (m *modules) leave(vm *otto.Otto, key string, exports *otto.Value) {
+	m.Lock()
+	defer m.Unlock()
+	loading := m.loading[vm]
+	m.loading[vm] = loading[:len(loading)-1]
+	if len(m.loading[vm]) == 0 {
+		delete(m.loading, vm)
+	}
+	if exports == nil {
+		return
+	}
+	if m.cache[vm] == nil {
+		m.cache[vm] = make(map[string]otto.Value)
+	}
+	m.cache[vm][key] = *exports
+}
+
+// require load a library algorithm and return its exports
+func (m *modules) require(call otto.FunctionCall) otto.Value {
+	vm := call.Otto
+	spec := call.Argument(0).String()
+	name, version := model.ParseLibrary(spec)
+	if name == "" {
+		panic(vm.MakeCustomError("RequireError", "require() need a library name"))
+	}
+	user, err := m.getUser()
+	if err != nil {
+		panic(vm.MakeCustomError("RequireError", err.Error()))
+	}
+	library, err := user.GetLibrary(name, version)
+	if err != nil {
+		panic(vm.MakeCustomError("RequireError", err.Error()))
+	}
+	key := library.Name
+	if library.Version != "" {
+		key += "@" + library.Version
+	}
+	exports, ok, err := m.enter(vm, key)
+	if err != nil {
+		panic(vm.MakeCustomError("RequireError", err.Error()))
+	}
+	if ok {
+		return exports
+	}
+	var loaded *otto.Value
+	defer func() {
+		m.leave(vm, key, loaded)
+	}()
+
+	wrapper, err := vm.Run("(function(module, exports, require) {\n" + library.Script + "\n})")
+	if err != nil {
+		panic(vm.MakeCustomError("RequireError", key+" "+err.Error()))
+	}
+	module, err := vm.Object("({exports: {}})")
+	if err != nil {
+		panic(vm.MakeCustomError("RequireError", err.Error()))
+	}
+	exports, _ = module.Get("exports")
+	requireFn, _ := vm.ToValue(m.require)
+	if _, err := wrapper.Call(otto.UndefinedValue(), module, exports, requireFn); err != nil {
+		panic(vm.MakeCustomError("RequireError", key+" "+err.Error()))
+	}
+	exports, _ = module.Get("exports")
+	loaded = &exports
+	return exports
+}
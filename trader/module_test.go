@@ -0,0 +1,92 @@
+package trader
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/robertkrimen/otto"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// openTestDB replace the database with an in-memory one until the test ends
+func openTestDB(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	db.AutoMigrate(&model.User{}, &model.Algorithm{})
+	old := model.DB
+	model.DB = db
+	t.Cleanup(func() {
+		model.DB = old
+		db.Close()
+	})
+}
+
+func TestRequire(t *testing.T) {
+	openTestDB(t)
+	user := model.User{Username: "u", Level: 1}
+	model.DB.Create(&user)
+	now := time.Now()
+	for i, lib := range []model.Algorithm{
+		{Name: "util", Version: "1.0", Script: "exports.v = 1;"},
+		{Name: "util", Version: "2.0", Script: "exports.v = 2;"},
+		{Name: "a", Script: "exports.b = require('b');"},
+		{Name: "b", Script: "exports.a = require('a');"},
+		{Name: "main", Script: "exports.v = require('util@1.0').v;"},
+	} {
+		lib.UserID = user.ID
+		lib.Library = true
+		lib.UpdatedAt = now.Add(time.Duration(i) * time.Second)
+		model.DB.Create(&lib)
+	}
+
+	trader := &Global{}
+	trader.UserID = user.ID
+	vm := otto.New()
+	vm.Set("require", newModules(trader).require)
+
+	cases := []struct {
+		script string
+		value  int64
+		err    string
+	}{
+		{"require('util').v", 2, ""},
+		{"require('util@1.0').v", 1, ""},
+		{"require('main').v", 1, ""},
+		{"require('util@3.0')", 0, "can not found the library util@3.0"},
+		{"require('missing')", 0, "can not found the library missing"},
+		{"require('a')", 0, "circular require a -> b -> a"},
+	}
+	for i, c := range cases {
+		value, err := vm.Run(c.script)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("case %d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if v, _ := value.ToInteger(); err != nil || v != c.value {
+			t.Fatalf("case %d: unexpected value %v %v", i, value, err)
+		}
+	}
+
+	// ExecTasks 中的虚拟机并发加载
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(vm *otto.Otto) {
+			defer wg.Done()
+			if value, err := vm.Run("require('util@2.0').v + require('main').v"); err != nil {
+				t.Errorf("concurrent require: %v", err)
+			} else if v, _ := value.ToInteger(); v != 3 {
+				t.Errorf("unexpected value %v", value)
+			}
+		}(vm.Copy())
+	}
+	wg.Wait()
+}
@@ -0,0 +1,334 @@
+package trader
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// portfolioCurrency the key of the reference currency in config.ini
+const portfolioCurrency = "portfoliocurrency"
+
+// portfolioTTL how long a portfolio snapshot is reused by the order checks
+const portfolioTTL = time.Second
+
+func init() {
+	api.SetPortfolioCheck(checkPortfolio)
+}
+
+// PortfolioPosition the position of a trader on a symbol, the amounts in the reference currency
+type PortfolioPosition struct {
+	TraderID      int64   `json:"traderId"`
+	UserID        int64   `json:"userId"`
+	Trader        string  `json:"trader"`
+	ExchangeID    int64   `json:"exchangeId"`
+	Exchange      string  `json:"exchange"`
+	StockType     string  `json:"stockType"`
+	Amount        float64 `json:"amount"`
+	AvgPrice      float64 `json:"avgPrice"`
+	Mark          float64 `json:"mark"`       // 最新价, 计价货币
+	Multiplier    float64 `json:"multiplier"` // 合约乘数, 现货为 1
+	Exposure      float64 `json:"exposure"`
+	UnrealizedPnl float64 `json:"unrealizedPnl"`
+	RealizedPnl   float64 `json:"realizedPnl"`
+}
+
+// PortfolioAccount the positions of all the traders on an exchange account
+type PortfolioAccount struct {
+	ExchangeID    int64                 `json:"exchangeId"`
+	Exchange      string                `json:"exchange"`
+	Exposure      float64               `json:"exposure"`
+	UnrealizedPnl float64               `json:"unrealizedPnl"`
+	RealizedPnl   float64               `json:"realizedPnl"`
+	Limit         constant.AccountLimit `json:"limit"`
+	Unpriced      []string              `json:"unpriced"` // 没有最新价或无法换算成参考货币的品种
+	Breached      string                `json:"breached"` // 超出的限制
+}
+
+// Portfolio the positions, exposures and pnl across all the running traders
+type Portfolio struct {
+	Currency      string              `json:"currency"`
+	Exposure      float64             `json:"exposure"`
+	UnrealizedPnl float64             `json:"unrealizedPnl"`
+	RealizedPnl   float64             `json:"realizedPnl"`
+	Accounts      []PortfolioAccount  `json:"accounts"`
+	Positions     []PortfolioPosition `json:"positions"`
+	Unconverted   []string            `json:"unconverted"` // 无法换算成参考货币的计价货币
+	Time          time.Time           `json:"time"`
+
+	marks  map[string]float64
+	limits map[int64]constant.AccountLimit
+}
+
+var portfolioCache struct {
+	sync.Mutex
+	portfolio Portfolio
+	at        time.Time
+}
+
+// referenceCurrency ...
+func referenceCurrency() string {
+	if currency := config.String(portfolioCurrency); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USDT"
+}
+
+// quoteCurrency the quote currency of the symbol, e.g. USDT of BTC/USDT and BTC/USDT.quarter
+func quoteCurrency(stockType string) string {
+	parts := strings.Split(stockType, "/")
+	return strings.ToUpper(strings.Split(parts[len(parts)-1], ".")[0])
+}
+
+// conversion the rate from the currency to the reference currency by the marks, 0 if unknown
+func conversion(currency, reference string, marks map[string]float64) float64 {
+	if currency == reference {
+		return 1
+	}
+	if rate := marks[currency+"/"+reference]; rate > 0 {
+		return rate
+	}
+	if rate := marks[reference+"/"+currency]; rate > 0 {
+		return 1 / rate
+	}
+	return 0
+}
+
+// aggregate convert the positions to the reference currency and sum them by account
+func aggregate(currency string, positions []PortfolioPosition, marks map[string]float64,
+	limits map[int64]constant.AccountLimit) (portfolio Portfolio) {
+	portfolio.Currency = currency
+	portfolio.Time = time.Now()
+	portfolio.marks, portfolio.limits = marks, limits
+	accounts := make(map[int64]*PortfolioAccount)
+	unconverted := make(map[string]bool)
+	for _, p := range positions {
+		rate := conversion(quoteCurrency(p.StockType), currency, marks)
+		if rate == 0 {
+			unconverted[quoteCurrency(p.StockType)] = true
+		}
+		price := p.Mark
+		if price <= 0 {
+			// 没有最新价时以开仓均价估算敞口
+			price = p.AvgPrice
+		}
+		// 期货的数量为合约张数, 按合约乘数换算
+		size := constant.Instrument{Multiplier: p.Multiplier}.ContractSize()
+		p.Exposure = math.Abs(p.Amount) * price * size * rate
+		if p.Mark > 0 && p.Amount != 0 {
+			p.UnrealizedPnl = p.Amount * (p.Mark - p.AvgPrice) * size * rate
+		}
+		p.RealizedPnl *= rate
+		account := accounts[p.ExchangeID]
+		if account == nil {
+			account = &PortfolioAccount{ExchangeID: p.ExchangeID, Exchange: p.Exchange, Limit: limits[p.ExchangeID]}
+			accounts[p.ExchangeID] = account
+		}
+		if p.Amount != 0 && (p.Mark <= 0 || rate == 0) {
+			account.Unpriced = append(account.Unpriced, p.StockType)
+		}
+		account.Exposure += p.Exposure
+		account.UnrealizedPnl += p.UnrealizedPnl
+		account.RealizedPnl += p.RealizedPnl
+		portfolio.Exposure += p.Exposure
+		portfolio.UnrealizedPnl += p.UnrealizedPnl
+		portfolio.RealizedPnl += p.RealizedPnl
+		portfolio.Positions = append(portfolio.Positions, p)
+	}
+	for _, account := range accounts {
+		account.Breached = account.breached()
+		portfolio.Accounts = append(portfolio.Accounts, *account)
+	}
+	sort.Slice(portfolio.Accounts, func(i, j int) bool {
+		return portfolio.Accounts[i].ExchangeID < portfolio.Accounts[j].ExchangeID
+	})
+	for c := range unconverted {
+		portfolio.Unconverted = append(portfolio.Unconverted, c)
+	}
+	sort.Strings(portfolio.Unconverted)
+	return
+}
+
+// breached the limit the account exceeds, empty if none
+func (a PortfolioAccount) breached() string {
+	switch {
+	case a.Limit.MaxExposure > 0 && a.Exposure > a.Limit.MaxExposure:
+		return fmt.Sprintf("exposure %v exceeds the max exposure %v", a.Exposure, a.Limit.MaxExposure)
+	case a.Limit.MaxUnrealizedLoss > 0 && -a.UnrealizedPnl >= a.Limit.MaxUnrealizedLoss:
+		return fmt.Sprintf("unrealized loss %v reaches the max unrealized loss %v", -a.UnrealizedPnl, a.Limit.MaxUnrealizedLoss)
+	case a.Limit != (constant.AccountLimit{}) && len(a.Unpriced) > 0:
+		return fmt.Sprintf("positions %s can not be priced", strings.Join(a.Unpriced, ","))
+	}
+	return ""
+}
+
+// collect the ledgers and marks of the running traders
+func collect() (positions []PortfolioPosition, marks map[string]float64, limits map[int64]constant.AccountLimit, err error) {
+	marks = make(map[string]float64)
+	limits = make(map[int64]constant.AccountLimit)
+	var ids []int64
+	for _, t := range executor.list() {
+		if t.state() != StateRunning || len(t.oms) == 0 {
+			continue
+		}
+		traderMarks := make([]map[string]float64, len(t.oms))
+		for i, oms := range t.oms {
+			traderMarks[i] = oms.Marks()
+			for symbol, price := range traderMarks[i] {
+				marks[symbol] = price
+			}
+			ids = append(ids, oms.GetOption().ExchangeID)
+		}
+		ledgers, err := model.ListTraderLedger(t.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, ledger := range ledgers {
+			if ledger.Amount == 0 && ledger.RealizedPnl == 0 {
+				continue
+			}
+			// 账本按交易员, 交易所及品种记录, 交易所已移除的账本没有最新价
+			position := PortfolioPosition{
+				TraderID:    t.ID,
+				UserID:      t.UserID,
+				Trader:      t.Name,
+				ExchangeID:  ledger.ExchangeID,
+				StockType:   ledger.StockType,
+				Amount:      ledger.Amount,
+				AvgPrice:    ledger.AvgPrice,
+				RealizedPnl: ledger.RealizedPnl,
+			}
+			for i := range t.oms {
+				if opt := t.oms[i].GetOption(); opt.ExchangeID == ledger.ExchangeID {
+					position.Exchange = opt.Name
+					position.Mark = traderMarks[i][ledger.StockType]
+					position.Multiplier = t.oms[i].GetInstrument(ledger.StockType).ContractSize()
+					break
+				}
+			}
+			positions = append(positions, position)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	var exchanges []model.Exchange
+	if err = model.DB.Where("id in (?)", ids).Find(&exchanges).Error; err != nil {
+		return
+	}
+	for _, e := range exchanges {
+		if limit, err := api.ParseAccountLimit(e.Limit); err == nil {
+			limits[e.ID] = limit
+		}
+	}
+	return
+}
+
+// snapshot the portfolio of all the running traders, cached for a short while
+func snapshot() (Portfolio, error) {
+	portfolioCache.Lock()
+	defer portfolioCache.Unlock()
+	if time.Since(portfolioCache.at) < portfolioTTL {
+		return portfolioCache.portfolio, nil
+	}
+	positions, marks, limits, err := collect()
+	if err != nil {
+		return Portfolio{}, err
+	}
+	portfolioCache.portfolio = aggregate(referenceCurrency(), positions, marks, limits)
+	portfolioCache.at = time.Now()
+	return portfolioCache.portfolio, nil
+}
+
+// GetPortfolio the portfolio of the traders of the user, all the traders for the administrator
+func GetPortfolio(user model.User) (Portfolio, error) {
+	portfolio, err := snapshot()
+	if err != nil || user.Level >= constant.AdminLevel {
+		return portfolio, err
+	}
+	var positions []PortfolioPosition
+	for _, p := range portfolio.Positions {
+		if p.UserID == user.ID {
+			positions = append(positions, p)
+		}
+	}
+	accounts := make(map[int64]bool)
+	for _, p := range positions {
+		accounts[p.ExchangeID] = true
+	}
+	var own []PortfolioAccount
+	for _, a := range portfolio.Accounts {
+		if accounts[a.ExchangeID] {
+			own = append(own, a)
+		}
+	}
+	portfolio.Positions, portfolio.Accounts = positions, own
+	return portfolio, nil
+}
+
+// checkPortfolio reject the orders increasing the position of an account breaching its limits
+func checkPortfolio(opt constant.Option, stockType string, req constant.OrderRequest, price, size float64) error {
+	if opt.ExchangeID == 0 || opt.BackTest {
+		return nil
+	}
+	portfolio, err := snapshot()
+	if err != nil {
+		return fmt.Errorf("can not get the portfolio to check the order: %s", err.Error())
+	}
+	account := PortfolioAccount{ExchangeID: opt.ExchangeID, Exchange: opt.Name, Limit: portfolio.limits[opt.ExchangeID]}
+	for _, a := range portfolio.Accounts {
+		if a.ExchangeID == opt.ExchangeID {
+			account = a
+		}
+	}
+	if account.Limit == (constant.AccountLimit{}) {
+		return nil
+	}
+	qty := req.Amount
+	if req.Side == constant.TradeTypeSell {
+		qty = -qty
+	}
+	mark := 0.0
+	for _, p := range portfolio.Positions {
+		if p.ExchangeID != opt.ExchangeID || p.StockType != stockType {
+			continue
+		}
+		// 减仓不受限制
+		if p.TraderID == opt.TraderID && p.Amount*qty < 0 && math.Abs(qty) <= math.Abs(p.Amount) {
+			return nil
+		}
+		if p.Mark > 0 {
+			mark = p.Mark
+		}
+	}
+	if len(account.Unpriced) > 0 {
+		return fmt.Errorf("account %s can not price the positions %s", account.Exchange, strings.Join(account.Unpriced, ","))
+	}
+	if account.Limit.MaxUnrealizedLoss > 0 && -account.UnrealizedPnl >= account.Limit.MaxUnrealizedLoss {
+		return fmt.Errorf("account %s unrealized loss %v reaches the max unrealized loss %v",
+			account.Exchange, -account.UnrealizedPnl, account.Limit.MaxUnrealizedLoss)
+	}
+	if account.Limit.MaxExposure > 0 {
+		if price <= 0 {
+			price = mark
+		}
+		rate := conversion(quoteCurrency(stockType), portfolio.Currency, portfolio.marks)
+		if price <= 0 || rate == 0 {
+			return fmt.Errorf("account %s can not price the order of %s", account.Exchange, stockType)
+		}
+		exposure := account.Exposure + req.Amount*price*size*rate
+		if exposure > account.Limit.MaxExposure {
+			return fmt.Errorf("account %s exposure %v after the order exceeds the max exposure %v",
+				account.Exchange, exposure, account.Limit.MaxExposure)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package trader
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+func TestAggregate(t *testing.T) {
+	marks := map[string]float64{"BTC/USDT": 110, "ETH/BTC": 0.05, "USDT/JPY": 100}
+	positions := []PortfolioPosition{
+		{TraderID: 1, ExchangeID: 1, StockType: "BTC/USDT", Amount: 2, AvgPrice: 100, Mark: 110, RealizedPnl: 5},
+		{TraderID: 2, ExchangeID: 1, StockType: "ETH/BTC", Amount: -10, AvgPrice: 0.04, Mark: 0.05},
+		{TraderID: 3, ExchangeID: 2, StockType: "BTC/JPY", Amount: 1, AvgPrice: 11000, Mark: 12000},
+		{TraderID: 3, ExchangeID: 2, StockType: "BTC/EUR", Amount: 1, Mark: 100},
+	}
+	limits := map[int64]constant.AccountLimit{1: {MaxExposure: 250}}
+	p := aggregate("USDT", positions, marks, limits)
+	if len(p.Accounts) != 2 || len(p.Positions) != 4 {
+		t.Fatalf("unexpected portfolio %+v", p)
+	}
+	// BTC/USDT 2*110, ETH/BTC 10*0.05*110
+	a := p.Accounts[0]
+	if a.Exposure != 275 || math.Abs(a.UnrealizedPnl-9) > 1e-9 || a.RealizedPnl != 5 || a.Breached == "" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+	if b := p.Accounts[1]; b.Exposure != 120 || b.UnrealizedPnl != 10 || b.Breached != "" {
+		t.Fatalf("unexpected account %+v", b)
+	}
+	if b := p.Accounts[1]; len(b.Unpriced) != 1 || b.Unpriced[0] != "BTC/EUR" {
+		t.Fatalf("unexpected unpriced %v", b.Unpriced)
+	}
+	if len(p.Unconverted) != 1 || p.Unconverted[0] != "EUR" {
+		t.Fatalf("unexpected unconverted %v", p.Unconverted)
+	}
+}
+
+func TestAggregateContracts(t *testing.T) {
+	marks := map[string]float64{"BTC/USDT": 110, "BTC/USDT.quarter": 110}
+	positions := []PortfolioPosition{
+		{TraderID: 1, ExchangeID: 1, StockType: "BTC/USDT.quarter", Amount: -3, AvgPrice: 100, Mark: 110, Multiplier: 0.01},
+		{TraderID: 1, ExchangeID: 1, StockType: "BTC/USDT", Amount: 1, AvgPrice: 100, Mark: 110},
+	}
+	limits := map[int64]constant.AccountLimit{1: {MaxExposure: 200}}
+	p := aggregate("USDT", positions, marks, limits)
+	// 3 张合约 3*0.01*110, 现货 1*110
+	if a := p.Accounts[0]; math.Abs(a.Exposure-113.3) > 1e-9 || math.Abs(a.UnrealizedPnl-9.7) > 1e-9 || a.Breached != "" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+
+	portfolioCache.Lock()
+	portfolioCache.portfolio = p
+	portfolioCache.at = time.Now()
+	portfolioCache.Unlock()
+	defer func() {
+		portfolioCache.Lock()
+		portfolioCache.at = time.Time{}
+		portfolioCache.Unlock()
+	}()
+	sell := constant.OrderRequest{Side: constant.TradeTypeSell, Amount: 1}
+	if err := checkPortfolio(constant.Option{TraderID: 1, ExchangeID: 1}, "BTC/USDT.quarter", sell, 110, 0.01); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	// 1 张合约 1*100*110 超出限制
+	if err := checkPortfolio(constant.Option{TraderID: 1, ExchangeID: 1}, "BTC/USDT.quarter", sell, 110, 100); err == nil {
+		t.Fatalf("the exposure of the contracts should count the multiplier")
+	}
+}
+
+func TestCheckPortfolio(t *testing.T) {
+	marks := map[string]float64{"BTC/USDT": 110}
+	positions := []PortfolioPosition{
+		{TraderID: 1, ExchangeID: 1, StockType: "BTC/USDT", Amount: 2, AvgPrice: 100, Mark: 110},
+		{TraderID: 2, ExchangeID: 2, StockType: "BTC/USDT", Amount: 5, AvgPrice: 100, Mark: 110},
+		{TraderID: 3, ExchangeID: 3, StockType: "ETH/EUR", Amount: 1, AvgPrice: 100},
+	}
+	limits := map[int64]constant.AccountLimit{2: {MaxExposure: 600}, 3: {MaxExposure: 1000}}
+	portfolioCache.Lock()
+	portfolioCache.portfolio = aggregate("USDT", positions, marks, limits)
+	portfolioCache.at = time.Now()
+	portfolioCache.Unlock()
+	defer func() {
+		portfolioCache.Lock()
+		portfolioCache.at = time.Time{}
+		portfolioCache.Unlock()
+	}()
+
+	sell := constant.OrderRequest{Side: constant.TradeTypeSell, Amount: 2}
+	cases := []struct {
+		opt   constant.Option
+		req   constant.OrderRequest
+		price float64
+		ok    bool
+	}{
+		{constant.Option{TraderID: 2, ExchangeID: 2}, sell, 110, true},
+		// 其他交易所的持仓不能抵消本交易所的敞口
+		{constant.Option{TraderID: 1, ExchangeID: 2}, sell, 110, false},
+		{constant.Option{TraderID: 1, ExchangeID: 2}, constant.OrderRequest{Side: constant.TradeTypeBuy, Amount: 0.1}, 0, true},
+		{constant.Option{TraderID: 1, ExchangeID: 4}, constant.OrderRequest{Side: constant.TradeTypeBuy, Amount: 0.1}, 0, true},
+		// 持仓没有最新价或无法换算时拒绝
+		{constant.Option{TraderID: 3, ExchangeID: 3}, constant.OrderRequest{Side: constant.TradeTypeBuy, Amount: 0.1}, 100, false},
+	}
+	for i, c := range cases {
+		if err := checkPortfolio(c.opt, "BTC/USDT", c.req, c.price, 1); (err == nil) != c.ok {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+	}
+	limits[4] = constant.AccountLimit{MaxExposure: 1000}
+	if err := checkPortfolio(constant.Option{TraderID: 1, ExchangeID: 4}, "BTC/EUR",
+		constant.OrderRequest{Side: constant.TradeTypeBuy, Amount: 0.1}, 100, 1); err == nil {
+		t.Fatalf("the order which can not be converted should be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// Recovery open orders and positions of an exchange found when the trader is restored
+type Recovery struct {
+	Index     int
+	Name      string
+	Orders    []constant.Order
+	Positions []constant.Position
+}
+
+// Restore relaunch the traders which were running before the server restarted
+func Restore() error {
+	traders, err := model.ListRunningTrader()
+	if err != nil {
+		return err
+	}
+	for _, t := range traders {
+		if err := restore(t.ID); err != nil {
+			log.Printf("restore trader %d fail:%s\n", t.ID, err.Error())
+			if err := model.SetTraderRunStatus(t.ID, constant.Stop); err != nil {
+				log.Printf("reset trader %d status fail:%s\n", t.ID, err.Error())
+			}
+			continue
+		}
+		log.Printf("restore trader %d success\n", t.ID)
+	}
+	return nil
+}
+
+// restore ...
+func restore(id int64) (err error) {
+	if err = checkHalted(id); err != nil {
+		return
+	}
+	trader, err := executor.create(id, traderOption(id, false, false))
+	if err != nil {
+		return
+	}
+	if err = initialize(trader, id, false, false); err != nil {
+		trader.transit(StateFailed, err.Error())
+		return
+	}
+	trader.Log(constant.RECOVER, "", 0.0, 0.0, "trader restore after server restart")
+	if err = reconcile(trader); err != nil {
+		trader.Log(constant.ERROR, "", 0.0, 0.0, "trader restore fail:"+err.Error())
+		trader.transit(StateFailed, err.Error())
+		return
+	}
+	if err = runJs(trader); err != nil {
+		trader.transit(StateFailed, err.Error())
+	}
+	return
+}
+
+// reconcile fetch the open orders and positions from every exchange before main is called
+func reconcile(trader *Global) error {
+	trader.recovery = nil
+	for i, e := range trader.es {
+		if err := e.Start(); err != nil {
+			return fmt.Errorf("start exchange %s fail:%s", e.GetName(), err.Error())
+		}
+		recovery := Recovery{Index: i, Name: e.GetName()}
+		orders, err := e.GetOrders()
+		if err != nil {
+			trader.Log(constant.RECOVER, e.GetStockType(), 0.0, 0.0,
+				fmt.Sprintf("%s GetOrders() fail:%s", e.GetName(), err.Error()))
+		}
+		for _, order := range orders {
+			trader.Log(constant.RECOVER, order.StockType, order.Price, order.Amount-order.DealAmount,
+				fmt.Sprintf("%s open order %s %s", e.GetName(), order.Id, order.TradeType))
+		}
+		recovery.Orders = orders
+		positions, err := e.GetPosition()
+		if err != nil {
+			trader.Log(constant.RECOVER, e.GetStockType(), 0.0, 0.0,
+				fmt.Sprintf("%s GetPosition() fail:%s", e.GetName(), err.Error()))
+		}
+		for _, position := range positions {
+			trader.Log(constant.RECOVER, position.StockType, position.Price, position.Amount,
+				fmt.Sprintf("%s position %s", e.GetName(), position.TradeType))
+		}
+		recovery.Positions = positions
+		trader.recovery = append(trader.recovery, recovery)
+	}
+	return nil
+}
+
+// GetRecovery get the orders and positions found when the trader is restored, nil if started normally
+func (g *Global) GetRecovery() []Recovery {
+	return g.recovery
+}
@@ -0,0 +1,255 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+// scenarioTimeout max time a scenario runs
+const scenarioTimeout = 5 * time.Second
+
+var errScenarioDone = fmt.Errorf("SCENARIO")
+
+// Scenario a test case of the strategy running against the mock exchange
+type Scenario struct {
+	Name      string              `json:"name"`
+	StockType string              `json:"stockType"`
+	Balances  map[string]float64  `json:"balances"`
+	Positions []constant.Position `json:"positions"`
+	FillRatio *float64            `json:"fillRatio"` // 每次撮合成交的比例, 默认全部成交
+	Tickers   []constant.Ticker   `json:"tickers"`   // 脚本每 Sleep 一次推进一个行情, 用完后结束
+	Depths    []constant.Depth    `json:"depths"`    // 与 Tickers 一一对应, 可选
+	Expect    ScenarioExpect      `json:"expect"`
+}
+
+// ScenarioExpect the assertions of a scenario
+type ScenarioExpect struct {
+	Orders     []ExpectOrder      `json:"orders"`     // 依次与下单记录比较
+	OrderCount *int               `json:"orderCount"` // 下单总数
+	Logs       []string           `json:"logs"`       // 日志中需要出现的内容
+	Messages   []string           `json:"messages"`   // ding 及邮件中需要出现的内容
+	Error      string             `json:"error"`      // 期望脚本抛出的错误
+	Balances   map[string]float64 `json:"balances"`   // 运行结束后的账户余额
+}
+
+// ExpectOrder an expected order, the empty fields are not checked
+type ExpectOrder struct {
+	TradeType string  `json:"tradeType"`
+	Price     float64 `json:"price"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"` // UNFINISH, PART_FINISH, FINISH, CANCEL ...
+}
+
+// ScenarioResult ...
+type ScenarioResult struct {
+	Name     string             `json:"name"`
+	Passed   bool               `json:"passed"`
+	Failures []string           `json:"failures"`
+	Error    string             `json:"error"`
+	Orders   []constant.Order   `json:"orders"`
+	Logs     []api.MockLog      `json:"logs"`
+	Messages []string           `json:"messages"`
+	Balances map[string]float64 `json:"balances"`
+}
+
+// LoadScenarios parse a scenario or a list of scenarios from json
+func LoadScenarios(data []byte) (scenarios []Scenario, err error) {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var scenario Scenario
+		err = json.Unmarshal(data, &scenario)
+		return []Scenario{scenario}, err
+	}
+	err = json.Unmarshal(data, &scenarios)
+	return
+}
+
+// LoadScenarioFile ...
+func LoadScenarioFile(path string) ([]Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadScenarios(data)
+}
+
+// RunScenarios ...
+func RunScenarios(algorithm model.Algorithm, scenarios []Scenario) (results []ScenarioResult) {
+	for _, scenario := range scenarios {
+		results = append(results, RunScenario(algorithm, scenario))
+	}
+	return
+}
+
+// RunScenario run the strategy against the mock exchange and check the expectations
+func RunScenario(algorithm model.Algorithm, scenario Scenario) (result ScenarioResult) {
+	result.Name = scenario.Name
+	global := api.NewMockGlobal()
+	exchange := api.NewMockExchange(constant.Option{Name: "mock", Type: "Mock", BackTest: true, BackLog: true})
+	if scenario.StockType != "" {
+		exchange.SetStockType(scenario.StockType)
+	}
+	if scenario.Balances != nil {
+		account := constant.Account{SubAccounts: make(map[string]constant.SubAccount)}
+		for currency, amount := range scenario.Balances {
+			account.SubAccounts[currency] = constant.SubAccount{StockType: currency, Amount: amount}
+		}
+		exchange.SetAccount(account)
+	}
+	exchange.SetPositions(scenario.Positions)
+	if scenario.FillRatio != nil {
+		exchange.SetFillRatio(*scenario.FillRatio)
+	}
+
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+	step := -1
+	advance := func() {
+		step++
+		if step >= len(scenario.Tickers) {
+			stopVM(vm, errScenarioDone)
+			return
+		}
+		if step < len(scenario.Depths) {
+			exchange.SetDepth(scenario.Depths[step])
+		}
+		exchange.SetTicker(scenario.Tickers[step])
+	}
+	advance()
+	global.SetSleepHook(advance)
+	exchange.SetSleepHook(advance)
+
+	owner := &Global{}
+	owner.UserID = algorithm.UserID
+	es := []api.Exchange{exchange}
+	for name, value := range map[string]interface{}{
+		"G": global, "Global": global,
+		"E": exchange, "Exchange": exchange,
+		"Es": es, "Exchanges": es,
+		"require": newModules(owner).require,
+	} {
+		if err := vm.Set(name, value); err != nil {
+			result.Error = err.Error()
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(scenarioTimeout):
+			stopVM(vm, fmt.Errorf("scenario timeout after %s", scenarioTimeout))
+		}
+	}()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil && r != errScenarioDone {
+				err = fmt.Errorf("%s", err2String(r))
+			}
+		}()
+		if _, err = vm.Run(algorithm.Script); err != nil {
+			return
+		}
+		main, err := vm.Get("main")
+		if err != nil || !main.IsFunction() {
+			return fmt.Errorf("can not get the main function")
+		}
+		_, err = main.Call(main)
+		return
+	}()
+	close(done)
+
+	result.Orders = exchange.Orders()
+	result.Logs = append(global.Logs(), exchange.Logs()...)
+	result.Messages = global.Messages()
+	if account, err := exchange.GetAccount(); err == nil {
+		result.Balances = make(map[string]float64)
+		for currency, sub := range account.SubAccounts {
+			result.Balances[currency] = sub.Amount
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Failures = scenario.Expect.check(result)
+	result.Passed = len(result.Failures) == 0
+	return
+}
+
+// check compare the result with the expectations
+func (expect ScenarioExpect) check(result ScenarioResult) (failures []string) {
+	switch {
+	case expect.Error == "" && result.Error != "":
+		failures = append(failures, "script error: "+result.Error)
+	case expect.Error != "" && !strings.Contains(result.Error, expect.Error):
+		failures = append(failures, fmt.Sprintf("expect error %q, got %q", expect.Error, result.Error))
+	}
+	if expect.OrderCount != nil && *expect.OrderCount != len(result.Orders) {
+		failures = append(failures, fmt.Sprintf("expect %d orders, got %d", *expect.OrderCount, len(result.Orders)))
+	}
+	for i, e := range expect.Orders {
+		if i >= len(result.Orders) {
+			failures = append(failures, fmt.Sprintf("order %d: expect %+v, not placed", i, e))
+			continue
+		}
+		o := result.Orders[i]
+		if e.TradeType != "" && e.TradeType != o.TradeType ||
+			e.Price != 0 && e.Price != o.Price ||
+			e.Amount != 0 && e.Amount != o.Amount ||
+			e.Status != "" && e.Status != o.Status.String() {
+			failures = append(failures, fmt.Sprintf("order %d: expect %+v, got %s %v@%v %s",
+				i, e, o.TradeType, o.Amount, o.Price, o.Status))
+		}
+	}
+	for _, text := range expect.Logs {
+		found := false
+		for _, l := range result.Logs {
+			if strings.Contains(l.Message, text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("expect log %q", text))
+		}
+	}
+	for currency, amount := range expect.Balances {
+		if got, ok := result.Balances[currency]; !ok || math.Abs(got-amount) > 1e-8 {
+			failures = append(failures, fmt.Sprintf("expect %s balance %v, got %v", currency, amount, got))
+		}
+	}
+	for _, text := range expect.Messages {
+		found := false
+		for _, m := range result.Messages {
+			if strings.Contains(m, text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("expect message %q", text))
+		}
+	}
+	return
+}
+
+// stopVM replace the pending interrupt with a panic of reason
+func stopVM(vm *otto.Otto, reason error) {
+	select {
+	case <-vm.Interrupt:
+	default:
+	}
+	select {
+	case vm.Interrupt <- func() { panic(reason) }:
+	default:
+	}
+}
@@ -0,0 +1,43 @@
+package trader
+
+import (
+	"testing"
+
+	"snack.com/xiyanxiyan10/stocktrader/model"
+)
+
+const breakout = `function main() {
+    var base = E.GetTicker()[0].Last;
+    var holding = false;
+    while (true) {
+        var ticker = E.GetTicker()[0];
+        if (!holding && ticker.Last > base * 1.05) {
+            G.Log("INFO", "", 0, 0, "breakout at " + ticker.Last);
+            E.Buy(String(ticker.Sell), "1", "breakout");
+            holding = true;
+            base = ticker.Last;
+        } else if (holding && ticker.Last > base * 1.04) {
+            G.Log("INFO", "", 0, 0, "take profit at " + ticker.Last);
+            E.Sell(String(ticker.Buy), "1", "take profit");
+            holding = false;
+        }
+        G.Sleep(1000);
+    }
+}`
+
+func TestRunScenario(t *testing.T) {
+	scenarios, err := LoadScenarioFile("testdata/breakout.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range RunScenarios(model.Algorithm{Script: breakout}, scenarios) {
+		if !result.Passed {
+			t.Errorf("%s: %v", result.Name, result.Failures)
+		}
+	}
+
+	scenarios[1].Expect.Logs = []string{"breakout"}
+	if result := RunScenario(model.Algorithm{Script: breakout}, scenarios[1]); result.Passed {
+		t.Errorf("%s: missing log should fail", result.Name)
+	}
+}
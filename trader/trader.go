@@ -7,28 +7,37 @@ import (
 
 	"github.com/robertkrimen/otto"
 	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/config"
 	"snack.com/xiyanxiyan10/stocktrader/constant"
 	"snack.com/xiyanxiyan10/stocktrader/model"
+	"snack.com/xiyanxiyan10/stocktrader/util"
 )
 
+// omsReconcile the key in config.ini of the seconds between the reconciliations of the open orders
+const omsReconcile = "omsreconcile"
+
 // Trader Variable
 var (
-	Executor = make(map[int64]*Global)
+	executor = newRegistry()
 	errHalt  = fmt.Errorf("HALT")
 )
 
 // GetTraderStatus ...
 func GetTraderStatus(id int64) (status int64) {
-	if t, ok := Executor[id]; ok && t != nil {
-		status = t.Status
-		// show pending in status
-		if t.Pending == constant.Enable {
-			status = constant.Pending
-		}
+	if t := executor.get(id); t != nil {
+		status = t.status()
 	}
 	return
 }
 
+// GetTraderState get the lifecycle state of the trader
+func GetTraderState(id int64) string {
+	if t := executor.get(id); t != nil {
+		return t.state()
+	}
+	return StateStopped
+}
+
 // GetTraderLogStatus ...
 func GetTraderLogStatus(id int64) (status string) {
 	return ""
@@ -69,14 +78,15 @@ func initializeJs(trader *Global) (err error) {
 		err = localErr
 		return
 	}
+	if localErr := trader.ctx.Set("require", newModules(trader).require); localErr != nil {
+		err = localErr
+		return
+	}
 	return
 }
 
-//initialize
-func initialize(id int64, backlog, backtest bool) (trader Global, err error) {
-	if t := Executor[id]; t != nil && t.Status > 0 {
-		return
-	}
+// initialize load the trader from database into the created one
+func initialize(trader *Global, id int64, backlog, backtest bool) (err error) {
 	err = model.DB.First(&trader.Trader, id).Error
 	if err != nil {
 		return
@@ -93,35 +103,65 @@ func initialize(id int64, backlog, backtest bool) (trader Global, err error) {
 	if err != nil {
 		return
 	}
-	es, err := self.GetTraderExchanges(trader.ID)
+	if trader.Algorithm.Library {
+		err = fmt.Errorf("library algorithm can only be required")
+		return
+	}
+	revision, err := model.GetLatestRevision(trader.AlgorithmID)
 	if err != nil {
+		// 版本记录之前保存的算法
+		if revision, err = model.AddRevision(model.DB, trader.Algorithm, self, "initial revision"); err != nil {
+			return
+		}
+	}
+	trader.Algorithm.Script = revision.Script
+	trader.Revision = revision.Revision
+	if err = model.SetTraderRevision(trader.ID, revision.Revision); err != nil {
 		return
 	}
-
-	var opt constant.Option
-	opt.BackLog = backlog
-	opt.BackTest = backtest
-	opt.TraderID = id
-
-	trader.Global = *(api.NewGlobalStruct(opt))
+	trader.Log(constant.INFO, "", 0.0, 0.0, fmt.Sprintf("run algorithm %s revision %d", trader.Algorithm.Name, revision.Revision))
 	trader.scriptType = trader.Algorithm.Type
 	trader.tasks = make(Tasks)
 	trader.ctx = otto.New()
 	trader.ctx.Interrupt = make(chan func(), 1)
+	return loadExchanges(trader, self, backlog, backtest)
+}
+
+// loadExchanges connect the exchanges of the trader, each wrapped by an OMS with the risk limits of the trader
+func loadExchanges(trader *Global, self model.User, backlog, backtest bool) (err error) {
+	es, err := self.GetTraderExchanges(trader.ID)
+	if err != nil {
+		return
+	}
+
+	risk, err := api.ParseRiskLimit(trader.Risk)
+	if err != nil {
+		return
+	}
 
 	for i, e := range es {
+		// 密钥只在这里解密, 不保存在 model 中
+		secretKey, errS := model.OpenSecret(e.SecretKey)
+		if errS != nil {
+			err = fmt.Errorf("exchange %s: %s", e.Name, errS.Error())
+			return
+		}
 		opt := constant.Option{
-			Index:     i,
-			TraderID:  trader.ID,
-			Type:      e.Type,
-			Name:      e.Name,
-			AccessKey: e.AccessKey,
-			SecretKey: e.SecretKey,
-			BackLog:   backlog,
-			BackTest:  backtest,
+			Index:      i,
+			TraderID:   trader.ID,
+			ExchangeID: e.ExchangeID,
+			Type:       e.Type,
+			Name:       e.Name,
+			AccessKey:  e.AccessKey,
+			SecretKey:  secretKey,
+			BackLog:    backlog,
+			BackTest:   backtest,
 		}
-		if exchange, errD := api.GetExchange(opt); errD != nil {
-			trader.es = append(trader.es, exchange)
+		if exchange, errD := api.GetExchange(opt); errD == nil {
+			oms := api.NewOMS(exchange, opt)
+			oms.SetRiskLimit(risk)
+			trader.oms = append(trader.oms, oms)
+			trader.es = append(trader.es, oms)
 		} else {
 			fmt.Printf("make exchange fail:%s\n", errD.Error())
 		}
@@ -148,49 +188,102 @@ func err2String(err interface{}) string {
 	}
 }
 
+// traderOption ...
+func traderOption(id int64, backlog, backtest bool) constant.Option {
+	var opt constant.Option
+	opt.BackLog = backlog
+	opt.BackTest = backtest
+	opt.TraderID = id
+	return opt
+}
+
 // run ...
 func run(id int64) (err error) {
-	trader, err := initialize(id, false, false)
+	if err = checkHalted(id); err != nil {
+		return
+	}
+	trader, err := executor.create(id, traderOption(id, false, false))
 	if err != nil {
 		return
 	}
-	return runJs(trader, id)
+	if err = initialize(trader, id, false, false); err != nil {
+		trader.transit(StateFailed, err.Error())
+		return
+	}
+	if err = runJs(trader); err != nil {
+		trader.transit(StateFailed, err.Error())
+	}
+	return
 }
 
 // runJs ...
-func runJs(trader Global, id int64) (err error) {
-	err = initializeJs(&trader)
+func runJs(trader *Global) (err error) {
+	trader.watchdog = newWatchdog(trader)
+	for i, e := range trader.es {
+		trader.es[i] = &limitedExchange{exchange: e, w: trader.watchdog}
+	}
+	err = initializeJs(trader)
 	if err != nil {
 		return
 	}
+	// 先记录运行状态, 脚本很快结束时写入的 Stop 不会被覆盖
+	if err = model.SetTraderRunStatus(trader.ID, constant.Running); err != nil {
+		return
+	}
+	// 定时对账, 记录策略不查询的订单的成交
+	interval := time.Duration(util.Int64Must(config.String(omsReconcile), 10)) * time.Second
+	for _, oms := range trader.oms {
+		oms.StartReconcile(interval)
+	}
 	go func() {
+		failed := ""
 		defer func() {
+			for _, oms := range trader.oms {
+				oms.StopReconcile()
+			}
 			if err := recover(); err != nil && err != errHalt {
-				trader.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
+				failed = err2String(err)
+				trader.Log(constant.ERROR, "", 0.0, 0.0, failed)
 			}
 			if exit, err := trader.ctx.Get("exit"); err == nil && exit.IsFunction() {
 				if _, err := exit.Call(exit); err != nil {
 					trader.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
 				}
 			}
+			trader.watchdog.stop()
 			close(trader.ctx.Interrupt)
-			trader.Status = constant.Stop
-			trader.Pending = constant.Disable
+			if failed != "" {
+				trader.transit(StateFailed, failed)
+			} else {
+				trader.transit(StateStopped, "")
+			}
+			if err := model.SetTraderRunStatus(trader.ID, constant.Stop); err != nil {
+				trader.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
+			}
 		}()
 		trader.LastRunAt = time.Now()
-		trader.Status = constant.Running
+		if err := trader.transit(StateRunning, ""); err != nil {
+			// stopped before running
+			return
+		}
+		trader.watchdog.enter(trader.watchdog.main)
+		defer trader.watchdog.leave(trader.watchdog.main)
+		trader.watchdog.start()
 		if _, err := trader.ctx.Run(trader.Algorithm.Script); err != nil {
-			trader.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
+			failed = err2String(err)
+			trader.Log(constant.ERROR, "", 0.0, 0.0, failed)
+			return
 		}
 		if main, err := trader.ctx.Get("main"); err != nil || !main.IsFunction() {
-			trader.Log(constant.ERROR, "", 0.0, 0.0, "can not get the main function")
+			failed = "can not get the main function"
+			trader.Log(constant.ERROR, "", 0.0, 0.0, failed)
 		} else {
 			if _, err := main.Call(main); err != nil {
-				trader.Log(constant.ERROR, "", 0.0, 0.0, err2String(err))
+				failed = err2String(err)
+				trader.Log(constant.ERROR, "", 0.0, 0.0, failed)
 			}
 		}
 	}()
-	Executor[trader.ID] = &trader
 	return
 }
 
@@ -204,19 +297,25 @@ func runJs(trader Global, id int64) (err error) {
 
 // stop ...
 func stop(id int64) (err error) {
-	if t, ok := Executor[id]; !ok || t == nil {
+	t := executor.get(id)
+	if t == nil {
 		return fmt.Errorf("can not found the Trader")
 	}
-	if Executor[id].Pending == constant.Enable {
-		return fmt.Errorf("pending Trader")
+	if err = t.transit(StateStopping, ""); err != nil {
+		return
 	}
-	Executor[id].Pending = constant.Enable
-	return stopJs(id)
+	return stopJs(t)
 }
 
-// stop ...
-func stopJs(id int64) (err error) {
-	Executor[id].ctx.Interrupt <- func() { panic(errHalt) }
+// stopJs ...
+func stopJs(t *Global) (err error) {
+	if t.watchdog == nil {
+		// still initializing, the trader stops itself before running
+		return
+	}
+	if !t.watchdog.interrupt(func() { panic(errHalt) }, true) {
+		return fmt.Errorf("trader already stopped")
+	}
 	return
 }
 
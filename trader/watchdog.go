@@ -0,0 +1,468 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/config"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+	"snack.com/xiyanxiyan10/stocktrader/util"
+)
+
+// vm limit keys in config.ini
+const (
+	vmSlice       = "vmslice"       // cpu time slice of the vm in milliseconds
+	vmMaxBusy     = "vmmaxbusy"     // max seconds the vm runs script without calling any api
+	vmMaxMemory   = "vmmaxmemory"   // max heap of the server in MB
+	vmMaxCallRate = "vmmaxcallrate" // max exchange calls per second
+)
+
+var memoryWatchOnce sync.Once
+
+// watchdog limit the resource used by the js vms of a trader
+type watchdog struct {
+	sync.Mutex
+	trader  *Global
+	slice   time.Duration
+	maxBusy time.Duration
+	maxRate int64
+
+	main    *watchedVM          // vm running main
+	vms     map[*watchedVM]bool // vms running, the main one and those of ExecTasks
+	cpu     time.Duration       // cpu time used since started
+	second  int64               // the second calls counted in
+	calls   int64               // calls in the second
+	halted  bool
+	pending func() // forced interrupt sent to the vms entered later
+	stopped bool
+	done    chan struct{}
+}
+
+// watchedVM a js vm watched, locked to its os thread while running
+type watchedVM struct {
+	ctx  *otto.Otto
+	tid  int           // os thread running the vm
+	last time.Duration // cpu time of the thread at the last check
+	busy time.Duration // cpu time used since the last api call
+}
+
+// newWatchdog ...
+func newWatchdog(trader *Global) *watchdog {
+	w := &watchdog{
+		trader:  trader,
+		slice:   time.Duration(util.Int64Must(config.String(vmSlice), 100)) * time.Millisecond,
+		maxBusy: time.Duration(util.Int64Must(config.String(vmMaxBusy), 0)) * time.Second,
+		maxRate: util.Int64Must(config.String(vmMaxCallRate), 0),
+		main:    &watchedVM{ctx: trader.ctx},
+		vms:     make(map[*watchedVM]bool),
+		done:    make(chan struct{}),
+	}
+	// 启动前的停止请求也能送达 main
+	w.vms[w.main] = true
+	return w
+}
+
+// start the time slicing of the vms
+func (w *watchdog) start() {
+	memoryWatchOnce.Do(func() {
+		go memoryWatch()
+	})
+	if w.slice <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(w.slice)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				w.Lock()
+				for v := range w.vms {
+					v := v
+					w.send(v, func() { w.yield(v) }, false)
+				}
+				w.Unlock()
+			}
+		}
+	}()
+}
+
+// stop the watchdog, must be called before the interrupt channel closed
+func (w *watchdog) stop() {
+	w.Lock()
+	defer w.Unlock()
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	close(w.done)
+}
+
+// enter bind the vm to the calling goroutine, which is locked to its thread until leave
+func (w *watchdog) enter(v *watchedVM) {
+	runtime.LockOSThread()
+	w.Lock()
+	defer w.Unlock()
+	v.tid = threadID()
+	v.last = threadCPU()
+	v.busy = 0
+	w.vms[v] = true
+	if w.pending != nil {
+		w.send(v, w.pending, true)
+	}
+}
+
+// leave ...
+func (w *watchdog) leave(v *watchedVM) {
+	w.Lock()
+	delete(w.vms, v)
+	select {
+	case <-v.ctx.Interrupt:
+	default:
+	}
+	w.Unlock()
+	runtime.UnlockOSThread()
+}
+
+// send the fn into the vm, a forced one replaces the pending one, must be called with the lock held
+func (w *watchdog) send(v *watchedVM, fn func(), force bool) bool {
+	if !force {
+		select {
+		case v.ctx.Interrupt <- fn:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case <-v.ctx.Interrupt:
+	default:
+	}
+	v.ctx.Interrupt <- fn
+	return true
+}
+
+// interrupt send fn into all the vms, a forced interrupt replaces the pending one
+func (w *watchdog) interrupt(fn func(), force bool) bool {
+	w.Lock()
+	defer w.Unlock()
+	if w.stopped {
+		return false
+	}
+	if !force && w.halted {
+		return false
+	}
+	if force {
+		w.pending = fn
+	}
+	for v := range w.vms {
+		w.send(v, fn, force)
+	}
+	return true
+}
+
+// yield run inside the vm when a slice is used up
+func (w *watchdog) yield(v *watchedVM) {
+	w.Lock()
+	if !w.vms[v] {
+		w.Unlock()
+		return
+	}
+	now := threadCPU()
+	if now > v.last {
+		v.busy += now - v.last
+		w.cpu += now - v.last
+	}
+	v.last = now
+	busy := v.busy
+	w.Unlock()
+	if w.maxBusy > 0 && busy > w.maxBusy {
+		w.halt(fmt.Sprintf("cpu limit exceeded, script runs %s without calling any api", busy))
+	}
+	runtime.Gosched()
+}
+
+// touch mark the vm on the calling thread called into the api
+func (w *watchdog) touch() {
+	w.Lock()
+	w.reset()
+	w.Unlock()
+}
+
+// reset the busy time of the vm calling the api, of all the vms if the thread is unknown
+func (w *watchdog) reset() {
+	tid := threadID()
+	for v := range w.vms {
+		if tid == 0 || v.tid == tid {
+			v.busy = 0
+			v.last = threadCPU()
+		}
+	}
+}
+
+// call count a exchange call, fail when the call rate exceeded
+func (w *watchdog) call(method string) error {
+	w.Lock()
+	w.reset()
+	now := time.Now().Unix()
+	if now != w.second {
+		w.second = now
+		w.calls = 0
+	}
+	w.calls++
+	calls := w.calls
+	w.Unlock()
+	if w.maxRate > 0 && calls > w.maxRate {
+		msg := fmt.Sprintf("call rate limit exceeded, %s called %d times in one second", method, calls)
+		w.halt(msg)
+		return fmt.Errorf("%s() error, the error number is %s", method, msg)
+	}
+	return nil
+}
+
+// halt stop the trader as a limit is breached
+func (w *watchdog) halt(reason string) {
+	w.Lock()
+	if w.halted {
+		w.Unlock()
+		return
+	}
+	w.halted = true
+	w.Unlock()
+	w.trader.Log(constant.ERROR, "", 0.0, 0.0, "trader stopped, "+reason)
+	w.trader.transit(StateStopping, reason)
+	w.interrupt(func() { panic(errHalt) }, true)
+}
+
+// usage the busy time of the busiest vm and the cpu time of all
+func (w *watchdog) usage() (busy, cpu time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+	for v := range w.vms {
+		if v.busy > busy {
+			busy = v.busy
+		}
+	}
+	return busy, w.cpu
+}
+
+// memoryWatch stop the busiest trader when the heap of the server exceeds the limit.
+// go does not count the heap allocated by a goroutine, so the memory of a single vm is unknown,
+// the trader whose vm runs longest without calling any api is taken as the one leaking,
+// e.g. building a huge array in a loop, then the one using the most cpu. The heuristic
+// is written in the LIFECYCLE log of the stopped trader
+func memoryWatch() {
+	for {
+		time.Sleep(5 * time.Second)
+		limit := util.Int64Must(config.String(vmMaxMemory), 0)
+		if limit <= 0 {
+			continue
+		}
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		heap := int64(stats.HeapAlloc / 1024 / 1024)
+		if heap <= limit {
+			continue
+		}
+		var victim *Global
+		var victimBusy, victimCPU time.Duration
+		for _, t := range executor.list() {
+			if t.state() != StateRunning || t.watchdog == nil {
+				continue
+			}
+			busy, cpu := t.watchdog.usage()
+			if victim == nil || busy > victimBusy || busy == victimBusy && cpu > victimCPU {
+				victim, victimBusy, victimCPU = t, busy, cpu
+			}
+		}
+		if victim == nil {
+			log.Printf("memory limit exceeded %dMB > %dMB, no trader running\n", heap, limit)
+			continue
+		}
+		reason := fmt.Sprintf("memory limit exceeded, heap %dMB > %dMB, stopped as the busiest trader "+
+			"(busy %s, cpu %s) since the memory of a single vm is not measured", heap, limit, victimBusy, victimCPU)
+		log.Printf("trader %d %s\n", victim.ID, reason)
+		victim.watchdog.halt(reason)
+	}
+}
+
+// exchange is embedded by the wrappers with an unexported name,
+// otto can not look up fields through an embedded interface
+type exchange = api.Exchange
+
+// limitedExchange count the calls of the exchange for the watchdog
+type limitedExchange struct {
+	exchange
+	w *watchdog
+}
+
+// Sleep ...
+func (e *limitedExchange) Sleep(intervals int64) {
+	e.w.touch()
+	e.exchange.Sleep(intervals)
+}
+
+// AutoSleep ...
+func (e *limitedExchange) AutoSleep() {
+	e.w.touch()
+	e.exchange.AutoSleep()
+}
+
+// Buy ...
+func (e *limitedExchange) Buy(price, amount, msg string) (string, error) {
+	if err := e.w.call("Buy"); err != nil {
+		return "", err
+	}
+	return e.exchange.Buy(price, amount, msg)
+}
+
+// Sell ...
+func (e *limitedExchange) Sell(price, amount, msg string) (string, error) {
+	if err := e.w.call("Sell"); err != nil {
+		return "", err
+	}
+	return e.exchange.Sell(price, amount, msg)
+}
+
+// PlaceOrder ...
+func (e *limitedExchange) PlaceOrder(req constant.OrderRequest) (string, error) {
+	if err := e.w.call("PlaceOrder"); err != nil {
+		return "", err
+	}
+	return e.exchange.PlaceOrder(req)
+}
+
+// GetOrder ...
+func (e *limitedExchange) GetOrder(id string) (*constant.Order, error) {
+	if err := e.w.call("GetOrder"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetOrder(id)
+}
+
+// GetOrderByClientID ...
+func (e *limitedExchange) GetOrderByClientID(clientID string) (*constant.Order, error) {
+	if err := e.w.call("GetOrderByClientID"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetOrderByClientID(clientID)
+}
+
+// GetOrders ...
+func (e *limitedExchange) GetOrders() ([]constant.Order, error) {
+	if err := e.w.call("GetOrders"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetOrders()
+}
+
+// CancelOrder ...
+func (e *limitedExchange) CancelOrder(orderID string) (bool, error) {
+	if err := e.w.call("CancelOrder"); err != nil {
+		return false, err
+	}
+	return e.exchange.CancelOrder(orderID)
+}
+
+// GetTicker ...
+func (e *limitedExchange) GetTicker() (*constant.Ticker, error) {
+	if err := e.w.call("GetTicker"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetTicker()
+}
+
+// GetPosition ...
+func (e *limitedExchange) GetPosition() ([]constant.Position, error) {
+	if err := e.w.call("GetPosition"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetPosition()
+}
+
+// GetAccount ...
+func (e *limitedExchange) GetAccount() (*constant.Account, error) {
+	if err := e.w.call("GetAccount"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetAccount()
+}
+
+// GetDepth ...
+func (e *limitedExchange) GetDepth() (*constant.Depth, error) {
+	if err := e.w.call("GetDepth"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetDepth()
+}
+
+// GetRecords ...
+func (e *limitedExchange) GetRecords() ([]constant.Record, error) {
+	if err := e.w.call("GetRecords"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetRecords()
+}
+
+// GetTickerOf ...
+func (e *limitedExchange) GetTickerOf(symbol string) (*constant.Ticker, error) {
+	if err := e.w.call("GetTickerOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetTickerOf(symbol)
+}
+
+// GetDepthOf ...
+func (e *limitedExchange) GetDepthOf(symbol string) (*constant.Depth, error) {
+	if err := e.w.call("GetDepthOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetDepthOf(symbol)
+}
+
+// GetRecordsOf ...
+func (e *limitedExchange) GetRecordsOf(symbol string) ([]constant.Record, error) {
+	if err := e.w.call("GetRecordsOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetRecordsOf(symbol)
+}
+
+// GetOrderOf ...
+func (e *limitedExchange) GetOrderOf(symbol, id string) (*constant.Order, error) {
+	if err := e.w.call("GetOrderOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetOrderOf(symbol, id)
+}
+
+// GetOrdersOf ...
+func (e *limitedExchange) GetOrdersOf(symbol string) ([]constant.Order, error) {
+	if err := e.w.call("GetOrdersOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetOrdersOf(symbol)
+}
+
+// CancelOrderOf ...
+func (e *limitedExchange) CancelOrderOf(symbol, orderID string) (bool, error) {
+	if err := e.w.call("CancelOrderOf"); err != nil {
+		return false, err
+	}
+	return e.exchange.CancelOrderOf(symbol, orderID)
+}
+
+// GetPositionOf ...
+func (e *limitedExchange) GetPositionOf(symbol string) ([]constant.Position, error) {
+	if err := e.w.call("GetPositionOf"); err != nil {
+		return nil, err
+	}
+	return e.exchange.GetPositionOf(symbol)
+}
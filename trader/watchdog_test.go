@@ -0,0 +1,68 @@
+package trader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"snack.com/xiyanxiyan10/stocktrader/api"
+	"snack.com/xiyanxiyan10/stocktrader/constant"
+)
+
+// newWatchedTrader ...
+func newWatchedTrader(maxBusy time.Duration) *Global {
+	opt := constant.Option{BackTest: true, BackLog: true}
+	g := &Global{}
+	g.Global = *(api.NewGlobalStruct(opt))
+	g.tasks = make(Tasks)
+	g.ctx = otto.New()
+	g.ctx.Interrupt = make(chan func(), 1)
+	g.watchdog = newWatchdog(g)
+	g.watchdog.slice = 10 * time.Millisecond
+	g.watchdog.maxBusy = maxBusy
+	g.es = []api.Exchange{&limitedExchange{exchange: api.NewMockExchange(opt), w: g.watchdog}}
+	g.ctx.Set("G", g)
+	g.ctx.Set("E", g.es[0])
+	return g
+}
+
+func TestWatchdogExchangeCalls(t *testing.T) {
+	g := newWatchedTrader(0)
+	value, err := g.ctx.Run("E.GetTicker()[0].Last")
+	if err != nil {
+		t.Fatalf("E.GetTicker: %v", err)
+	}
+	if last, _ := value.ToFloat(); last != 100 {
+		t.Fatalf("unexpected last %v", value)
+	}
+}
+
+func TestWatchdogTasks(t *testing.T) {
+	g := newWatchedTrader(200 * time.Millisecond)
+	g.watchdog.start()
+	defer g.watchdog.stop()
+	if _, err := g.ctx.Run("function spin() { while (true) {} }"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	group, _ := g.ctx.ToValue("group")
+	fn, _ := g.ctx.ToValue("spin")
+	if !g.AddTask(group, fn) {
+		t.Fatalf("add task fail")
+	}
+
+	done := make(chan []interface{})
+	go func() {
+		done <- g.ExecTasks(group)
+	}()
+	select {
+	case results := <-done:
+		if len(results) != 1 || results[0] != false {
+			t.Fatalf("unexpected results %v", results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the task running away should be halted")
+	}
+	if busy, cpu := g.watchdog.usage(); busy != 0 || cpu < 200*time.Millisecond {
+		t.Fatalf("unexpected usage %s %s", busy, cpu)
+	}
+}
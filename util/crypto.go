@@ -21,7 +21,9 @@ func initCryptoCipher() (cipher.Block, error) {
 	return c, nil
 }
 
-//EnCrypto 加密
+// EnCrypto 加密
+//
+// Deprecated: the key and the iv are hard coded, use Vault for the secrets
 func EnCrypto(plainText string) ([]byte, error) {
 	block, err := initCryptoCipher()
 	if err != nil {
@@ -37,7 +39,9 @@ func EnCrypto(plainText string) ([]byte, error) {
 	return cipherText, nil
 }
 
-//DeCrypto 解密
+// DeCrypto 解密
+//
+// Deprecated: the key and the iv are hard coded, use Vault for the secrets
 func DeCrypto(cipherText string) ([]byte, error) {
 	block, err := initCryptoCipher()
 	if err != nil {
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"strings"
+)
+
+// diff operations
+const (
+	DiffEqual  = " "
+	DiffInsert = "+"
+	DiffDelete = "-"
+)
+
+// DiffLine a line of the diff result
+type DiffLine struct {
+	Op      string `json:"op"`
+	OldLine int    `json:"oldLine"` // 旧文本中的行号, 新增行为 0
+	NewLine int    `json:"newLine"` // 新文本中的行号, 删除行为 0
+	Text    string `json:"text"`
+}
+
+// DiffLines compare two texts line by line with the longest common subsequence
+func DiffLines(a, b string) (lines []DiffLine) {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+	n, m := len(as), len(bs)
+	// lcs[i][j] is the lcs length of as[i:] and bs[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && as[i] == bs[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, OldLine: i + 1, NewLine: j + 1, Text: as[i]})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, DiffLine{Op: DiffInsert, NewLine: j + 1, Text: bs[j]})
+			j++
+		default:
+			lines = append(lines, DiffLine{Op: DiffDelete, OldLine: i + 1, Text: as[i]})
+			i++
+		}
+	}
+	return
+}
+
+// DiffString format the diff result as text
+func DiffString(lines []DiffLine) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.Op)
+		b.WriteString(l.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := "function main() {\n    var a = 1;\n    Log(a);\n}"
+	b := "function main() {\n    var a = 2;\n    Log(a);\n    Sleep(1000);\n}"
+	want := " function main() {\n-    var a = 1;\n+    var a = 2;\n     Log(a);\n+    Sleep(1000);\n }\n"
+	lines := DiffLines(a, b)
+	if got := DiffString(lines); got != want {
+		t.Fatalf("diff:\n%s\nwant:\n%s", got, want)
+	}
+	last := lines[len(lines)-1]
+	if last.OldLine != 4 || last.NewLine != 5 {
+		t.Fatalf("line numbers of the last line: %d %d", last.OldLine, last.NewLine)
+	}
+	for _, l := range DiffLines(a, a) {
+		if l.Op != DiffEqual {
+			t.Fatalf("same text should not differ: %v", l)
+		}
+	}
+}
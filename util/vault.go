@@ -0,0 +1,128 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// vaultPrefix the prefix of the sealed secrets, followed by the key id and the cipher text
+const vaultPrefix = "vault:v1:"
+
+// Vault seal the secrets with AES-256-GCM, the first key seals and all the keys open,
+// so an old key is kept in the list until the secrets are sealed again with the new key
+type Vault struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// vaultKeyID the id of the key, the first 8 hex of its sha256
+func vaultKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// NewVault create a vault of the 32 bytes keys, the first is the current key
+func NewVault(keys ...[]byte) (*Vault, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("vault error, no master key")
+	}
+	v := &Vault{keys: make(map[string]cipher.AEAD)}
+	for i, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("vault error, the master key %d is %d bytes, want 32", i, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := vaultKeyID(key)
+		if i == 0 {
+			v.current = id
+		}
+		v.keys[id] = aead
+	}
+	return v, nil
+}
+
+// ParseVault create a vault of the base64 keys separated by commas or lines, the first is the current key
+func ParseVault(str string) (*Vault, error) {
+	keys := [][]byte{}
+	for _, item := range strings.FieldsFunc(str, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(item)
+		if err != nil {
+			return nil, fmt.Errorf("vault error, the master key is not base64: %s", err.Error())
+		}
+		keys = append(keys, key)
+	}
+	return NewVault(keys...)
+}
+
+// Current the id of the key sealing the secrets
+func (v *Vault) Current() string {
+	return v.current
+}
+
+// Sealed whether the string is a secret sealed by a vault
+func Sealed(str string) bool {
+	return strings.HasPrefix(str, vaultPrefix)
+}
+
+// SealedBy the id of the key sealing the secret
+func SealedBy(sealed string) string {
+	if !Sealed(sealed) {
+		return ""
+	}
+	vec := strings.SplitN(strings.TrimPrefix(sealed, vaultPrefix), ":", 2)
+	return vec[0]
+}
+
+// Seal encrypt the secret with the current key, vault:v1:<key id>:<base64 of nonce and cipher text>
+func (v *Vault) Seal(plain string) (string, error) {
+	aead := v.keys[v.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	// 密钥 id 作为附加数据, 防止密文被换到其他密钥下
+	data := aead.Seal(nonce, nonce, []byte(plain), []byte(v.current))
+	return vaultPrefix + v.current + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Open decrypt the sealed secret with the key it is sealed by
+func (v *Vault) Open(sealed string) (string, error) {
+	if !Sealed(sealed) {
+		return "", fmt.Errorf("vault error, the secret is not sealed")
+	}
+	vec := strings.SplitN(strings.TrimPrefix(sealed, vaultPrefix), ":", 2)
+	if len(vec) != 2 {
+		return "", fmt.Errorf("vault error, the secret is malformed")
+	}
+	aead, ok := v.keys[vec[0]]
+	if !ok {
+		return "", fmt.Errorf("vault error, the master key %s of the secret not found", vec[0])
+	}
+	data, err := base64.StdEncoding.DecodeString(vec[1])
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("vault error, the secret is malformed")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(vec[0]))
+	if err != nil {
+		return "", fmt.Errorf("vault error, the secret can not be opened: %s", err.Error())
+	}
+	return string(plain), nil
+}
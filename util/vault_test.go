@@ -0,0 +1,58 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	old, err := ParseVault(oldKey)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	sealed, err := old.Seal("my-secret")
+	if err != nil || !Sealed(sealed) || strings.Contains(sealed, "my-secret") || SealedBy(sealed) != old.Current() {
+		t.Fatalf("unexpected sealed secret %s %v", sealed, err)
+	}
+	if again, _ := old.Seal("my-secret"); again == sealed {
+		t.Fatalf("the nonce should differ between seals")
+	}
+	if plain, err := old.Open(sealed); err != nil || plain != "my-secret" {
+		t.Fatalf("unexpected open %s %v", plain, err)
+	}
+
+	// 轮换后新密钥加密, 旧密钥仍可解密之前的密文
+	rotated, err := ParseVault(newKey + "\n# the old key\n" + oldKey)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if rotated.Current() == old.Current() {
+		t.Fatalf("the first key should be the current key")
+	}
+	if plain, err := rotated.Open(sealed); err != nil || plain != "my-secret" {
+		t.Fatalf("the old secret should be opened after the rotation, %s %v", plain, err)
+	}
+	resealed, _ := rotated.Seal("my-secret")
+	if SealedBy(resealed) != rotated.Current() {
+		t.Fatalf("unexpected key of %s", resealed)
+	}
+	if _, err := old.Open(resealed); err == nil {
+		t.Fatalf("the old vault should not open the secret of the new key")
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-3] ^= 1
+	if _, err := old.Open(string(tampered)); err == nil {
+		t.Fatalf("the tampered secret should not be opened")
+	}
+	if _, err := ParseVault(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatalf("the key of 5 bytes should fail")
+	}
+	if _, err := ParseVault(""); err == nil {
+		t.Fatalf("no key should fail")
+	}
+}